@@ -4,10 +4,22 @@ import (
 	"chat-app-backend/internal/api"
 	"chat-app-backend/internal/api/router"
 	"chat-app-backend/internal/database"
+	"chat-app-backend/internal/env"
+	"chat-app-backend/internal/model"
 	"chat-app-backend/internal/queue"
+	"chat-app-backend/internal/search"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/storage"
+	"chat-app-backend/internal/websocket"
+	"context"
 	"log"
+	"time"
 )
 
+// searchFollowRetryDelay is how long to wait before resubscribing after the
+// search event stream drops.
+const searchFollowRetryDelay = 5 * time.Second
+
 func main() {
 	queue := queue.NewRequestQueueManager(10, 10)
 	db, err := database.NewDatabase()
@@ -15,6 +27,17 @@ func main() {
 	if err != nil {
 		log.Fatalf("db init failed: %v", err)
 	}
+	broker, err := websocket.NewBrokerFromEnv()
+	if err != nil {
+		log.Fatalf("broker init failed: %v", err)
+	}
+	blobs, err := storage.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("blob store init failed: %v", err)
+	}
+
+	searchIndex := search.NewIndex()
+	go maintainSearchIndex(db, searchIndex, broker)
 
 	server := api.NewAPIServer(
 		":81",
@@ -25,8 +48,109 @@ func main() {
 		router.AuthRoutes("/api/client/v1"),
 		router.TenantRoutes("/api/client/v1"),
 		router.WidgetRoutes("/api/client/v1"),
-		router.ConversationTenantRoutes("/api/client/v1"),
+		router.ConversationTenantRoutes("/api/client/v1", searchIndex),
 	)
+	server.SetBroker(broker)
+	server.SetBlobStore(blobs)
+
+	shutdown, err := api.ShutdownConfigFromEnv()
+	if err != nil {
+		log.Fatalf("shutdown config init failed: %v", err)
+	}
+	server.SetShutdownConfig(shutdown)
 
 	server.Run()
 }
+
+// maintainSearchIndex seeds the index from the snapshot written by
+// cmd/search-rebuild when one is configured and catches up on the messages
+// stored since. Without a snapshot it rebuilds the index from the messages
+// table. From then on followSearchEvents keeps it current, and an optional
+// interval rebuild repairs anything missed while the event stream was down.
+func maintainSearchIndex(db *database.Database, index *search.Index, broker websocket.Broker) {
+	service := conversationservice.New(db)
+	service.SetSearchIndex(index)
+	go followSearchEvents(service, broker)
+
+	loaded := false
+	if path := env.Get(env.SearchSnapshotPath); path != "" {
+		if err := index.LoadFile(path); err != nil {
+			log.Printf("search snapshot load failed: %v", err)
+		} else {
+			loaded = true
+			log.Printf("search snapshot loaded: %d messages", index.Len())
+		}
+	}
+
+	if loaded {
+		count, err := service.CatchUpSearchIndex(context.Background(), index.Latest())
+		if err != nil {
+			log.Printf("search index catch-up failed: %v", err)
+		} else {
+			log.Printf("search index caught up: %d messages", count)
+		}
+	} else {
+		rebuildSearchIndex(service)
+	}
+
+	var interval time.Duration
+	if raw := env.Get(env.SearchRebuildInterval); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Printf("invalid %s %q: %v", env.SearchRebuildInterval, raw, err)
+		} else {
+			interval = parsed
+		}
+	}
+	if interval <= 0 {
+		return
+	}
+	for {
+		time.Sleep(interval)
+		rebuildSearchIndex(service)
+	}
+}
+
+func rebuildSearchIndex(service *conversationservice.Service) {
+	count, err := service.RebuildSearchIndex(context.Background())
+	if err != nil {
+		log.Printf("search index rebuild failed: %v", err)
+		return
+	}
+	log.Printf("search index rebuilt: %d messages", count)
+}
+
+// followSearchEvents indexes the messages announced on the tenant notification
+// rooms, and drops the deleted ones. Visitor messages are stored by the public
+// server and agent messages by any client-server replica, so this is how every
+// replica sees them.
+func followSearchEvents(service *conversationservice.Service, broker websocket.Broker) {
+	for {
+		err := websocket.FollowTenantEvents(context.Background(), broker, func(tenantID string, event websocket.Event) {
+			switch event.Type {
+			case websocket.EventMessageCreated, websocket.EventConversationCreated,
+				websocket.EventMessageUpdated, websocket.EventMessageDeleted:
+			default:
+				return
+			}
+			var payload websocket.MessageEvent
+			if err := event.DecodePayload(&payload); err != nil {
+				log.Printf("search event %s: decode payload: %v", event.ID, err)
+				return
+			}
+			service.IndexMessage(model.MessageItem{
+				TenantID:       tenantID,
+				ConversationID: payload.Message.ConversationID,
+				MessageID:      payload.Message.MessageID,
+				SenderType:     payload.Message.SenderType,
+				SenderID:       payload.Message.SenderID,
+				Body:           payload.Message.Body,
+				CreatedAt:      payload.Message.CreatedAt,
+				EditedAt:       payload.Message.EditedAt,
+				DeletedAt:      payload.Message.DeletedAt,
+			})
+		})
+		log.Printf("search event stream stopped: %v", err)
+		time.Sleep(searchFollowRetryDelay)
+	}
+}
@@ -0,0 +1,34 @@
+// Command conversation-backfill writes the attributes that conversations
+// created by older releases are missing, so the filter indexes see them and
+// their read receipts and unread counts work.
+package main
+
+import (
+	"chat-app-backend/internal/database"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"context"
+	"log"
+)
+
+func main() {
+	db, err := database.NewDatabase()
+	if err != nil {
+		log.Fatalf("db init failed: %v", err)
+	}
+
+	service := conversationservice.New(db)
+
+	updated, err := service.BackfillIndexKeys(context.Background())
+	if err != nil {
+		log.Fatalf("index key backfill failed after %d conversations: %v", updated, err)
+	}
+
+	log.Printf("backfilled index keys of %d conversations", updated)
+
+	initialized, err := service.BackfillReadCounters(context.Background())
+	if err != nil {
+		log.Fatalf("read counter backfill failed after %d conversations: %v", initialized, err)
+	}
+
+	log.Printf("backfilled read counters of %d conversations", initialized)
+}
@@ -5,6 +5,8 @@ import (
 	"chat-app-backend/internal/api/router"
 	"chat-app-backend/internal/database"
 	"chat-app-backend/internal/queue"
+	"chat-app-backend/internal/storage"
+	"chat-app-backend/internal/websocket"
 	"log"
 )
 
@@ -14,6 +16,14 @@ func main() {
 	if err != nil {
 		log.Fatalf("db init failed: %v", err)
 	}
+	broker, err := websocket.NewBrokerFromEnv()
+	if err != nil {
+		log.Fatalf("broker init failed: %v", err)
+	}
+	blobs, err := storage.NewBlobStoreFromEnv()
+	if err != nil {
+		log.Fatalf("blob store init failed: %v", err)
+	}
 
 	server := api.NewAPIServer(
 		":82",
@@ -24,6 +34,14 @@ func main() {
 		router.ConversationPublicRoutes("/api/public/v1"),
 		router.WidgetPublicRoutes("/api/public/v1"),
 	)
+	server.SetBroker(broker)
+	server.SetBlobStore(blobs)
+
+	shutdown, err := api.ShutdownConfigFromEnv()
+	if err != nil {
+		log.Fatalf("shutdown config init failed: %v", err)
+	}
+	server.SetShutdownConfig(shutdown)
 
 	server.Run()
 }
@@ -0,0 +1,42 @@
+// Command search-rebuild walks the messages table and writes a search index
+// snapshot that the client server loads on startup.
+package main
+
+import (
+	"chat-app-backend/internal/database"
+	"chat-app-backend/internal/env"
+	"chat-app-backend/internal/search"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"context"
+	"flag"
+	"log"
+)
+
+func main() {
+	out := flag.String("out", env.Get(env.SearchSnapshotPath), "snapshot file to write")
+	flag.Parse()
+
+	if *out == "" {
+		log.Fatalf("no snapshot path: pass -out or set %s", env.SearchSnapshotPath)
+	}
+
+	db, err := database.NewDatabase()
+	if err != nil {
+		log.Fatalf("db init failed: %v", err)
+	}
+
+	index := search.NewIndex()
+	service := conversationservice.New(db)
+	service.SetSearchIndex(index)
+
+	count, err := service.RebuildSearchIndex(context.Background())
+	if err != nil {
+		log.Fatalf("search index rebuild failed: %v", err)
+	}
+
+	if err := index.SaveFile(*out); err != nil {
+		log.Fatalf("snapshot write failed: %v", err)
+	}
+
+	log.Printf("indexed %d messages into %s", count, *out)
+}
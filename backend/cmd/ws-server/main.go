@@ -16,9 +16,22 @@ func main() {
 		log.Fatalf("db init failed: %v", err)
 	}
 
+	broker, err := websocket.NewBrokerFromEnv()
+	if err != nil {
+		log.Fatalf("broker init failed: %v", err)
+	}
+
+	policies, err := websocket.ConsumerPoliciesFromEnv()
+	if err != nil {
+		log.Fatalf("websocket policy init failed: %v", err)
+	}
+
 	hub := websocket.NewHub()
+	if err := hub.SetConsumerPolicies(policies); err != nil {
+		log.Fatalf("websocket policy init failed: %v", err)
+	}
+	handler := websocket.NewHandler(hub, broker)
 	go hub.Run()
-	handler := websocket.NewHandler(hub)
 
 	server := api.NewAPIServer(
 		":83",
@@ -28,8 +41,17 @@ func main() {
 		router.UtilsRoutes("/api/ws/v1"),
 		router.ConversationWebsocketRoutes("/api/ws/v1"),
 	)
+	server.SetBroker(broker)
+
+	shutdown, err := api.ShutdownConfigFromEnv()
+	if err != nil {
+		log.Fatalf("shutdown config init failed: %v", err)
+	}
+	server.SetShutdownConfig(shutdown)
 
-	handler.SubscribeToRedisChannels()
+	go handler.RelayRoomEvents()
+	go handler.MaintainPresence()
+	go handler.MaintainTyping()
 
 	server.Run()
 }
@@ -3,9 +3,14 @@ package api
 import (
 	"chat-app-backend/internal/database"
 	"chat-app-backend/internal/queue"
+	"chat-app-backend/internal/storage"
 	"chat-app-backend/internal/websocket"
+	"context"
 	"fmt"
 	"net/http"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -18,21 +23,37 @@ type APIServer struct {
 	db                  *database.Database
 	routeRegistrars     []RouteRegistrar
 	handler             *websocket.Handler
+	broker              websocket.Broker
+	blobs               storage.BlobStore
 	metrics             *metrics
+	shutdown            ShutdownConfig
+	httpServer          *http.Server
+	draining            atomic.Bool
 }
 
 func NewAPIServer(listenAddr string, rqm *queue.RequestQueueManager, db *database.Database, handler *websocket.Handler, registrars ...RouteRegistrar) *APIServer {
+	return newAPIServer(listenAddr, rqm, db, handler, prometheus.DefaultRegisterer, prometheus.DefaultGatherer, registrars)
+}
+
+// NewAPIServerWithRegistry is NewAPIServer with its metrics kept in reg rather
+// than the process-wide default registry, so tests can build many servers.
+func NewAPIServerWithRegistry(listenAddr string, rqm *queue.RequestQueueManager, db *database.Database, handler *websocket.Handler, reg *prometheus.Registry, registrars ...RouteRegistrar) *APIServer {
+	return newAPIServer(listenAddr, rqm, db, handler, reg, reg, registrars)
+}
 
+func newAPIServer(listenAddr string, rqm *queue.RequestQueueManager, db *database.Database, handler *websocket.Handler, reg prometheus.Registerer, gatherer prometheus.Gatherer, registrars []RouteRegistrar) *APIServer {
 	return &APIServer{
 		listenAddr:          listenAddr,
 		requestQueueManager: rqm,
 		db:                  db,
 		handler:             handler,
 		routeRegistrars:     registrars,
-		metrics:             newMetrics(prometheus.DefaultRegisterer, listenAddr, rqm),
+		metrics:             newMetrics(reg, gatherer, listenAddr, rqm),
+		shutdown:            DefaultShutdownConfig(),
 	}
 }
 
+// Run serves until SIGINT or SIGTERM and then drains through Shutdown.
 func (s *APIServer) Run() {
 	mux := http.NewServeMux()
 
@@ -44,9 +65,15 @@ func (s *APIServer) Run() {
 
 	fmt.Printf("Server listening on http://localhost%s\n", s.listenAddr)
 
-	if err := http.ListenAndServe(s.listenAddr, s.metrics.instrument(mux)); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	srv := &http.Server{Addr: s.listenAddr, Handler: s.metrics.instrument(mux)}
+	if err := s.serve(ctx, srv); err != nil {
 		fmt.Printf("server stopped: %v\n", err)
+		return
 	}
+	fmt.Printf("server stopped\n")
 }
 
 func (s *APIServer) Database() *database.Database {
@@ -56,3 +83,23 @@ func (s *APIServer) Database() *database.Database {
 func (s *APIServer) Handler() *websocket.Handler {
 	return s.handler
 }
+
+// SetBroker sets the broker realtime events are published through. It must be
+// called before Run.
+func (s *APIServer) SetBroker(broker websocket.Broker) {
+	s.broker = broker
+}
+
+func (s *APIServer) Broker() websocket.Broker {
+	return s.broker
+}
+
+// SetBlobStore sets the store message attachments are kept in. It must be
+// called before Run.
+func (s *APIServer) SetBlobStore(store storage.BlobStore) {
+	s.blobs = store
+}
+
+func (s *APIServer) BlobStore() storage.BlobStore {
+	return s.blobs
+}
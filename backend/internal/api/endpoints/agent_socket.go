@@ -0,0 +1,36 @@
+package endpoints
+
+import (
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"context"
+	"net/http"
+)
+
+// AgentWebsocket opens the socket an agent follows its inbox over: the
+// notification room of the agent, plus every conversation it subscribes to.
+// It is authenticated like the notification socket.
+func (h *conversationEndpoints) AgentWebsocket(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.notificationParticipant(r, h.paths.AgentWebsocketPath)
+	if err != nil {
+		return err
+	}
+	h.handler.JoinAgent(w, r, participant.roomID, participant.userID, participant.tenantID)
+	return nil
+}
+
+// NewConversationAuthorizer returns the websocket.ConversationAuthorizer that
+// lets agents subscribe to the conversations of their tenant.
+func NewConversationAuthorizer(service *conversationservice.Service) websocket.ConversationAuthorizer {
+	return &conversationEndpoints{service: service}
+}
+
+// AuthorizeConversation checks the conversation exists in the tenant of the
+// agent, the same way reading it over REST does.
+func (h *conversationEndpoints) AuthorizeConversation(ctx context.Context, tenantID, userID, conversationID string) error {
+	identity := conversationservice.Identity{UserID: userID, TenantID: tenantID}
+	if _, err := h.service.GetConversation(ctx, identity, conversationID); err != nil {
+		return conversationCommandError(err)
+	}
+	return nil
+}
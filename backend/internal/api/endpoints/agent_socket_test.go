@@ -0,0 +1,125 @@
+package endpoints
+
+import (
+	internaljwt "chat-app-backend/internal/jwt"
+	"chat-app-backend/internal/model"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+func dialAgentSocket(t *testing.T, server *httptest.Server, token string) *gorillaws.Conn {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws/agent?token=" + token
+	conn, _, err := gorillaws.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial agent socket: %v", err)
+	}
+	return conn
+}
+
+func writeSubscriptionFrame(t *testing.T, conn *gorillaws.Conn, frame map[string]interface{}) {
+	t.Helper()
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatalf("write %v: %v", frame["type"], err)
+	}
+}
+
+// readConversationEvent reads frames from conn until an event of eventType
+// tagged with conversationID arrives, skipping the notification room's.
+func readConversationEvent(t *testing.T, conn *gorillaws.Conn, conversationID, eventType string) socketFrame {
+	t.Helper()
+	for {
+		frame := readSocketFrame(t, conn, eventType)
+		if frame.ConversationID == conversationID {
+			return frame
+		}
+	}
+}
+
+func TestAgentSocketMultiplexesSubscribedConversations(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	for _, tenantID := range []string{"tenant-1", "tenant-2"} {
+		repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+		repo.keys["key-"+tenantID] = tenantID
+	}
+	repo.users[model.TenantScopedPK("tenant-1", "agent-1")] = model.UserItem{
+		PK:       model.TenantScopedPK("tenant-1", "agent-1"),
+		TenantID: "tenant-1",
+		UserID:   "agent-1",
+	}
+
+	create := func(apiKey string) conversationservice.ConversationResult {
+		result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+			TenantAPIKey: apiKey,
+			Message:      "Hello",
+			Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+		})
+		if err != nil {
+			t.Fatalf("CreateConversation error: %v", err)
+		}
+		return result
+	}
+	own := create("key-tenant-1")
+	foreign := create("key-tenant-2")
+	conversationID := own.Conversation.ConversationID
+
+	token, err := internaljwt.CreateToken(
+		internaljwt.User{Id: "agent-1", TenantID: "tenant-1", Email: "agent@example.com"},
+		internaljwt.RoleUser,
+		time.Now().Add(time.Hour).Unix(),
+	)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	agent := dialAgentSocket(t, server, token)
+	defer agent.Close()
+
+	writeSubscriptionFrame(t, agent, map[string]interface{}{"type": websocket.FrameSubscribe, "conversationId": foreign.Conversation.ConversationID})
+	if refused := readSocketFrame(t, agent, websocket.FrameSubscriptionError); refused.ConversationID != foreign.Conversation.ConversationID || refused.Error.Code == "" {
+		t.Fatalf("expected another tenant's conversation to be refused, got %+v", refused)
+	}
+
+	writeSubscriptionFrame(t, agent, map[string]interface{}{"type": websocket.FrameSubscribe, "conversationId": conversationID})
+	if subscribed := readSocketFrame(t, agent, websocket.FrameSubscribed); subscribed.ConversationID != conversationID {
+		t.Fatalf("unexpected subscribe reply %+v", subscribed)
+	}
+
+	postVisitorMessage(t, server, conversationID, own.VisitorToken, "First")
+	if created := readConversationEvent(t, agent, conversationID, websocket.EventMessageCreated); created.Seq != 1 {
+		t.Fatalf("expected the event tagged with its conversation, got %+v", created)
+	}
+
+	writeSubscriptionFrame(t, agent, map[string]interface{}{"type": websocket.FrameUnsubscribe, "conversationId": conversationID})
+	readSocketFrame(t, agent, websocket.FrameUnsubscribed)
+	postVisitorMessage(t, server, conversationID, own.VisitorToken, "Second")
+
+	// Resubscribing from the last sequence seen replays what was missed, and
+	// nothing of the conversation arrived while unsubscribed.
+	writeSubscriptionFrame(t, agent, map[string]interface{}{"type": websocket.FrameSubscribe, "conversationId": conversationID, "lastSeq": 1})
+	agent.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var frame socketFrame
+		if err := agent.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for the resubscription: %v", err)
+		}
+		if frame.Type == websocket.EventMessageCreated && frame.ConversationID == conversationID {
+			t.Fatalf("expected no events while unsubscribed, got %+v", frame)
+		}
+		if frame.Type == websocket.FrameSubscribed {
+			break
+		}
+	}
+	if replayed := readConversationEvent(t, agent, conversationID, websocket.EventMessageCreated); replayed.Seq != 2 {
+		t.Fatalf("expected the missed message to be replayed, got %+v", replayed)
+	}
+}
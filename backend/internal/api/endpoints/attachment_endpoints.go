@@ -0,0 +1,172 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/api"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	tenantservice "chat-app-backend/internal/service/tenant"
+	"chat-app-backend/internal/storage"
+	"chat-app-backend/internal/websocket"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strings"
+)
+
+// multipartOverhead covers the boundaries, headers and text fields sent
+// alongside an uploaded file.
+const multipartOverhead = 1 << 20
+
+// multipartMemory is how much of an upload is buffered in memory before it
+// spills to a temporary file.
+const multipartMemory = 1 << 20
+
+// handlePostVisitorAttachment accepts a multipart form with the file in
+// "file", an optional message in "body" and the visitor token in
+// "visitorToken" or the X-Visitor-Token header.
+func (h *conversationEndpoints) handlePostVisitorAttachment(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractPublicConversationAction(r.URL.Path, "attachments")
+	if err != nil {
+		return err
+	}
+
+	upload, form, err := readAttachmentForm(w, r)
+	if err != nil {
+		return err
+	}
+	defer form.RemoveAll()
+
+	token := strings.TrimSpace(r.FormValue("visitorToken"))
+	if token == "" {
+		token = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
+	}
+
+	result, err := h.service.PostVisitorAttachment(r.Context(), token, conversationID, r.FormValue("body"), upload)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusCreated, toMessageResponse(result.Message))
+}
+
+// handlePostAgentAttachment accepts a multipart form with the file in "file"
+// and an optional message in "body".
+func (h *conversationEndpoints) handlePostAgentAttachment(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "attachments")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	upload, form, err := readAttachmentForm(w, r)
+	if err != nil {
+		return err
+	}
+	defer form.RemoveAll()
+
+	result, err := h.service.PostAgentAttachment(r.Context(), identity, conversationID, r.FormValue("body"), upload)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusCreated, toMessageResponse(result.Message))
+}
+
+// readAttachmentForm parses the multipart upload of r. The caller removes the
+// returned form's temporary files once the upload is stored.
+func readAttachmentForm(w http.ResponseWriter, r *http.Request) (conversationservice.AttachmentUpload, *multipart.Form, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, tenantservice.MaxAttachmentBytes+multipartOverhead)
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return conversationservice.AttachmentUpload{}, nil, &HTTPError{
+				StatusCode: http.StatusRequestEntityTooLarge,
+				Message:    "Attachment is too large",
+				ErrorLog:   fmt.Errorf("parse attachment form: %w", err),
+			}
+		}
+		return conversationservice.AttachmentUpload{}, nil, &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid multipart form",
+			ErrorLog:   fmt.Errorf("parse attachment form: %w", err),
+		}
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		r.MultipartForm.RemoveAll()
+		return conversationservice.AttachmentUpload{}, nil, &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "file is required",
+			ErrorLog:   fmt.Errorf("read attachment file: %w", err),
+		}
+	}
+
+	return conversationservice.AttachmentUpload{
+		FileName:    header.Filename,
+		ContentType: header.Header.Get("Content-Type"),
+		Size:        header.Size,
+		Body:        file,
+	}, r.MultipartForm, nil
+}
+
+type AttachmentEndpoints interface {
+	Download(http.ResponseWriter, *http.Request) error
+}
+
+type attachmentEndpoints struct {
+	store  *storage.LocalStore
+	prefix string
+}
+
+// NewAttachmentEndpoints serves the blobs of store under prefix through the
+// signed URLs the store hands out.
+func NewAttachmentEndpoints(store *storage.LocalStore, prefix string) AttachmentEndpoints {
+	return &attachmentEndpoints{
+		store:  store,
+		prefix: strings.TrimRight(prefix, "/") + "/",
+	}
+}
+
+func (h *attachmentEndpoints) Download(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet:  h.handleDownload,
+		http.MethodHead: h.handleDownload,
+	})
+}
+
+func (h *attachmentEndpoints) handleDownload(w http.ResponseWriter, r *http.Request) error {
+	key := strings.TrimPrefix(r.URL.Path, h.prefix)
+	download, err := h.store.Open(key, r.URL.Query())
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInvalidSignature), errors.Is(err, storage.ErrExpired):
+			return &HTTPError{StatusCode: http.StatusForbidden, Message: "Download link is invalid or expired", ErrorLog: fmt.Errorf("open attachment %q: %w", key, err)}
+		case errors.Is(err, storage.ErrNotFound), errors.Is(err, storage.ErrInvalidKey):
+			return &HTTPError{StatusCode: http.StatusNotFound, Message: "Attachment not found", ErrorLog: fmt.Errorf("open attachment %q: %w", key, err)}
+		}
+		return &HTTPError{StatusCode: http.StatusInternalServerError, Message: "Internal server error", ErrorLog: fmt.Errorf("open attachment %q: %w", key, err)}
+	}
+	defer download.Content.Close()
+
+	contentType := download.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if disposition := download.ContentDisposition(); disposition != "" {
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	w.Header().Set("Cache-Control", "private, max-age=3600")
+	http.ServeContent(w, r, "", download.ModTime, download.Content)
+	return nil
+}
@@ -0,0 +1,74 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/dto"
+	tenantservice "chat-app-backend/internal/service/tenant"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type AttachmentSettingsEndpoints interface {
+	TenantAttachmentSettings(http.ResponseWriter, *http.Request) error
+}
+
+type attachmentSettingsEndpoints struct {
+	service *tenantservice.Service
+}
+
+func NewAttachmentSettingsEndpoints(service *tenantservice.Service) AttachmentSettingsEndpoints {
+	return &attachmentSettingsEndpoints{
+		service: service,
+	}
+}
+
+func (h *attachmentSettingsEndpoints) TenantAttachmentSettings(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet:   h.handleGetTenantAttachmentSettings,
+		http.MethodPatch: h.handleUpdateTenantAttachmentSettings,
+	})
+}
+
+func (h *attachmentSettingsEndpoints) handleGetTenantAttachmentSettings(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	settings, err := h.service.GetAttachmentSettings(r.Context(), identity, identity.TenantID)
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusOK, dto.AttachmentSettingsResultResponse{
+		Attachments: attachmentSettingsResult(settings),
+	})
+}
+
+func (h *attachmentSettingsEndpoints) handleUpdateTenantAttachmentSettings(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	var req dto.UpdateAttachmentSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode attachment settings request: %w", err),
+		}
+	}
+
+	settings, err := h.service.UpdateAttachmentSettings(r.Context(), identity, identity.TenantID, tenantservice.AttachmentSettingsInput{
+		MaxBytes:     req.MaxBytes,
+		AllowedTypes: req.AllowedTypes,
+	})
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusOK, dto.AttachmentSettingsResultResponse{
+		Attachments: attachmentSettingsResult(settings),
+	})
+}
@@ -11,6 +11,7 @@ import (
 	authsvc "chat-app-backend/internal/service/auth"
 	"context"
 	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -167,7 +168,7 @@ func setupAuthHandler(t *testing.T, svc *authsvc.Service) (http.Handler, func())
 
 	queueManager := queue.NewRequestQueueManager(10, 1)
 
-	server := api.NewAPIServer(":0", queueManager, nil, nil)
+	server := api.NewAPIServerWithRegistry(":0", queueManager, nil, nil, prometheus.NewRegistry())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/auth/register", server.MakeHTTPHandleFunc(authEndpoints.Register))
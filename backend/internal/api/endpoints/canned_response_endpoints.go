@@ -0,0 +1,168 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/dto"
+	"chat-app-backend/internal/model"
+	tenantservice "chat-app-backend/internal/service/tenant"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type CannedResponseEndpoints interface {
+	CannedResponses(http.ResponseWriter, *http.Request) error
+	CannedResponse(http.ResponseWriter, *http.Request) error
+}
+
+type cannedResponseEndpoints struct {
+	service    *tenantservice.Service
+	itemPrefix string
+}
+
+// NewCannedResponseEndpoints serves the canned responses of a tenant under
+// prefix+"/tenant/canned-responses".
+func NewCannedResponseEndpoints(service *tenantservice.Service, prefix string) CannedResponseEndpoints {
+	return &cannedResponseEndpoints{
+		service:    service,
+		itemPrefix: strings.TrimRight(prefix, "/") + "/tenant/canned-responses/",
+	}
+}
+
+func (h *cannedResponseEndpoints) CannedResponses(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet:  h.handleListCannedResponses,
+		http.MethodPost: h.handleCreateCannedResponse,
+	})
+}
+
+func (h *cannedResponseEndpoints) CannedResponse(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodPatch:  h.handleUpdateCannedResponse,
+		http.MethodDelete: h.handleDeleteCannedResponse,
+	})
+}
+
+func (h *cannedResponseEndpoints) handleListCannedResponses(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	items, err := h.service.ListCannedResponses(r.Context(), identity, r.URL.Query().Get("folder"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	resp := dto.CannedResponseListResponse{CannedResponses: make([]dto.CannedResponse, 0, len(items))}
+	for _, item := range items {
+		resp.CannedResponses = append(resp.CannedResponses, toCannedResponseDTO(item))
+	}
+	return WriteJSON(w, http.StatusOK, resp)
+}
+
+func (h *cannedResponseEndpoints) handleCreateCannedResponse(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	input, err := decodeCannedResponseRequest(r)
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.CreateCannedResponse(r.Context(), identity, input)
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusCreated, dto.CannedResponseResultResponse{
+		CannedResponse: toCannedResponseDTO(item),
+	})
+}
+
+func (h *cannedResponseEndpoints) handleUpdateCannedResponse(w http.ResponseWriter, r *http.Request) error {
+	responseID, err := h.extractResponseID(r.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	input, err := decodeCannedResponseRequest(r)
+	if err != nil {
+		return err
+	}
+
+	item, err := h.service.UpdateCannedResponse(r.Context(), identity, responseID, input)
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusOK, dto.CannedResponseResultResponse{
+		CannedResponse: toCannedResponseDTO(item),
+	})
+}
+
+func (h *cannedResponseEndpoints) handleDeleteCannedResponse(w http.ResponseWriter, r *http.Request) error {
+	responseID, err := h.extractResponseID(r.URL.Path)
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	if err := h.service.DeleteCannedResponse(r.Context(), identity, responseID); err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func (h *cannedResponseEndpoints) extractResponseID(path string) (string, error) {
+	responseID := strings.Trim(strings.TrimPrefix(path, h.itemPrefix), "/")
+	if responseID == "" || strings.Contains(responseID, "/") || !strings.HasPrefix(path, h.itemPrefix) {
+		return "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Canned response not found", ErrorLog: fmt.Errorf("invalid canned response path: %s", path)}
+	}
+	return responseID, nil
+}
+
+func decodeCannedResponseRequest(r *http.Request) (tenantservice.CannedResponseInput, error) {
+	var req dto.CannedResponseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return tenantservice.CannedResponseInput{}, &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode canned response request: %w", err),
+		}
+	}
+	return tenantservice.CannedResponseInput{
+		Title:    req.Title,
+		Shortcut: req.Shortcut,
+		Folder:   req.Folder,
+		Body:     req.Body,
+	}, nil
+}
+
+func toCannedResponseDTO(item model.CannedResponseItem) dto.CannedResponse {
+	return dto.CannedResponse{
+		ResponseID: item.ResponseID,
+		Title:      item.Title,
+		Shortcut:   item.Shortcut,
+		Folder:     item.Folder,
+		Body:       item.Body,
+		CreatedBy:  item.CreatedBy,
+		CreatedAt:  item.CreatedAt,
+		UpdatedAt:  item.UpdatedAt,
+		UsageCount: item.UsageCount,
+		LastUsedAt: item.LastUsedAt,
+	}
+}
@@ -6,9 +6,13 @@ import (
 	"chat-app-backend/internal/model"
 	conversationservice "chat-app-backend/internal/service/conversation"
 	"chat-app-backend/internal/websocket"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -19,8 +23,14 @@ type ConversationEndpoints interface {
 	Conversations(http.ResponseWriter, *http.Request) error
 	ConversationMessages(http.ResponseWriter, *http.Request) error
 	ConversationUsage(http.ResponseWriter, *http.Request) error
+	ConversationSearch(http.ResponseWriter, *http.Request) error
 	Websocket(http.ResponseWriter, *http.Request) error
 	NotificationsWebsocket(http.ResponseWriter, *http.Request) error
+	ConversationStream(http.ResponseWriter, *http.Request) error
+	NotificationsStream(http.ResponseWriter, *http.Request) error
+	ConversationPoll(http.ResponseWriter, *http.Request) error
+	NotificationsPoll(http.ResponseWriter, *http.Request) error
+	AgentWebsocket(http.ResponseWriter, *http.Request) error
 }
 
 type ConversationPaths struct {
@@ -30,32 +40,49 @@ type ConversationPaths struct {
 	TenantConversationPrefix         string
 	WebsocketPrefix                  string
 	TenantNotificationPath           string
+	StreamPrefix                     string
+	StreamNotificationPath           string
+	PollPrefix                       string
+	PollNotificationPath             string
+	AgentWebsocketPath               string
 }
 
 type conversationEndpoints struct {
 	service *conversationservice.Service
 	handler *websocket.Handler
+	broker  websocket.Broker
+	tickets *websocket.Tickets
 	paths   ConversationPaths
 }
 
-func NewConversationEndpoints(service *conversationservice.Service, handler *websocket.Handler, prefix string) ConversationEndpoints {
+func NewConversationEndpoints(service *conversationservice.Service, handler *websocket.Handler, broker websocket.Broker, prefix string) ConversationEndpoints {
 	base := strings.TrimRight(prefix, "/")
-	return NewConversationEndpointsWithPaths(service, handler, ConversationPaths{
+	return NewConversationEndpointsWithPaths(service, handler, broker, ConversationPaths{
 		PublicConversationsPath:          base + "/public/conversations",
 		PublicConversationMessagesPrefix: base + "/public/conversations/",
 		TenantConversationsPath:          base + "/conversations",
 		TenantConversationPrefix:         base + "/conversations/",
 		WebsocketPrefix:                  base + "/ws/conversations/",
 		TenantNotificationPath:           base + "/ws/notifications",
+		StreamPrefix:                     base + "/sse/conversations/",
+		StreamNotificationPath:           base + "/sse/notifications",
+		PollPrefix:                       base + "/poll/conversations/",
+		PollNotificationPath:             base + "/poll/notifications",
+		AgentWebsocketPath:               base + "/ws/agent",
 	})
 }
 
-func NewConversationEndpointsWithPaths(service *conversationservice.Service, handler *websocket.Handler, paths ConversationPaths) ConversationEndpoints {
-	return &conversationEndpoints{
+func NewConversationEndpointsWithPaths(service *conversationservice.Service, handler *websocket.Handler, broker websocket.Broker, paths ConversationPaths) ConversationEndpoints {
+	endpoints := &conversationEndpoints{
 		service: service,
 		handler: handler,
+		broker:  broker,
 		paths:   paths,
 	}
+	if broker != nil {
+		endpoints.tickets = websocket.NewTickets(broker)
+	}
+	return endpoints
 }
 
 func (h *conversationEndpoints) PublicConversations(w http.ResponseWriter, r *http.Request) error {
@@ -71,6 +98,19 @@ func (h *conversationEndpoints) PublicConversationMessages(w http.ResponseWriter
 			http.MethodPost: h.handleAssignVisitorEmail,
 		})
 	}
+	if strings.HasSuffix(trimmed, "/read") {
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handleMarkVisitorRead,
+		})
+	}
+	if strings.HasSuffix(trimmed, "/attachments") {
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handlePostVisitorAttachment,
+		})
+	}
+	if _, _, ok := messagePathIDs(trimmed, h.paths.PublicConversationMessagesPrefix, ""); ok {
+		return h.publicMessageItem(w, r)
+	}
 
 	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
 		http.MethodGet:  h.handleListPublicMessages,
@@ -85,6 +125,42 @@ func (h *conversationEndpoints) Conversations(w http.ResponseWriter, r *http.Req
 }
 
 func (h *conversationEndpoints) ConversationMessages(w http.ResponseWriter, r *http.Request) error {
+	trimmed := strings.TrimRight(r.URL.Path, "/")
+	switch {
+	case strings.HasSuffix(trimmed, "/close"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handleCloseConversation,
+		})
+	case strings.HasSuffix(trimmed, "/reopen"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handleReopenConversation,
+		})
+	case strings.HasSuffix(trimmed, "/archive"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handleArchiveConversation,
+		})
+	case strings.HasSuffix(trimmed, "/assignment"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPut:    h.handleAssignConversation,
+			http.MethodDelete: h.handleUnassignConversation,
+		})
+	case strings.HasSuffix(trimmed, "/read"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handleMarkRead,
+		})
+	case strings.HasSuffix(trimmed, "/revisions"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodGet: h.handleMessageHistory,
+		})
+	case strings.HasSuffix(trimmed, "/attachments"):
+		return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+			http.MethodPost: h.handlePostAgentAttachment,
+		})
+	}
+	if _, _, ok := messagePathIDs(trimmed, h.paths.TenantConversationPrefix, ""); ok {
+		return h.tenantMessageItem(w, r)
+	}
+
 	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
 		http.MethodGet:  h.handleListMessages,
 		http.MethodPost: h.handlePostAgentMessage,
@@ -97,53 +173,156 @@ func (h *conversationEndpoints) ConversationUsage(w http.ResponseWriter, r *http
 	})
 }
 
+func (h *conversationEndpoints) ConversationSearch(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet: h.handleSearchMessages,
+	})
+}
+
 func (h *conversationEndpoints) Websocket(w http.ResponseWriter, r *http.Request) error {
-	convID, err := h.extractFromPath(r.URL.Path, h.paths.WebsocketPrefix)
+	participant, err := h.conversationParticipant(r, h.paths.WebsocketPrefix)
+	if err != nil {
+		return err
+	}
+	h.handler.JoinRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+// ConversationStream serves the events of a conversation as Server-Sent
+// Events, authenticated like its websocket.
+func (h *conversationEndpoints) ConversationStream(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.conversationParticipant(r, h.paths.StreamPrefix)
+	if err != nil {
+		return err
+	}
+	h.handler.StreamRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+// ConversationPoll answers a long poll for the events of a conversation,
+// authenticated like its websocket. Tickets are single-use, so clients polling
+// with tickets need a new one for every poll.
+func (h *conversationEndpoints) ConversationPoll(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.conversationParticipant(r, h.paths.PollPrefix)
+	if err != nil {
+		return err
+	}
+	h.handler.PollRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+func (h *conversationEndpoints) NotificationsWebsocket(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.notificationParticipant(r, h.paths.TenantNotificationPath)
+	if err != nil {
+		return err
+	}
+	h.handler.JoinRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+// NotificationsStream serves the events of a notification room as
+// Server-Sent Events, authenticated like its websocket.
+func (h *conversationEndpoints) NotificationsStream(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.notificationParticipant(r, h.paths.StreamNotificationPath)
 	if err != nil {
 		return err
 	}
+	h.handler.StreamRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+// NotificationsPoll answers a long poll for the events of a notification
+// room, authenticated like its websocket.
+func (h *conversationEndpoints) NotificationsPoll(w http.ResponseWriter, r *http.Request) error {
+	participant, err := h.notificationParticipant(r, h.paths.PollNotificationPath)
+	if err != nil {
+		return err
+	}
+	h.handler.PollRoom(w, r, participant.roomID, participant.userID, participant.senderType, participant.tenantID)
+	return nil
+}
+
+// roomParticipant is the room a realtime connection is for and who opened it.
+type roomParticipant struct {
+	roomID     string
+	userID     string
+	senderType string
+	tenantID   string
+}
+
+// conversationParticipant authenticates a connection to the conversation
+// under prefix with its ticket, visitor token or agent token.
+func (h *conversationEndpoints) conversationParticipant(r *http.Request, prefix string) (roomParticipant, error) {
+	if h.handler == nil {
+		return roomParticipant{}, &HTTPError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Websocket not available",
+			ErrorLog:   fmt.Errorf("conversation realtime handler missing"),
+		}
+	}
+
+	convID, err := h.extractFromPath(r.URL.Path, prefix)
+	if err != nil {
+		return roomParticipant{}, err
+	}
 	convID = strings.Trim(convID, "/")
 	if convID == "" {
-		return &HTTPError{
+		return roomParticipant{}, &HTTPError{
 			StatusCode: http.StatusNotFound,
 			Message:    "Conversation not found",
 			ErrorLog:   fmt.Errorf("websocket conversation id missing"),
 		}
 	}
 
+	if ticketID := strings.TrimSpace(r.URL.Query().Get("ticket")); ticketID != "" {
+		ticket, err := h.redeemTicket(r, ticketID)
+		if err != nil {
+			return roomParticipant{}, err
+		}
+		switch ticket.Role {
+		case websocket.TicketRoleVisitor:
+			if ticket.ConversationID != convID {
+				return roomParticipant{}, &HTTPError{
+					StatusCode: http.StatusForbidden,
+					Message:    "Ticket does not match conversation",
+					ErrorLog:   fmt.Errorf("websocket ticket conversation mismatch: %s vs %s", ticket.ConversationID, convID),
+				}
+			}
+			return roomParticipant{roomID: convID, userID: ticket.ParticipantID, senderType: websocket.SenderVisitor, tenantID: ticket.TenantID}, nil
+		default:
+			return h.agentParticipant(r.Context(), ticket.TenantID, ticket.ParticipantID, convID)
+		}
+	}
+
 	role := r.URL.Query().Get("role")
 	switch role {
 	case "visitor":
 		token := r.URL.Query().Get("token")
 		access, err := h.service.ValidateVisitorAccess(token)
 		if err != nil {
-			return h.serviceError(err)
+			return roomParticipant{}, h.serviceError(err)
 		}
 		if access.ConversationID != convID {
-			return &HTTPError{
+			return roomParticipant{}, &HTTPError{
 				StatusCode: http.StatusForbidden,
 				Message:    "Token does not match conversation",
 				ErrorLog:   fmt.Errorf("websocket conversation mismatch: %s vs %s", access.ConversationID, convID),
 			}
 		}
-		h.ensureRoom(convID)
-		h.handler.JoinRoom(w, r, convID, access.VisitorID)
-		return nil
+		return roomParticipant{roomID: convID, userID: access.VisitorID, senderType: websocket.SenderVisitor, tenantID: access.TenantID}, nil
 
 	case "agent", "user", "tenant":
 		identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
 		if err != nil {
-			return h.serviceError(err)
+			return roomParticipant{}, h.serviceError(err)
 		}
 		if identity.TenantID == "" {
-			return &HTTPError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized", ErrorLog: fmt.Errorf("websocket missing tenant")}
+			return roomParticipant{}, &HTTPError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized", ErrorLog: fmt.Errorf("websocket missing tenant")}
 		}
-		h.ensureRoom(convID)
-		h.handler.JoinRoom(w, r, convID, identity.UserID)
-		return nil
+		return h.agentParticipant(r.Context(), identity.TenantID, identity.UserID, convID)
 
 	default:
-		return &HTTPError{
+		return roomParticipant{}, &HTTPError{
 			StatusCode: http.StatusBadRequest,
 			Message:    "Missing or invalid role parameter",
 			ErrorLog:   fmt.Errorf("websocket role invalid: %s", role),
@@ -151,9 +330,21 @@ func (h *conversationEndpoints) Websocket(w http.ResponseWriter, r *http.Request
 	}
 }
 
-func (h *conversationEndpoints) NotificationsWebsocket(w http.ResponseWriter, r *http.Request) error {
-	if strings.TrimSpace(h.paths.TenantNotificationPath) == "" {
-		return &HTTPError{
+// agentParticipant admits a tenant user to the room of a conversation of
+// their tenant, checked the same way reading it over REST is.
+func (h *conversationEndpoints) agentParticipant(ctx context.Context, tenantID, userID, conversationID string) (roomParticipant, error) {
+	identity := conversationservice.Identity{UserID: userID, TenantID: tenantID}
+	if _, err := h.service.GetConversation(ctx, identity, conversationID); err != nil {
+		return roomParticipant{}, h.serviceError(err)
+	}
+	return roomParticipant{roomID: conversationID, userID: userID, senderType: websocket.SenderAgent, tenantID: tenantID}, nil
+}
+
+// notificationParticipant authenticates a connection to the notification
+// room served at path, which must be configured.
+func (h *conversationEndpoints) notificationParticipant(r *http.Request, path string) (roomParticipant, error) {
+	if strings.TrimSpace(path) == "" {
+		return roomParticipant{}, &HTTPError{
 			StatusCode: http.StatusNotFound,
 			Message:    "Websocket not configured",
 			ErrorLog:   fmt.Errorf("notification websocket path not configured"),
@@ -161,16 +352,72 @@ func (h *conversationEndpoints) NotificationsWebsocket(w http.ResponseWriter, r
 	}
 
 	if h.handler == nil {
-		return &HTTPError{
+		return roomParticipant{}, &HTTPError{
 			StatusCode: http.StatusServiceUnavailable,
 			Message:    "Websocket not available",
 			ErrorLog:   fmt.Errorf("notification websocket handler missing"),
 		}
 	}
 
+	identity, err := h.notificationIdentity(r)
+	if err != nil {
+		return roomParticipant{}, err
+	}
+	if identity.TenantID == "" {
+		return roomParticipant{}, &HTTPError{
+			StatusCode: http.StatusUnauthorized,
+			Message:    "Unauthorized",
+			ErrorLog:   fmt.Errorf("notification websocket missing tenant"),
+		}
+	}
+
+	// scope=user opens the personal room of the agent instead of the shared
+	// tenant room.
+	var roomID string
+	switch scope := strings.TrimSpace(r.URL.Query().Get("scope")); scope {
+	case "", "tenant":
+		roomID = tenantNotificationRoomID(identity.TenantID)
+	case "user":
+		roomID = userNotificationRoomID(identity.TenantID, identity.UserID)
+	default:
+		return roomParticipant{}, &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid notification scope",
+			ErrorLog:   fmt.Errorf("notification websocket invalid scope %q", scope),
+		}
+	}
+	if roomID == "" {
+		return roomParticipant{}, &HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Unable to resolve notification room",
+			ErrorLog:   fmt.Errorf("notification websocket invalid tenant room"),
+		}
+	}
+
+	return roomParticipant{roomID: roomID, userID: identity.UserID, senderType: websocket.SenderAgent, tenantID: identity.TenantID}, nil
+}
+
+// notificationIdentity authenticates a notification socket with its ticket,
+// or with the agent token of clients that do not use tickets yet.
+func (h *conversationEndpoints) notificationIdentity(r *http.Request) (conversationservice.Identity, error) {
+	if ticketID := strings.TrimSpace(r.URL.Query().Get("ticket")); ticketID != "" {
+		ticket, err := h.redeemTicket(r, ticketID)
+		if err != nil {
+			return conversationservice.Identity{}, err
+		}
+		if ticket.Role != websocket.TicketRoleAgent {
+			return conversationservice.Identity{}, &HTTPError{
+				StatusCode: http.StatusForbidden,
+				Message:    "Forbidden",
+				ErrorLog:   fmt.Errorf("notification websocket ticket for role %s", ticket.Role),
+			}
+		}
+		return conversationservice.Identity{TenantID: ticket.TenantID, UserID: ticket.ParticipantID}, nil
+	}
+
 	token := strings.TrimSpace(r.URL.Query().Get("token"))
 	if token == "" {
-		return &HTTPError{
+		return conversationservice.Identity{}, &HTTPError{
 			StatusCode: http.StatusUnauthorized,
 			Message:    "Missing token",
 			ErrorLog:   fmt.Errorf("notification websocket missing token"),
@@ -179,28 +426,37 @@ func (h *conversationEndpoints) NotificationsWebsocket(w http.ResponseWriter, r
 
 	identity, err := h.service.IdentityFromToken(token)
 	if err != nil {
-		return h.serviceError(err)
+		return conversationservice.Identity{}, h.serviceError(err)
 	}
-	if identity.TenantID == "" {
-		return &HTTPError{
-			StatusCode: http.StatusUnauthorized,
-			Message:    "Unauthorized",
-			ErrorLog:   fmt.Errorf("notification websocket missing tenant"),
+	return identity, nil
+}
+
+// redeemTicket consumes the connection ticket a socket was opened with.
+func (h *conversationEndpoints) redeemTicket(r *http.Request, ticketID string) (websocket.Ticket, error) {
+	if h.tickets == nil {
+		return websocket.Ticket{}, &HTTPError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Websocket not available",
+			ErrorLog:   fmt.Errorf("websocket tickets not configured"),
 		}
 	}
 
-	roomID := tenantNotificationRoomID(identity.TenantID)
-	if roomID == "" {
-		return &HTTPError{
+	ticket, err := h.tickets.Redeem(r.Context(), ticketID)
+	if errors.Is(err, websocket.ErrTicketInvalid) {
+		return websocket.Ticket{}, &HTTPError{
+			StatusCode: http.StatusUnauthorized,
+			Message:    "Invalid or expired ticket",
+			ErrorLog:   err,
+		}
+	}
+	if err != nil {
+		return websocket.Ticket{}, &HTTPError{
 			StatusCode: http.StatusInternalServerError,
-			Message:    "Unable to resolve notification room",
-			ErrorLog:   fmt.Errorf("notification websocket invalid tenant room"),
+			Message:    "Internal server error",
+			ErrorLog:   err,
 		}
 	}
-
-	h.ensureRoom(roomID)
-	h.handler.JoinRoom(w, r, roomID, identity.UserID)
-	return nil
+	return ticket, nil
 }
 
 func (h *conversationEndpoints) handleCreateConversation(w http.ResponseWriter, r *http.Request) error {
@@ -230,8 +486,10 @@ func (h *conversationEndpoints) handleCreateConversation(w http.ResponseWriter,
 		return h.serviceError(err)
 	}
 
-	h.ensureRoom(result.Conversation.ConversationID)
-	h.broadcastEvent("conversation.created", result.Conversation, result.Message)
+	h.broadcastEvent(websocket.EventConversationCreated, result.Conversation, result.Message)
+	if result.Assignment != nil {
+		h.broadcastAssignment(result.Conversation, *result.Assignment)
+	}
 
 	resp := dto.CreateConversationResponse{
 		Conversation: toConversationMetadata(result.Conversation),
@@ -258,7 +516,12 @@ func (h *conversationEndpoints) handlePostVisitorMessage(w http.ResponseWriter,
 		}
 	}
 
-	result, err := h.service.PostVisitorMessage(r.Context(), req.VisitorToken, req.Body)
+	var result conversationservice.MessageResult
+	if req.Type != "" || req.Content != nil {
+		result, err = h.service.PostVisitorContent(r.Context(), req.VisitorToken, convID, toMessageInput(req.Type, req.Body, req.Content))
+	} else {
+		result, err = h.service.PostVisitorMessage(r.Context(), req.VisitorToken, req.Body)
+	}
 	if err != nil {
 		return h.serviceError(err)
 	}
@@ -271,7 +534,7 @@ func (h *conversationEndpoints) handlePostVisitorMessage(w http.ResponseWriter,
 		}
 	}
 
-	h.broadcastEvent("message.created", result.Conversation, result.Message)
+	h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
 
 	return api.WriteJSON(w, http.StatusCreated, toMessageResponse(result.Message))
 }
@@ -317,6 +580,32 @@ func (h *conversationEndpoints) handleAssignVisitorEmail(w http.ResponseWriter,
 	return api.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (h *conversationEndpoints) handleMarkVisitorRead(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractPublicConversationAction(r.URL.Path, "read")
+	if err != nil {
+		return err
+	}
+
+	req, err := decodeMarkReadRequest(r)
+	if err != nil {
+		return err
+	}
+	if req.VisitorToken == "" {
+		req.VisitorToken = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
+	}
+
+	result, err := h.service.MarkVisitorRead(r.Context(), req.VisitorToken, conversationID, req.MessageID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	if result.Advanced {
+		h.broadcastRead(result)
+	}
+
+	return api.WriteJSON(w, http.StatusOK, toReadReceiptResponse(result))
+}
+
 func (h *conversationEndpoints) handleListPublicMessages(w http.ResponseWriter, r *http.Request) error {
 	conversationID, err := h.extractPublicMessagePath(r.URL.Path)
 	if err != nil {
@@ -328,17 +617,17 @@ func (h *conversationEndpoints) handleListPublicMessages(w http.ResponseWriter,
 		token = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
 	}
 
-	result, err := h.service.ListVisitorMessages(r.Context(), token, conversationID, 100)
+	params, err := parseListMessagesParams(r)
 	if err != nil {
-		return h.serviceError(err)
+		return err
 	}
 
-	resp := dto.ListMessagesResponse{Messages: make([]dto.MessageResponse, len(result.Messages))}
-	for i, msg := range result.Messages {
-		resp.Messages[i] = toMessageResponse(msg)
+	result, err := h.service.ListVisitorMessages(r.Context(), token, conversationID, params)
+	if err != nil {
+		return h.serviceError(err)
 	}
 
-	return api.WriteJSON(w, http.StatusOK, resp)
+	return api.WriteJSON(w, http.StatusOK, toListMessagesResponse(result))
 }
 
 func (h *conversationEndpoints) handleListConversations(w http.ResponseWriter, r *http.Request) error {
@@ -347,14 +636,27 @@ func (h *conversationEndpoints) handleListConversations(w http.ResponseWriter, r
 		return h.serviceError(err)
 	}
 
-	result, err := h.service.ListConversations(r.Context(), identity, 50)
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.service.ListConversations(r.Context(), identity, parseConversationFilter(r, identity), conversationservice.PageQuery{
+		Limit:  limit,
+		Cursor: r.URL.Query().Get("cursor"),
+	})
 	if err != nil {
 		return h.serviceError(err)
 	}
 
-	resp := dto.ListConversationsResponse{Conversations: make([]dto.ConversationMetadata, len(result.Conversations))}
+	resp := dto.ListConversationsResponse{
+		Conversations: make([]dto.ConversationMetadata, len(result.Conversations)),
+		NextCursor:    result.NextCursor,
+	}
 	for i, conv := range result.Conversations {
 		resp.Conversations[i] = toConversationMetadata(conv)
+		unread := conv.UnreadForUser(identity.UserID)
+		resp.Conversations[i].UnreadCount = &unread
 	}
 
 	return api.WriteJSON(w, http.StatusOK, resp)
@@ -371,17 +673,17 @@ func (h *conversationEndpoints) handleListMessages(w http.ResponseWriter, r *htt
 		return h.serviceError(err)
 	}
 
-	result, err := h.service.ListMessages(r.Context(), identity, conversationID, 100)
+	params, err := parseListMessagesParams(r)
 	if err != nil {
-		return h.serviceError(err)
+		return err
 	}
 
-	resp := dto.ListMessagesResponse{Messages: make([]dto.MessageResponse, len(result.Messages))}
-	for i, msg := range result.Messages {
-		resp.Messages[i] = toMessageResponse(msg)
+	result, err := h.service.ListMessages(r.Context(), identity, conversationID, params)
+	if err != nil {
+		return h.serviceError(err)
 	}
 
-	return api.WriteJSON(w, http.StatusOK, resp)
+	return api.WriteJSON(w, http.StatusOK, toListMessagesResponse(result))
 }
 
 func (h *conversationEndpoints) handleConversationUsage(w http.ResponseWriter, r *http.Request) error {
@@ -414,6 +716,37 @@ func (h *conversationEndpoints) handleConversationUsage(w http.ResponseWriter, r
 	return api.WriteJSON(w, http.StatusOK, resp)
 }
 
+func (h *conversationEndpoints) handleSearchMessages(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.service.SearchMessages(r.Context(), identity, r.URL.Query().Get("q"), limit)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	resp := dto.SearchMessagesResponse{
+		Query: result.Query,
+		Hits:  make([]dto.SearchHitResponse, len(result.Hits)),
+	}
+	for i, hit := range result.Hits {
+		resp.Hits[i] = dto.SearchHitResponse{
+			Message:      toMessageResponse(hit.Message),
+			Snippet:      hit.Snippet,
+			Conversation: toConversationMetadata(hit.Conversation),
+		}
+	}
+
+	return api.WriteJSON(w, http.StatusOK, resp)
+}
+
 func (h *conversationEndpoints) handlePostAgentMessage(w http.ResponseWriter, r *http.Request) error {
 	conversationID, err := h.extractTenantConversationPath(r.URL.Path)
 	if err != nil {
@@ -434,16 +767,196 @@ func (h *conversationEndpoints) handlePostAgentMessage(w http.ResponseWriter, r
 		}
 	}
 
-	result, err := h.service.PostAgentMessage(r.Context(), identity, conversationID, req.Body)
+	var result conversationservice.MessageResult
+	switch {
+	case req.CannedResponseID != "":
+		result, err = h.service.PostCannedResponse(r.Context(), identity, conversationID, req.CannedResponseID)
+	case req.Type != "" || req.Content != nil:
+		result, err = h.service.PostAgentContent(r.Context(), identity, conversationID, toMessageInput(req.Type, req.Body, req.Content))
+	default:
+		result, err = h.service.PostAgentMessage(r.Context(), identity, conversationID, req.Body)
+	}
 	if err != nil {
 		return h.serviceError(err)
 	}
 
-	h.broadcastEvent("message.created", result.Conversation, result.Message)
+	if result.Message.VisibleToVisitor() {
+		h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
+	} else {
+		h.broadcastNote(websocket.EventMessageCreated, result.Conversation, result.Message)
+	}
+
+	// The message is already out, so a failure to count it must not fail the
+	// request and invite a second post.
+	if req.CannedResponseID != "" {
+		if err := h.service.RecordCannedResponseUse(r.Context(), identity, req.CannedResponseID); err != nil {
+			log.Printf("failed to record use of canned response %s: %v", req.CannedResponseID, err)
+		}
+	}
 
 	return api.WriteJSON(w, http.StatusCreated, toMessageResponse(result.Message))
 }
 
+func (h *conversationEndpoints) handleCloseConversation(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "close")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	var req dto.CloseConversationRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &HTTPError{
+				StatusCode: http.StatusBadRequest,
+				Message:    "Invalid request payload",
+				ErrorLog:   fmt.Errorf("decode close conversation request: %w", err),
+			}
+		}
+	}
+
+	conversation, err := h.service.CloseConversation(r.Context(), identity, conversationID, req.Reason)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastConversationEvent(websocket.EventConversationClosed, conversation)
+	h.announce(r.Context(), conversation, model.SystemEventConversationClosed, identity.UserID)
+
+	return api.WriteJSON(w, http.StatusOK, dto.ConversationResponse{Conversation: toConversationMetadata(conversation)})
+}
+
+func (h *conversationEndpoints) handleReopenConversation(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "reopen")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	conversation, err := h.service.ReopenConversation(r.Context(), identity, conversationID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastConversationEvent(websocket.EventConversationReopened, conversation)
+	h.announce(r.Context(), conversation, model.SystemEventConversationReopened, identity.UserID)
+
+	return api.WriteJSON(w, http.StatusOK, dto.ConversationResponse{Conversation: toConversationMetadata(conversation)})
+}
+
+func (h *conversationEndpoints) handleArchiveConversation(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "archive")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	conversation, err := h.service.ArchiveConversation(r.Context(), identity, conversationID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastConversationEvent(websocket.EventConversationArchived, conversation)
+
+	return api.WriteJSON(w, http.StatusOK, dto.ConversationResponse{Conversation: toConversationMetadata(conversation)})
+}
+
+func (h *conversationEndpoints) handleMarkRead(w http.ResponseWriter, r *http.Request) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "read")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	req, err := decodeMarkReadRequest(r)
+	if err != nil {
+		return err
+	}
+
+	result, err := h.service.MarkRead(r.Context(), identity, conversationID, req.MessageID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	if result.Advanced {
+		h.broadcastRead(result)
+	}
+
+	return api.WriteJSON(w, http.StatusOK, toReadReceiptResponse(result))
+}
+
+func (h *conversationEndpoints) handleAssignConversation(w http.ResponseWriter, r *http.Request) error {
+	var req dto.AssignConversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode assign conversation request: %w", err),
+		}
+	}
+
+	req.UserID = strings.TrimSpace(req.UserID)
+	if req.UserID == "" {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "userId is required",
+			ErrorLog:   fmt.Errorf("assign conversation missing userId"),
+		}
+	}
+
+	return h.updateAssignment(w, r, req.UserID)
+}
+
+func (h *conversationEndpoints) handleUnassignConversation(w http.ResponseWriter, r *http.Request) error {
+	return h.updateAssignment(w, r, "")
+}
+
+func (h *conversationEndpoints) updateAssignment(w http.ResponseWriter, r *http.Request, assigneeID string) error {
+	conversationID, err := h.extractTenantConversationAction(r.URL.Path, "assignment")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	result, err := h.service.AssignConversation(r.Context(), identity, conversationID, assigneeID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastAssignment(result.Conversation, result.Assignment)
+	if previous := result.Assignment.PreviousUserID; previous != "" {
+		h.announce(r.Context(), result.Conversation, model.SystemEventAgentLeft, previous)
+	}
+	if assignee := result.Assignment.AssignedUserID; assignee != "" {
+		h.announce(r.Context(), result.Conversation, model.SystemEventAgentJoined, assignee)
+	}
+
+	return api.WriteJSON(w, http.StatusOK, dto.ConversationAssignmentResponse{
+		Conversation: toConversationMetadata(result.Conversation),
+		Assignment:   toAssignmentRecordResponse(result.Assignment),
+	})
+}
+
 func resolveUsagePeriod(param string) (time.Time, time.Time, string, error) {
 	month := strings.TrimSpace(param)
 	var start time.Time
@@ -503,6 +1016,22 @@ func (h *conversationEndpoints) extractTenantConversationPath(path string) (stri
 	return parts[0], nil
 }
 
+func (h *conversationEndpoints) extractTenantConversationAction(path, action string) (string, error) {
+	prefix := h.paths.TenantConversationPrefix
+	if prefix == "" {
+		return "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Conversation not found", ErrorLog: fmt.Errorf("tenant messaging not configured")}
+	}
+	trimmed := strings.TrimPrefix(path, prefix)
+	if trimmed == path {
+		return "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Conversation not found", ErrorLog: fmt.Errorf("conversation path mismatch: %s", path)}
+	}
+	parts := strings.Split(strings.Trim(trimmed, "/"), "/")
+	if len(parts) != 2 || parts[1] != action {
+		return "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Conversation not found", ErrorLog: fmt.Errorf("invalid conversation %s path: %s", action, path)}
+	}
+	return parts[0], nil
+}
+
 func (h *conversationEndpoints) extractFromPath(path, prefix string) (string, error) {
 	if prefix == "" {
 		return "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Conversation not found", ErrorLog: fmt.Errorf("websocket not configured")}
@@ -514,45 +1043,148 @@ func (h *conversationEndpoints) extractFromPath(path, prefix string) (string, er
 	return trimmed, nil
 }
 
-func (h *conversationEndpoints) ensureRoom(conversationID string) {
-	if conversationID == "" || h.handler == nil {
+func (h *conversationEndpoints) broadcastEvent(eventType string, conversation model.ConversationItem, message model.MessageItem) {
+	event, ok := newRoomEvent(eventType, websocket.MessageEvent{
+		Conversation: toConversationMetadata(conversation),
+		Message:      toMessageResponse(message),
+	})
+	if !ok {
 		return
 	}
-	h.handler.CreateRoom(conversationID)
+
+	h.notifyRoom(conversation.ConversationID, event)
+	h.notifyTenant(conversation.TenantID, event)
 }
 
-func (h *conversationEndpoints) broadcastEvent(eventType string, conversation model.ConversationItem, message model.MessageItem) {
-	payload := map[string]interface{}{
-		"type":          eventType,
-		"conversation":  toConversationMetadata(conversation),
-		"message":       toMessageResponse(message),
-		"broadcastedAt": time.Now().UTC().Format(time.RFC3339),
+// announce records a system message for kind in conversation and sends it to
+// the room. The change it describes has already been made, so a failure is
+// only logged.
+func (h *conversationEndpoints) announce(ctx context.Context, conversation model.ConversationItem, kind, actorID string) {
+	result, err := h.service.RecordSystemEvent(ctx, conversation, kind, actorID)
+	if err != nil {
+		log.Printf("failed to record %s event in conversation %s: %v", kind, conversation.ConversationID, err)
+		return
+	}
+	h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
+}
+
+// broadcastNote sends an event about a note to the tenant room only, since
+// the conversation room reaches the visitor. A new note is also sent to the
+// personal room of each user it mentions.
+func (h *conversationEndpoints) broadcastNote(eventType string, conversation model.ConversationItem, message model.MessageItem) {
+	payload := websocket.MessageEvent{
+		Conversation: toConversationMetadata(conversation),
+		Message:      toMessageResponse(message),
+	}
+	event, ok := newRoomEvent(eventType, payload)
+	if !ok {
+		return
+	}
+	h.notifyTenant(conversation.TenantID, event)
+
+	if eventType != websocket.EventMessageCreated || len(message.Mentions) == 0 {
+		return
+	}
+	mention, ok := newRoomEvent(websocket.EventNoteMentioned, payload)
+	if !ok {
+		return
+	}
+	for _, userID := range message.Mentions {
+		h.notifyRoom(userNotificationRoomID(conversation.TenantID, userID), mention)
+	}
+}
+
+func (h *conversationEndpoints) broadcastConversationEvent(eventType string, conversation model.ConversationItem) {
+	event, ok := newRoomEvent(eventType, websocket.ConversationEvent{
+		Conversation: toConversationMetadata(conversation),
+	})
+	if !ok {
+		return
+	}
+
+	h.notifyRoom(conversation.ConversationID, event)
+	h.notifyTenant(conversation.TenantID, event)
+}
+
+func (h *conversationEndpoints) broadcastAssignment(conversation model.ConversationItem, record model.AssignmentRecord) {
+	event, ok := newRoomEvent(websocket.EventAssignmentChanged, websocket.AssignmentEvent{
+		Conversation: toConversationMetadata(conversation),
+		Assignment:   toAssignmentRecordResponse(record),
+	})
+	if !ok {
+		return
+	}
+
+	for _, roomID := range assignmentNotificationRooms(conversation.TenantID, record) {
+		h.notifyRoom(roomID, event)
+	}
+}
+
+// assignmentNotificationRooms lists the rooms an assignment change goes to: the
+// tenant room for dashboards, and the personal room of the new assignee so
+// they are told even when not watching the whole tenant.
+func assignmentNotificationRooms(tenantID string, record model.AssignmentRecord) []string {
+	rooms := []string{tenantNotificationRoomID(tenantID)}
+	if roomID := userNotificationRoomID(tenantID, record.AssignedUserID); roomID != "" {
+		rooms = append(rooms, roomID)
+	}
+	return rooms
+}
+
+func (h *conversationEndpoints) broadcastRead(result conversationservice.ReadReceiptResult) {
+	event, ok := newRoomEvent(websocket.EventMessageRead, websocket.ReadEvent{
+		ConversationID: result.Conversation.ConversationID,
+		ReaderType:     result.ReaderType,
+		ReaderID:       result.ReaderID,
+		MessageID:      result.Marker.MessageID,
+		ReadAt:         result.Marker.ReadAt,
+	})
+	if !ok {
+		return
 	}
 
-	h.notifyRoom(conversation.ConversationID, payload)
-	h.notifyTenant(conversation.TenantID, payload)
+	h.notifyRoom(result.Conversation.ConversationID, event)
+	h.notifyTenant(result.Conversation.TenantID, event)
 }
 
-func (h *conversationEndpoints) notifyTenant(tenantID string, payload interface{}) {
+func newRoomEvent(eventType string, payload interface{}) (websocket.Event, bool) {
+	event, err := websocket.NewEvent(eventType, time.Now(), payload)
+	if err != nil {
+		log.Printf("failed to build websocket event %s: %v", eventType, err)
+		return websocket.Event{}, false
+	}
+	return event, true
+}
+
+func (h *conversationEndpoints) notifyTenant(tenantID string, event websocket.Event) {
 	roomID := tenantNotificationRoomID(tenantID)
-	h.notifyRoom(roomID, payload)
+	h.notifyRoom(roomID, event)
 }
 
-func (h *conversationEndpoints) notifyRoom(roomID string, payload interface{}) {
+func (h *conversationEndpoints) notifyRoom(roomID string, event websocket.Event) {
 	if roomID == "" {
 		return
 	}
 
-	if err := websocket.Publish(roomID, payload); err != nil {
-		fmt.Printf("failed to publish websocket payload for room %s: %v\n", roomID, err)
+	// Published events come back to this server through the room relay, so
+	// local clients are only notified directly when the broker is unavailable.
+	if h.broker != nil {
+		_, err := h.broker.Publish(context.Background(), roomID, event)
+		if err == nil {
+			return
+		}
+		log.Printf("failed to publish websocket payload for room %s: %v", roomID, err)
 	}
-
 	if h.handler != nil {
-		h.handler.NotifyRoom(roomID, payload)
+		h.handler.NotifyRoom(roomID, event)
 	}
 }
 
 func (h *conversationEndpoints) serviceError(err error) error {
+	return conversationServiceError(err)
+}
+
+func conversationServiceError(err error) error {
 	if err == nil {
 		return nil
 	}
@@ -591,20 +1223,73 @@ func (h *conversationEndpoints) serviceError(err error) error {
 
 func toConversationMetadata(item model.ConversationItem) dto.ConversationMetadata {
 	return dto.ConversationMetadata{
-		ConversationID:  item.ConversationID,
-		VisitorID:       item.VisitorID,
-		VisitorName:     item.VisitorName,
-		VisitorEmail:    item.VisitorEmail,
-		Status:          string(item.Status),
-		AssignedUserID:  item.AssignedUserID,
-		TenantStartedAt: item.TenantStartedAt,
-		TenantStartedBy: item.TenantStartedBy,
-		CreatedAt:       item.CreatedAt,
-		UpdatedAt:       item.UpdatedAt,
-		LastMessageAt:   item.LastMessageAt,
-		OriginURL:       item.OriginURL,
-		Metadata:        cloneMetadata(item.Metadata),
+		ConversationID:    item.ConversationID,
+		VisitorID:         item.VisitorID,
+		VisitorName:       item.VisitorName,
+		VisitorEmail:      item.VisitorEmail,
+		Status:            string(item.Status),
+		AssignedUserID:    item.AssignedUserID,
+		AssignmentHistory: toAssignmentHistory(item.AssignmentHistory),
+		TenantStartedAt:   item.TenantStartedAt,
+		TenantStartedBy:   item.TenantStartedBy,
+		CreatedAt:         item.CreatedAt,
+		UpdatedAt:         item.UpdatedAt,
+		LastMessageAt:     item.LastMessageAt,
+		OriginURL:         item.OriginURL,
+		ClosedAt:          item.ClosedAt,
+		ClosedBy:          item.ClosedBy,
+		CloseReason:       item.CloseReason,
+		ArchivedAt:        item.ArchivedAt,
+		ArchivedBy:        item.ArchivedBy,
+		Metadata:          cloneMetadata(item.Metadata),
+	}
+}
+
+func toReadReceiptResponse(result conversationservice.ReadReceiptResult) dto.ReadReceiptResponse {
+	return dto.ReadReceiptResponse{
+		ConversationID:    result.Conversation.ConversationID,
+		ReaderType:        result.ReaderType,
+		ReaderID:          result.ReaderID,
+		LastReadMessageID: result.Marker.MessageID,
+		LastReadAt:        result.Marker.ReadAt,
+		UnreadCount:       result.UnreadCount,
+	}
+}
+
+func decodeMarkReadRequest(r *http.Request) (dto.MarkReadRequest, error) {
+	var req dto.MarkReadRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return dto.MarkReadRequest{}, &HTTPError{
+				StatusCode: http.StatusBadRequest,
+				Message:    "Invalid request payload",
+				ErrorLog:   fmt.Errorf("decode mark read request: %w", err),
+			}
+		}
+	}
+	req.MessageID = strings.TrimSpace(req.MessageID)
+	req.VisitorToken = strings.TrimSpace(req.VisitorToken)
+	return req, nil
+}
+
+func toAssignmentRecordResponse(record model.AssignmentRecord) dto.AssignmentRecordResponse {
+	return dto.AssignmentRecordResponse{
+		AssignedUserID: record.AssignedUserID,
+		PreviousUserID: record.PreviousUserID,
+		AssignedBy:     record.AssignedBy,
+		AssignedAt:     record.AssignedAt,
+	}
+}
+
+func toAssignmentHistory(records []model.AssignmentRecord) []dto.AssignmentRecordResponse {
+	if len(records) == 0 {
+		return nil
+	}
+	out := make([]dto.AssignmentRecordResponse, len(records))
+	for i, record := range records {
+		out[i] = toAssignmentRecordResponse(record)
 	}
+	return out
 }
 
 func toMessageResponse(item model.MessageItem) dto.MessageResponse {
@@ -615,9 +1300,32 @@ func toMessageResponse(item model.MessageItem) dto.MessageResponse {
 		SenderID:       item.SenderID,
 		Body:           item.Body,
 		CreatedAt:      item.CreatedAt,
+		Type:           messageType(item),
+		Content:        toMessageContent(item.Content),
+		Mentions:       item.Mentions,
+		EditedAt:       item.EditedAt,
+		DeletedAt:      item.DeletedAt,
+		Attachments:    toAttachmentResponses(item.Attachments),
 	}
 }
 
+func toAttachmentResponses(items []model.Attachment) []dto.AttachmentResponse {
+	if len(items) == 0 {
+		return nil
+	}
+	resp := make([]dto.AttachmentResponse, 0, len(items))
+	for _, item := range items {
+		resp = append(resp, dto.AttachmentResponse{
+			AttachmentID: item.AttachmentID,
+			FileName:     item.FileName,
+			ContentType:  item.ContentType,
+			Size:         item.Size,
+			URL:          item.URL,
+		})
+	}
+	return resp
+}
+
 func cloneMetadata(in map[string]string) map[string]string {
 	if len(in) == 0 {
 		return nil
@@ -629,10 +1337,79 @@ func cloneMetadata(in map[string]string) map[string]string {
 	return out
 }
 
-func tenantNotificationRoomID(tenantID string) string {
-	tenantID = strings.TrimSpace(tenantID)
-	if tenantID == "" {
-		return ""
+func parseLimitParam(r *http.Request) (int, error) {
+	raw := strings.TrimSpace(r.URL.Query().Get("limit"))
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit <= 0 {
+		return 0, &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid limit parameter",
+			ErrorLog:   fmt.Errorf("invalid limit %q", raw),
+		}
 	}
-	return fmt.Sprintf("tenant:%s:notifications", tenantID)
+	return limit, nil
+}
+
+// parseConversationFilter reads the listing filters. assignedUserId accepts
+// "me" for the caller and "none" for unassigned conversations.
+func parseConversationFilter(r *http.Request, identity conversationservice.Identity) conversationservice.ConversationFilter {
+	query := r.URL.Query()
+	filter := conversationservice.ConversationFilter{
+		Status:          model.ConversationStatus(query.Get("status")),
+		VisitorID:       query.Get("visitorId"),
+		VisitorEmail:    query.Get("visitorEmail"),
+		CreatedFrom:     query.Get("createdFrom"),
+		CreatedTo:       query.Get("createdTo"),
+		LastMessageFrom: query.Get("lastMessageFrom"),
+		LastMessageTo:   query.Get("lastMessageTo"),
+		MetadataKey:     query.Get("metadataKey"),
+		MetadataValue:   query.Get("metadataValue"),
+	}
+
+	switch assignee := strings.TrimSpace(query.Get("assignedUserId")); assignee {
+	case "me":
+		filter.AssignedUserID = identity.UserID
+	case "none":
+		filter.Unassigned = true
+	default:
+		filter.AssignedUserID = assignee
+	}
+
+	return filter
+}
+
+func parseListMessagesParams(r *http.Request) (conversationservice.ListMessagesParams, error) {
+	limit, err := parseLimitParam(r)
+	if err != nil {
+		return conversationservice.ListMessagesParams{}, err
+	}
+	query := r.URL.Query()
+	return conversationservice.ListMessagesParams{
+		Limit:  limit,
+		Cursor: query.Get("cursor"),
+		Before: query.Get("before"),
+		After:  query.Get("after"),
+	}, nil
+}
+
+func toListMessagesResponse(result conversationservice.ListMessagesResult) dto.ListMessagesResponse {
+	resp := dto.ListMessagesResponse{
+		Messages:   make([]dto.MessageResponse, len(result.Messages)),
+		NextCursor: result.NextCursor,
+	}
+	for i, msg := range result.Messages {
+		resp.Messages[i] = toMessageResponse(msg)
+	}
+	return resp
+}
+
+func tenantNotificationRoomID(tenantID string) string {
+	return websocket.TenantNotificationRoomID(tenantID)
+}
+
+func userNotificationRoomID(tenantID, userID string) string {
+	return websocket.UserNotificationRoomID(tenantID, userID)
 }
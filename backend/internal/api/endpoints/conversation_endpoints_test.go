@@ -8,14 +8,22 @@ import (
 	internaljwt "chat-app-backend/internal/jwt"
 	"chat-app-backend/internal/model"
 	"chat-app-backend/internal/queue"
+	"chat-app-backend/internal/search"
 	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/storage"
 	"chat-app-backend/internal/websocket"
 	"context"
 	"encoding/json"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -29,6 +37,7 @@ type memoryRepository struct {
 	conversations map[string]model.ConversationItem
 	messages      map[string][]model.MessageItem
 	keys          map[string]string
+	canned        map[string]model.CannedResponseItem
 }
 
 func newMemoryRepository() *memoryRepository {
@@ -39,6 +48,7 @@ func newMemoryRepository() *memoryRepository {
 		conversations: make(map[string]model.ConversationItem),
 		messages:      make(map[string][]model.MessageItem),
 		keys:          make(map[string]string),
+		canned:        make(map[string]model.CannedResponseItem),
 	}
 }
 
@@ -74,6 +84,33 @@ func (m *memoryRepository) GetUser(ctx context.Context, tenantID, userID string)
 	return user, nil
 }
 
+func (m *memoryRepository) ListTenantUsers(ctx context.Context, tenantID string) ([]model.UserItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []model.UserItem
+	for _, user := range m.users {
+		if user.TenantID == tenantID {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *memoryRepository) UpdateTenantRoutingCursor(ctx context.Context, tenantID, previous, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant, ok := m.tenants[tenantID]
+	if !ok {
+		return conversationservice.ErrNotFound
+	}
+	if tenant.RoutingCursor != previous {
+		return conversationservice.ErrRoutingCursorConflict
+	}
+	tenant.RoutingCursor = userID
+	m.tenants[tenantID] = tenant
+	return nil
+}
+
 func (m *memoryRepository) GetVisitor(ctx context.Context, tenantID, visitorID string) (model.VisitorItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -92,6 +129,29 @@ func (m *memoryRepository) PutVisitor(ctx context.Context, visitor model.Visitor
 	return nil
 }
 
+func (m *memoryRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return model.CannedResponseItem{}, conversationservice.ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *memoryRepository) RecordCannedResponseUse(ctx context.Context, tenantID, responseID, usedAt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return conversationservice.ErrNotFound
+	}
+	item.UsageCount++
+	item.LastUsedAt = usedAt
+	m.canned[responseID] = item
+	return nil
+}
+
 func (m *memoryRepository) CreateConversation(ctx context.Context, conversation model.ConversationItem) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -99,21 +159,31 @@ func (m *memoryRepository) CreateConversation(ctx context.Context, conversation
 	return nil
 }
 
-func (m *memoryRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, updatedAt, lastMessageAt string, assignedUserID *string) error {
+func (m *memoryRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, senderType, updatedAt, lastMessageAt string, assignment *model.AssignmentRecord) (model.ConversationItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	pk := model.ConversationPK(tenantID, conversationID)
 	conv, ok := m.conversations[pk]
 	if !ok {
-		return conversationservice.ErrNotFound
+		return model.ConversationItem{}, conversationservice.ErrNotFound
+	}
+	if assignment != nil {
+		if conv.AssignedUserID != assignment.PreviousUserID {
+			return model.ConversationItem{}, conversationservice.ErrAssignmentConflict
+		}
+		conv.AssignedUserID = assignment.AssignedUserID
+		conv.AssignmentHistory = append(conv.AssignmentHistory, *assignment)
 	}
 	conv.UpdatedAt = updatedAt
 	conv.LastMessageAt = lastMessageAt
-	if assignedUserID != nil {
-		conv.AssignedUserID = *assignedUserID
+	switch senderType {
+	case model.MessageSenderVisitor:
+		conv.VisitorMessageCount++
+	case model.MessageSenderAgent:
+		conv.AgentMessageCount++
 	}
 	m.conversations[pk] = conv
-	return nil
+	return conv, nil
 }
 
 func (m *memoryRepository) UpdateConversationVisitorEmail(ctx context.Context, tenantID, conversationID, visitorEmail, updatedAt string) error {
@@ -144,6 +214,67 @@ func (m *memoryRepository) MarkConversationTenantStart(ctx context.Context, tena
 	return nil
 }
 
+func (m *memoryRepository) UpdateConversationStatus(ctx context.Context, tenantID, conversationID string, update conversationservice.StatusUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return conversationservice.ErrNotFound
+	}
+	conversation.Status = update.Status
+	conversation.UpdatedAt = update.UpdatedAt
+	conversation.ClosedAt = update.ClosedAt
+	conversation.ClosedBy = update.ClosedBy
+	conversation.CloseReason = update.CloseReason
+	conversation.ArchivedAt = update.ArchivedAt
+	conversation.ArchivedBy = update.ArchivedBy
+	m.conversations[pk] = conversation
+	return nil
+}
+
+func (m *memoryRepository) UpdateConversationAssignment(ctx context.Context, tenantID, conversationID string, record model.AssignmentRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return conversationservice.ErrNotFound
+	}
+	if conversation.AssignedUserID != record.PreviousUserID {
+		return conversationservice.ErrAssignmentConflict
+	}
+	conversation.AssignedUserID = record.AssignedUserID
+	conversation.AssignmentHistory = append(conversation.AssignmentHistory, record)
+	conversation.UpdatedAt = record.AssignedAt
+	m.conversations[pk] = conversation
+	return nil
+}
+
+func (m *memoryRepository) UpdateReadMarker(ctx context.Context, tenantID, conversationID, participant string, marker model.ReadMarker) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return conversationservice.ErrNotFound
+	}
+	if conversation.ReadMarkers == nil {
+		return conversationservice.ErrReadMarkersMissing
+	}
+	if existing, ok := conversation.ReadMarkers[participant]; ok && existing.MessageCreatedAt > marker.MessageCreatedAt {
+		return conversationservice.ErrReadMarkerBehind
+	}
+	markers := make(map[string]model.ReadMarker, len(conversation.ReadMarkers)+1)
+	for key, value := range conversation.ReadMarkers {
+		markers[key] = value
+	}
+	markers[participant] = marker
+	conversation.ReadMarkers = markers
+	m.conversations[pk] = conversation
+	return nil
+}
+
 func (m *memoryRepository) GetConversation(ctx context.Context, tenantID, conversationID string) (model.ConversationItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -155,20 +286,31 @@ func (m *memoryRepository) GetConversation(ctx context.Context, tenantID, conver
 	return conv, nil
 }
 
-func (m *memoryRepository) ListConversations(ctx context.Context, tenantID string, limit int) ([]model.ConversationItem, error) {
+func (m *memoryRepository) ListConversations(ctx context.Context, tenantID string, filter conversationservice.ConversationFilter, query conversationservice.PageQuery) (conversationservice.ConversationPage, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	items := make([]model.ConversationItem, 0)
 	for _, conv := range m.conversations {
-		if conv.TenantID == tenantID {
+		if conv.TenantID == tenantID && filter.Matches(conv) {
 			items = append(items, conv)
 		}
 	}
 	sort.Slice(items, func(i, j int) bool { return items[i].LastMessageAt > items[j].LastMessageAt })
-	if limit > 0 && len(items) > limit {
-		items = items[:limit]
+	offset := 0
+	if query.Cursor != "" {
+		parsed, err := strconv.Atoi(query.Cursor)
+		if err != nil || parsed < 0 || parsed > len(items) {
+			return conversationservice.ConversationPage{}, conversationservice.ErrInvalidCursor
+		}
+		offset = parsed
 	}
-	return items, nil
+	items = items[offset:]
+	page := conversationservice.ConversationPage{Conversations: items}
+	if query.Limit > 0 && len(items) > query.Limit {
+		page.Conversations = items[:query.Limit]
+		page.NextCursor = strconv.Itoa(offset + query.Limit)
+	}
+	return page, nil
 }
 
 func (m *memoryRepository) CountConversationsStartedBetween(ctx context.Context, tenantID string, start, end time.Time) (int, error) {
@@ -190,6 +332,18 @@ func (m *memoryRepository) CountConversationsStartedBetween(ctx context.Context,
 	return count, nil
 }
 
+func (m *memoryRepository) CountOpenConversationsByAssignee(ctx context.Context, tenantID string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int)
+	for _, conversation := range m.conversations {
+		if conversation.TenantID == tenantID && conversation.Status == model.ConversationStatusOpen && conversation.AssignedUserID != "" {
+			counts[conversation.AssignedUserID]++
+		}
+	}
+	return counts, nil
+}
+
 func (m *memoryRepository) CreateMessage(ctx context.Context, message model.MessageItem) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -197,7 +351,65 @@ func (m *memoryRepository) CreateMessage(ctx context.Context, message model.Mess
 	return nil
 }
 
-func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversationID string, limit int) ([]model.MessageItem, error) {
+func (m *memoryRepository) GetMessage(ctx context.Context, tenantID, conversationID, messageID string) (model.MessageItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range m.messages[conversationID] {
+		if msg.MessageID == messageID && msg.TenantID == tenantID {
+			return msg, nil
+		}
+	}
+	return model.MessageItem{}, conversationservice.ErrNotFound
+}
+
+func (m *memoryRepository) UpdateMessageCounters(ctx context.Context, message model.MessageItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.messages[message.ConversationID] {
+		if msg.MessageID == message.MessageID {
+			m.messages[message.ConversationID][i].VisitorCount = message.VisitorCount
+			m.messages[message.ConversationID][i].AgentCount = message.AgentCount
+			return nil
+		}
+	}
+	return conversationservice.ErrNotFound
+}
+
+func (m *memoryRepository) ReviseMessage(ctx context.Context, message model.MessageItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.messages[message.ConversationID] {
+		if msg.MessageID == message.MessageID {
+			if msg.DeletedAt != "" || len(msg.Revisions) != len(message.Revisions)-1 {
+				return conversationservice.ErrMessageChanged
+			}
+			m.messages[message.ConversationID][i] = message
+			return nil
+		}
+	}
+	return conversationservice.ErrNotFound
+}
+
+func (m *memoryRepository) InitializeReadMarkers(ctx context.Context, conversation model.ConversationItem, seenVisitorCount, seenAgentCount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.conversations[conversation.PK]
+	if !ok {
+		return conversationservice.ErrNotFound
+	}
+	if stored.ReadMarkers != nil || stored.VisitorMessageCount != seenVisitorCount || stored.AgentMessageCount != seenAgentCount {
+		return conversationservice.ErrReadCountersChanged
+	}
+	stored.VisitorMessageCount = conversation.VisitorMessageCount
+	stored.AgentMessageCount = conversation.AgentMessageCount
+	stored.ReadMarkers = conversation.ReadMarkers
+	m.conversations[conversation.PK] = stored
+	return nil
+}
+
+// ListMessages mirrors the Dynamo paging semantics using "direction:index"
+// cursors over the chronologically sorted messages.
+func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversationID string, query conversationservice.MessageQuery) (conversationservice.MessagePage, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	items := make([]model.MessageItem, 0)
@@ -206,15 +418,111 @@ func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversat
 			items = append(items, msg)
 		}
 	}
-	sort.Slice(items, func(i, j int) bool {
-		ti, _ := time.Parse(time.RFC3339, items[i].CreatedAt)
-		tj, _ := time.Parse(time.RFC3339, items[j].CreatedAt)
-		return ti.Before(tj)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt < items[j].CreatedAt })
+
+	direction := query.Direction
+	boundary := -1
+	if query.Cursor != "" {
+		parts := strings.SplitN(query.Cursor, ":", 2)
+		index, err := strconv.Atoi(parts[len(parts)-1])
+		if len(parts) != 2 || err != nil || index < 0 || index > len(items) {
+			return conversationservice.MessagePage{}, conversationservice.ErrInvalidCursor
+		}
+		direction = conversationservice.MessageDirection(parts[0])
+		boundary = index
+	} else if query.Anchor != nil {
+		for i, msg := range items {
+			if msg.MessageID == query.Anchor.MessageID {
+				boundary = i
+				if direction == conversationservice.MessageDirectionAfter {
+					boundary = i + 1
+				}
+			}
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = len(items)
+	}
+	page := conversationservice.MessagePage{}
+	if direction == conversationservice.MessageDirectionAfter {
+		start := boundary
+		if start < 0 {
+			start = 0
+		}
+		end := start + limit
+		if end < len(items) {
+			page.NextCursor = fmt.Sprintf("after:%d", end)
+		} else {
+			end = len(items)
+		}
+		page.Messages = items[start:end]
+		return page, nil
+	}
+	end := boundary
+	if end < 0 {
+		end = len(items)
+	}
+	start := end - limit
+	if start > 0 {
+		page.NextCursor = fmt.Sprintf("before:%d", start)
+	} else {
+		start = 0
+	}
+	page.Messages = items[start:end]
+	return page, nil
+}
+
+func (m *memoryRepository) ScanMessages(ctx context.Context, visit func(model.MessageItem) error) error {
+	m.mu.Lock()
+	var all []model.MessageItem
+	for _, items := range m.messages {
+		all = append(all, items...)
+	}
+	m.mu.Unlock()
+	for _, msg := range all {
+		if err := visit(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ScanMessagesSince(ctx context.Context, since string, visit func(model.MessageItem) error) error {
+	return m.ScanMessages(ctx, func(message model.MessageItem) error {
+		if message.CreatedAt <= since {
+			return nil
+		}
+		return visit(message)
 	})
-	if limit > 0 && len(items) > limit {
-		items = items[len(items)-limit:]
+}
+
+func (m *memoryRepository) ScanConversations(ctx context.Context, visit func(model.ConversationItem) error) error {
+	m.mu.Lock()
+	all := make([]model.ConversationItem, 0, len(m.conversations))
+	for _, conversation := range m.conversations {
+		all = append(all, conversation)
+	}
+	m.mu.Unlock()
+	for _, conversation := range all {
+		if err := visit(conversation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) UpdateConversationIndexKeys(ctx context.Context, conversation model.ConversationItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.conversations[conversation.PK]
+	if !ok {
+		return conversationservice.ErrNotFound
 	}
-	return items, nil
+	stored.SetIndexKeys()
+	m.conversations[conversation.PK] = stored
+	return nil
 }
 
 func setupConversationTestHandler(t *testing.T) (http.Handler, *conversationservice.Service, *memoryRepository) {
@@ -232,21 +540,34 @@ func setupConversationTestHandler(t *testing.T) (http.Handler, *conversationserv
 		internaljwt.RoleSecrets[internaljwt.RoleUser] = originalSecret
 	})
 
+	broker := websocket.NewMemoryBroker()
 	hub := websocket.NewHub()
+	handler := websocket.NewHandler(hub, broker)
 	go hub.Run()
-	handler := websocket.NewHandler(hub)
+	go handler.RelayRoomEvents()
 
 	queueManager := queue.NewRequestQueueManager(10, 1)
-	server := api.NewAPIServer(":0", queueManager, nil, handler)
+	server := api.NewAPIServerWithRegistry(":0", queueManager, nil, handler, prometheus.NewRegistry())
 
-	endpoints := NewConversationEndpoints(svc, handler, "/api")
+	endpoints := NewConversationEndpoints(svc, handler, broker, "/api")
+	handler.SetMessageSender(NewMessageSender(svc, handler, broker))
+	handler.SetConversationAuthorizer(NewConversationAuthorizer(svc))
+	ticketEndpoints := NewTicketEndpoints(svc, websocket.NewTickets(broker))
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/public/conversations", server.MakeHTTPHandleFunc(endpoints.PublicConversations))
 	mux.HandleFunc("/api/public/conversations/", server.MakeHTTPHandleFunc(endpoints.PublicConversationMessages))
 	mux.HandleFunc("/api/conversations", server.MakeHTTPHandleFunc(endpoints.Conversations, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/conversations/usage", server.MakeHTTPHandleFunc(endpoints.ConversationUsage, middleware.ValidateUserJWT))
+	mux.HandleFunc("/api/conversations/search", server.MakeHTTPHandleFunc(endpoints.ConversationSearch, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/conversations/", server.MakeHTTPHandleFunc(endpoints.ConversationMessages, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/ws/conversations/", server.MakeHTTPHandleFunc(endpoints.Websocket))
+	mux.HandleFunc("/api/ws/agent", server.MakeHTTPHandleFunc(endpoints.AgentWebsocket))
+	mux.HandleFunc("/api/sse/conversations/", server.MakeStreamHandleFunc(endpoints.ConversationStream))
+	mux.HandleFunc("/api/sse/notifications", server.MakeStreamHandleFunc(endpoints.NotificationsStream))
+	mux.HandleFunc("/api/poll/conversations/", server.MakeStreamHandleFunc(endpoints.ConversationPoll))
+	mux.HandleFunc("/api/poll/notifications", server.MakeStreamHandleFunc(endpoints.NotificationsPoll))
+	mux.HandleFunc("/api/public/ws-tickets", server.MakeHTTPHandleFunc(ticketEndpoints.PublicTickets))
+	mux.HandleFunc("/api/ws-tickets", server.MakeHTTPHandleFunc(ticketEndpoints.TenantTickets, middleware.ValidateUserJWT))
 
 	t.Cleanup(queueManager.Shutdown)
 
@@ -577,3 +898,826 @@ func TestAgentCannotPostToForeignConversation(t *testing.T) {
 
 	_ = svc // ensure svc referenced for coverage
 }
+
+func TestCloseConversationEndpoint(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-close"
+	userID := "user-close"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["close-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+		Email:    "agent@example.com",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "close-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	body, _ := json.Marshal(dto.CloseConversationRequest{Reason: "Resolved"})
+	req := httptest.NewRequest(http.MethodPost, "/api/conversations/"+result.Conversation.ConversationID+"/close", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp dto.ConversationResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Conversation.Status != string(model.ConversationStatusClosed) {
+		t.Fatalf("expected closed status, got %s", resp.Conversation.Status)
+	}
+	if resp.Conversation.CloseReason != "Resolved" || resp.Conversation.ClosedBy != userID {
+		t.Fatalf("unexpected close details %+v", resp.Conversation)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/conversations/"+result.Conversation.ConversationID+"/close", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 when closing twice, got %d", rec.Code)
+	}
+}
+
+func TestAssignConversationEndpoint(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-assign"
+	userID := "user-owner"
+	assigneeID := "user-assignee"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["assign-key"] = tenantID
+	for _, id := range []string{userID, assigneeID} {
+		repo.users[model.TenantScopedPK(tenantID, id)] = model.UserItem{
+			PK:       model.TenantScopedPK(tenantID, id),
+			TenantID: tenantID,
+			UserID:   id,
+			Status:   "active",
+		}
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "assign-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "owner@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	path := "/api/conversations/" + result.Conversation.ConversationID + "/assignment"
+	body, _ := json.Marshal(dto.AssignConversationRequest{UserID: assigneeID})
+	req := httptest.NewRequest(http.MethodPut, path, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+
+	var resp dto.ConversationAssignmentResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Conversation.AssignedUserID != assigneeID {
+		t.Fatalf("expected assignee %s, got %s", assigneeID, resp.Conversation.AssignedUserID)
+	}
+	if resp.Assignment.AssignedBy != userID {
+		t.Fatalf("expected assignment by %s, got %s", userID, resp.Assignment.AssignedBy)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, path, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 on unassign, got %d", rec.Code)
+	}
+
+	stored := repo.conversations[model.ConversationPK(tenantID, result.Conversation.ConversationID)]
+	if stored.AssignedUserID != "" {
+		t.Fatalf("expected assignment to be cleared, got %s", stored.AssignedUserID)
+	}
+	if len(stored.AssignmentHistory) != 2 {
+		t.Fatalf("expected 2 history entries, got %d", len(stored.AssignmentHistory))
+	}
+}
+
+func TestAssignmentNotificationRooms(t *testing.T) {
+	rooms := assignmentNotificationRooms("tenant-1", model.AssignmentRecord{AssignedUserID: "agent-1"})
+	if len(rooms) != 2 || rooms[0] != "tenant:tenant-1:notifications" || rooms[1] != "tenant:tenant-1:user:agent-1:notifications" {
+		t.Fatalf("unexpected assignment rooms %v", rooms)
+	}
+
+	rooms = assignmentNotificationRooms("tenant-1", model.AssignmentRecord{PreviousUserID: "agent-1"})
+	if len(rooms) != 1 || rooms[0] != "tenant:tenant-1:notifications" {
+		t.Fatalf("expected unassignment to reach the tenant room only, got %v", rooms)
+	}
+}
+
+func TestSearchMessagesEndpoint(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	svc.SetSearchIndex(search.NewIndex())
+	tenantID := "tenant-search"
+	userID := "user-search"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["search-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "search-key",
+		Message:      "I need a refund for <order> 42",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/conversations/search?q=Refund+order", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var resp dto.SearchMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(resp.Hits))
+	}
+	hit := resp.Hits[0]
+	if hit.Conversation.ConversationID != result.Conversation.ConversationID {
+		t.Fatalf("expected conversation %s, got %s", result.Conversation.ConversationID, hit.Conversation.ConversationID)
+	}
+	if hit.Snippet != "I need a <mark>refund</mark> for &lt;<mark>order</mark>&gt; 42" {
+		t.Fatalf("unexpected snippet %q", hit.Snippet)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/conversations/search", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for missing query, got %d", rec.Code)
+	}
+}
+
+func TestMarkReadEndpoints(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-read"
+	userID := "user-read"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["read-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+		Email:    "agent@example.com",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "read-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/conversations", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var list dto.ListConversationsResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	if len(list.Conversations) != 1 || list.Conversations[0].UnreadCount == nil || *list.Conversations[0].UnreadCount != 1 {
+		t.Fatalf("expected one conversation with 1 unread message, got %+v", list.Conversations)
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/conversations/"+conversationID+"/read", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var receipt dto.ReadReceiptResponse
+	if err := json.NewDecoder(rec.Body).Decode(&receipt); err != nil {
+		t.Fatalf("decode receipt: %v", err)
+	}
+	if receipt.ReaderType != model.MessageSenderAgent || receipt.ReaderID != userID {
+		t.Fatalf("unexpected reader %+v", receipt)
+	}
+	if receipt.LastReadMessageID != result.Message.MessageID || receipt.UnreadCount != 0 {
+		t.Fatalf("expected marker on first message with nothing unread, got %+v", receipt)
+	}
+
+	if _, err := svc.PostAgentMessage(context.Background(), conversationservice.Identity{UserID: userID, TenantID: tenantID}, conversationID, "Hi there"); err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+
+	body, _ := json.Marshal(dto.MarkReadRequest{})
+	req = httptest.NewRequest(http.MethodPost, "/api/public/conversations/"+conversationID+"/read", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for visitor receipt, got %d", rec.Code)
+	}
+	receipt = dto.ReadReceiptResponse{}
+	if err := json.NewDecoder(rec.Body).Decode(&receipt); err != nil {
+		t.Fatalf("decode visitor receipt: %v", err)
+	}
+	if receipt.ReaderType != model.MessageSenderVisitor || receipt.UnreadCount != 0 {
+		t.Fatalf("unexpected visitor receipt %+v", receipt)
+	}
+}
+
+func TestEditAndDeleteMessageEndpoints(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-edit"
+	userID := "user-edit"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["edit-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+		Email:    "owner@example.com",
+		Role:     "owner",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "edit-key",
+		Message:      "Helo",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+	posted, err := svc.PostAgentMessage(context.Background(), conversationservice.Identity{UserID: userID, TenantID: tenantID}, conversationID, "Wrong chat")
+	if err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "owner@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	body, _ := json.Marshal(dto.EditMessageRequest{Body: "Hello"})
+	req := httptest.NewRequest(http.MethodPatch, "/api/public/conversations/"+conversationID+"/messages/"+result.Message.MessageID, bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the visitor edit, got %d", rec.Code)
+	}
+	var edited dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&edited); err != nil {
+		t.Fatalf("decode edited message: %v", err)
+	}
+	if edited.Body != "Hello" || edited.EditedAt == "" {
+		t.Fatalf("unexpected edited message %+v", edited)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/public/conversations/"+conversationID+"/messages/"+posted.Message.MessageID, nil)
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected the visitor to be refused deleting an agent message, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/conversations/"+conversationID+"/messages/"+posted.Message.MessageID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the agent delete, got %d", rec.Code)
+	}
+	var deleted dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&deleted); err != nil {
+		t.Fatalf("decode deleted message: %v", err)
+	}
+	if deleted.Body != "" || deleted.DeletedAt == "" {
+		t.Fatalf("expected a tombstone, got %+v", deleted)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/conversations/"+conversationID+"/messages/"+posted.Message.MessageID+"/revisions", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the history, got %d", rec.Code)
+	}
+	var history dto.MessageHistoryResponse
+	if err := json.NewDecoder(rec.Body).Decode(&history); err != nil {
+		t.Fatalf("decode history: %v", err)
+	}
+	if len(history.Revisions) != 1 || history.Revisions[0].Body != "Wrong chat" || history.Revisions[0].Action != model.MessageRevisionDeleted {
+		t.Fatalf("unexpected history %+v", history)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/poll/conversations/"+conversationID+"?lastSeq=0&role=visitor&token="+result.VisitorToken, nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var polled pollResult
+	if err := json.NewDecoder(rec.Body).Decode(&polled); err != nil {
+		t.Fatalf("decode poll: %v", err)
+	}
+	var types []string
+	for _, event := range polled.Events {
+		types = append(types, event.Type)
+	}
+	if len(types) < 2 || types[len(types)-2] != websocket.EventMessageUpdated || types[len(types)-1] != websocket.EventMessageDeleted {
+		t.Fatalf("expected message.updated and message.deleted in the room, got %v", types)
+	}
+}
+
+func TestAttachmentUploadAndDownloadEndpoints(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	blobs, err := storage.NewLocalStore(t.TempDir(), "http://example.com/api/attachments", []byte("blob-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore error: %v", err)
+	}
+	svc.SetBlobStore(blobs)
+	mux := http.NewServeMux()
+	mux.Handle("/", handler)
+	mux.HandleFunc("/api/attachments/", func(w http.ResponseWriter, r *http.Request) {
+		if err := NewAttachmentEndpoints(blobs, "/api/attachments").Download(w, r); err != nil {
+			httpErr := err.(*HTTPError)
+			http.Error(w, httpErr.Message, httpErr.StatusCode)
+		}
+	})
+
+	tenantID := "tenant-files"
+	userID := "user-files"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["files-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+		Email:    "agent@example.com",
+		Role:     "member",
+	}
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "files-key",
+		Message:      "Checkout fails",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	upload := func(path, fileName string, content []byte, fields map[string]string) *http.Request {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, value := range fields {
+			form.WriteField(name, value)
+		}
+		part, _ := form.CreateFormFile("file", fileName)
+		part.Write(content)
+		form.Close()
+		req := httptest.NewRequest(http.MethodPost, path, &body)
+		req.Header.Set("Content-Type", form.FormDataContentType())
+		return req
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 64)...)
+
+	req := upload("/api/public/conversations/"+conversationID+"/attachments", "error.png", png, map[string]string{
+		"body":         "This is what I see",
+		"visitorToken": result.VisitorToken,
+	})
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for the visitor upload, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var posted dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&posted); err != nil {
+		t.Fatalf("decode posted message: %v", err)
+	}
+	if posted.Body != "This is what I see" || len(posted.Attachments) != 1 || posted.Attachments[0].ContentType != "image/png" {
+		t.Fatalf("unexpected posted message %+v", posted)
+	}
+
+	req = upload("/api/conversations/"+conversationID+"/attachments", "script.html", []byte("<html><script>alert(1)</script></html>"), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected the agent upload of a disallowed type to fail, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/public/conversations/"+conversationID+"/messages", nil)
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	var list dto.ListMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode messages: %v", err)
+	}
+	if len(list.Messages) != 2 || len(list.Messages[1].Attachments) != 1 {
+		t.Fatalf("expected the listed message to carry the attachment, got %+v", list.Messages)
+	}
+	attachment := list.Messages[1].Attachments[0]
+	if attachment.AttachmentID != posted.Attachments[0].AttachmentID || attachment.FileName != "error.png" || attachment.Size != int64(len(png)) {
+		t.Fatalf("unexpected listed attachment %+v", attachment)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, attachment.URL, nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the download, got %d", rec.Code)
+	}
+	if downloaded, _ := io.ReadAll(rec.Body); !bytes.Equal(downloaded, png) {
+		t.Fatalf("unexpected download %q", downloaded)
+	}
+	if rec.Header().Get("Content-Type") != "image/png" || rec.Header().Get("X-Content-Type-Options") != "nosniff" || !strings.Contains(rec.Header().Get("Content-Disposition"), "error.png") {
+		t.Fatalf("unexpected download headers %v", rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, strings.Replace(attachment.URL, "image%2Fpng", "text%2Fhtml", 1), nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected a tampered download URL to be refused, got %d", rec.Code)
+	}
+}
+
+func TestStructuredMessageEndpoints(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-rich"
+	userID := "user-rich"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["rich-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+		Name:     "Anna",
+		Email:    "anna@example.com",
+		Role:     "owner",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "rich-key",
+		Message:      "Can I book a demo?",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: "anna@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	body, _ := json.Marshal(dto.PostAgentMessageRequest{
+		Type: model.MessageTypeForm,
+		Body: "When suits you?",
+		Content: &dto.MessageContent{Form: &dto.MessageForm{Fields: []dto.FormField{
+			{Name: "email", Label: "Email", Type: model.FormFieldEmail, Required: true},
+			{Name: "slot", Label: "Slot", Type: model.FormFieldSelect, Options: []string{"Morning", "Afternoon"}},
+		}}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for the form, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var form dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&form); err != nil {
+		t.Fatalf("decode form: %v", err)
+	}
+	if form.Type != model.MessageTypeForm || form.Content == nil || form.Content.Form == nil || len(form.Content.Form.Fields) != 2 {
+		t.Fatalf("unexpected form message %+v", form)
+	}
+
+	postVisitor := func(req dto.PostVisitorMessageRequest) *httptest.ResponseRecorder {
+		req.VisitorToken = result.VisitorToken
+		body, _ := json.Marshal(req)
+		r := httptest.NewRequest(http.MethodPost, "/api/public/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("X-Tenant-Key", "rich-key")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec = postVisitor(dto.PostVisitorMessageRequest{
+		Type:    model.MessageTypeFormResponse,
+		Content: &dto.MessageContent{FormResponse: &dto.FormResponse{FormMessageID: form.MessageID, Values: map[string]string{"slot": "Evening"}}},
+	})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an invalid form response, got %d", rec.Code)
+	}
+	rec = postVisitor(dto.PostVisitorMessageRequest{
+		Type:    model.MessageTypeFormResponse,
+		Content: &dto.MessageContent{FormResponse: &dto.FormResponse{FormMessageID: form.MessageID, Values: map[string]string{"email": "me@example.com", "slot": "Morning"}}},
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for the form response, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	req = httptest.NewRequest(http.MethodPost, "/api/conversations/"+conversationID+"/close", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200 for the close, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/public/conversations/"+conversationID+"/messages", nil)
+	req.Header.Set("X-Tenant-Key", "rich-key")
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var list dto.ListMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode messages: %v", err)
+	}
+	if len(list.Messages) != 4 {
+		t.Fatalf("expected 4 messages, got %+v", list.Messages)
+	}
+	if first := list.Messages[0]; first.Type != model.MessageTypeText || first.Content != nil {
+		t.Fatalf("expected the plain message to read as text, got %+v", first)
+	}
+	response := list.Messages[2]
+	if response.Type != model.MessageTypeFormResponse || response.Body != "Email: me@example.com\nSlot: Morning" || response.Content.FormResponse.FormMessageID != form.MessageID {
+		t.Fatalf("unexpected form response %+v", response)
+	}
+	closed := list.Messages[3]
+	if closed.SenderType != model.MessageSenderSystem || closed.Body != "Anna closed the conversation" || closed.Content.Event.Kind != model.SystemEventConversationClosed {
+		t.Fatalf("expected a system message for the close, got %+v", closed)
+	}
+}
+
+func TestInternalNotesStayWithTenant(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-notes"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["notes-key"] = tenantID
+	for userID, user := range map[string]model.UserItem{
+		"user-author": {Name: "Anna", Email: "anna@example.com"},
+		"user-ben":    {Name: "Ben Smith", Email: "ben@example.com"},
+	} {
+		user.PK = model.TenantScopedPK(tenantID, userID)
+		user.TenantID = tenantID
+		user.UserID = userID
+		user.Role = "member"
+		repo.users[user.PK] = user
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "notes-key",
+		Message:      "My invoice is wrong",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	tokenFor := func(userID, email string) string {
+		token, err := internaljwt.CreateToken(internaljwt.User{Id: userID, TenantID: tenantID, Email: email}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		return token
+	}
+	author := tokenFor("user-author", "anna@example.com")
+
+	body, _ := json.Marshal(dto.PostAgentMessageRequest{Type: model.MessageTypeNote, Body: "VIP customer, @BenSmith please check the refund"})
+	req := httptest.NewRequest(http.MethodPost, "/api/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+author)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for the note, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var note dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&note); err != nil {
+		t.Fatalf("decode note: %v", err)
+	}
+	if note.Type != model.MessageTypeNote || len(note.Mentions) != 1 || note.Mentions[0] != "user-ben" {
+		t.Fatalf("unexpected note %+v", note)
+	}
+
+	body, _ = json.Marshal(dto.PostVisitorMessageRequest{VisitorToken: result.VisitorToken, Body: "Any news?"})
+	req = httptest.NewRequest(http.MethodPost, "/api/public/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Tenant-Key", "notes-key")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 for the visitor message, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/public/conversations/"+conversationID+"/messages", nil)
+	req.Header.Set("X-Tenant-Key", "notes-key")
+	req.Header.Set("X-Visitor-Token", result.VisitorToken)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var visitorList dto.ListMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&visitorList); err != nil {
+		t.Fatalf("decode visitor messages: %v", err)
+	}
+	if len(visitorList.Messages) != 2 {
+		t.Fatalf("expected the visitor to see only their 2 messages, got %+v", visitorList.Messages)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/conversations/"+conversationID+"/messages", nil)
+	req.Header.Set("Authorization", "Bearer "+author)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var agentList dto.ListMessagesResponse
+	if err := json.NewDecoder(rec.Body).Decode(&agentList); err != nil {
+		t.Fatalf("decode agent messages: %v", err)
+	}
+	if len(agentList.Messages) != 3 || agentList.Messages[1].MessageID != note.MessageID {
+		t.Fatalf("expected agents to see the note, got %+v", agentList.Messages)
+	}
+
+	poll := func(url string) []websocket.Event {
+		req := httptest.NewRequest(http.MethodGet, url, nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var polled pollResult
+		if err := json.NewDecoder(rec.Body).Decode(&polled); err != nil {
+			t.Fatalf("decode poll of %s: %v", url, err)
+		}
+		return polled.Events
+	}
+	hasNote := func(events []websocket.Event, eventType string) bool {
+		for _, event := range events {
+			var payload websocket.MessageEvent
+			if event.Type == eventType && event.DecodePayload(&payload) == nil && payload.Message.MessageID == note.MessageID {
+				return true
+			}
+		}
+		return false
+	}
+
+	visitorEvents := poll("/api/poll/conversations/" + conversationID + "?lastSeq=0&role=visitor&token=" + result.VisitorToken)
+	if len(visitorEvents) == 0 || hasNote(visitorEvents, websocket.EventMessageCreated) {
+		t.Fatalf("expected the conversation room to carry the visitor message but not the note, got %+v", visitorEvents)
+	}
+	if !hasNote(poll("/api/poll/notifications?lastSeq=0&token="+author), websocket.EventMessageCreated) {
+		t.Fatal("expected the note in the tenant room")
+	}
+	if !hasNote(poll("/api/poll/notifications?lastSeq=0&scope=user&token="+tokenFor("user-ben", "ben@example.com")), websocket.EventNoteMentioned) {
+		t.Fatal("expected a mention notification in the personal room of the mentioned user")
+	}
+}
+
+func TestPostCannedResponseEndpoint(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	tenantID := "tenant-canned"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["canned-key"] = tenantID
+	agent := model.UserItem{PK: model.TenantScopedPK(tenantID, "user-ana"), TenantID: tenantID, UserID: "user-ana", Name: "Ana", Role: "member"}
+	repo.users[agent.PK] = agent
+	repo.canned["welcome"] = model.CannedResponseItem{
+		TenantID:   tenantID,
+		ResponseID: "welcome",
+		Title:      "Welcome",
+		Body:       "Hi {{visitor.name|there}}, {{agent.name}} here.",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "canned-key",
+		Message:      "Hello?",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: agent.UserID, TenantID: tenantID, Email: "ana@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	post := func(responseID string) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(dto.PostAgentMessageRequest{Body: "ignored", CannedResponseID: responseID})
+		req := httptest.NewRequest(http.MethodPost, "/api/conversations/"+conversationID+"/messages", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := post("missing"); rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 for an unknown canned response, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := post("welcome")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var message dto.MessageResponse
+	if err := json.NewDecoder(rec.Body).Decode(&message); err != nil {
+		t.Fatalf("decode message: %v", err)
+	}
+	if message.Body != "Hi there, Ana here." {
+		t.Fatalf("expected the rendered canned response, got %q", message.Body)
+	}
+
+	repo.mu.Lock()
+	used := repo.canned["welcome"]
+	repo.mu.Unlock()
+	if used.UsageCount != 1 || used.LastUsedAt == "" {
+		t.Fatalf("expected one recorded use, got %+v", used)
+	}
+}
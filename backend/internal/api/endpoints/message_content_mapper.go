@@ -0,0 +1,100 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/dto"
+	"chat-app-backend/internal/model"
+	conversationservice "chat-app-backend/internal/service/conversation"
+)
+
+// messageType reports the type of item, which is text for messages stored
+// before types existed.
+func messageType(item model.MessageItem) string {
+	if item.Type == "" {
+		return model.MessageTypeText
+	}
+	return item.Type
+}
+
+func toMessageContent(content *model.MessageContent) *dto.MessageContent {
+	if content == nil {
+		return nil
+	}
+	resp := &dto.MessageContent{Text: content.Text}
+	for _, reply := range content.QuickReplies {
+		resp.QuickReplies = append(resp.QuickReplies, dto.QuickReply{Label: reply.Label, Value: reply.Value})
+	}
+	if card := content.Card; card != nil {
+		resp.Card = &dto.MessageCard{
+			Title:       card.Title,
+			Description: card.Description,
+			URL:         card.URL,
+			ImageURL:    card.ImageURL,
+		}
+	}
+	if form := content.Form; form != nil {
+		resp.Form = &dto.MessageForm{SubmitLabel: form.SubmitLabel}
+		for _, field := range form.Fields {
+			resp.Form.Fields = append(resp.Form.Fields, dto.FormField{
+				Name:     field.Name,
+				Label:    field.Label,
+				Type:     field.Type,
+				Required: field.Required,
+				Options:  field.Options,
+			})
+		}
+	}
+	if response := content.FormResponse; response != nil {
+		resp.FormResponse = &dto.FormResponse{
+			FormMessageID: response.FormMessageID,
+			Values:        cloneMetadata(response.Values),
+		}
+	}
+	if event := content.Event; event != nil {
+		resp.Event = &dto.SystemEvent{
+			Kind:      event.Kind,
+			ActorID:   event.ActorID,
+			ActorName: event.ActorName,
+		}
+	}
+	return resp
+}
+
+// toMessageInput reads the message of a post request. System events cannot be
+// posted, so their content is ignored.
+func toMessageInput(messageType, body string, content *dto.MessageContent) conversationservice.MessageInput {
+	input := conversationservice.MessageInput{Type: messageType, Body: body}
+	if content == nil {
+		return input
+	}
+	input.Content.Text = content.Text
+	for _, reply := range content.QuickReplies {
+		input.Content.QuickReplies = append(input.Content.QuickReplies, model.QuickReply{Label: reply.Label, Value: reply.Value})
+	}
+	if card := content.Card; card != nil {
+		input.Content.Card = &model.MessageCard{
+			Title:       card.Title,
+			Description: card.Description,
+			URL:         card.URL,
+			ImageURL:    card.ImageURL,
+		}
+	}
+	if form := content.Form; form != nil {
+		input.Content.Form = &model.MessageForm{SubmitLabel: form.SubmitLabel}
+		for _, field := range form.Fields {
+			input.Content.Form.Fields = append(input.Content.Form.Fields, model.FormField{
+				Name:     field.Name,
+				Label:    field.Label,
+				Type:     field.Type,
+				Required: field.Required,
+				Options:  field.Options,
+			})
+		}
+	}
+	if response := content.FormResponse; response != nil {
+		input.Content.FormResponse = &model.FormResponse{
+			FormMessageID: response.FormMessageID,
+			Values:        response.Values,
+		}
+	}
+	return input
+}
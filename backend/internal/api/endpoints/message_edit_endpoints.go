@@ -0,0 +1,219 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/api"
+	"chat-app-backend/internal/dto"
+	"chat-app-backend/internal/model"
+	"chat-app-backend/internal/websocket"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// publicMessageItem dispatches /public/conversations/{id}/messages/{messageId}.
+func (h *conversationEndpoints) publicMessageItem(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodPatch:  h.handleEditVisitorMessage,
+		http.MethodDelete: h.handleDeleteVisitorMessage,
+	})
+}
+
+// tenantMessageItem dispatches /conversations/{id}/messages/{messageId}.
+func (h *conversationEndpoints) tenantMessageItem(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodPatch:  h.handleEditAgentMessage,
+		http.MethodDelete: h.handleDeleteAgentMessage,
+	})
+}
+
+func (h *conversationEndpoints) handleEditVisitorMessage(w http.ResponseWriter, r *http.Request) error {
+	conversationID, messageID, err := h.extractMessagePath(r.URL.Path, h.paths.PublicConversationMessagesPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	var req dto.EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode edit message request: %w", err),
+		}
+	}
+	req.VisitorToken = strings.TrimSpace(req.VisitorToken)
+	if req.VisitorToken == "" {
+		req.VisitorToken = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
+	}
+
+	result, err := h.service.EditVisitorMessage(r.Context(), req.VisitorToken, conversationID, messageID, req.Body)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastMessageRevision(result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusOK, toMessageResponse(result.Message))
+}
+
+func (h *conversationEndpoints) handleDeleteVisitorMessage(w http.ResponseWriter, r *http.Request) error {
+	conversationID, messageID, err := h.extractMessagePath(r.URL.Path, h.paths.PublicConversationMessagesPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	var req dto.DeleteMessageRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return &HTTPError{
+				StatusCode: http.StatusBadRequest,
+				Message:    "Invalid request payload",
+				ErrorLog:   fmt.Errorf("decode delete message request: %w", err),
+			}
+		}
+	}
+	req.VisitorToken = strings.TrimSpace(req.VisitorToken)
+	if req.VisitorToken == "" {
+		req.VisitorToken = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
+	}
+
+	result, err := h.service.DeleteVisitorMessage(r.Context(), req.VisitorToken, conversationID, messageID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastMessageRevision(result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusOK, toMessageResponse(result.Message))
+}
+
+func (h *conversationEndpoints) handleEditAgentMessage(w http.ResponseWriter, r *http.Request) error {
+	conversationID, messageID, err := h.extractMessagePath(r.URL.Path, h.paths.TenantConversationPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	var req dto.EditMessageRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode edit message request: %w", err),
+		}
+	}
+
+	result, err := h.service.EditAgentMessage(r.Context(), identity, conversationID, messageID, req.Body)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastMessageRevision(result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusOK, toMessageResponse(result.Message))
+}
+
+func (h *conversationEndpoints) handleDeleteAgentMessage(w http.ResponseWriter, r *http.Request) error {
+	conversationID, messageID, err := h.extractMessagePath(r.URL.Path, h.paths.TenantConversationPrefix, "")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	result, err := h.service.DeleteAgentMessage(r.Context(), identity, conversationID, messageID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	h.broadcastMessageRevision(result.Conversation, result.Message)
+
+	return api.WriteJSON(w, http.StatusOK, toMessageResponse(result.Message))
+}
+
+func (h *conversationEndpoints) handleMessageHistory(w http.ResponseWriter, r *http.Request) error {
+	conversationID, messageID, err := h.extractMessagePath(r.URL.Path, h.paths.TenantConversationPrefix, "revisions")
+	if err != nil {
+		return err
+	}
+
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	message, err := h.service.GetMessageHistory(r.Context(), identity, conversationID, messageID)
+	if err != nil {
+		return h.serviceError(err)
+	}
+
+	resp := dto.MessageHistoryResponse{
+		Message:   toMessageResponse(message),
+		Revisions: make([]dto.MessageRevisionResponse, 0, len(message.Revisions)),
+	}
+	for _, revision := range message.Revisions {
+		resp.Revisions = append(resp.Revisions, dto.MessageRevisionResponse{
+			Body:        revision.Body,
+			CreatedAt:   revision.CreatedAt,
+			ReplacedAt:  revision.ReplacedAt,
+			ReplacedBy:  revision.ReplacedBy,
+			Action:      revision.Action,
+			Attachments: toAttachmentResponses(revision.Attachments),
+		})
+	}
+
+	return api.WriteJSON(w, http.StatusOK, resp)
+}
+
+// broadcastMessageRevision announces an edited or deleted message.
+func (h *conversationEndpoints) broadcastMessageRevision(conversation model.ConversationItem, message model.MessageItem) {
+	eventType := websocket.EventMessageUpdated
+	if message.DeletedAt != "" {
+		eventType = websocket.EventMessageDeleted
+	}
+	if !message.VisibleToVisitor() {
+		h.broadcastNote(eventType, conversation, message)
+		return
+	}
+	h.broadcastEvent(eventType, conversation, message)
+}
+
+// extractMessagePath returns the conversation and message IDs of a path below
+// prefix of the form {conversationId}/messages/{messageId}, followed by
+// /{action} when action is set.
+func (h *conversationEndpoints) extractMessagePath(path, prefix, action string) (string, string, error) {
+	conversationID, messageID, ok := messagePathIDs(path, prefix, action)
+	if !ok {
+		return "", "", &HTTPError{StatusCode: http.StatusNotFound, Message: "Message not found", ErrorLog: fmt.Errorf("invalid message path: %s", path)}
+	}
+	return conversationID, messageID, nil
+}
+
+func messagePathIDs(path, prefix, action string) (string, string, bool) {
+	if prefix == "" {
+		return "", "", false
+	}
+	trimmed := strings.TrimPrefix(path, prefix)
+	if trimmed == path {
+		return "", "", false
+	}
+	parts := strings.Split(strings.Trim(trimmed, "/"), "/")
+	want := 3
+	if action != "" {
+		want = 4
+	}
+	if len(parts) != want || parts[0] == "" || parts[1] != "messages" || parts[2] == "" {
+		return "", "", false
+	}
+	if action != "" && parts[3] != action {
+		return "", "", false
+	}
+	return parts[0], parts[2], true
+}
@@ -0,0 +1,58 @@
+package endpoints
+
+import (
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"context"
+)
+
+// NewMessageSender returns the websocket.MessageSender that stores messages
+// sent over sockets and publishes them the way the REST endpoints do.
+func NewMessageSender(service *conversationservice.Service, handler *websocket.Handler, broker websocket.Broker) websocket.MessageSender {
+	return &conversationEndpoints{
+		service: service,
+		handler: handler,
+		broker:  broker,
+	}
+}
+
+// SendMessage stores a message.send frame as a message of the socket's
+// participant. Visitors are identified by the ticket or token the socket was
+// opened with, so the service checks the conversation is theirs.
+func (h *conversationEndpoints) SendMessage(ctx context.Context, cmd websocket.MessageCommand) (interface{}, error) {
+	var (
+		result conversationservice.MessageResult
+		err    error
+	)
+	switch cmd.SenderType {
+	case websocket.SenderVisitor:
+		access := conversationservice.VisitorAccess{
+			TenantID:       cmd.TenantID,
+			ConversationID: cmd.ConversationID,
+			VisitorID:      cmd.SenderID,
+		}
+		result, err = h.service.PostVisitorMessageWithAccess(ctx, access, cmd.Body)
+	case websocket.SenderAgent:
+		identity := conversationservice.Identity{UserID: cmd.SenderID, TenantID: cmd.TenantID}
+		result, err = h.service.PostAgentMessage(ctx, identity, cmd.ConversationID, cmd.Body)
+	default:
+		return nil, &websocket.CommandError{Code: websocket.CommandErrorForbidden, Message: "this connection cannot send messages"}
+	}
+	if err != nil {
+		return nil, conversationCommandError(err)
+	}
+
+	h.broadcastEvent(websocket.EventMessageCreated, result.Conversation, result.Message)
+
+	return toMessageResponse(result.Message), nil
+}
+
+// conversationCommandError reports the service errors a client can act on in
+// its message.error frame. Internal errors are left to be logged.
+func conversationCommandError(err error) error {
+	svcErr, ok := err.(*conversationservice.Error)
+	if !ok || svcErr.Code == conversationservice.ErrorCodeInternal {
+		return err
+	}
+	return &websocket.CommandError{Code: string(svcErr.Code), Message: svcErr.Message}
+}
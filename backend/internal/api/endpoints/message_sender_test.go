@@ -0,0 +1,138 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/dto"
+	internaljwt "chat-app-backend/internal/jwt"
+	"chat-app-backend/internal/model"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+type socketFrame struct {
+	Type           string                 `json:"type"`
+	Seq            int64                  `json:"seq"`
+	ClientID       string                 `json:"clientId"`
+	ConversationID string                 `json:"conversationId"`
+	Message        dto.MessageResponse    `json:"message"`
+	Error          websocket.CommandError `json:"error"`
+	Payload        json.RawMessage        `json:"payload"`
+}
+
+// readSocketFrame reads frames from conn until one of frameType arrives.
+func readSocketFrame(t *testing.T, conn *gorillaws.Conn, frameType string) socketFrame {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		var frame socketFrame
+		if err := conn.ReadJSON(&frame); err != nil {
+			t.Fatalf("waiting for %s: %v", frameType, err)
+		}
+		if frame.Type == frameType {
+			return frame
+		}
+	}
+}
+
+func sendMessageFrame(t *testing.T, conn *gorillaws.Conn, clientID, body string) {
+	t.Helper()
+	frame := map[string]string{"type": websocket.FrameMessageSend, "clientId": clientID, "body": body}
+	if err := conn.WriteJSON(frame); err != nil {
+		t.Fatalf("write message.send: %v", err)
+	}
+}
+
+func TestWebsocketMessageSendIsStoredAndAcknowledged(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1"}
+	repo.keys["public-key"] = "tenant-1"
+	repo.users[model.TenantScopedPK("tenant-1", "agent-1")] = model.UserItem{
+		PK:       model.TenantScopedPK("tenant-1", "agent-1"),
+		TenantID: "tenant-1",
+		UserID:   "agent-1",
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "public-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	visitor, status, err := dialConversation(server, conversationID, "role=visitor&protocol=v1&token="+result.VisitorToken)
+	if err != nil {
+		t.Fatalf("dial visitor socket: %v (status %d)", err, status)
+	}
+	defer visitor.Close()
+
+	sendMessageFrame(t, visitor, "visitor-msg-1", "Is anyone there?")
+	ack := readSocketFrame(t, visitor, websocket.FrameMessageAck)
+	if ack.ClientID != "visitor-msg-1" || ack.Message.MessageID == "" || ack.Message.Body != "Is anyone there?" || ack.Message.SenderType != model.MessageSenderVisitor {
+		t.Fatalf("unexpected visitor ack %+v", ack)
+	}
+
+	sendMessageFrame(t, visitor, "visitor-msg-2", "   ")
+	if rejected := readSocketFrame(t, visitor, websocket.FrameMessageError); rejected.ClientID != "visitor-msg-2" || rejected.Error.Code != websocket.CommandErrorValidation {
+		t.Fatalf("expected an empty message to be rejected, got %+v", rejected)
+	}
+	sendMessageFrame(t, visitor, "", "No client id")
+	if rejected := readSocketFrame(t, visitor, websocket.FrameMessageError); rejected.Error.Code != websocket.CommandErrorValidation {
+		t.Fatalf("expected a frame without clientId to be rejected, got %+v", rejected)
+	}
+
+	token, err := internaljwt.CreateToken(
+		internaljwt.User{Id: "agent-1", TenantID: "tenant-1", Email: "agent@example.com"},
+		internaljwt.RoleUser,
+		time.Now().Add(time.Hour).Unix(),
+	)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	status, ticket := requestTicket(t, handler, "/api/ws-tickets", nil, map[string]string{"Authorization": "Bearer " + token})
+	if status != http.StatusCreated {
+		t.Fatalf("expected an agent ticket, got %d", status)
+	}
+	agent, status, err := dialConversation(server, conversationID, "protocol=v1&ticket="+ticket.Ticket)
+	if err != nil {
+		t.Fatalf("dial agent socket: %v (status %d)", err, status)
+	}
+	defer agent.Close()
+
+	sendMessageFrame(t, agent, "agent-msg-1", "Hi, how can I help?")
+	ack = readSocketFrame(t, agent, websocket.FrameMessageAck)
+	if ack.ClientID != "agent-msg-1" || ack.Message.SenderType != model.MessageSenderAgent || ack.Message.SenderID != "agent-1" {
+		t.Fatalf("unexpected agent ack %+v", ack)
+	}
+
+	// The visitor also receives the message.created of its own message first.
+	for {
+		created := readSocketFrame(t, visitor, websocket.EventMessageCreated)
+		var event websocket.MessageEvent
+		if err := json.Unmarshal(created.Payload, &event); err != nil {
+			t.Fatalf("decode message.created: %v", err)
+		}
+		if event.Message.MessageID == ack.Message.MessageID {
+			break
+		}
+	}
+
+	repo.mu.Lock()
+	stored := len(repo.messages[conversationID])
+	repo.mu.Unlock()
+	if stored != 3 {
+		t.Fatalf("expected the opening message and both socket messages to be stored, got %d", stored)
+	}
+}
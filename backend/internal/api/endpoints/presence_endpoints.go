@@ -0,0 +1,79 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/api"
+	"chat-app-backend/internal/dto"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type PresenceEndpoints interface {
+	Presence(http.ResponseWriter, *http.Request) error
+}
+
+type presenceEndpoints struct {
+	service  *conversationservice.Service
+	presence *websocket.Presence
+}
+
+func NewPresenceEndpoints(service *conversationservice.Service, presence *websocket.Presence) PresenceEndpoints {
+	return &presenceEndpoints{
+		service:  service,
+		presence: presence,
+	}
+}
+
+func (h *presenceEndpoints) Presence(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet: h.handleListPresence,
+	})
+}
+
+func (h *presenceEndpoints) handleListPresence(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return conversationServiceError(err)
+	}
+
+	filter := websocket.PresenceFilter{
+		ParticipantType: strings.TrimSpace(r.URL.Query().Get("type")),
+		ConversationID:  strings.TrimSpace(r.URL.Query().Get("conversationId")),
+	}
+	switch filter.ParticipantType {
+	case "", websocket.SenderAgent, websocket.SenderVisitor:
+	default:
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "type must be agent or visitor",
+			ErrorLog:   fmt.Errorf("invalid presence type %q", filter.ParticipantType),
+		}
+	}
+
+	entries, err := h.presence.List(r.Context(), identity.TenantID, filter)
+	if err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to load presence",
+			ErrorLog:   err,
+		}
+	}
+
+	resp := dto.PresenceResponse{
+		Participants: make([]dto.PresenceEntryResponse, len(entries)),
+	}
+	for i, entry := range entries {
+		resp.Participants[i] = dto.PresenceEntryResponse{
+			ParticipantType: entry.ParticipantType,
+			ParticipantID:   entry.ParticipantID,
+			Status:          entry.Status,
+			ConversationIDs: entry.ConversationIDs,
+			LastSeenAt:      entry.LastSeenAt.UTC().Format(time.RFC3339),
+		}
+	}
+
+	return api.WriteJSON(w, http.StatusOK, resp)
+}
@@ -0,0 +1,71 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/api"
+	"chat-app-backend/internal/api/middleware"
+	"chat-app-backend/internal/dto"
+	internaljwt "chat-app-backend/internal/jwt"
+	"chat-app-backend/internal/queue"
+	"chat-app-backend/internal/websocket"
+	"context"
+	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestListPresenceEndpoint(t *testing.T) {
+	_, svc, _ := setupConversationTestHandler(t)
+
+	presence := websocket.NewPresenceWithStore(websocket.NewMemoryPresenceStore(), nil, nil)
+	for _, conn := range []websocket.PresenceConnection{
+		{ConnectionID: "v1", TenantID: "tenant-1", ParticipantType: websocket.SenderVisitor, ParticipantID: "visitor-1", ConversationID: "conv-1"},
+		{ConnectionID: "a1", TenantID: "tenant-1", ParticipantType: websocket.SenderAgent, ParticipantID: "agent-1"},
+		{ConnectionID: "x1", TenantID: "tenant-2", ParticipantType: websocket.SenderVisitor, ParticipantID: "visitor-9"},
+	} {
+		if err := presence.Connect(context.Background(), conn); err != nil {
+			t.Fatalf("Connect error: %v", err)
+		}
+	}
+
+	queueManager := queue.NewRequestQueueManager(10, 1)
+	t.Cleanup(queueManager.Shutdown)
+	server := api.NewAPIServerWithRegistry(":0", queueManager, nil, nil, prometheus.NewRegistry())
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/presence", server.MakeHTTPHandleFunc(NewPresenceEndpoints(svc, presence).Presence, middleware.ValidateUserJWT))
+
+	token, err := internaljwt.CreateToken(internaljwt.User{Id: "agent-1", TenantID: "tenant-1", Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/presence?type=visitor", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	var resp dto.PresenceResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(resp.Participants) != 1 {
+		t.Fatalf("expected only the tenant's visitor, got %+v", resp.Participants)
+	}
+	visitor := resp.Participants[0]
+	if visitor.ParticipantID != "visitor-1" || visitor.Status != websocket.PresenceOnline || len(visitor.ConversationIDs) != 1 {
+		t.Fatalf("unexpected visitor presence %+v", visitor)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/presence?type=robot", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for unknown type, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/dto"
+	tenantservice "chat-app-backend/internal/service/tenant"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+type RoutingEndpoints interface {
+	TenantRoutingSettings(http.ResponseWriter, *http.Request) error
+}
+
+type routingEndpoints struct {
+	service *tenantservice.Service
+}
+
+func NewRoutingEndpoints(service *tenantservice.Service) RoutingEndpoints {
+	return &routingEndpoints{
+		service: service,
+	}
+}
+
+func (h *routingEndpoints) TenantRoutingSettings(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodGet:   h.handleGetTenantRoutingSettings,
+		http.MethodPatch: h.handleUpdateTenantRoutingSettings,
+	})
+}
+
+func (h *routingEndpoints) handleGetTenantRoutingSettings(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	settings, err := h.service.GetRoutingSettings(r.Context(), identity, identity.TenantID)
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusOK, dto.RoutingSettingsResultResponse{
+		Routing: routingSettingsResult(settings),
+	})
+}
+
+func (h *routingEndpoints) handleUpdateTenantRoutingSettings(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	var req dto.UpdateRoutingSettingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode routing settings request: %w", err),
+		}
+	}
+
+	settings, err := h.service.UpdateRoutingSettings(r.Context(), identity, identity.TenantID, tenantservice.RoutingSettingsInput{
+		Strategy: req.Strategy,
+	})
+	if err != nil {
+		return mapTenantServiceError(err)
+	}
+
+	return WriteJSON(w, http.StatusOK, dto.RoutingSettingsResultResponse{
+		Routing: routingSettingsResult(settings),
+	})
+}
@@ -12,6 +12,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -27,6 +28,7 @@ type tenantTestRepository struct {
 	usersByEmail map[string]map[string]string
 	invites      map[string]model.TenantInviteItem
 	keys         map[string]map[string]model.TenantAPIKeyItem
+	canned       map[string]model.CannedResponseItem
 }
 
 func newTenantTestRepository() *tenantTestRepository {
@@ -36,6 +38,7 @@ func newTenantTestRepository() *tenantTestRepository {
 		usersByEmail: make(map[string]map[string]string),
 		invites:      make(map[string]model.TenantInviteItem),
 		keys:         make(map[string]map[string]model.TenantAPIKeyItem),
+		canned:       make(map[string]model.CannedResponseItem),
 	}
 }
 
@@ -254,6 +257,65 @@ func (m *tenantTestRepository) GetTenantAPIKey(ctx context.Context, tenantID, ke
 	return model.TenantAPIKeyItem{}, tenantservice.ErrNotFound
 }
 
+func (m *tenantTestRepository) ListCannedResponses(ctx context.Context, tenantID string) ([]model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	responses := make([]model.CannedResponseItem, 0)
+	for _, item := range m.canned {
+		if item.TenantID == tenantID {
+			responses = append(responses, item)
+		}
+	}
+	return responses, nil
+}
+
+func (m *tenantTestRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return model.CannedResponseItem{}, tenantservice.ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *tenantTestRepository) CreateCannedResponse(ctx context.Context, item model.CannedResponseItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.canned[item.ResponseID] = item
+	return nil
+}
+
+func (m *tenantTestRepository) UpdateCannedResponse(ctx context.Context, item model.CannedResponseItem) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.canned[item.ResponseID]
+	if !ok || existing.TenantID != item.TenantID {
+		return model.CannedResponseItem{}, tenantservice.ErrNotFound
+	}
+	existing.Title = item.Title
+	existing.Shortcut = item.Shortcut
+	existing.Folder = item.Folder
+	existing.Body = item.Body
+	existing.UpdatedAt = item.UpdatedAt
+	m.canned[item.ResponseID] = existing
+	return existing, nil
+}
+
+func (m *tenantTestRepository) DeleteCannedResponse(ctx context.Context, tenantID, responseID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.canned[responseID]; ok && item.TenantID == tenantID {
+		delete(m.canned, responseID)
+	}
+	return nil
+}
+
 func (m *tenantTestRepository) GetTenantByAPIKey(ctx context.Context, apiKey string) (model.TenantItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -292,14 +354,17 @@ func setupTenantHandler(t *testing.T, repo tenantservice.Repository) (http.Handl
 
 	service := tenantservice.NewWithRepository(repo, tenantFixedTime)
 	tenantEndpoints := NewTenantEndpoints(service)
+	cannedResponseEndpoints := NewCannedResponseEndpoints(service, "/api")
 
 	queueManager := queue.NewRequestQueueManager(10, 1)
-	server := api.NewAPIServer(":0", queueManager, nil, nil)
+	server := api.NewAPIServerWithRegistry(":0", queueManager, nil, nil, prometheus.NewRegistry())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/tenant", server.MakeHTTPHandleFunc(tenantEndpoints.UpdateTenant, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/tenant/users", server.MakeHTTPHandleFunc(tenantEndpoints.AddTenantUser, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/tenant/api-keys", server.MakeHTTPHandleFunc(tenantEndpoints.TenantAPIKeys, middleware.ValidateUserJWT))
+	mux.HandleFunc("/api/tenant/canned-responses", server.MakeHTTPHandleFunc(cannedResponseEndpoints.CannedResponses, middleware.ValidateUserJWT))
+	mux.HandleFunc("/api/tenant/canned-responses/", server.MakeHTTPHandleFunc(cannedResponseEndpoints.CannedResponse, middleware.ValidateUserJWT))
 	mux.HandleFunc("/api/tenant/invites/accept", server.MakeHTTPHandleFunc(tenantEndpoints.AcceptInvite))
 	mux.HandleFunc("/api/tenant/invites/pending", server.MakeHTTPHandleFunc(tenantEndpoints.ListPendingInvites, middleware.ValidateUserJWT))
 
@@ -1019,3 +1084,99 @@ func TestTenantListPendingInvitesRequiresAuth(t *testing.T) {
 		t.Fatalf("expected status 401, got %d", rec.Code)
 	}
 }
+
+func TestTenantCannedResponseEndpoints(t *testing.T) {
+	repo := newTenantTestRepository()
+
+	tenant := model.TenantItem{
+		TenantID: "tenant-1",
+		Name:     "Tenant",
+		Plan:     "starter",
+		Seats:    2,
+		Created:  tenantFixedTime().Format(time.RFC3339),
+	}
+	repo.tenants[tenant.TenantID] = tenant
+
+	member := model.UserItem{
+		PK:           model.TenantScopedPK(tenant.TenantID, "member-1"),
+		TenantID:     tenant.TenantID,
+		UserID:       "member-1",
+		Email:        "member@example.com",
+		Name:         "Member",
+		Role:         "member",
+		Status:       "active",
+		PasswordHash: "hash",
+		CreatedAt:    tenantFixedTime().Format(time.RFC3339),
+	}
+	repo.CreateUser(context.Background(), member)
+
+	handler, cleanup := setupTenantHandler(t, repo)
+	defer cleanup()
+
+	send := func(method, path string, payload interface{}) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		if payload != nil {
+			json.NewEncoder(&body).Encode(payload)
+		}
+		req := httptest.NewRequest(method, path, &body)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", bearer(t, member))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := send(http.MethodPost, "/api/tenant/canned-responses", dto.CannedResponseRequest{Title: "Hi", Body: "Hello {{visitor.age}}"})
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400 for an unknown placeholder, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send(http.MethodPost, "/api/tenant/canned-responses", dto.CannedResponseRequest{
+		Title:    "Greeting",
+		Shortcut: "/hi",
+		Folder:   "General",
+		Body:     "Hello {{visitor.name|there}}!",
+	})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created dto.CannedResponseResultResponse
+	if err := json.NewDecoder(rec.Body).Decode(&created); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if created.CannedResponse.ResponseID == "" || created.CannedResponse.Shortcut != "hi" {
+		t.Fatalf("unexpected canned response %+v", created.CannedResponse)
+	}
+	itemPath := "/api/tenant/canned-responses/" + created.CannedResponse.ResponseID
+
+	rec = send(http.MethodPost, "/api/tenant/canned-responses", dto.CannedResponseRequest{Title: "Other", Shortcut: "hi", Body: "Hey"})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("expected status 409 for a taken shortcut, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send(http.MethodPatch, itemPath, dto.CannedResponseRequest{Title: "Greeting", Shortcut: "hi", Folder: "Sales", Body: "Hi {{visitor.name}}"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec = send(http.MethodGet, "/api/tenant/canned-responses?folder=Sales", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var list dto.CannedResponseListResponse
+	if err := json.NewDecoder(rec.Body).Decode(&list); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if len(list.CannedResponses) != 1 || list.CannedResponses[0].Body != "Hi {{visitor.name}}" {
+		t.Fatalf("unexpected canned responses %+v", list.CannedResponses)
+	}
+
+	rec = send(http.MethodDelete, itemPath, nil)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected status 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+	rec = send(http.MethodDelete, itemPath, nil)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404 after delete, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -8,12 +8,15 @@ import (
 
 func tenantSettingsResponse(tenant model.TenantItem) *dto.TenantSettingsResponse {
 	widget := tenantservice.WidgetSettingsFromTenant(tenant)
+	routing := tenantservice.RoutingSettingsFromTenant(tenant)
 	return &dto.TenantSettingsResponse{
 		Widget: dto.WidgetSettingsResponse{
 			BubbleText: widget.BubbleText,
 			HeaderText: widget.HeaderText,
 			ThemeColor: widget.ThemeColor,
 		},
+		Routing:     routingSettingsResult(routing),
+		Attachments: attachmentSettingsResult(tenantservice.AttachmentSettingsFromTenant(tenant)),
 	}
 }
 
@@ -24,3 +27,16 @@ func widgetSettingsResult(settings tenantservice.WidgetSettings) dto.WidgetSetti
 		ThemeColor: settings.ThemeColor,
 	}
 }
+
+func routingSettingsResult(settings tenantservice.RoutingSettings) dto.RoutingSettingsResponse {
+	return dto.RoutingSettingsResponse{
+		Strategy: string(settings.Strategy),
+	}
+}
+
+func attachmentSettingsResult(settings tenantservice.AttachmentSettings) dto.AttachmentSettingsResponse {
+	return dto.AttachmentSettingsResponse{
+		MaxBytes:     settings.MaxBytes,
+		AllowedTypes: append([]string{}, settings.AllowedTypes...),
+	}
+}
@@ -0,0 +1,112 @@
+package endpoints
+
+import (
+	"chat-app-backend/internal/api"
+	"chat-app-backend/internal/dto"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type TicketEndpoints interface {
+	PublicTickets(http.ResponseWriter, *http.Request) error
+	TenantTickets(http.ResponseWriter, *http.Request) error
+}
+
+type ticketEndpoints struct {
+	service *conversationservice.Service
+	tickets *websocket.Tickets
+}
+
+func NewTicketEndpoints(service *conversationservice.Service, tickets *websocket.Tickets) TicketEndpoints {
+	return &ticketEndpoints{
+		service: service,
+		tickets: tickets,
+	}
+}
+
+func (h *ticketEndpoints) PublicTickets(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodPost: h.handleCreateVisitorTicket,
+	})
+}
+
+func (h *ticketEndpoints) TenantTickets(w http.ResponseWriter, r *http.Request) error {
+	return MethodHandler(w, r, map[string]func(http.ResponseWriter, *http.Request) error{
+		http.MethodPost: h.handleCreateAgentTicket,
+	})
+}
+
+// handleCreateVisitorTicket issues a ticket for the conversation of the
+// visitor token, sent in the body or the X-Visitor-Token header.
+func (h *ticketEndpoints) handleCreateVisitorTicket(w http.ResponseWriter, r *http.Request) error {
+	var req dto.CreateWebsocketTicketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		return &HTTPError{
+			StatusCode: http.StatusBadRequest,
+			Message:    "Invalid request payload",
+			ErrorLog:   fmt.Errorf("decode ticket request: %w", err),
+		}
+	}
+	req.VisitorToken = strings.TrimSpace(req.VisitorToken)
+	if req.VisitorToken == "" {
+		req.VisitorToken = strings.TrimSpace(r.Header.Get("X-Visitor-Token"))
+	}
+
+	access, err := h.service.ValidateVisitorAccess(req.VisitorToken)
+	if err != nil {
+		return conversationServiceError(err)
+	}
+	if conversationID := strings.TrimSpace(req.ConversationID); conversationID != "" && conversationID != access.ConversationID {
+		return &HTTPError{
+			StatusCode: http.StatusForbidden,
+			Message:    "Token does not match conversation",
+			ErrorLog:   fmt.Errorf("ticket conversation mismatch: %s vs %s", access.ConversationID, conversationID),
+		}
+	}
+
+	return h.issue(w, r, websocket.Ticket{
+		Role:           websocket.TicketRoleVisitor,
+		TenantID:       access.TenantID,
+		ParticipantID:  access.VisitorID,
+		ConversationID: access.ConversationID,
+	})
+}
+
+func (h *ticketEndpoints) handleCreateAgentTicket(w http.ResponseWriter, r *http.Request) error {
+	identity, err := h.service.IdentityFromAuthorizationHeader(r.Header.Get("Authorization"))
+	if err != nil {
+		return conversationServiceError(err)
+	}
+	if identity.TenantID == "" {
+		return &HTTPError{StatusCode: http.StatusUnauthorized, Message: "Unauthorized", ErrorLog: fmt.Errorf("ticket request missing tenant")}
+	}
+
+	return h.issue(w, r, websocket.Ticket{
+		Role:          websocket.TicketRoleAgent,
+		TenantID:      identity.TenantID,
+		ParticipantID: identity.UserID,
+	})
+}
+
+func (h *ticketEndpoints) issue(w http.ResponseWriter, r *http.Request, ticket websocket.Ticket) error {
+	id, expiresAt, err := h.tickets.Issue(r.Context(), ticket)
+	if err != nil {
+		return &HTTPError{
+			StatusCode: http.StatusInternalServerError,
+			Message:    "Failed to issue ticket",
+			ErrorLog:   err,
+		}
+	}
+
+	return api.WriteJSON(w, http.StatusCreated, dto.WebsocketTicketResponse{
+		Ticket:    id,
+		ExpiresAt: expiresAt.UTC().Format(time.RFC3339),
+	})
+}
@@ -0,0 +1,142 @@
+package endpoints
+
+import (
+	"bytes"
+	"chat-app-backend/internal/dto"
+	internaljwt "chat-app-backend/internal/jwt"
+	"chat-app-backend/internal/model"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gorillaws "github.com/gorilla/websocket"
+)
+
+func requestTicket(t *testing.T, handler http.Handler, path string, body interface{}, headers map[string]string) (int, dto.WebsocketTicketResponse) {
+	t.Helper()
+	raw, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var resp dto.WebsocketTicketResponse
+	if rec.Code == http.StatusCreated {
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("decode ticket response: %v", err)
+		}
+	}
+	return rec.Code, resp
+}
+
+func dialConversation(server *httptest.Server, conversationID, query string) (*gorillaws.Conn, int, error) {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/ws/conversations/" + conversationID + "?" + query
+	conn, res, err := gorillaws.DefaultDialer.Dial(url, nil)
+	status := 0
+	if res != nil {
+		status = res.StatusCode
+	}
+	return conn, status, err
+}
+
+func TestVisitorTicketOpensConversationSocketOnce(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1"}
+	repo.keys["public-key"] = "tenant-1"
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "public-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	status, _ := requestTicket(t, handler, "/api/public/ws-tickets", dto.CreateWebsocketTicketRequest{ConversationID: "other"}, map[string]string{"X-Visitor-Token": result.VisitorToken})
+	if status != http.StatusForbidden {
+		t.Fatalf("expected a ticket for another conversation to be refused, got %d", status)
+	}
+
+	status, ticket := requestTicket(t, handler, "/api/public/ws-tickets", dto.CreateWebsocketTicketRequest{ConversationID: conversationID}, map[string]string{"X-Visitor-Token": result.VisitorToken})
+	if status != http.StatusCreated || ticket.Ticket == "" {
+		t.Fatalf("expected a ticket, got %d %+v", status, ticket)
+	}
+	expiresAt, err := time.Parse(time.RFC3339, ticket.ExpiresAt)
+	if err != nil || time.Until(expiresAt) > 31*time.Second {
+		t.Fatalf("expected the ticket to expire within 30 seconds, got %s", ticket.ExpiresAt)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	conn, status, err := dialConversation(server, conversationID, "role=visitor&ticket="+ticket.Ticket)
+	if err != nil {
+		t.Fatalf("expected the ticket to open the socket, got %v (status %d)", err, status)
+	}
+	conn.Close()
+
+	if _, status, err := dialConversation(server, conversationID, "role=visitor&ticket="+ticket.Ticket); err == nil || status != http.StatusUnauthorized {
+		t.Fatalf("expected a redeemed ticket to be rejected with 401, got %v (status %d)", err, status)
+	}
+}
+
+func TestAgentTicketRequiresUserToken(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1"}
+	repo.tenants["tenant-2"] = model.TenantItem{TenantID: "tenant-2"}
+	repo.keys["other-key"] = "tenant-2"
+	agent := model.UserItem{PK: model.TenantScopedPK("tenant-1", "agent-1"), TenantID: "tenant-1", UserID: "agent-1"}
+	repo.users[agent.PK] = agent
+	repo.conversations[model.ConversationPK("tenant-1", "conv-1")] = model.ConversationItem{
+		PK:             model.ConversationPK("tenant-1", "conv-1"),
+		TenantID:       "tenant-1",
+		ConversationID: "conv-1",
+	}
+
+	other, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "other-key",
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+
+	if status, _ := requestTicket(t, handler, "/api/ws-tickets", nil, nil); status != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without a token, got %d", status)
+	}
+
+	token, err := internaljwt.CreateToken(
+		internaljwt.User{Id: "agent-1", TenantID: "tenant-1", Email: "agent@example.com"},
+		internaljwt.RoleUser,
+		time.Now().Add(time.Hour).Unix(),
+	)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	status, ticket := requestTicket(t, handler, "/api/ws-tickets", nil, map[string]string{"Authorization": "Bearer " + token})
+	if status != http.StatusCreated || ticket.Ticket == "" {
+		t.Fatalf("expected an agent ticket, got %d %+v", status, ticket)
+	}
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+	conn, status, err := dialConversation(server, "conv-1", "ticket="+ticket.Ticket)
+	if err != nil {
+		t.Fatalf("expected the agent ticket to open the socket, got %v (status %d)", err, status)
+	}
+	conn.Close()
+
+	_, ticket = requestTicket(t, handler, "/api/ws-tickets", nil, map[string]string{"Authorization": "Bearer " + token})
+	if _, status, err := dialConversation(server, other.Conversation.ConversationID, "ticket="+ticket.Ticket); err == nil || status != http.StatusNotFound {
+		t.Fatalf("expected another tenant's conversation to be refused with 404, got %v (status %d)", err, status)
+	}
+}
@@ -0,0 +1,207 @@
+package endpoints
+
+import (
+	"bufio"
+	"bytes"
+	"chat-app-backend/internal/dto"
+	internaljwt "chat-app-backend/internal/jwt"
+	"chat-app-backend/internal/model"
+	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/websocket"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pollResult struct {
+	Events  []websocket.Event `json:"events"`
+	LastSeq int64             `json:"lastSeq"`
+}
+
+func postVisitorMessage(t *testing.T, server *httptest.Server, conversationID, token, body string) {
+	t.Helper()
+	raw, _ := json.Marshal(dto.PostVisitorMessageRequest{Body: body, VisitorToken: token})
+	res, err := http.Post(server.URL+"/api/public/conversations/"+conversationID+"/messages", "application/json", bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("post visitor message: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("expected the message to be stored, got %d", res.StatusCode)
+	}
+}
+
+func poll(url string) (pollResult, error) {
+	res, err := http.Get(url)
+	if err != nil {
+		return pollResult{}, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return pollResult{}, fmt.Errorf("poll answered %d", res.StatusCode)
+	}
+	var result pollResult
+	err = json.NewDecoder(res.Body).Decode(&result)
+	return result, err
+}
+
+// readServerSentEvent returns the ID and data of the next event of stream.
+func readServerSentEvent(t *testing.T, stream *bufio.Reader) (string, websocket.Event) {
+	t.Helper()
+	var id string
+	for {
+		line, err := stream.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			var event websocket.Event
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event); err != nil {
+				t.Fatalf("decode event data: %v", err)
+			}
+			return id, event
+		}
+	}
+}
+
+func TestFallbackTransportsDeliverConversationEvents(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1"}
+	repo.keys["public-key"] = "tenant-1"
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "public-key",
+		Message:      "Hello",
+		Visitor:      conversationservice.VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+	auth := "role=visitor&token=" + result.VisitorToken
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	res, err := http.Get(server.URL + "/api/poll/conversations/" + conversationID + "?role=visitor&token=wrong")
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an invalid token to be refused, got %d", res.StatusCode)
+	}
+
+	postVisitorMessage(t, server, conversationID, result.VisitorToken, "First")
+	first, err := poll(server.URL + "/api/poll/conversations/" + conversationID + "?lastSeq=0&" + auth)
+	if err != nil {
+		t.Fatalf("poll: %v", err)
+	}
+	if len(first.Events) != 1 || first.Events[0].Type != websocket.EventMessageCreated || first.LastSeq != 1 {
+		t.Fatalf("expected the logged message to be replayed, got %+v", first)
+	}
+
+	type answer struct {
+		result pollResult
+		err    error
+	}
+	waiting := make(chan answer, 1)
+	go func() {
+		result, err := poll(server.URL + "/api/poll/conversations/" + conversationID + "?lastSeq=1&" + auth)
+		waiting <- answer{result, err}
+	}()
+	time.Sleep(50 * time.Millisecond)
+	postVisitorMessage(t, server, conversationID, result.VisitorToken, "Second")
+	select {
+	case answered := <-waiting:
+		if answered.err != nil {
+			t.Fatalf("poll: %v", answered.err)
+		}
+		second := answered.result
+		if len(second.Events) != 1 || second.Events[0].Seq != 2 || second.LastSeq != 2 {
+			t.Fatalf("expected the waiting poll to return the new message, got %+v", second)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the waiting poll to be answered")
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/api/sse/conversations/"+conversationID+"?"+auth, nil)
+	req.Header.Set("Last-Event-ID", "1")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	res, err = http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("open event stream: %v", err)
+	}
+	defer res.Body.Close()
+	if got := res.Header.Get("Content-Type"); got != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", got)
+	}
+
+	stream := bufio.NewReader(res.Body)
+	if id, event := readServerSentEvent(t, stream); id != "2" || event.Type != websocket.EventMessageCreated {
+		t.Fatalf("expected the stream to resume after Last-Event-ID, got %s %+v", id, event)
+	}
+	postVisitorMessage(t, server, conversationID, result.VisitorToken, "Third")
+	if id, event := readServerSentEvent(t, stream); id != "3" || event.Seq != 3 {
+		t.Fatalf("expected the live message on the stream, got %s %+v", id, event)
+	}
+}
+
+func TestFallbackTransportsRefuseOtherTenantsConversations(t *testing.T) {
+	handler, svc, repo := setupConversationTestHandler(t)
+	for _, tenantID := range []string{"tenant-a", "tenant-b"} {
+		repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+		repo.keys[tenantID+"-key"] = tenantID
+		agent := model.UserItem{PK: model.TenantScopedPK(tenantID, tenantID+"-agent"), TenantID: tenantID, UserID: tenantID + "-agent"}
+		repo.users[agent.PK] = agent
+	}
+
+	result, err := svc.CreateConversation(context.Background(), conversationservice.CreateConversationParams{
+		TenantAPIKey: "tenant-b-key",
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := result.Conversation.ConversationID
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	get := func(path, tenantID string) int {
+		token, err := internaljwt.CreateToken(internaljwt.User{Id: tenantID + "-agent", TenantID: tenantID, Email: "agent@example.com"}, internaljwt.RoleUser, time.Now().Add(time.Hour).Unix())
+		if err != nil {
+			t.Fatalf("create token: %v", err)
+		}
+		req, _ := http.NewRequest(http.MethodGet, server.URL+path+conversationID+"?role=agent&lastSeq=0", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("GET %s: %v", path, err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+
+	for _, path := range []string{"/api/sse/conversations/", "/api/poll/conversations/"} {
+		if status := get(path, "tenant-a"); status != http.StatusNotFound {
+			t.Fatalf("expected %s to refuse another tenant's agent with 404, got %d", path, status)
+		}
+	}
+	postVisitorMessage(t, server, conversationID, result.VisitorToken, "Anyone there?")
+	if status := get("/api/poll/conversations/", "tenant-b"); status != http.StatusOK {
+		t.Fatalf("expected the conversation's own tenant to poll it, got %d", status)
+	}
+}
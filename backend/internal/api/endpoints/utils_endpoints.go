@@ -1,18 +1,24 @@
 package endpoints
 
 import (
+	"fmt"
 	"net/http"
 )
 
 type UtilsEndpoints interface {
 	HelloWorld(http.ResponseWriter, *http.Request) error
 	Health(http.ResponseWriter, *http.Request) error
+	Ready(http.ResponseWriter, *http.Request) error
 }
 
-type utilsEndpoints struct{}
+type utilsEndpoints struct {
+	ready func() bool
+}
 
-func NewUtilsEndpoints() UtilsEndpoints {
-	return &utilsEndpoints{}
+// NewUtilsEndpoints returns the utility endpoints; ready reports whether the
+// server should stay in rotation.
+func NewUtilsEndpoints(ready func() bool) UtilsEndpoints {
+	return &utilsEndpoints{ready: ready}
 }
 
 func (h *utilsEndpoints) HelloWorld(w http.ResponseWriter, r *http.Request) error {
@@ -21,4 +27,17 @@ func (h *utilsEndpoints) HelloWorld(w http.ResponseWriter, r *http.Request) erro
 
 func (h *utilsEndpoints) Health(w http.ResponseWriter, r *http.Request) error {
 	return WriteJSON(w, http.StatusOK, struct{}{})
+}
+
+// Ready fails once the server starts draining, so load balancers stop
+// sending it new connections while it finishes the ones it has.
+func (h *utilsEndpoints) Ready(w http.ResponseWriter, r *http.Request) error {
+	if h.ready != nil && !h.ready() {
+		return &HTTPError{
+			StatusCode: http.StatusServiceUnavailable,
+			Message:    "Server is shutting down",
+			ErrorLog:   fmt.Errorf("readiness check while draining"),
+		}
+	}
+	return WriteJSON(w, http.StatusOK, struct{}{})
 }
\ No newline at end of file
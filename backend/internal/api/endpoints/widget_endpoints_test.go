@@ -11,6 +11,7 @@ import (
 	tenantservice "chat-app-backend/internal/service/tenant"
 	"context"
 	"encoding/json"
+	"github.com/prometheus/client_golang/prometheus"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -26,7 +27,7 @@ func setupWidgetHandler(t *testing.T, repo tenantservice.Repository) (http.Handl
 	widgetEndpoints := NewWidgetEndpoints(service)
 
 	queueManager := queue.NewRequestQueueManager(10, 1)
-	server := api.NewAPIServer(":0", queueManager, nil, nil)
+	server := api.NewAPIServerWithRegistry(":0", queueManager, nil, nil, prometheus.NewRegistry())
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/tenant/widget", server.MakeHTTPHandleFunc(widgetEndpoints.TenantWidgetSettings, middleware.ValidateUserJWT))
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"bufio"
+	"fmt"
+	"net"
 	"net/http"
 	"path"
 	"strconv"
@@ -19,12 +22,14 @@ type metrics struct {
 	duration   *prometheus.HistogramVec
 	inFlight   prometheus.Gauge
 	queueDepth prometheus.GaugeFunc
+	gatherer   prometheus.Gatherer
 }
 
-func newMetrics(reg prometheus.Registerer, listenAddr string, q *queue.RequestQueueManager) *metrics {
+func newMetrics(reg prometheus.Registerer, gatherer prometheus.Gatherer, listenAddr string, q *queue.RequestQueueManager) *metrics {
 	labels := prometheus.Labels{"listen_addr": listenAddr}
 
 	m := &metrics{
+		gatherer: gatherer,
 		requests: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name:        "chat_app_http_requests_total",
@@ -68,9 +73,12 @@ func newMetrics(reg prometheus.Registerer, listenAddr string, q *queue.RequestQu
 	return m
 }
 
-// metricsHandler exposes /metrics using the shared registry.
+// metricsHandler exposes /metrics from the registry the collectors live in.
 func (m *metrics) metricsHandler() http.Handler {
-	return promhttp.Handler()
+	if m.gatherer == prometheus.DefaultGatherer {
+		return promhttp.Handler()
+	}
+	return promhttp.HandlerFor(m.gatherer, promhttp.HandlerOpts{})
 }
 
 // instrument wraps the provided handler with Prometheus counters and histograms.
@@ -126,3 +134,18 @@ func (sr *statusRecorder) WriteHeader(status int) {
 	sr.status = status
 	sr.ResponseWriter.WriteHeader(status)
 }
+
+// Flush and Hijack pass through to the wrapped writer, which event streams and
+// websocket upgrades need.
+func (sr *statusRecorder) Flush() {
+	if f, ok := sr.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sr *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if h, ok := sr.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, fmt.Errorf("statusRecorder: underlying ResponseWriter does not support hijacking")
+}
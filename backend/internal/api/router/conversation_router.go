@@ -4,7 +4,10 @@ import (
 	"chat-app-backend/internal/api"
 	"chat-app-backend/internal/api/endpoints"
 	"chat-app-backend/internal/api/middleware"
+	"chat-app-backend/internal/search"
 	conversationservice "chat-app-backend/internal/service/conversation"
+	"chat-app-backend/internal/storage"
+	"chat-app-backend/internal/websocket"
 	"net/http"
 	"strings"
 )
@@ -12,42 +15,79 @@ import (
 func ConversationPublicRoutes(prefix string) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
 		service := conversationservice.New(s.Database())
+		service.SetAgentAvailability(websocket.NewPresence(s.Broker()))
+		service.SetBlobStore(s.BlobStore())
 		paths := endpoints.ConversationPaths{
 			PublicConversationsPath:          strings.TrimRight(prefix, "/") + "/conversations",
 			PublicConversationMessagesPrefix: strings.TrimRight(prefix, "/") + "/conversations/",
 		}
-		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), paths)
+		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), s.Broker(), paths)
+		ticketEndpoints := endpoints.NewTicketEndpoints(service, websocket.NewTickets(s.Broker()))
 
 		mux.HandleFunc(prefix+"/conversations", s.MakeHTTPHandleFunc(convEndpoints.PublicConversations))
 		mux.HandleFunc(prefix+"/conversations/", s.MakeHTTPHandleFunc(convEndpoints.PublicConversationMessages))
+		mux.HandleFunc(prefix+"/ws-tickets", s.MakeHTTPHandleFunc(ticketEndpoints.PublicTickets))
+		// Blobs kept in S3 are downloaded from the bucket directly.
+		if local, ok := s.BlobStore().(*storage.LocalStore); ok {
+			attachmentEndpoints := endpoints.NewAttachmentEndpoints(local, prefix+"/attachments")
+			mux.HandleFunc(prefix+"/attachments/", s.MakeHTTPHandleFunc(attachmentEndpoints.Download))
+		}
 	}
 }
 
-func ConversationTenantRoutes(prefix string) api.RouteRegistrar {
+// ConversationTenantRoutes registers the agent conversation API. Messages
+// stored through it are added to searchIndex, which also backs the search
+// endpoint; a nil index leaves search unavailable.
+func ConversationTenantRoutes(prefix string, searchIndex *search.Index) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
 		service := conversationservice.New(s.Database())
+		if searchIndex != nil {
+			service.SetSearchIndex(searchIndex)
+		}
+		service.SetBlobStore(s.BlobStore())
 		paths := endpoints.ConversationPaths{
 			TenantConversationsPath:  strings.TrimRight(prefix, "/") + "/conversations",
 			TenantConversationPrefix: strings.TrimRight(prefix, "/") + "/conversations/",
 		}
-		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), paths)
+		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), s.Broker(), paths)
+		presenceEndpoints := endpoints.NewPresenceEndpoints(service, websocket.NewPresence(s.Broker()))
+		ticketEndpoints := endpoints.NewTicketEndpoints(service, websocket.NewTickets(s.Broker()))
 
 		mux.HandleFunc(prefix+"/conversations", s.MakeHTTPHandleFunc(convEndpoints.Conversations, middleware.ValidateUserJWT))
 		mux.HandleFunc(prefix+"/conversations/usage", s.MakeHTTPHandleFunc(convEndpoints.ConversationUsage, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/conversations/search", s.MakeHTTPHandleFunc(convEndpoints.ConversationSearch, middleware.ValidateUserJWT))
 		mux.HandleFunc(prefix+"/conversations/", s.MakeHTTPHandleFunc(convEndpoints.ConversationMessages, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/presence", s.MakeHTTPHandleFunc(presenceEndpoints.Presence, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/ws-tickets", s.MakeHTTPHandleFunc(ticketEndpoints.TenantTickets, middleware.ValidateUserJWT))
 	}
 }
 
 func ConversationWebsocketRoutes(prefix string) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
 		service := conversationservice.New(s.Database())
+		base := strings.TrimRight(prefix, "/")
 		paths := endpoints.ConversationPaths{
-			WebsocketPrefix:        strings.TrimRight(prefix, "/") + "/conversations/",
-			TenantNotificationPath: strings.TrimRight(prefix, "/") + "/notifications",
+			WebsocketPrefix:        base + "/conversations/",
+			TenantNotificationPath: base + "/notifications",
+			StreamPrefix:           base + "/sse/conversations/",
+			StreamNotificationPath: base + "/sse/notifications",
+			PollPrefix:             base + "/poll/conversations/",
+			PollNotificationPath:   base + "/poll/notifications",
+			AgentWebsocketPath:     base + "/agent",
+		}
+		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), s.Broker(), paths)
+		if handler := s.Handler(); handler != nil {
+			handler.SetMessageSender(endpoints.NewMessageSender(service, handler, s.Broker()))
+			handler.SetConversationAuthorizer(endpoints.NewConversationAuthorizer(service))
 		}
-		convEndpoints := endpoints.NewConversationEndpointsWithPaths(service, s.Handler(), paths)
 
 		mux.HandleFunc(prefix+"/conversations/", s.MakeHTTPHandleFunc(convEndpoints.Websocket))
 		mux.HandleFunc(prefix+"/notifications", s.MakeHTTPHandleFunc(convEndpoints.NotificationsWebsocket))
+		mux.HandleFunc(prefix+"/agent", s.MakeHTTPHandleFunc(convEndpoints.AgentWebsocket))
+		// Fallbacks for networks that block websocket upgrades.
+		mux.HandleFunc(prefix+"/sse/conversations/", s.MakeStreamHandleFunc(convEndpoints.ConversationStream))
+		mux.HandleFunc(prefix+"/sse/notifications", s.MakeStreamHandleFunc(convEndpoints.NotificationsStream))
+		mux.HandleFunc(prefix+"/poll/conversations/", s.MakeStreamHandleFunc(convEndpoints.ConversationPoll))
+		mux.HandleFunc(prefix+"/poll/notifications", s.MakeStreamHandleFunc(convEndpoints.NotificationsPoll))
 	}
 }
@@ -12,10 +12,13 @@ func TenantRoutes(prefix string) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
 		service := tenantservice.New(s.Database())
 		tenantEndpoints := endpoints.NewTenantEndpoints(service)
+		cannedResponseEndpoints := endpoints.NewCannedResponseEndpoints(service, prefix)
 
 		mux.HandleFunc(prefix+"/tenant", s.MakeHTTPHandleFunc(tenantEndpoints.UpdateTenant, middleware.ValidateUserJWT))
 		mux.HandleFunc(prefix+"/tenant/users", s.MakeHTTPHandleFunc(tenantEndpoints.AddTenantUser, middleware.ValidateUserJWT))
 		mux.HandleFunc(prefix+"/tenant/api-keys", s.MakeHTTPHandleFunc(tenantEndpoints.TenantAPIKeys, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/tenant/canned-responses", s.MakeHTTPHandleFunc(cannedResponseEndpoints.CannedResponses, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/tenant/canned-responses/", s.MakeHTTPHandleFunc(cannedResponseEndpoints.CannedResponse, middleware.ValidateUserJWT))
 		mux.HandleFunc(prefix+"/tenant/invites/accept", s.MakeHTTPHandleFunc(tenantEndpoints.AcceptInvite))
 		mux.HandleFunc(prefix+"/tenant/invites/pending", s.MakeHTTPHandleFunc(tenantEndpoints.ListPendingInvites, middleware.ValidateUserJWT))
 	}
@@ -8,8 +8,9 @@ import (
 
 func UtilsRoutes(prefix string) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
-		utilsEndpoints := endpoints.NewUtilsEndpoints()
+		utilsEndpoints := endpoints.NewUtilsEndpoints(s.Ready)
 		mux.HandleFunc(prefix+"/hello-world", s.MakeHTTPHandleFunc(utilsEndpoints.HelloWorld))
 		mux.HandleFunc(prefix+"/health", s.MakeHTTPHandleFunc(utilsEndpoints.Health))
+		mux.HandleFunc(prefix+"/ready", s.MakeHTTPHandleFunc(utilsEndpoints.Ready))
 	}
 }
@@ -12,8 +12,12 @@ func WidgetRoutes(prefix string) api.RouteRegistrar {
 	return func(mux *http.ServeMux, s *api.APIServer) {
 		service := tenantservice.New(s.Database())
 		widgetEndpoints := endpoints.NewWidgetEndpoints(service)
+		routingEndpoints := endpoints.NewRoutingEndpoints(service)
+		attachmentSettingsEndpoints := endpoints.NewAttachmentSettingsEndpoints(service)
 
 		mux.HandleFunc(prefix+"/widget", s.MakeHTTPHandleFunc(widgetEndpoints.TenantWidgetSettings, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/routing", s.MakeHTTPHandleFunc(routingEndpoints.TenantRoutingSettings, middleware.ValidateUserJWT))
+		mux.HandleFunc(prefix+"/attachments", s.MakeHTTPHandleFunc(attachmentSettingsEndpoints.TenantAttachmentSettings, middleware.ValidateUserJWT))
 	}
 }
 
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"chat-app-backend/internal/env"
+)
+
+// ShutdownConfig is how an APIServer drains on SIGINT or SIGTERM.
+type ShutdownConfig struct {
+	// DrainDelay is how long the server keeps serving with failing readiness
+	// before it stops, so load balancers take it out of rotation first.
+	DrainDelay time.Duration
+	// Timeout bounds closing connections and finishing queued requests.
+	Timeout time.Duration
+	// ReconnectSpread is the window websocket clients are told to reconnect
+	// within.
+	ReconnectSpread time.Duration
+}
+
+// DefaultShutdownConfig fits the grace period of a rolling restart.
+func DefaultShutdownConfig() ShutdownConfig {
+	return ShutdownConfig{
+		DrainDelay:      5 * time.Second,
+		Timeout:         20 * time.Second,
+		ReconnectSpread: 5 * time.Second,
+	}
+}
+
+// ShutdownConfigFromEnv returns DefaultShutdownConfig with the overrides of
+// SHUTDOWN_DRAIN_DELAY, SHUTDOWN_TIMEOUT and CHAT_WS_RECONNECT_SPREAD applied.
+func ShutdownConfigFromEnv() (ShutdownConfig, error) {
+	config := DefaultShutdownConfig()
+	overrides := map[string]*time.Duration{
+		env.ShutdownDrainDelay: &config.DrainDelay,
+		env.ShutdownTimeout:    &config.Timeout,
+		env.WSReconnectSpread:  &config.ReconnectSpread,
+	}
+	for key, target := range overrides {
+		raw := env.Get(key)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			return ShutdownConfig{}, fmt.Errorf("shutdown: invalid %s %q", key, raw)
+		}
+		*target = parsed
+	}
+	return config, nil
+}
+
+// SetShutdownConfig replaces how the server drains. It must be called before
+// Run.
+func (s *APIServer) SetShutdownConfig(config ShutdownConfig) {
+	s.shutdown = config
+}
+
+// Ready reports whether the server takes new work; it turns false once
+// Shutdown starts.
+func (s *APIServer) Ready() bool {
+	return !s.draining.Load()
+}
+
+// Shutdown drains the server: readiness fails first, and after DrainDelay the
+// listener closes, websocket clients are told to reconnect elsewhere and the
+// requests in flight and in the request queue get until Timeout to finish.
+func (s *APIServer) Shutdown() error {
+	s.draining.Store(true)
+	log.Printf("Server %s draining", s.listenAddr)
+	time.Sleep(s.shutdown.DrainDelay)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.shutdown.Timeout)
+	defer cancel()
+
+	var errs []error
+	// Sockets and streams are closed before the listener, as Shutdown would
+	// wait for the streams and does not track hijacked connections.
+	if s.handler != nil {
+		if err := s.handler.Drain(ctx, s.shutdown.ReconnectSpread); err != nil {
+			errs = append(errs, fmt.Errorf("drain websockets: %w", err))
+		}
+	}
+	if s.httpServer != nil {
+		if err := s.httpServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("stop listener: %w", err))
+		}
+	}
+	if s.requestQueueManager != nil {
+		if err := s.requestQueueManager.ShutdownContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("drain request queue: %w", err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// serve runs srv until ctx is done and then shuts the server down.
+func (s *APIServer) serve(ctx context.Context, srv *http.Server) error {
+	s.httpServer = srv
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+	return s.Shutdown()
+}
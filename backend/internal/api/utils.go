@@ -18,13 +18,6 @@ func WriteJSON(w http.ResponseWriter, status int, v any) error {
 }
 
 func (s *APIServer) MakeHTTPHandleFunc(f apiFunc, authMiddleware ...middleware.Middleware) http.HandlerFunc {
-	corsConfig := middleware.CORSConfig{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PATCH", "PUT", "OPTIONS", "DELETE"},
-		AllowedHeaders:   []string{"Content-Type", "X-Requested-With", "Authorization", "X-Tenant-Key", "X-Visitor-Token"},
-		AllowCredentials: true,
-	}
-
 	baseHandler := func(w http.ResponseWriter, r *http.Request) {
 		errc := make(chan error, 1)
 
@@ -36,18 +29,48 @@ func (s *APIServer) MakeHTTPHandleFunc(f apiFunc, authMiddleware ...middleware.M
 			Errc: errc,
 		}
 
-		s.requestQueueManager.EnqueueJob(job)
-
-		err := <-errc
-		if err != nil {
-			var httpErr *HTTPError
-			if errors.As(err, &httpErr) {
-				fmt.Println(httpErr.ErrorLog)
-				WriteJSON(w, httpErr.StatusCode, ApiError{Error: httpErr.Message})
-			} else {
-				WriteJSON(w, http.StatusInternalServerError, ApiError{Error: "Internal server error"})
-			}
+		if err := s.requestQueueManager.EnqueueJob(job); err != nil {
+			WriteJSON(w, http.StatusServiceUnavailable, ApiError{Error: "Server is shutting down"})
+			return
 		}
+
+		writeAPIError(w, <-errc)
+	}
+
+	return makeHandleFunc(baseHandler, authMiddleware)
+}
+
+// MakeStreamHandleFunc is MakeHTTPHandleFunc for handlers that hold their
+// request open, such as event streams and long polls. They run on the request
+// goroutine rather than the request queue, whose workers they would otherwise
+// occupy for as long as the client stays connected.
+func (s *APIServer) MakeStreamHandleFunc(f apiFunc, authMiddleware ...middleware.Middleware) http.HandlerFunc {
+	baseHandler := func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, f(w, r))
+	}
+
+	return makeHandleFunc(baseHandler, authMiddleware)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	if err == nil {
+		return
+	}
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		fmt.Println(httpErr.ErrorLog)
+		WriteJSON(w, httpErr.StatusCode, ApiError{Error: httpErr.Message})
+	} else {
+		WriteJSON(w, http.StatusInternalServerError, ApiError{Error: "Internal server error"})
+	}
+}
+
+func makeHandleFunc(baseHandler http.HandlerFunc, authMiddleware []middleware.Middleware) http.HandlerFunc {
+	corsConfig := middleware.CORSConfig{
+		AllowedOrigins:   []string{"*"},
+		AllowedMethods:   []string{"GET", "POST", "PATCH", "PUT", "OPTIONS", "DELETE"},
+		AllowedHeaders:   []string{"Content-Type", "X-Requested-With", "Authorization", "X-Tenant-Key", "X-Visitor-Token"},
+		AllowCredentials: true,
 	}
 
 	middlewares := []middleware.Middleware{
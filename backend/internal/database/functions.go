@@ -77,6 +77,21 @@ func (c *DynamoDBClient) UpdateItem(
 	exprAttrValues map[string]types.AttributeValue,
 	exprAttrNames map[string]string,
 	out interface{},
+) error {
+	return c.UpdateItemWithCondition(ctx, tableName, key, updateExpr, "", exprAttrValues, exprAttrNames, out)
+}
+
+// UpdateItemWithCondition is UpdateItem guarded by condExpr. A failed
+// condition surfaces as *types.ConditionalCheckFailedException.
+func (c *DynamoDBClient) UpdateItemWithCondition(
+	ctx context.Context,
+	tableName string,
+	key map[string]types.AttributeValue,
+	updateExpr string,
+	condExpr string,
+	exprAttrValues map[string]types.AttributeValue,
+	exprAttrNames map[string]string,
+	out interface{},
 ) error {
 	input := &dynamodb.UpdateItemInput{
 		TableName:                 aws.String(tableName),
@@ -86,6 +101,9 @@ func (c *DynamoDBClient) UpdateItem(
 		ExpressionAttributeNames:  exprAttrNames,
 		ReturnValues:              types.ReturnValueAllNew,
 	}
+	if condExpr != "" {
+		input.ConditionExpression = aws.String(condExpr)
+	}
 
 	res, err := c.svc.UpdateItem(ctx, input)
 	if err != nil {
@@ -448,6 +466,60 @@ func (c *DynamoDBClient) QueryPaginated(
 	}, nil
 }
 
+// QueryPaginatedWithFilter is QueryPaginated with a filter expression and
+// attribute names. The page size limits items read before filtering, so a page
+// may hold fewer items than requested while HasMore is still true.
+func (c *DynamoDBClient) QueryPaginatedWithFilter(
+	ctx context.Context,
+	tableName string,
+	indexName *string,
+	keyCondExpr string,
+	filterExpr *string,
+	exprAttrValues map[string]types.AttributeValue,
+	exprAttrNames map[string]string,
+	pageSize int,
+	lastEvaluatedKey map[string]types.AttributeValue,
+	scanIndexForward *bool,
+) (*PaginatedScanResult, error) {
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    aws.String(keyCondExpr),
+		ExpressionAttributeValues: exprAttrValues,
+		Limit:                     aws.Int32(int32(pageSize)),
+	}
+
+	if indexName != nil {
+		input.IndexName = indexName
+	}
+	if filterExpr != nil {
+		input.FilterExpression = filterExpr
+	}
+	if len(exprAttrNames) > 0 {
+		input.ExpressionAttributeNames = exprAttrNames
+	}
+	if lastEvaluatedKey != nil {
+		input.ExclusiveStartKey = lastEvaluatedKey
+	}
+	if scanIndexForward != nil {
+		input.ScanIndexForward = aws.Bool(*scanIndexForward)
+	}
+
+	result, err := c.svc.Query(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("query paginated %s[%s]: %w", tableName, aws.ToString(indexName), err)
+	}
+
+	return &PaginatedScanResult{
+		Items:            result.Items,
+		LastEvaluatedKey: result.LastEvaluatedKey,
+		HasMore:          result.LastEvaluatedKey != nil,
+	}, nil
+}
+
 // QueryAll performs a complete query, handling pagination internally.
 func (c *DynamoDBClient) QueryAll(
 	ctx context.Context,
@@ -1,28 +1,121 @@
 package dto
 
 type ConversationMetadata struct {
-	ConversationID  string            `json:"conversationId"`
-	VisitorID       string            `json:"visitorId"`
-	VisitorName     string            `json:"visitorName,omitempty"`
-	VisitorEmail    string            `json:"visitorEmail,omitempty"`
-	Status          string            `json:"status"`
-	AssignedUserID  string            `json:"assignedUserId,omitempty"`
-	TenantStartedAt string            `json:"tenantStartedAt,omitempty"`
-	TenantStartedBy string            `json:"tenantStartedBy,omitempty"`
-	CreatedAt       string            `json:"createdAt"`
-	UpdatedAt       string            `json:"updatedAt"`
-	LastMessageAt   string            `json:"lastMessageAt"`
-	OriginURL       string            `json:"originUrl,omitempty"`
-	Metadata        map[string]string `json:"metadata,omitempty"`
+	ConversationID    string                     `json:"conversationId"`
+	VisitorID         string                     `json:"visitorId"`
+	VisitorName       string                     `json:"visitorName,omitempty"`
+	VisitorEmail      string                     `json:"visitorEmail,omitempty"`
+	Status            string                     `json:"status"`
+	AssignedUserID    string                     `json:"assignedUserId,omitempty"`
+	AssignmentHistory []AssignmentRecordResponse `json:"assignmentHistory,omitempty"`
+	TenantStartedAt   string                     `json:"tenantStartedAt,omitempty"`
+	TenantStartedBy   string                     `json:"tenantStartedBy,omitempty"`
+	CreatedAt         string                     `json:"createdAt"`
+	UpdatedAt         string                     `json:"updatedAt"`
+	LastMessageAt     string                     `json:"lastMessageAt"`
+	OriginURL         string                     `json:"originUrl,omitempty"`
+	ClosedAt          string                     `json:"closedAt,omitempty"`
+	ClosedBy          string                     `json:"closedBy,omitempty"`
+	CloseReason       string                     `json:"closeReason,omitempty"`
+	ArchivedAt        string                     `json:"archivedAt,omitempty"`
+	ArchivedBy        string                     `json:"archivedBy,omitempty"`
+	Metadata          map[string]string          `json:"metadata,omitempty"`
+	UnreadCount       *int                       `json:"unreadCount,omitempty"`
+}
+
+type AssignmentRecordResponse struct {
+	AssignedUserID string `json:"assignedUserId,omitempty"`
+	PreviousUserID string `json:"previousUserId,omitempty"`
+	AssignedBy     string `json:"assignedBy"`
+	AssignedAt     string `json:"assignedAt"`
 }
 
 type MessageResponse struct {
-	MessageID      string `json:"messageId"`
-	ConversationID string `json:"conversationId"`
-	SenderType     string `json:"senderType"`
-	SenderID       string `json:"senderId"`
-	Body           string `json:"body"`
-	CreatedAt      string `json:"createdAt"`
+	MessageID      string               `json:"messageId"`
+	ConversationID string               `json:"conversationId"`
+	SenderType     string               `json:"senderType"`
+	SenderID       string               `json:"senderId"`
+	Body           string               `json:"body"`
+	CreatedAt      string               `json:"createdAt"`
+	Type           string               `json:"type"`
+	Content        *MessageContent      `json:"content,omitempty"`
+	Mentions       []string             `json:"mentions,omitempty"`
+	EditedAt       string               `json:"editedAt,omitempty"`
+	DeletedAt      string               `json:"deletedAt,omitempty"`
+	Attachments    []AttachmentResponse `json:"attachments,omitempty"`
+}
+
+// MessageContent is the structured part of a message that is not plain text.
+// Body always holds a plain text rendering of it for clients that ignore it.
+type MessageContent struct {
+	Text         string        `json:"text,omitempty"`
+	QuickReplies []QuickReply  `json:"quickReplies,omitempty"`
+	Card         *MessageCard  `json:"card,omitempty"`
+	Form         *MessageForm  `json:"form,omitempty"`
+	FormResponse *FormResponse `json:"formResponse,omitempty"`
+	Event        *SystemEvent  `json:"event,omitempty"`
+}
+
+type QuickReply struct {
+	Label string `json:"label"`
+	Value string `json:"value,omitempty"`
+}
+
+type MessageCard struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+}
+
+type MessageForm struct {
+	Fields      []FormField `json:"fields"`
+	SubmitLabel string      `json:"submitLabel,omitempty"`
+}
+
+type FormField struct {
+	Name     string   `json:"name"`
+	Label    string   `json:"label,omitempty"`
+	Type     string   `json:"type,omitempty"`
+	Required bool     `json:"required,omitempty"`
+	Options  []string `json:"options,omitempty"`
+}
+
+type FormResponse struct {
+	FormMessageID string            `json:"formMessageId"`
+	Values        map[string]string `json:"values"`
+}
+
+type SystemEvent struct {
+	Kind      string `json:"kind"`
+	ActorID   string `json:"actorId,omitempty"`
+	ActorName string `json:"actorName,omitempty"`
+}
+
+// AttachmentResponse is a file sent with a message. URL is signed and expires
+// after a while; listing the messages again returns fresh ones.
+type AttachmentResponse struct {
+	AttachmentID string `json:"attachmentId"`
+	FileName     string `json:"fileName"`
+	ContentType  string `json:"contentType"`
+	Size         int64  `json:"size"`
+	URL          string `json:"url"`
+}
+
+// MessageRevisionResponse is a body a message had before it was edited or
+// deleted.
+type MessageRevisionResponse struct {
+	Body        string               `json:"body"`
+	CreatedAt   string               `json:"createdAt"`
+	ReplacedAt  string               `json:"replacedAt"`
+	ReplacedBy  string               `json:"replacedBy"`
+	Action      string               `json:"action"`
+	Attachments []AttachmentResponse `json:"attachments,omitempty"`
+}
+
+type MessageHistoryResponse struct {
+	Message   MessageResponse           `json:"message"`
+	Revisions []MessageRevisionResponse `json:"revisions"`
 }
 
 type CreateConversationRequest struct {
@@ -55,9 +148,13 @@ type CreateConversationResponse struct {
 	Message      MessageResponse      `json:"message"`
 }
 
+// PostVisitorMessageRequest posts a text message, or a form response when
+// Type is "form_response".
 type PostVisitorMessageRequest struct {
-	Body         string `json:"body"`
-	VisitorToken string `json:"visitorToken"`
+	Body         string          `json:"body"`
+	VisitorToken string          `json:"visitorToken"`
+	Type         string          `json:"type,omitempty"`
+	Content      *MessageContent `json:"content,omitempty"`
 }
 
 type AssignConversationEmailRequest struct {
@@ -69,16 +166,77 @@ type AssignConversationEmailResponse struct {
 	Conversation ConversationMetadata `json:"conversation"`
 }
 
+// PostAgentMessageRequest posts a text message, or quick replies, a card or
+// a form as selected by Type. CannedResponseID posts a saved reply of the
+// tenant instead, with its placeholders filled in, and Body is ignored.
 type PostAgentMessageRequest struct {
-	Body string `json:"body"`
+	Body             string          `json:"body"`
+	Type             string          `json:"type,omitempty"`
+	Content          *MessageContent `json:"content,omitempty"`
+	CannedResponseID string          `json:"cannedResponseId,omitempty"`
+}
+
+// EditMessageRequest replaces the body of a message. VisitorToken is only used
+// on the public route.
+type EditMessageRequest struct {
+	Body         string `json:"body"`
+	VisitorToken string `json:"visitorToken,omitempty"`
+}
+
+type DeleteMessageRequest struct {
+	VisitorToken string `json:"visitorToken,omitempty"`
+}
+
+type CloseConversationRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type MarkReadRequest struct {
+	MessageID    string `json:"messageId,omitempty"`
+	VisitorToken string `json:"visitorToken,omitempty"`
+}
+
+type ReadReceiptResponse struct {
+	ConversationID    string `json:"conversationId"`
+	ReaderType        string `json:"readerType"`
+	ReaderID          string `json:"readerId"`
+	LastReadMessageID string `json:"lastReadMessageId"`
+	LastReadAt        string `json:"lastReadAt"`
+	UnreadCount       int    `json:"unreadCount"`
+}
+
+type ConversationResponse struct {
+	Conversation ConversationMetadata `json:"conversation"`
+}
+
+type AssignConversationRequest struct {
+	UserID string `json:"userId"`
+}
+
+type ConversationAssignmentResponse struct {
+	Conversation ConversationMetadata     `json:"conversation"`
+	Assignment   AssignmentRecordResponse `json:"assignment"`
 }
 
 type ListConversationsResponse struct {
 	Conversations []ConversationMetadata `json:"conversations"`
+	NextCursor    string                 `json:"nextCursor,omitempty"`
 }
 
 type ListMessagesResponse struct {
-	Messages []MessageResponse `json:"messages"`
+	Messages   []MessageResponse `json:"messages"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+type SearchHitResponse struct {
+	Message      MessageResponse      `json:"message"`
+	Snippet      string               `json:"snippet"`
+	Conversation ConversationMetadata `json:"conversation"`
+}
+
+type SearchMessagesResponse struct {
+	Query string              `json:"query"`
+	Hits  []SearchHitResponse `json:"hits"`
 }
 
 type ConversationUsageResponse struct {
@@ -88,3 +246,25 @@ type ConversationUsageResponse struct {
 	PeriodEnd            string `json:"periodEnd"`
 	ConversationsStarted int    `json:"conversationsStarted"`
 }
+
+type PresenceEntryResponse struct {
+	ParticipantType string   `json:"participantType"`
+	ParticipantID   string   `json:"participantId"`
+	Status          string   `json:"status"`
+	ConversationIDs []string `json:"conversationIds,omitempty"`
+	LastSeenAt      string   `json:"lastSeenAt"`
+}
+
+type PresenceResponse struct {
+	Participants []PresenceEntryResponse `json:"participants"`
+}
+
+type CreateWebsocketTicketRequest struct {
+	ConversationID string `json:"conversationId,omitempty"`
+	VisitorToken   string `json:"visitorToken,omitempty"`
+}
+
+type WebsocketTicketResponse struct {
+	Ticket    string `json:"ticket"`
+	ExpiresAt string `json:"expiresAt"`
+}
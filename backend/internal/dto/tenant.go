@@ -5,7 +5,9 @@ type UpdateTenantRequest struct {
 }
 
 type TenantSettingsResponse struct {
-	Widget WidgetSettingsResponse `json:"widget"`
+	Widget      WidgetSettingsResponse     `json:"widget"`
+	Routing     RoutingSettingsResponse    `json:"routing"`
+	Attachments AttachmentSettingsResponse `json:"attachments"`
 }
 
 type WidgetSettingsResponse struct {
@@ -24,6 +26,32 @@ type WidgetSettingsResultResponse struct {
 	Widget WidgetSettingsResponse `json:"widget"`
 }
 
+type RoutingSettingsResponse struct {
+	Strategy string `json:"strategy"`
+}
+
+type UpdateRoutingSettingsRequest struct {
+	Strategy string `json:"strategy"`
+}
+
+type RoutingSettingsResultResponse struct {
+	Routing RoutingSettingsResponse `json:"routing"`
+}
+
+type AttachmentSettingsResponse struct {
+	MaxBytes     int64    `json:"maxBytes"`
+	AllowedTypes []string `json:"allowedTypes"`
+}
+
+type UpdateAttachmentSettingsRequest struct {
+	MaxBytes     int64    `json:"maxBytes"`
+	AllowedTypes []string `json:"allowedTypes"`
+}
+
+type AttachmentSettingsResultResponse struct {
+	Attachments AttachmentSettingsResponse `json:"attachments"`
+}
+
 type AddTenantUserRequest struct {
 	Name     string `json:"name"`
 	Email    string `json:"email"`
@@ -86,3 +114,34 @@ type CreateTenantAPIKeyResponse struct {
 type DeleteTenantAPIKeyRequest struct {
 	KeyID string `json:"keyId"`
 }
+
+// CannedResponse is a saved reply of a tenant. Body may hold the placeholders
+// {{visitor.name}}, {{visitor.email}} and {{agent.name}}, optionally with a
+// fallback as in {{visitor.name|there}}.
+type CannedResponse struct {
+	ResponseID string `json:"responseId"`
+	Title      string `json:"title"`
+	Shortcut   string `json:"shortcut,omitempty"`
+	Folder     string `json:"folder,omitempty"`
+	Body       string `json:"body"`
+	CreatedBy  string `json:"createdBy"`
+	CreatedAt  string `json:"createdAt"`
+	UpdatedAt  string `json:"updatedAt,omitempty"`
+	UsageCount int    `json:"usageCount"`
+	LastUsedAt string `json:"lastUsedAt,omitempty"`
+}
+
+type CannedResponseListResponse struct {
+	CannedResponses []CannedResponse `json:"cannedResponses"`
+}
+
+type CannedResponseRequest struct {
+	Title    string `json:"title"`
+	Shortcut string `json:"shortcut,omitempty"`
+	Folder   string `json:"folder,omitempty"`
+	Body     string `json:"body"`
+}
+
+type CannedResponseResultResponse struct {
+	CannedResponse CannedResponse `json:"cannedResponse"`
+}
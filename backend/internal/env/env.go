@@ -5,18 +5,35 @@ import (
 )
 
 const (
-	AWSRegion              = "AWS_REGION"
-	AWSID                  = "AWS_ID"
-	AWSSecret              = "AWS_SECRET"
-	AWSToken               = "AWS_TOKEN"
-	DynamoDBEndpoint       = "DYNAMODB_ENDPOINT"
-	UserSecretKey          = "USER_SECRET"
-	AdminSecretKey         = "ADMIN_SECRET"
-	AuthRedisURL           = "AUTH_REDIS_URL"
-	AuthRedisPass          = "AUTH_REDIS_PASS"
-	ChatRedisURL           = "CHAT_REDIS_URL"
-	ChatRedisPass          = "CHAT_REDIS_PASS"
-	WebUrl                 = "WEB_URL"
+	AWSRegion             = "AWS_REGION"
+	AWSID                 = "AWS_ID"
+	AWSSecret             = "AWS_SECRET"
+	AWSToken              = "AWS_TOKEN"
+	DynamoDBEndpoint      = "DYNAMODB_ENDPOINT"
+	UserSecretKey         = "USER_SECRET"
+	AdminSecretKey        = "ADMIN_SECRET"
+	AuthRedisURL          = "AUTH_REDIS_URL"
+	AuthRedisPass         = "AUTH_REDIS_PASS"
+	ChatRedisURL          = "CHAT_REDIS_URL"
+	ChatRedisPass         = "CHAT_REDIS_PASS"
+	ChatBroker            = "CHAT_BROKER"
+	WebUrl                = "WEB_URL"
+	SearchSnapshotPath    = "CHAT_SEARCH_SNAPSHOT"
+	SearchRebuildInterval = "CHAT_SEARCH_REBUILD_INTERVAL"
+	WSConversationPolicy  = "CHAT_WS_CONVERSATION_POLICY"
+	WSConversationBuffer  = "CHAT_WS_CONVERSATION_BUFFER"
+	WSNotificationPolicy  = "CHAT_WS_NOTIFICATION_POLICY"
+	WSNotificationBuffer  = "CHAT_WS_NOTIFICATION_BUFFER"
+	WSBlockTimeout        = "CHAT_WS_BLOCK_TIMEOUT"
+	WSReconnectSpread     = "CHAT_WS_RECONNECT_SPREAD"
+	ShutdownDrainDelay    = "SHUTDOWN_DRAIN_DELAY"
+	ShutdownTimeout       = "SHUTDOWN_TIMEOUT"
+	BlobStore             = "CHAT_BLOB_STORE"
+	BlobDir               = "CHAT_BLOB_DIR"
+	BlobURL               = "CHAT_BLOB_URL"
+	S3Bucket              = "CHAT_S3_BUCKET"
+	S3Endpoint            = "CHAT_S3_ENDPOINT"
+	S3Region              = "CHAT_S3_REGION"
 )
 
 func init() {
@@ -27,7 +44,6 @@ func init() {
 		// AWSToken,
 		UserSecretKey,
 		AuthRedisURL,
-		ChatRedisURL,
 		WebUrl,
 	}
 	for _, key := range required {
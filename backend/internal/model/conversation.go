@@ -5,8 +5,9 @@ import "fmt"
 type ConversationStatus string
 
 const (
-	ConversationStatusOpen   ConversationStatus = "open"
-	ConversationStatusClosed ConversationStatus = "closed"
+	ConversationStatusOpen     ConversationStatus = "open"
+	ConversationStatusClosed   ConversationStatus = "closed"
+	ConversationStatusArchived ConversationStatus = "archived"
 )
 
 func ConversationPK(tenantID, conversationID string) string {
@@ -21,22 +22,136 @@ func VisitorPK(tenantID, visitorID string) string {
 	return fmt.Sprintf("%s#%s", tenantID, visitorID)
 }
 
+// Message sender types. System messages record conversation events such as
+// an agent joining; they have no sender ID and do not count as messages of
+// either side.
+const (
+	MessageSenderVisitor = "visitor"
+	MessageSenderAgent   = "agent"
+	MessageSenderSystem  = "system"
+)
+
+// Message content types. Messages stored without a type are text messages.
+const (
+	MessageTypeText         = "text"
+	MessageTypeQuickReplies = "quick_replies"
+	MessageTypeCard         = "card"
+	MessageTypeForm         = "form"
+	MessageTypeFormResponse = "form_response"
+	MessageTypeSystem       = "system"
+	// MessageTypeNote is an internal note between agents, which the visitor
+	// never sees.
+	MessageTypeNote = "note"
+)
+
+// System events recorded by system messages.
+const (
+	SystemEventAgentJoined          = "agent.joined"
+	SystemEventAgentLeft            = "agent.left"
+	SystemEventConversationClosed   = "conversation.closed"
+	SystemEventConversationReopened = "conversation.reopened"
+)
+
+// ReadMarkerVisitor is the ReadMarkers key of the conversation visitor; tenant
+// users are keyed by their user ID.
+const ReadMarkerVisitor = "visitor"
+
+// ConversationUnassigned is the tenantAssignee key suffix used for
+// conversations without an assignee so they can be queried directly.
+const ConversationUnassigned = "unassigned"
+
+// TenantScopedKey builds the tenant-prefixed partition keys used by the
+// Conversations filter indexes.
+func TenantScopedKey(tenantID, value string) string {
+	return fmt.Sprintf("%s#%s", tenantID, value)
+}
+
 type ConversationItem struct {
-	PK              string             `dynamodbav:"pk"`
-	ConversationID  string             `dynamodbav:"conversationId"`
-	TenantID        string             `dynamodbav:"tenantId"`
-	VisitorID       string             `dynamodbav:"visitorId"`
-	VisitorName     string             `dynamodbav:"visitorName,omitempty"`
-	VisitorEmail    string             `dynamodbav:"visitorEmail,omitempty"`
-	Status          ConversationStatus `dynamodbav:"status"`
-	AssignedUserID  string             `dynamodbav:"assignedUserId,omitempty"`
-	TenantStartedAt string             `dynamodbav:"tenantStartedAt,omitempty"`
-	TenantStartedBy string             `dynamodbav:"tenantStartedBy,omitempty"`
-	Metadata        map[string]string  `dynamodbav:"metadata,omitempty"`
-	OriginURL       string             `dynamodbav:"originUrl,omitempty"`
-	CreatedAt       string             `dynamodbav:"createdAt"`
-	UpdatedAt       string             `dynamodbav:"updatedAt"`
-	LastMessageAt   string             `dynamodbav:"lastMessageAt"`
+	PK                string             `dynamodbav:"pk"`
+	ConversationID    string             `dynamodbav:"conversationId"`
+	TenantID          string             `dynamodbav:"tenantId"`
+	VisitorID         string             `dynamodbav:"visitorId"`
+	VisitorName       string             `dynamodbav:"visitorName,omitempty"`
+	VisitorEmail      string             `dynamodbav:"visitorEmail,omitempty"`
+	Status            ConversationStatus `dynamodbav:"status"`
+	AssignedUserID    string             `dynamodbav:"assignedUserId,omitempty"`
+	AssignmentHistory []AssignmentRecord `dynamodbav:"assignmentHistory,omitempty"`
+	TenantStartedAt   string             `dynamodbav:"tenantStartedAt,omitempty"`
+	TenantStartedBy   string             `dynamodbav:"tenantStartedBy,omitempty"`
+	Metadata          map[string]string  `dynamodbav:"metadata,omitempty"`
+	OriginURL         string             `dynamodbav:"originUrl,omitempty"`
+	ClosedAt          string             `dynamodbav:"closedAt,omitempty"`
+	ClosedBy          string             `dynamodbav:"closedBy,omitempty"`
+	CloseReason       string             `dynamodbav:"closeReason,omitempty"`
+	ArchivedAt        string             `dynamodbav:"archivedAt,omitempty"`
+	ArchivedBy        string             `dynamodbav:"archivedBy,omitempty"`
+	CreatedAt         string             `dynamodbav:"createdAt"`
+	UpdatedAt         string             `dynamodbav:"updatedAt"`
+	LastMessageAt     string             `dynamodbav:"lastMessageAt"`
+
+	// Message counters per sender side. Together with ReadMarkers they give the
+	// unread count of each participant without reading the messages.
+	VisitorMessageCount int                   `dynamodbav:"visitorMessageCount,omitempty"`
+	AgentMessageCount   int                   `dynamodbav:"agentMessageCount,omitempty"`
+	ReadMarkers         map[string]ReadMarker `dynamodbav:"readMarkers,omitempty"`
+
+	TenantStatus       string `dynamodbav:"tenantStatus,omitempty"`
+	TenantAssignee     string `dynamodbav:"tenantAssignee,omitempty"`
+	TenantVisitor      string `dynamodbav:"tenantVisitor,omitempty"`
+	TenantVisitorEmail string `dynamodbav:"tenantVisitorEmail,omitempty"`
+}
+
+// SetIndexKeys refreshes the composite attributes backing the filter indexes
+// from the conversation fields.
+func (c *ConversationItem) SetIndexKeys() {
+	c.TenantStatus = TenantScopedKey(c.TenantID, string(c.Status))
+	assignee := c.AssignedUserID
+	if assignee == "" {
+		assignee = ConversationUnassigned
+	}
+	c.TenantAssignee = TenantScopedKey(c.TenantID, assignee)
+	c.TenantVisitor = ""
+	if c.VisitorID != "" {
+		c.TenantVisitor = TenantScopedKey(c.TenantID, c.VisitorID)
+	}
+	c.TenantVisitorEmail = ""
+	if c.VisitorEmail != "" {
+		c.TenantVisitorEmail = TenantScopedKey(c.TenantID, c.VisitorEmail)
+	}
+}
+
+// UnreadForUser returns how many visitor messages tenant user userID has not
+// read yet.
+func (c ConversationItem) UnreadForUser(userID string) int {
+	return unreadCount(c.VisitorMessageCount, c.ReadMarkers[userID])
+}
+
+// UnreadForVisitor returns how many agent messages the visitor has not read yet.
+func (c ConversationItem) UnreadForVisitor() int {
+	return unreadCount(c.AgentMessageCount, c.ReadMarkers[ReadMarkerVisitor])
+}
+
+func unreadCount(total int, marker ReadMarker) int {
+	if total <= marker.ReadCount {
+		return 0
+	}
+	return total - marker.ReadCount
+}
+
+// ReadMarker is the last message a participant has read. ReadCount is the
+// number of messages from the other side up to and including that message.
+type ReadMarker struct {
+	MessageID        string `dynamodbav:"messageId"`
+	MessageCreatedAt string `dynamodbav:"messageCreatedAt"`
+	ReadAt           string `dynamodbav:"readAt"`
+	ReadCount        int    `dynamodbav:"readCount"`
+}
+
+type AssignmentRecord struct {
+	AssignedUserID string `dynamodbav:"assignedUserId,omitempty"`
+	PreviousUserID string `dynamodbav:"previousUserId,omitempty"`
+	AssignedBy     string `dynamodbav:"assignedBy"`
+	AssignedAt     string `dynamodbav:"assignedAt"`
 }
 
 type MessageItem struct {
@@ -48,6 +163,143 @@ type MessageItem struct {
 	SenderID       string `dynamodbav:"senderId"`
 	Body           string `dynamodbav:"body"`
 	CreatedAt      string `dynamodbav:"createdAt"`
+
+	// Type is one of the MessageType constants, empty for text. Messages of
+	// other types carry their payload in Content and a plain text rendering
+	// of it in Body, for clients that only show text.
+	Type    string          `dynamodbav:"type,omitempty"`
+	Content *MessageContent `dynamodbav:"content,omitempty"`
+
+	// Mentions lists the tenant users named with @ in a note.
+	Mentions []string `dynamodbav:"mentions,omitempty"`
+
+	// Conversation message counters right after this message was posted, so
+	// a read marker on it knows how many messages it covers. Both are zero for
+	// messages stored before the counters existed.
+	VisitorCount int `dynamodbav:"visitorCount,omitempty"`
+	AgentCount   int `dynamodbav:"agentCount,omitempty"`
+
+	Attachments []Attachment `dynamodbav:"attachments,omitempty"`
+
+	// Set when the sender edits or deletes the message. A deleted message
+	// stays in the conversation as a tombstone with an empty body. Revisions
+	// holds every earlier body, oldest first.
+	EditedAt  string            `dynamodbav:"editedAt,omitempty"`
+	DeletedAt string            `dynamodbav:"deletedAt,omitempty"`
+	Revisions []MessageRevision `dynamodbav:"revisions,omitempty"`
+}
+
+// Actions recorded on a MessageRevision.
+const (
+	MessageRevisionEdited  = "edited"
+	MessageRevisionDeleted = "deleted"
+)
+
+// MessageRevision is a body a message had before its sender edited or deleted
+// it. CreatedAt is when that body was written and ReplacedAt when Action
+// replaced it.
+type MessageRevision struct {
+	Body       string `dynamodbav:"body"`
+	CreatedAt  string `dynamodbav:"createdAt"`
+	ReplacedAt string `dynamodbav:"replacedAt"`
+	ReplacedBy string `dynamodbav:"replacedBy"`
+	Action     string `dynamodbav:"action"`
+
+	// Attachments the message lost when it was deleted.
+	Attachments []Attachment `dynamodbav:"attachments,omitempty"`
+}
+
+// Attachment is a file sent with a message. Its contents live in the blob
+// store under Key. URL is a signed download URL filled in when the message is
+// returned; it is never stored.
+type Attachment struct {
+	AttachmentID string `dynamodbav:"attachmentId"`
+	Key          string `dynamodbav:"key"`
+	FileName     string `dynamodbav:"fileName"`
+	ContentType  string `dynamodbav:"contentType"`
+	Size         int64  `dynamodbav:"size"`
+	URL          string `dynamodbav:"-"`
+}
+
+// MessageContent is the payload of a message that is not plain text. Text is
+// the prompt shown with quick replies and forms; only the field matching the
+// message type is set otherwise.
+type MessageContent struct {
+	Text         string        `dynamodbav:"text,omitempty"`
+	QuickReplies []QuickReply  `dynamodbav:"quickReplies,omitempty"`
+	Card         *MessageCard  `dynamodbav:"card,omitempty"`
+	Form         *MessageForm  `dynamodbav:"form,omitempty"`
+	FormResponse *FormResponse `dynamodbav:"formResponse,omitempty"`
+	Event        *SystemEvent  `dynamodbav:"event,omitempty"`
+}
+
+// QuickReply is a button offered to the visitor. Choosing it sends Value as a
+// text message.
+type QuickReply struct {
+	Label string `dynamodbav:"label"`
+	Value string `dynamodbav:"value"`
+}
+
+// MessageCard previews a link.
+type MessageCard struct {
+	Title       string `dynamodbav:"title"`
+	Description string `dynamodbav:"description,omitempty"`
+	URL         string `dynamodbav:"url"`
+	ImageURL    string `dynamodbav:"imageUrl,omitempty"`
+}
+
+// MessageForm asks the visitor for the values of Fields, which they send back
+// in a form_response message.
+type MessageForm struct {
+	Fields      []FormField `dynamodbav:"fields"`
+	SubmitLabel string      `dynamodbav:"submitLabel,omitempty"`
+}
+
+// Form field types.
+const (
+	FormFieldText     = "text"
+	FormFieldTextarea = "textarea"
+	FormFieldEmail    = "email"
+	FormFieldNumber   = "number"
+	FormFieldSelect   = "select"
+)
+
+type FormField struct {
+	Name     string   `dynamodbav:"name"`
+	Label    string   `dynamodbav:"label"`
+	Type     string   `dynamodbav:"type"`
+	Required bool     `dynamodbav:"required,omitempty"`
+	Options  []string `dynamodbav:"options,omitempty"`
+}
+
+// FormResponse answers the form sent in message FormMessageID, keyed by field
+// name.
+type FormResponse struct {
+	FormMessageID string            `dynamodbav:"formMessageId"`
+	Values        map[string]string `dynamodbav:"values"`
+}
+
+// SystemEvent is what a system message records. ActorID is the tenant user
+// the event is about, such as the agent who joined.
+type SystemEvent struct {
+	Kind      string `dynamodbav:"kind"`
+	ActorID   string `dynamodbav:"actorId,omitempty"`
+	ActorName string `dynamodbav:"actorName,omitempty"`
+}
+
+// VisibleToVisitor reports whether the visitor of the conversation may see
+// the message, which excludes internal notes.
+func (m MessageItem) VisibleToVisitor() bool {
+	return m.Type != MessageTypeNote
+}
+
+// CountFor returns how many messages senderType had posted in the
+// conversation once this message was posted.
+func (m MessageItem) CountFor(senderType string) int {
+	if senderType == MessageSenderAgent {
+		return m.AgentCount
+	}
+	return m.VisitorCount
 }
 
 type VisitorItem struct {
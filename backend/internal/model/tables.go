@@ -3,22 +3,24 @@ package model
 import "fmt"
 
 const (
-	TenantsTable       = "Tenants"
-	UsersTable         = "Users"
-	ConversationsTable = "Conversations"
-	MessagesTable      = "Messages"
-	VisitorsTable      = "Visitors"
-	TenantInvitesTable = "TenantInvites"
-	TenantAPIKeysTable = "TenantAPIKeys"
+	TenantsTable         = "Tenants"
+	UsersTable           = "Users"
+	ConversationsTable   = "Conversations"
+	MessagesTable        = "Messages"
+	VisitorsTable        = "Visitors"
+	TenantInvitesTable   = "TenantInvites"
+	TenantAPIKeysTable   = "TenantAPIKeys"
+	CannedResponsesTable = "CannedResponses"
 )
 
 type TenantItem struct {
-	TenantID string                 `dynamodbav:"tenantId"`
-	Name     string                 `dynamodbav:"name"`
-	Plan     string                 `dynamodbav:"plan"`
-	Seats    int                    `dynamodbav:"seats"`
-	Settings map[string]interface{} `dynamodbav:"settings,omitempty"`
-	Created  string                 `dynamodbav:"createdAt"`
+	TenantID      string                 `dynamodbav:"tenantId"`
+	Name          string                 `dynamodbav:"name"`
+	Plan          string                 `dynamodbav:"plan"`
+	Seats         int                    `dynamodbav:"seats"`
+	Settings      map[string]interface{} `dynamodbav:"settings,omitempty"`
+	RoutingCursor string                 `dynamodbav:"routingCursor,omitempty"`
+	Created       string                 `dynamodbav:"createdAt"`
 }
 
 type UserItem struct {
@@ -53,6 +55,23 @@ type TenantAPIKeyItem struct {
 	LastUsedAt string `dynamodbav:"lastUsedAt,omitempty"`
 }
 
+// CannedResponseItem is a saved reply of a tenant. Body may hold
+// placeholders such as {{visitor.name}}, which are filled in when an agent
+// posts the reply. UsageCount counts the messages posted from it.
+type CannedResponseItem struct {
+	TenantID   string `dynamodbav:"tenantId"`
+	ResponseID string `dynamodbav:"responseId"`
+	Title      string `dynamodbav:"title"`
+	Shortcut   string `dynamodbav:"shortcut,omitempty"`
+	Folder     string `dynamodbav:"folder,omitempty"`
+	Body       string `dynamodbav:"body"`
+	CreatedBy  string `dynamodbav:"createdBy"`
+	CreatedAt  string `dynamodbav:"createdAt"`
+	UpdatedAt  string `dynamodbav:"updatedAt,omitempty"`
+	UsageCount int    `dynamodbav:"usageCount,omitempty"`
+	LastUsedAt string `dynamodbav:"lastUsedAt,omitempty"`
+}
+
 func TenantScopedPK(tenantID, entityID string) string {
 	return fmt.Sprintf("%s#%s", tenantID, entityID)
 }
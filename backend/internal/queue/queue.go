@@ -1,10 +1,15 @@
 package queue
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
 )
 
+// ErrQueueClosed is returned for jobs enqueued after Shutdown.
+var ErrQueueClosed = errors.New("request queue closed")
+
 type Job struct {
 	Fn   func() error
 	Errc chan error
@@ -14,6 +19,8 @@ type RequestQueueManager struct {
 	JobQueue      chan Job
 	MaxWorkers    int
 	wg            sync.WaitGroup
+	mu            sync.RWMutex
+	closed        bool
 }
 
 func NewRequestQueueManager(queueSize int, maxWorkers int) *RequestQueueManager {
@@ -42,11 +49,40 @@ func (rqm *RequestQueueManager) startWorkers() {
 	}
 }
 
-func (rqm *RequestQueueManager) EnqueueJob(job Job) {
+func (rqm *RequestQueueManager) EnqueueJob(job Job) error {
+	rqm.mu.RLock()
+	defer rqm.mu.RUnlock()
+	if rqm.closed {
+		return ErrQueueClosed
+	}
 	rqm.JobQueue <- job
+	return nil
 }
 
 func (rqm *RequestQueueManager) Shutdown() {
-	close(rqm.JobQueue)
-	rqm.wg.Wait()
+	rqm.ShutdownContext(context.Background())
+}
+
+// ShutdownContext stops accepting jobs and waits for the queued ones to
+// finish. When ctx is done first it returns ctx.Err(), leaving the remaining
+// jobs to the workers.
+func (rqm *RequestQueueManager) ShutdownContext(ctx context.Context) error {
+	rqm.mu.Lock()
+	if !rqm.closed {
+		rqm.closed = true
+		close(rqm.JobQueue)
+	}
+	rqm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		rqm.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
\ No newline at end of file
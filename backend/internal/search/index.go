@@ -0,0 +1,445 @@
+package search
+
+import (
+	"encoding/gob"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	snippetRadius      = 60
+)
+
+// Document is a single indexed message.
+type Document struct {
+	TenantID       string
+	ConversationID string
+	MessageID      string
+	SenderType     string
+	SenderID       string
+	Body           string
+	CreatedAt      string
+}
+
+// Hit is a matching document with an HTML-escaped snippet in which every
+// matched term is wrapped in <mark> tags.
+type Hit struct {
+	Document Document
+	Snippet  string
+}
+
+// Index is an in-memory inverted index over message bodies. Postings are kept
+// per tenant so a query never touches another tenant's documents.
+type Index struct {
+	mu      sync.RWMutex
+	tenants map[string]*tenantIndex
+	// journal records documents added and removed while a rebuild is running
+	// so Commit can carry them over into the rebuilt index.
+	rebuilds int
+	journal  []journalEntry
+}
+
+// journalEntry is an Add, or a Remove of Doc's message, made during a rebuild.
+type journalEntry struct {
+	Doc     Document
+	Removed bool
+}
+
+// Rebuild collects documents into a fresh index that replaces the live one on
+// Commit.
+type Rebuild struct {
+	index *Index
+	next  *Index
+}
+
+type tenantIndex struct {
+	docs     map[string]Document
+	postings map[string]map[string]struct{}
+}
+
+func NewIndex() *Index {
+	return &Index{
+		tenants: make(map[string]*tenantIndex),
+	}
+}
+
+// Add indexes doc, replacing any previous version of the same message.
+func (idx *Index) Add(doc Document) {
+	if doc.TenantID == "" || doc.MessageID == "" {
+		return
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.rebuilds > 0 {
+		idx.journal = append(idx.journal, journalEntry{Doc: doc})
+	}
+	idx.add(doc)
+}
+
+func (idx *Index) add(doc Document) {
+	tenant, ok := idx.tenants[doc.TenantID]
+	if !ok {
+		tenant = &tenantIndex{
+			docs:     make(map[string]Document),
+			postings: make(map[string]map[string]struct{}),
+		}
+		idx.tenants[doc.TenantID] = tenant
+	}
+
+	tenant.remove(doc.MessageID)
+	tenant.docs[doc.MessageID] = doc
+	for _, term := range uniqueTerms(doc.Body) {
+		posting, ok := tenant.postings[term]
+		if !ok {
+			posting = make(map[string]struct{})
+			tenant.postings[term] = posting
+		}
+		posting[doc.MessageID] = struct{}{}
+	}
+}
+
+// Remove drops a message from the index.
+func (idx *Index) Remove(tenantID, messageID string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if idx.rebuilds > 0 {
+		idx.journal = append(idx.journal, journalEntry{
+			Doc:     Document{TenantID: tenantID, MessageID: messageID},
+			Removed: true,
+		})
+	}
+	idx.remove(tenantID, messageID)
+}
+
+func (idx *Index) remove(tenantID, messageID string) {
+	if tenant, ok := idx.tenants[tenantID]; ok {
+		tenant.remove(messageID)
+	}
+}
+
+// Len returns the number of indexed documents across all tenants.
+func (idx *Index) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	total := 0
+	for _, tenant := range idx.tenants {
+		total += len(tenant.docs)
+	}
+	return total
+}
+
+// Latest returns the newest CreatedAt among the indexed documents. After a
+// snapshot load it tells how far the snapshot reaches.
+func (idx *Index) Latest() string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	latest := ""
+	for _, tenant := range idx.tenants {
+		for _, doc := range tenant.docs {
+			if doc.CreatedAt > latest {
+				latest = doc.CreatedAt
+			}
+		}
+	}
+	return latest
+}
+
+// Search returns the tenant documents containing every term of query, newest
+// first.
+func (idx *Index) Search(tenantID, query string, limit int) []Hit {
+	if limit <= 0 || limit > maxSearchLimit {
+		limit = defaultSearchLimit
+	}
+
+	terms := uniqueTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	tenant, ok := idx.tenants[tenantID]
+	if !ok {
+		return nil
+	}
+
+	// Intersect starting from the rarest term to keep the working set small.
+	sort.Slice(terms, func(i, j int) bool {
+		return len(tenant.postings[terms[i]]) < len(tenant.postings[terms[j]])
+	})
+
+	var matches []Document
+	for messageID := range tenant.postings[terms[0]] {
+		found := true
+		for _, term := range terms[1:] {
+			if _, ok := tenant.postings[term][messageID]; !ok {
+				found = false
+				break
+			}
+		}
+		if found {
+			matches = append(matches, tenant.docs[messageID])
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].CreatedAt == matches[j].CreatedAt {
+			return matches[i].MessageID < matches[j].MessageID
+		}
+		return matches[i].CreatedAt > matches[j].CreatedAt
+	})
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	hits := make([]Hit, len(matches))
+	for i, doc := range matches {
+		hits[i] = Hit{
+			Document: doc,
+			Snippet:  highlight(doc.Body, terms),
+		}
+	}
+	return hits
+}
+
+// Replace swaps the index contents for docs in one step so searches never
+// observe a partially rebuilt index.
+func (idx *Index) Replace(docs []Document) {
+	rebuild := idx.StartRebuild()
+	for _, doc := range docs {
+		rebuild.Add(doc)
+	}
+	rebuild.Commit()
+}
+
+// StartRebuild begins building a replacement index. Documents added to the
+// live index before Commit are kept.
+func (idx *Index) StartRebuild() *Rebuild {
+	idx.mu.Lock()
+	idx.rebuilds++
+	idx.mu.Unlock()
+
+	return &Rebuild{index: idx, next: NewIndex()}
+}
+
+func (r *Rebuild) Add(doc Document) {
+	r.next.Add(doc)
+}
+
+// Commit swaps the rebuilt contents into the live index.
+func (r *Rebuild) Commit() {
+	idx := r.index
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, entry := range idx.journal {
+		if entry.Removed {
+			r.next.remove(entry.Doc.TenantID, entry.Doc.MessageID)
+		} else {
+			r.next.add(entry.Doc)
+		}
+	}
+	idx.tenants = r.next.tenants
+	idx.finishRebuild()
+}
+
+// Abort discards the rebuild and leaves the live index untouched.
+func (r *Rebuild) Abort() {
+	r.index.mu.Lock()
+	r.index.finishRebuild()
+	r.index.mu.Unlock()
+}
+
+func (idx *Index) finishRebuild() {
+	idx.rebuilds--
+	if idx.rebuilds <= 0 {
+		idx.rebuilds = 0
+		idx.journal = nil
+	}
+}
+
+// WriteSnapshot serialises every indexed document to w.
+func (idx *Index) WriteSnapshot(w io.Writer) error {
+	idx.mu.RLock()
+	docs := make([]Document, 0)
+	for _, tenant := range idx.tenants {
+		for _, doc := range tenant.docs {
+			docs = append(docs, doc)
+		}
+	}
+	idx.mu.RUnlock()
+
+	return gob.NewEncoder(w).Encode(docs)
+}
+
+// ReadSnapshot replaces the index contents with a snapshot written by
+// WriteSnapshot.
+func (idx *Index) ReadSnapshot(r io.Reader) error {
+	var docs []Document
+	if err := gob.NewDecoder(r).Decode(&docs); err != nil {
+		return err
+	}
+	idx.Replace(docs)
+	return nil
+}
+
+// SaveFile writes a snapshot to path, replacing any previous file atomically.
+func (idx *Index) SaveFile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := idx.WriteSnapshot(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile replaces the index contents with the snapshot stored at path.
+func (idx *Index) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return idx.ReadSnapshot(file)
+}
+
+func (t *tenantIndex) remove(messageID string) {
+	doc, ok := t.docs[messageID]
+	if !ok {
+		return
+	}
+	for _, term := range uniqueTerms(doc.Body) {
+		if posting, ok := t.postings[term]; ok {
+			delete(posting, messageID)
+			if len(posting) == 0 {
+				delete(t.postings, term)
+			}
+		}
+	}
+	delete(t.docs, messageID)
+}
+
+type token struct {
+	term       string
+	start, end int
+}
+
+// tokenize splits text into lower-cased letter/digit runs with their byte
+// offsets in text.
+func tokenize(text string) []token {
+	var tokens []token
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, token{term: strings.ToLower(text[start:i]), start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{term: strings.ToLower(text[start:]), start: start, end: len(text)})
+	}
+	return tokens
+}
+
+func uniqueTerms(text string) []string {
+	seen := make(map[string]struct{})
+	var terms []string
+	for _, tok := range tokenize(text) {
+		if _, ok := seen[tok.term]; ok {
+			continue
+		}
+		seen[tok.term] = struct{}{}
+		terms = append(terms, tok.term)
+	}
+	return terms
+}
+
+// highlight cuts a window around the first matched term and marks every match
+// inside it.
+func highlight(body string, terms []string) string {
+	wanted := make(map[string]struct{}, len(terms))
+	for _, term := range terms {
+		wanted[term] = struct{}{}
+	}
+
+	var matched []token
+	for _, tok := range tokenize(body) {
+		if _, ok := wanted[tok.term]; ok {
+			matched = append(matched, tok)
+		}
+	}
+	if len(matched) == 0 {
+		return html.EscapeString(body)
+	}
+
+	start := clampToRune(body, matched[0].start-snippetRadius)
+	end := clampToRune(body, matched[0].end+snippetRadius)
+
+	var b strings.Builder
+	if start > 0 {
+		b.WriteString("…")
+	}
+	cursor := start
+	for _, tok := range matched {
+		if tok.start < cursor || tok.end > end {
+			continue
+		}
+		b.WriteString(html.EscapeString(body[cursor:tok.start]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(body[tok.start:tok.end]))
+		b.WriteString("</mark>")
+		cursor = tok.end
+	}
+	b.WriteString(html.EscapeString(body[cursor:end]))
+	if end < len(body) {
+		b.WriteString("…")
+	}
+	return b.String()
+}
+
+// clampToRune bounds offset to body and moves it back to a rune boundary.
+func clampToRune(body string, offset int) int {
+	if offset <= 0 {
+		return 0
+	}
+	if offset >= len(body) {
+		return len(body)
+	}
+	for offset > 0 && !isRuneStart(body[offset]) {
+		offset--
+	}
+	return offset
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSearchIsTenantScopedAndRequiresAllTerms(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", ConversationID: "c1", MessageID: "m1", Body: "My invoice is wrong", CreatedAt: "2024-06-01T10:00:00Z"})
+	idx.Add(Document{TenantID: "t1", ConversationID: "c2", MessageID: "m2", Body: "Where is my invoice?", CreatedAt: "2024-06-02T10:00:00Z"})
+	idx.Add(Document{TenantID: "t2", ConversationID: "c3", MessageID: "m3", Body: "Invoice question", CreatedAt: "2024-06-03T10:00:00Z"})
+
+	hits := idx.Search("t1", "INVOICE", 10)
+	if len(hits) != 2 {
+		t.Fatalf("expected 2 hits, got %d", len(hits))
+	}
+	if hits[0].Document.MessageID != "m2" {
+		t.Fatalf("expected newest hit first, got %s", hits[0].Document.MessageID)
+	}
+
+	hits = idx.Search("t1", "invoice wrong", 10)
+	if len(hits) != 1 || hits[0].Document.MessageID != "m1" {
+		t.Fatalf("expected only m1 to match both terms, got %+v", hits)
+	}
+	if hits[0].Snippet != "My <mark>invoice</mark> is <mark>wrong</mark>" {
+		t.Fatalf("unexpected snippet %q", hits[0].Snippet)
+	}
+
+	if hits := idx.Search("t2", "wrong", 10); len(hits) != 0 {
+		t.Fatalf("expected no cross-tenant hits, got %+v", hits)
+	}
+}
+
+func TestAddReplacesAndRemoveDropsDocument(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", MessageID: "m1", Body: "original text"})
+	idx.Add(Document{TenantID: "t1", MessageID: "m1", Body: "edited text"})
+
+	if hits := idx.Search("t1", "original", 10); len(hits) != 0 {
+		t.Fatalf("expected stale terms to be removed, got %+v", hits)
+	}
+	if hits := idx.Search("t1", "edited", 10); len(hits) != 1 {
+		t.Fatalf("expected edited document to match, got %+v", hits)
+	}
+
+	idx.Remove("t1", "m1")
+	if idx.Len() != 0 {
+		t.Fatalf("expected empty index, got %d documents", idx.Len())
+	}
+}
+
+func TestHighlightEscapesAndTrimsLongBodies(t *testing.T) {
+	body := strings.Repeat("filler ", 30) + "<b>refund</b> please " + strings.Repeat("tail ", 30)
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", MessageID: "m1", Body: body})
+
+	hits := idx.Search("t1", "refund", 10)
+	if len(hits) != 1 {
+		t.Fatalf("expected 1 hit, got %d", len(hits))
+	}
+	snippet := hits[0].Snippet
+	if !strings.Contains(snippet, "&lt;b&gt;<mark>refund</mark>&lt;/b&gt;") {
+		t.Fatalf("expected escaped highlighted term, got %q", snippet)
+	}
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Fatalf("expected trimmed snippet, got %q", snippet)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", ConversationID: "c1", MessageID: "m1", Body: "hello there", CreatedAt: "2024-06-02T10:00:00Z"})
+	idx.Add(Document{TenantID: "t2", ConversationID: "c2", MessageID: "m2", Body: "older", CreatedAt: "2024-06-01T10:00:00Z"})
+
+	var buf bytes.Buffer
+	if err := idx.WriteSnapshot(&buf); err != nil {
+		t.Fatalf("WriteSnapshot error: %v", err)
+	}
+
+	restored := NewIndex()
+	if err := restored.ReadSnapshot(&buf); err != nil {
+		t.Fatalf("ReadSnapshot error: %v", err)
+	}
+	if hits := restored.Search("t1", "hello", 10); len(hits) != 1 || hits[0].Document.ConversationID != "c1" {
+		t.Fatalf("unexpected hits after restore %+v", hits)
+	}
+	if latest := restored.Latest(); latest != "2024-06-02T10:00:00Z" {
+		t.Fatalf("expected the snapshot to reach 2024-06-02T10:00:00Z, got %q", latest)
+	}
+}
+
+func TestRebuildKeepsDocumentsAddedDuringScan(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", MessageID: "stale", Body: "stale entry"})
+
+	rebuild := idx.StartRebuild()
+	rebuild.Add(Document{TenantID: "t1", MessageID: "m1", Body: "scanned entry"})
+	idx.Add(Document{TenantID: "t1", MessageID: "m2", Body: "live entry"})
+	rebuild.Commit()
+
+	if hits := idx.Search("t1", "entry", 10); len(hits) != 2 {
+		t.Fatalf("expected scanned and live documents, got %+v", hits)
+	}
+	if hits := idx.Search("t1", "stale", 10); len(hits) != 0 {
+		t.Fatalf("expected stale document to be dropped, got %+v", hits)
+	}
+}
+
+func TestRebuildKeepsDocumentsRemovedDuringScan(t *testing.T) {
+	idx := NewIndex()
+	idx.Add(Document{TenantID: "t1", MessageID: "m1", Body: "deleted entry"})
+
+	rebuild := idx.StartRebuild()
+	rebuild.Add(Document{TenantID: "t1", MessageID: "m1", Body: "deleted entry"})
+	idx.Remove("t1", "m1")
+	rebuild.Commit()
+
+	if hits := idx.Search("t1", "deleted", 10); len(hits) != 0 {
+		t.Fatalf("expected the removed document to stay removed, got %+v", hits)
+	}
+}
@@ -0,0 +1,222 @@
+package conversation
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chat-app-backend/internal/model"
+	tenantservice "chat-app-backend/internal/service/tenant"
+	"chat-app-backend/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// attachmentURLTTL is how long signed attachment URLs handed to clients stay
+// valid. Clients list messages again to get fresh ones.
+const attachmentURLTTL = time.Hour
+
+// sniffLength is how much of an upload is read to detect its content type.
+const sniffLength = 512
+
+const maxAttachmentFileName = 255
+
+// AttachmentUpload is a file sent with a message. Body yields Size bytes.
+type AttachmentUpload struct {
+	FileName    string
+	ContentType string
+	Size        int64
+	Body        io.Reader
+}
+
+func (s *Service) SetBlobStore(store storage.BlobStore) {
+	s.blobs = store
+}
+
+// PostVisitorAttachment stores upload and posts it, with an optional body, as
+// a message of the visitor of token.
+func (s *Service) PostVisitorAttachment(ctx context.Context, token, conversationID, body string, upload AttachmentUpload) (MessageResult, error) {
+	conversation, access, err := s.visitorConversation(ctx, token, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	attachment, err := s.storeAttachment(ctx, conversation, upload)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	result, err := s.postVisitorMessage(ctx, access, messageDraft{Body: body, Attachments: []model.Attachment{attachment}})
+	if err != nil {
+		s.discardAttachment(ctx, attachment, err)
+		return MessageResult{}, err
+	}
+	return s.signedResult(ctx, result)
+}
+
+// PostAgentAttachment stores upload and posts it, with an optional body, as a
+// message of the calling tenant user.
+func (s *Service) PostAgentAttachment(ctx context.Context, identity Identity, conversationID, body string, upload AttachmentUpload) (MessageResult, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	attachment, err := s.storeAttachment(ctx, conversation, upload)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	result, err := s.postAgentMessage(ctx, identity, conversation.ConversationID, messageDraft{Body: body, Attachments: []model.Attachment{attachment}})
+	if err != nil {
+		s.discardAttachment(ctx, attachment, err)
+		return MessageResult{}, err
+	}
+	return s.signedResult(ctx, result)
+}
+
+// storeAttachment checks upload against the tenant attachment settings and
+// writes it to the blob store. The content type is detected from the file
+// rather than trusted from the client.
+func (s *Service) storeAttachment(ctx context.Context, conversation model.ConversationItem, upload AttachmentUpload) (model.Attachment, error) {
+	if s.blobs == nil {
+		return model.Attachment{}, newError(ErrorCodeInternal, "attachments are not configured", nil)
+	}
+	if conversation.Status == model.ConversationStatusClosed || conversation.Status == model.ConversationStatusArchived {
+		return model.Attachment{}, newError(ErrorCodeConflict, "conversation is closed", nil)
+	}
+
+	tenant, err := s.repo.GetTenant(ctx, conversation.TenantID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.Attachment{}, newError(ErrorCodeNotFound, "tenant not found", err)
+		}
+		return model.Attachment{}, newError(ErrorCodeInternal, "failed to fetch tenant", err)
+	}
+	settings := tenantservice.AttachmentSettingsFromTenant(tenant)
+
+	if upload.Body == nil || upload.Size <= 0 {
+		return model.Attachment{}, newError(ErrorCodeValidation, "attachment is empty", nil)
+	}
+	if upload.Size > settings.MaxBytes {
+		return model.Attachment{}, newError(ErrorCodeValidation, fmt.Sprintf("attachment exceeds the %d byte limit", settings.MaxBytes), nil)
+	}
+
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(upload.Body, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return model.Attachment{}, newError(ErrorCodeInternal, "failed to read attachment", err)
+	}
+	head = head[:n]
+
+	contentType := attachmentContentType(head, upload.ContentType)
+	if !settings.Allows(contentType) {
+		return model.Attachment{}, newError(ErrorCodeValidation, fmt.Sprintf("attachments of type %s are not allowed", contentType), nil)
+	}
+
+	attachmentID := uuid.NewString()
+	attachment := model.Attachment{
+		AttachmentID: attachmentID,
+		Key:          conversation.TenantID + "/" + conversation.ConversationID + "/" + attachmentID,
+		FileName:     attachmentFileName(upload.FileName),
+		ContentType:  contentType,
+		Size:         upload.Size,
+	}
+	body := io.MultiReader(bytes.NewReader(head), upload.Body)
+	if err := s.blobs.Put(ctx, attachment.Key, body, attachment.Size, contentType); err != nil {
+		if errors.Is(err, storage.ErrSizeMismatch) {
+			return model.Attachment{}, newError(ErrorCodeValidation, "attachment size does not match its content", err)
+		}
+		return model.Attachment{}, newError(ErrorCodeInternal, "failed to store attachment", err)
+	}
+	return attachment, nil
+}
+
+// discardAttachment removes the blob of a message that failed to post. After
+// internal errors the message may have been stored, so the blob is kept.
+func (s *Service) discardAttachment(ctx context.Context, attachment model.Attachment, postErr error) {
+	var serviceErr *Error
+	if errors.As(postErr, &serviceErr) && serviceErr.Code == ErrorCodeInternal {
+		return
+	}
+	_ = s.blobs.Delete(ctx, attachment.Key)
+}
+
+func (s *Service) signedResult(ctx context.Context, result MessageResult) (MessageResult, error) {
+	var err error
+	if result.Message.Attachments, err = s.signedAttachments(ctx, result.Message.Attachments); err != nil {
+		return MessageResult{}, err
+	}
+	return result, nil
+}
+
+// signAttachments fills in the download URLs of the attachments of messages.
+func (s *Service) signAttachments(ctx context.Context, messages []model.MessageItem) error {
+	for i := range messages {
+		signed, err := s.signedAttachments(ctx, messages[i].Attachments)
+		if err != nil {
+			return err
+		}
+		messages[i].Attachments = signed
+	}
+	return nil
+}
+
+// signedAttachments returns a copy of attachments with their download URLs
+// filled in, leaving the slice the repository handed out untouched.
+func (s *Service) signedAttachments(ctx context.Context, attachments []model.Attachment) ([]model.Attachment, error) {
+	if s.blobs == nil || len(attachments) == 0 {
+		return attachments, nil
+	}
+	signed := make([]model.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		url, err := s.blobs.SignedURL(ctx, attachment.Key, storage.URLOptions{
+			TTL:         attachmentURLTTL,
+			ContentType: attachment.ContentType,
+			FileName:    attachment.FileName,
+		})
+		if err != nil {
+			return nil, newError(ErrorCodeInternal, "failed to sign attachment URL", err)
+		}
+		attachment.URL = url
+		signed[i] = attachment
+	}
+	return signed, nil
+}
+
+// attachmentContentType detects the media type of a file starting with head.
+// The declared type is only used for files the detection cannot tell apart,
+// and never to claim an image or text type the content does not have.
+func attachmentContentType(head []byte, declared string) string {
+	detected, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	if detected != "application/octet-stream" {
+		return detected
+	}
+	declared, _, err = mime.ParseMediaType(declared)
+	if err != nil || strings.HasPrefix(declared, "image/") || strings.HasPrefix(declared, "text/") {
+		return detected
+	}
+	return declared
+}
+
+// attachmentFileName keeps the base name of a client supplied file name.
+func attachmentFileName(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "." || name == "/" || name == "" || !utf8.ValidString(name) {
+		return "attachment"
+	}
+	for len(name) > maxAttachmentFileName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
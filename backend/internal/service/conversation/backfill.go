@@ -0,0 +1,157 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+
+	"chat-app-backend/internal/model"
+)
+
+// BackfillIndexKeys writes the filter index attributes of conversations
+// stored before the attributes existed, or whose attributes drifted from the
+// conversation state. It is safe to run repeatedly and returns the number of
+// conversations it updated.
+func (s *Service) BackfillIndexKeys(ctx context.Context) (int, error) {
+	updated := 0
+	err := s.repo.ScanConversations(ctx, func(conversation model.ConversationItem) error {
+		if conversation.TenantID == "" || conversation.PK == "" {
+			return nil
+		}
+
+		expected := conversation
+		expected.SetIndexKeys()
+		if expected.TenantStatus == conversation.TenantStatus &&
+			expected.TenantAssignee == conversation.TenantAssignee &&
+			expected.TenantVisitor == conversation.TenantVisitor &&
+			expected.TenantVisitorEmail == conversation.TenantVisitorEmail {
+			return nil
+		}
+
+		if err := s.repo.UpdateConversationIndexKeys(ctx, conversation); err != nil {
+			// Deleted since the scan read it; nothing left to index.
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			return err
+		}
+		updated++
+		return nil
+	})
+	if err != nil {
+		return updated, newError(ErrorCodeInternal, "failed to backfill conversation index keys", err)
+	}
+	return updated, nil
+}
+
+const (
+	// readCounterPageSize is how many messages the read counter backfill reads
+	// per page.
+	readCounterPageSize = 100
+	// maxReadCounterAttempts bounds the recounts of a conversation that keeps
+	// receiving messages while it is backfilled.
+	maxReadCounterAttempts = 3
+)
+
+// BackfillReadCounters initialises the message counters and read markers of
+// conversations stored before read receipts. Their messages are numbered in
+// order and stamped with the counters, and everyone who posted is marked as
+// having read up to their own last message. It is safe to run repeatedly and
+// returns the number of conversations it initialised.
+func (s *Service) BackfillReadCounters(ctx context.Context) (int, error) {
+	updated := 0
+	err := s.repo.ScanConversations(ctx, func(conversation model.ConversationItem) error {
+		if conversation.TenantID == "" || conversation.PK == "" || conversation.ReadMarkers != nil {
+			return nil
+		}
+
+		for attempt := 1; ; attempt++ {
+			err := s.initializeReadCounters(ctx, conversation)
+			if err == nil {
+				updated++
+				return nil
+			}
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			if !errors.Is(err, ErrReadCountersChanged) || attempt == maxReadCounterAttempts {
+				return err
+			}
+
+			// A message arrived while the conversation was counted.
+			conversation, err = s.repo.GetConversation(ctx, conversation.TenantID, conversation.ConversationID)
+			if errors.Is(err, ErrNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if conversation.ReadMarkers != nil {
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return updated, newError(ErrorCodeInternal, "failed to backfill read counters", err)
+	}
+	return updated, nil
+}
+
+func (s *Service) initializeReadCounters(ctx context.Context, conversation model.ConversationItem) error {
+	seenVisitorCount := conversation.VisitorMessageCount
+	seenAgentCount := conversation.AgentMessageCount
+	conversation.VisitorMessageCount = 0
+	conversation.AgentMessageCount = 0
+	markers := make(map[string]model.ReadMarker)
+
+	cursor := ""
+	for {
+		page, err := s.repo.ListMessages(ctx, conversation.TenantID, conversation.ConversationID, MessageQuery{
+			Limit:     readCounterPageSize,
+			Cursor:    cursor,
+			Direction: MessageDirectionAfter,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, message := range page.Messages {
+			if message.Type == model.MessageTypeNote {
+				// Notes do not count towards either side's messages.
+				continue
+			}
+			participant, counterpart := model.ReadMarkerVisitor, model.MessageSenderAgent
+			switch message.SenderType {
+			case model.MessageSenderVisitor:
+				conversation.VisitorMessageCount++
+			case model.MessageSenderAgent:
+				conversation.AgentMessageCount++
+				participant, counterpart = message.SenderID, model.MessageSenderVisitor
+			default:
+				continue
+			}
+
+			if message.VisitorCount != conversation.VisitorMessageCount || message.AgentCount != conversation.AgentMessageCount {
+				message.VisitorCount = conversation.VisitorMessageCount
+				message.AgentCount = conversation.AgentMessageCount
+				if err := s.repo.UpdateMessageCounters(ctx, message); err != nil && !errors.Is(err, ErrNotFound) {
+					return err
+				}
+			}
+
+			markers[participant] = model.ReadMarker{
+				MessageID:        message.MessageID,
+				MessageCreatedAt: message.CreatedAt,
+				ReadAt:           message.CreatedAt,
+				ReadCount:        message.CountFor(counterpart),
+			}
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	conversation.ReadMarkers = markers
+	return s.repo.InitializeReadMarkers(ctx, conversation, seenVisitorCount, seenAgentCount)
+}
@@ -0,0 +1,84 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chat-app-backend/internal/model"
+	tenantservice "chat-app-backend/internal/service/tenant"
+)
+
+// PostCannedResponse posts the canned response responseID of the caller's
+// tenant to a conversation as a message of the calling tenant user, with its
+// placeholders filled in from the conversation, its visitor and the caller.
+// The use is not counted; call RecordCannedResponseUse once the message is out.
+func (s *Service) PostCannedResponse(ctx context.Context, identity Identity, conversationID, responseID string) (MessageResult, error) {
+	responseID = strings.TrimSpace(responseID)
+	if responseID == "" {
+		return MessageResult{}, newError(ErrorCodeValidation, "cannedResponseId is required", nil)
+	}
+
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	response, err := s.repo.GetCannedResponse(ctx, identity.TenantID, responseID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return MessageResult{}, newError(ErrorCodeNotFound, "canned response not found", err)
+		}
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to load canned response", err)
+	}
+
+	vars, err := s.cannedResponseVars(ctx, identity, conversation)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	body := tenantservice.RenderCannedResponse(response.Body, vars)
+	return s.postAgentMessage(ctx, identity, conversation.ConversationID, messageDraft{Body: body})
+}
+
+// RecordCannedResponseUse counts a message posted from the canned response
+// responseID of the caller's tenant.
+func (s *Service) RecordCannedResponseUse(ctx context.Context, identity Identity, responseID string) error {
+	usedAt := s.now().UTC().Format(time.RFC3339)
+	if err := s.repo.RecordCannedResponseUse(ctx, identity.TenantID, responseID, usedAt); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return newError(ErrorCodeNotFound, "canned response not found", err)
+		}
+		return newError(ErrorCodeInternal, "failed to record canned response use", err)
+	}
+	return nil
+}
+
+// cannedResponseVars collects the placeholder values of conversation. Visitor
+// details missing on the conversation are read from the visitor record.
+func (s *Service) cannedResponseVars(ctx context.Context, identity Identity, conversation model.ConversationItem) (map[string]string, error) {
+	vars := map[string]string{
+		tenantservice.PlaceholderVisitorName:  conversation.VisitorName,
+		tenantservice.PlaceholderVisitorEmail: conversation.VisitorEmail,
+	}
+
+	if conversation.VisitorName == "" || conversation.VisitorEmail == "" {
+		visitor, err := s.repo.GetVisitor(ctx, conversation.TenantID, conversation.VisitorID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return nil, newError(ErrorCodeInternal, "failed to fetch visitor", err)
+		}
+		if vars[tenantservice.PlaceholderVisitorName] == "" {
+			vars[tenantservice.PlaceholderVisitorName] = visitor.Name
+		}
+		if vars[tenantservice.PlaceholderVisitorEmail] == "" {
+			vars[tenantservice.PlaceholderVisitorEmail] = visitor.Email
+		}
+	}
+
+	agent, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID)
+	if err != nil {
+		return nil, newError(ErrorCodeInternal, "failed to fetch user", err)
+	}
+	vars[tenantservice.PlaceholderAgentName] = agent.Name
+	return vars, nil
+}
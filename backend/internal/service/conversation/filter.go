@@ -0,0 +1,241 @@
+package conversation
+
+import (
+	"strings"
+	"time"
+
+	"chat-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ConversationFilter narrows ListConversations. Empty fields are ignored and
+// range bounds are inclusive RFC3339 timestamps.
+type ConversationFilter struct {
+	Status          model.ConversationStatus
+	AssignedUserID  string
+	Unassigned      bool
+	VisitorID       string
+	VisitorEmail    string
+	CreatedFrom     string
+	CreatedTo       string
+	LastMessageFrom string
+	LastMessageTo   string
+	MetadataKey     string
+	MetadataValue   string
+}
+
+func normalizeConversationFilter(filter ConversationFilter) (ConversationFilter, error) {
+	filter.Status = model.ConversationStatus(strings.ToLower(strings.TrimSpace(string(filter.Status))))
+	switch filter.Status {
+	case "", model.ConversationStatusOpen, model.ConversationStatusClosed, model.ConversationStatusArchived:
+	default:
+		return ConversationFilter{}, newError(ErrorCodeValidation, "status must be one of open, closed or archived", nil)
+	}
+
+	filter.AssignedUserID = strings.TrimSpace(filter.AssignedUserID)
+	if filter.Unassigned && filter.AssignedUserID != "" {
+		return ConversationFilter{}, newError(ErrorCodeValidation, "assignedUserId cannot be combined with unassigned", nil)
+	}
+	filter.VisitorID = strings.TrimSpace(filter.VisitorID)
+	filter.VisitorEmail = normalizeEmail(filter.VisitorEmail)
+	filter.MetadataKey = strings.TrimSpace(filter.MetadataKey)
+	filter.MetadataValue = strings.TrimSpace(filter.MetadataValue)
+	if filter.MetadataValue != "" && filter.MetadataKey == "" {
+		return ConversationFilter{}, newError(ErrorCodeValidation, "metadataValue requires metadataKey", nil)
+	}
+
+	var err error
+	if filter.CreatedFrom, filter.CreatedTo, err = normalizeRange("createdAt", filter.CreatedFrom, filter.CreatedTo); err != nil {
+		return ConversationFilter{}, err
+	}
+	if filter.LastMessageFrom, filter.LastMessageTo, err = normalizeRange("lastMessageAt", filter.LastMessageFrom, filter.LastMessageTo); err != nil {
+		return ConversationFilter{}, err
+	}
+
+	return filter, nil
+}
+
+// normalizeRange converts both bounds to UTC RFC3339 so they compare correctly
+// against the stored timestamps.
+func normalizeRange(field, from, to string) (string, string, error) {
+	var bounds [2]string
+	for i, raw := range []string{from, to} {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			return "", "", newError(ErrorCodeValidation, field+" range must use RFC3339 timestamps", err)
+		}
+		bounds[i] = parsed.UTC().Format(time.RFC3339)
+	}
+	if bounds[0] != "" && bounds[1] != "" && bounds[0] > bounds[1] {
+		return "", "", newError(ErrorCodeValidation, field+" range start must not be after its end", nil)
+	}
+	return bounds[0], bounds[1], nil
+}
+
+// conversationQuery is the DynamoDB query chosen for a filter.
+type conversationQuery struct {
+	index     string
+	keyCond   string
+	filter    string
+	values    map[string]types.AttributeValue
+	names     map[string]string
+	sortField string
+}
+
+// planConversationQuery picks the most selective index for filter. Equality
+// filters become the partition key, the index sort key takes its range, and
+// everything else is applied as a filter expression.
+func planConversationQuery(tenantID string, filter ConversationFilter) conversationQuery {
+	q := conversationQuery{
+		index:     "byTenant",
+		keyCond:   "#pk = :pk",
+		values:    map[string]types.AttributeValue{},
+		names:     map[string]string{"#pk": "tenantId"},
+		sortField: "lastMessageAt",
+	}
+	q.values[":pk"] = &types.AttributeValueMemberS{Value: tenantID}
+
+	partitioned := true
+	assignee := filter.AssignedUserID
+	if filter.Unassigned {
+		assignee = model.ConversationUnassigned
+	}
+
+	switch {
+	case filter.VisitorID != "":
+		q.usePartition("byVisitor", "tenantVisitor", model.TenantScopedKey(tenantID, filter.VisitorID))
+	case filter.VisitorEmail != "":
+		q.usePartition("byVisitorEmail", "tenantVisitorEmail", model.TenantScopedKey(tenantID, filter.VisitorEmail))
+	case assignee != "":
+		q.usePartition("byTenantAssignee", "tenantAssignee", model.TenantScopedKey(tenantID, assignee))
+	case filter.Status != "":
+		q.usePartition("byTenantStatus", "tenantStatus", model.TenantScopedKey(tenantID, string(filter.Status)))
+	default:
+		partitioned = false
+	}
+
+	if !partitioned && filter.LastMessageFrom == "" && filter.LastMessageTo == "" &&
+		(filter.CreatedFrom != "" || filter.CreatedTo != "") {
+		q.index = "byTenantCreated"
+		q.sortField = "createdAt"
+	}
+
+	var filters []string
+	if filter.VisitorEmail != "" && filter.VisitorID != "" {
+		filters = append(filters, q.equals("visitorEmail", filter.VisitorEmail))
+	}
+	if assignee != "" && q.index != "byTenantAssignee" {
+		filters = append(filters, q.equals("tenantAssignee", model.TenantScopedKey(tenantID, assignee)))
+	}
+	if filter.Status != "" && q.index != "byTenantStatus" {
+		filters = append(filters, q.equals("status", string(filter.Status)))
+	}
+
+	if q.sortField == "createdAt" {
+		q.keyCond += q.rangeCondition("createdAt", filter.CreatedFrom, filter.CreatedTo)
+	} else {
+		q.keyCond += q.rangeCondition("lastMessageAt", filter.LastMessageFrom, filter.LastMessageTo)
+		if cond := q.rangeCondition("createdAt", filter.CreatedFrom, filter.CreatedTo); cond != "" {
+			filters = append(filters, strings.TrimPrefix(cond, " AND "))
+		}
+	}
+
+	if filter.MetadataKey != "" {
+		q.names["#metadata"] = "metadata"
+		q.names["#metadataKey"] = filter.MetadataKey
+		if filter.MetadataValue != "" {
+			q.values[":metadataValue"] = &types.AttributeValueMemberS{Value: filter.MetadataValue}
+			filters = append(filters, "#metadata.#metadataKey = :metadataValue")
+		} else {
+			filters = append(filters, "attribute_exists(#metadata.#metadataKey)")
+		}
+	}
+
+	q.filter = strings.Join(filters, " AND ")
+	return q
+}
+
+// acceptsStartKey reports whether a decoded cursor key belongs to this query.
+func (q conversationQuery) acceptsStartKey(key map[string]types.AttributeValue) bool {
+	return validStartKey(key, q.names["#pk"], stringAttr(q.values[":pk"]), q.sortField)
+}
+
+func (q *conversationQuery) usePartition(index, attribute, value string) {
+	q.index = index
+	q.names["#pk"] = attribute
+	q.values[":pk"] = &types.AttributeValueMemberS{Value: value}
+}
+
+func (q *conversationQuery) equals(attribute, value string) string {
+	q.names["#"+attribute] = attribute
+	q.values[":"+attribute] = &types.AttributeValueMemberS{Value: value}
+	return "#" + attribute + " = :" + attribute
+}
+
+func (q *conversationQuery) rangeCondition(attribute, from, to string) string {
+	if from == "" && to == "" {
+		return ""
+	}
+	name := "#" + attribute
+	q.names[name] = attribute
+	switch {
+	case from != "" && to != "":
+		q.values[":"+attribute+"From"] = &types.AttributeValueMemberS{Value: from}
+		q.values[":"+attribute+"To"] = &types.AttributeValueMemberS{Value: to}
+		return " AND " + name + " BETWEEN :" + attribute + "From AND :" + attribute + "To"
+	case from != "":
+		q.values[":"+attribute+"From"] = &types.AttributeValueMemberS{Value: from}
+		return " AND " + name + " >= :" + attribute + "From"
+	default:
+		q.values[":"+attribute+"To"] = &types.AttributeValueMemberS{Value: to}
+		return " AND " + name + " <= :" + attribute + "To"
+	}
+}
+
+// Matches reports whether conversation satisfies the filter, for repositories
+// that filter in memory.
+func (f ConversationFilter) Matches(conversation model.ConversationItem) bool {
+	if f.Status != "" && conversation.Status != f.Status {
+		return false
+	}
+	if f.Unassigned && conversation.AssignedUserID != "" {
+		return false
+	}
+	if f.AssignedUserID != "" && conversation.AssignedUserID != f.AssignedUserID {
+		return false
+	}
+	if f.VisitorID != "" && conversation.VisitorID != f.VisitorID {
+		return false
+	}
+	if f.VisitorEmail != "" && conversation.VisitorEmail != f.VisitorEmail {
+		return false
+	}
+	if !inRange(conversation.CreatedAt, f.CreatedFrom, f.CreatedTo) {
+		return false
+	}
+	if !inRange(conversation.LastMessageAt, f.LastMessageFrom, f.LastMessageTo) {
+		return false
+	}
+	if f.MetadataKey != "" {
+		value, ok := conversation.Metadata[f.MetadataKey]
+		if !ok || (f.MetadataValue != "" && value != f.MetadataValue) {
+			return false
+		}
+	}
+	return true
+}
+
+func inRange(value, from, to string) bool {
+	if from != "" && value < from {
+		return false
+	}
+	if to != "" && value > to {
+		return false
+	}
+	return true
+}
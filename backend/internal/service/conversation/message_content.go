@@ -0,0 +1,446 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chat-app-backend/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxPromptLength          = 2000
+	maxQuickReplies          = 10
+	maxQuickReplyLength      = 80
+	maxCardTitleLength       = 200
+	maxCardDescriptionLength = 1000
+	maxURLLength             = 2048
+	maxFormFields            = 10
+	maxFormLabelLength       = 100
+	maxFormOptions           = 20
+	maxFormValueLength       = 1000
+)
+
+var formFieldNamePattern = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]{0,39}$`)
+
+// Message types each sender may post. System messages are only recorded by
+// the service itself.
+var senderMessageTypes = map[string]map[string]bool{
+	model.MessageSenderVisitor: {
+		model.MessageTypeText:         true,
+		model.MessageTypeFormResponse: true,
+	},
+	model.MessageSenderAgent: {
+		model.MessageTypeText:         true,
+		model.MessageTypeQuickReplies: true,
+		model.MessageTypeCard:         true,
+		model.MessageTypeForm:         true,
+	},
+}
+
+var formFieldTypes = map[string]bool{
+	model.FormFieldText:     true,
+	model.FormFieldTextarea: true,
+	model.FormFieldEmail:    true,
+	model.FormFieldNumber:   true,
+	model.FormFieldSelect:   true,
+}
+
+// MessageInput is a message of any content type. Text messages only set Body.
+// The other types carry their payload in Content, with the prompt of quick
+// replies and forms in Content.Text or Body; the stored Body is then derived
+// from the payload.
+type MessageInput struct {
+	Type    string
+	Body    string
+	Content model.MessageContent
+}
+
+// messageDraft is a validated message ready to be stored.
+type messageDraft struct {
+	Type        string
+	Body        string
+	Content     *model.MessageContent
+	Attachments []model.Attachment
+}
+
+func (d messageDraft) empty() bool {
+	return d.Body == "" && d.Content == nil && len(d.Attachments) == 0
+}
+
+// PostVisitorContent posts input as a message of the visitor of token.
+func (s *Service) PostVisitorContent(ctx context.Context, token, conversationID string, input MessageInput) (MessageResult, error) {
+	conversation, access, err := s.visitorConversation(ctx, token, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	draft, err := s.draftMessage(ctx, conversation, model.MessageSenderVisitor, input)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.postVisitorMessage(ctx, access, draft)
+}
+
+// PostAgentContent posts input as a message of the calling tenant user. Notes
+// are handed to PostNote.
+func (s *Service) PostAgentContent(ctx context.Context, identity Identity, conversationID string, input MessageInput) (MessageResult, error) {
+	if strings.TrimSpace(input.Type) == model.MessageTypeNote {
+		return s.PostNote(ctx, identity, conversationID, input.Body)
+	}
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	draft, err := s.draftMessage(ctx, conversation, model.MessageSenderAgent, input)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.postAgentMessage(ctx, identity, conversation.ConversationID, draft)
+}
+
+// RecordSystemEvent adds a system message recording kind, one of the
+// SystemEvent constants, to conversation. actorID is the tenant user the
+// event is about. System messages are not indexed for search and do not
+// count towards either side's messages.
+func (s *Service) RecordSystemEvent(ctx context.Context, conversation model.ConversationItem, kind, actorID string) (MessageResult, error) {
+	event := model.SystemEvent{Kind: kind, ActorID: actorID}
+	if actorID != "" {
+		user, err := s.repo.GetUser(ctx, conversation.TenantID, actorID)
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return MessageResult{}, newError(ErrorCodeInternal, "failed to fetch user", err)
+		}
+		event.ActorName = strings.TrimSpace(user.Name)
+	}
+	body, err := systemEventBody(event)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	messageID := uuid.NewString()
+	message := model.MessageItem{
+		PK:             model.MessagePK(conversation.ConversationID, messageID),
+		TenantID:       conversation.TenantID,
+		ConversationID: conversation.ConversationID,
+		MessageID:      messageID,
+		SenderType:     model.MessageSenderSystem,
+		Body:           body,
+		CreatedAt:      s.now().UTC().Format(time.RFC3339),
+		Type:           model.MessageTypeSystem,
+		Content:        &model.MessageContent{Event: &event},
+		VisitorCount:   conversation.VisitorMessageCount,
+		AgentCount:     conversation.AgentMessageCount,
+	}
+	if err := s.repo.CreateMessage(ctx, message); err != nil {
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to store message", err)
+	}
+
+	return MessageResult{Conversation: conversation, Message: message}, nil
+}
+
+func systemEventBody(event model.SystemEvent) (string, error) {
+	actor := event.ActorName
+	if actor == "" {
+		actor = "An agent"
+	}
+	switch event.Kind {
+	case model.SystemEventAgentJoined:
+		return actor + " joined the conversation", nil
+	case model.SystemEventAgentLeft:
+		return actor + " left the conversation", nil
+	case model.SystemEventConversationClosed:
+		return actor + " closed the conversation", nil
+	case model.SystemEventConversationReopened:
+		return actor + " reopened the conversation", nil
+	default:
+		return "", newError(ErrorCodeValidation, fmt.Sprintf("unknown system event %q", event.Kind), nil)
+	}
+}
+
+// draftMessage validates input from senderType and derives the plain text
+// body of non-text messages.
+func (s *Service) draftMessage(ctx context.Context, conversation model.ConversationItem, senderType string, input MessageInput) (messageDraft, error) {
+	messageType := strings.TrimSpace(input.Type)
+	if messageType == "" {
+		messageType = model.MessageTypeText
+	}
+	if !senderMessageTypes[senderType][messageType] {
+		return messageDraft{}, newError(ErrorCodeValidation, fmt.Sprintf("message type %q is not allowed", messageType), nil)
+	}
+
+	if messageType == model.MessageTypeText {
+		return messageDraft{Body: input.Body}, nil
+	}
+
+	prompt := strings.TrimSpace(input.Content.Text)
+	if prompt == "" {
+		prompt = strings.TrimSpace(input.Body)
+	}
+	if utf8.RuneCountInString(prompt) > maxPromptLength {
+		return messageDraft{}, newError(ErrorCodeValidation, fmt.Sprintf("message text must be at most %d characters", maxPromptLength), nil)
+	}
+
+	var (
+		content *model.MessageContent
+		form    *model.MessageForm
+		err     error
+	)
+	switch messageType {
+	case model.MessageTypeQuickReplies:
+		content, err = quickRepliesContent(prompt, input.Content.QuickReplies)
+	case model.MessageTypeCard:
+		content, err = cardContent(prompt, input.Content.Card)
+	case model.MessageTypeForm:
+		content, err = formContent(prompt, input.Content.Form)
+	case model.MessageTypeFormResponse:
+		if input.Content.FormResponse == nil {
+			return messageDraft{}, newError(ErrorCodeValidation, "formResponse is required", nil)
+		}
+		form, err = s.answeredForm(ctx, conversation, input.Content.FormResponse.FormMessageID)
+		if err == nil {
+			content, err = formResponseContent(form, input.Content.FormResponse)
+		}
+	}
+	if err != nil {
+		return messageDraft{}, err
+	}
+
+	return messageDraft{Type: messageType, Body: contentBody(messageType, content, form), Content: content}, nil
+}
+
+func quickRepliesContent(prompt string, replies []model.QuickReply) (*model.MessageContent, error) {
+	if prompt == "" {
+		return nil, newError(ErrorCodeValidation, "quick replies need a prompt", nil)
+	}
+	if len(replies) == 0 || len(replies) > maxQuickReplies {
+		return nil, newError(ErrorCodeValidation, fmt.Sprintf("quick replies need between 1 and %d options", maxQuickReplies), nil)
+	}
+
+	normalized := make([]model.QuickReply, 0, len(replies))
+	for _, reply := range replies {
+		reply.Label = strings.TrimSpace(reply.Label)
+		reply.Value = strings.TrimSpace(reply.Value)
+		if reply.Value == "" {
+			reply.Value = reply.Label
+		}
+		if reply.Label == "" || utf8.RuneCountInString(reply.Label) > maxQuickReplyLength || utf8.RuneCountInString(reply.Value) > maxQuickReplyLength {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("quick reply labels must be between 1 and %d characters", maxQuickReplyLength), nil)
+		}
+		normalized = append(normalized, reply)
+	}
+	return &model.MessageContent{Text: prompt, QuickReplies: normalized}, nil
+}
+
+func cardContent(text string, card *model.MessageCard) (*model.MessageContent, error) {
+	if card == nil {
+		return nil, newError(ErrorCodeValidation, "card is required", nil)
+	}
+	normalized := model.MessageCard{
+		Title:       strings.TrimSpace(card.Title),
+		Description: strings.TrimSpace(card.Description),
+		URL:         strings.TrimSpace(card.URL),
+		ImageURL:    strings.TrimSpace(card.ImageURL),
+	}
+	if normalized.Title == "" || utf8.RuneCountInString(normalized.Title) > maxCardTitleLength {
+		return nil, newError(ErrorCodeValidation, fmt.Sprintf("card title must be between 1 and %d characters", maxCardTitleLength), nil)
+	}
+	if utf8.RuneCountInString(normalized.Description) > maxCardDescriptionLength {
+		return nil, newError(ErrorCodeValidation, fmt.Sprintf("card description must be at most %d characters", maxCardDescriptionLength), nil)
+	}
+	if !isWebURL(normalized.URL) {
+		return nil, newError(ErrorCodeValidation, "card url must be an http or https URL", nil)
+	}
+	if normalized.ImageURL != "" && !isWebURL(normalized.ImageURL) {
+		return nil, newError(ErrorCodeValidation, "card imageUrl must be an http or https URL", nil)
+	}
+	return &model.MessageContent{Text: text, Card: &normalized}, nil
+}
+
+func formContent(prompt string, form *model.MessageForm) (*model.MessageContent, error) {
+	if prompt == "" {
+		return nil, newError(ErrorCodeValidation, "forms need a prompt", nil)
+	}
+	if form == nil || len(form.Fields) == 0 || len(form.Fields) > maxFormFields {
+		return nil, newError(ErrorCodeValidation, fmt.Sprintf("forms need between 1 and %d fields", maxFormFields), nil)
+	}
+
+	normalized := model.MessageForm{
+		Fields:      make([]model.FormField, 0, len(form.Fields)),
+		SubmitLabel: strings.TrimSpace(form.SubmitLabel),
+	}
+	if utf8.RuneCountInString(normalized.SubmitLabel) > maxQuickReplyLength {
+		return nil, newError(ErrorCodeValidation, fmt.Sprintf("submitLabel must be at most %d characters", maxQuickReplyLength), nil)
+	}
+	seen := make(map[string]bool, len(form.Fields))
+	for _, field := range form.Fields {
+		field.Name = strings.TrimSpace(field.Name)
+		field.Label = strings.TrimSpace(field.Label)
+		field.Type = strings.ToLower(strings.TrimSpace(field.Type))
+		if field.Type == "" {
+			field.Type = model.FormFieldText
+		}
+		if !formFieldNamePattern.MatchString(field.Name) {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("form field name %q must be a letter followed by up to 39 letters, digits or underscores", field.Name), nil)
+		}
+		if seen[field.Name] {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("form field %q is listed twice", field.Name), nil)
+		}
+		seen[field.Name] = true
+		if field.Label == "" {
+			field.Label = field.Name
+		}
+		if utf8.RuneCountInString(field.Label) > maxFormLabelLength {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("form field labels must be at most %d characters", maxFormLabelLength), nil)
+		}
+		if !formFieldTypes[field.Type] {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("form field %q has unknown type %q", field.Name, field.Type), nil)
+		}
+
+		var options []string
+		for _, option := range field.Options {
+			if option = strings.TrimSpace(option); option != "" {
+				options = append(options, option)
+			}
+		}
+		if field.Type == model.FormFieldSelect {
+			if len(options) == 0 || len(options) > maxFormOptions {
+				return nil, newError(ErrorCodeValidation, fmt.Sprintf("select field %q needs between 1 and %d options", field.Name, maxFormOptions), nil)
+			}
+		} else {
+			options = nil
+		}
+		field.Options = options
+		normalized.Fields = append(normalized.Fields, field)
+	}
+	return &model.MessageContent{Text: prompt, Form: &normalized}, nil
+}
+
+// formResponseContent checks response against the form it answers.
+func formResponseContent(form *model.MessageForm, response *model.FormResponse) (*model.MessageContent, error) {
+	fields := make(map[string]model.FormField, len(form.Fields))
+	for _, field := range form.Fields {
+		fields[field.Name] = field
+	}
+	for name := range response.Values {
+		if _, ok := fields[name]; !ok {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("form has no field %q", name), nil)
+		}
+	}
+
+	values := make(map[string]string, len(form.Fields))
+	for _, field := range form.Fields {
+		value := strings.TrimSpace(response.Values[field.Name])
+		if value == "" {
+			if field.Required {
+				return nil, newError(ErrorCodeValidation, fmt.Sprintf("%s is required", field.Label), nil)
+			}
+			continue
+		}
+		if utf8.RuneCountInString(value) > maxFormValueLength {
+			return nil, newError(ErrorCodeValidation, fmt.Sprintf("%s must be at most %d characters", field.Label, maxFormValueLength), nil)
+		}
+		switch field.Type {
+		case model.FormFieldEmail:
+			value = normalizeEmail(value)
+			if !isValidEmail(value) {
+				return nil, newError(ErrorCodeValidation, fmt.Sprintf("%s must be a valid email", field.Label), nil)
+			}
+		case model.FormFieldNumber:
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return nil, newError(ErrorCodeValidation, fmt.Sprintf("%s must be a number", field.Label), nil)
+			}
+		case model.FormFieldSelect:
+			if !containsString(field.Options, value) {
+				return nil, newError(ErrorCodeValidation, fmt.Sprintf("%s must be one of the offered options", field.Label), nil)
+			}
+		}
+		values[field.Name] = value
+	}
+
+	return &model.MessageContent{FormResponse: &model.FormResponse{
+		FormMessageID: strings.TrimSpace(response.FormMessageID),
+		Values:        values,
+	}}, nil
+}
+
+// answeredForm loads the form of message formMessageID, which must be an
+// agent form message of conversation.
+func (s *Service) answeredForm(ctx context.Context, conversation model.ConversationItem, formMessageID string) (*model.MessageForm, error) {
+	if strings.TrimSpace(formMessageID) == "" {
+		return nil, newError(ErrorCodeValidation, "formMessageId is required", nil)
+	}
+	message, err := s.conversationMessage(ctx, conversation, formMessageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Type != model.MessageTypeForm || message.SenderType != model.MessageSenderAgent || message.Content == nil || message.Content.Form == nil {
+		return nil, newError(ErrorCodeValidation, "formMessageId does not refer to a form", nil)
+	}
+	return message.Content.Form, nil
+}
+
+// contentBody renders content as the plain text stored in Body, which older
+// clients show in place of the structured message. form is the form answered
+// by form responses.
+func contentBody(messageType string, content *model.MessageContent, form *model.MessageForm) string {
+	var lines []string
+	if content.Text != "" {
+		lines = append(lines, content.Text)
+	}
+
+	switch messageType {
+	case model.MessageTypeQuickReplies:
+		for _, reply := range content.QuickReplies {
+			lines = append(lines, "- "+reply.Label)
+		}
+	case model.MessageTypeCard:
+		lines = append(lines, content.Card.Title)
+		if content.Card.Description != "" {
+			lines = append(lines, content.Card.Description)
+		}
+		lines = append(lines, content.Card.URL)
+	case model.MessageTypeForm:
+		labels := make([]string, 0, len(content.Form.Fields))
+		for _, field := range content.Form.Fields {
+			labels = append(labels, field.Label)
+		}
+		lines = append(lines, "Please reply with: "+strings.Join(labels, ", "))
+	case model.MessageTypeFormResponse:
+		for _, field := range form.Fields {
+			if value, ok := content.FormResponse.Values[field.Name]; ok {
+				lines = append(lines, field.Label+": "+value)
+			}
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "Form submitted")
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func isWebURL(raw string) bool {
+	if raw == "" || len(raw) > maxURLLength {
+		return false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	return (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
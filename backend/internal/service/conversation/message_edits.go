@@ -0,0 +1,220 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chat-app-backend/internal/model"
+)
+
+// Tenant roles allowed to read the revision history of messages.
+var messageAuditRoles = map[string]bool{
+	"owner": true,
+	"admin": true,
+}
+
+// EditVisitorMessage replaces the body of a message the visitor of token sent.
+func (s *Service) EditVisitorMessage(ctx context.Context, token, conversationID, messageID, body string) (MessageResult, error) {
+	conversation, access, err := s.visitorConversation(ctx, token, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.reviseMessage(ctx, conversation, model.MessageSenderVisitor, access.VisitorID, messageID, body, model.MessageRevisionEdited)
+}
+
+// DeleteVisitorMessage deletes a message the visitor of token sent, leaving a
+// tombstone in its place.
+func (s *Service) DeleteVisitorMessage(ctx context.Context, token, conversationID, messageID string) (MessageResult, error) {
+	conversation, access, err := s.visitorConversation(ctx, token, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.reviseMessage(ctx, conversation, model.MessageSenderVisitor, access.VisitorID, messageID, "", model.MessageRevisionDeleted)
+}
+
+// EditAgentMessage replaces the body of a message the calling tenant user
+// sent.
+func (s *Service) EditAgentMessage(ctx context.Context, identity Identity, conversationID, messageID, body string) (MessageResult, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.reviseMessage(ctx, conversation, model.MessageSenderAgent, identity.UserID, messageID, body, model.MessageRevisionEdited)
+}
+
+// DeleteAgentMessage deletes a message the calling tenant user sent, leaving
+// a tombstone in its place.
+func (s *Service) DeleteAgentMessage(ctx context.Context, identity Identity, conversationID, messageID string) (MessageResult, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	return s.reviseMessage(ctx, conversation, model.MessageSenderAgent, identity.UserID, messageID, "", model.MessageRevisionDeleted)
+}
+
+// GetMessageHistory returns a message together with its earlier bodies. Only
+// tenant owners and admins may read it, as it shows what senders deleted.
+func (s *Service) GetMessageHistory(ctx context.Context, identity Identity, conversationID, messageID string) (model.MessageItem, error) {
+	if identity.UserID == "" || identity.TenantID == "" {
+		return model.MessageItem{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
+	}
+	user, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.MessageItem{}, newError(ErrorCodeUnauthorized, "user not found", err)
+		}
+		return model.MessageItem{}, newError(ErrorCodeInternal, "failed to verify user", err)
+	}
+	if !messageAuditRoles[user.Role] {
+		return model.MessageItem{}, newError(ErrorCodeForbidden, "only tenant admins can read message history", nil)
+	}
+
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return model.MessageItem{}, err
+	}
+	message, err := s.conversationMessage(ctx, conversation, messageID)
+	if err != nil {
+		return model.MessageItem{}, err
+	}
+	revisions := make([]model.MessageRevision, len(message.Revisions))
+	for i, revision := range message.Revisions {
+		if revision.Attachments, err = s.signedAttachments(ctx, revision.Attachments); err != nil {
+			return model.MessageItem{}, err
+		}
+		revisions[i] = revision
+	}
+	message.Revisions = revisions
+	if message.Attachments, err = s.signedAttachments(ctx, message.Attachments); err != nil {
+		return model.MessageItem{}, err
+	}
+	return message, nil
+}
+
+// visitorConversation loads the conversation of token, which must be
+// conversationID.
+func (s *Service) visitorConversation(ctx context.Context, token, conversationID string) (model.ConversationItem, VisitorAccess, error) {
+	conversationID = strings.TrimSpace(conversationID)
+	if conversationID == "" {
+		return model.ConversationItem{}, VisitorAccess{}, newError(ErrorCodeValidation, "conversationId is required", nil)
+	}
+
+	access, err := s.ValidateVisitorAccess(token)
+	if err != nil {
+		return model.ConversationItem{}, VisitorAccess{}, err
+	}
+	if access.ConversationID != conversationID {
+		return model.ConversationItem{}, VisitorAccess{}, newError(ErrorCodeForbidden, "token does not match conversation", nil)
+	}
+
+	conversation, err := s.repo.GetConversation(ctx, access.TenantID, conversationID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.ConversationItem{}, VisitorAccess{}, newError(ErrorCodeNotFound, "conversation not found", err)
+		}
+		return model.ConversationItem{}, VisitorAccess{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
+	}
+	if conversation.VisitorID != access.VisitorID {
+		return model.ConversationItem{}, VisitorAccess{}, newError(ErrorCodeForbidden, "token does not match conversation", nil)
+	}
+	return conversation, access, nil
+}
+
+// conversationMessage loads messageID of conversation.
+func (s *Service) conversationMessage(ctx context.Context, conversation model.ConversationItem, messageID string) (model.MessageItem, error) {
+	messageID = strings.TrimSpace(messageID)
+	if messageID == "" {
+		return model.MessageItem{}, newError(ErrorCodeValidation, "messageId is required", nil)
+	}
+
+	message, err := s.repo.GetMessage(ctx, conversation.TenantID, conversation.ConversationID, messageID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.MessageItem{}, newError(ErrorCodeNotFound, "message not found", err)
+		}
+		return model.MessageItem{}, newError(ErrorCodeInternal, "failed to fetch message", err)
+	}
+	if message.ConversationID != conversation.ConversationID {
+		return model.MessageItem{}, newError(ErrorCodeNotFound, "message not found", nil)
+	}
+	return message, nil
+}
+
+// reviseMessage edits or deletes messageID on behalf of its sender, keeping
+// the body it replaces as a revision. Deleting clears the body.
+func (s *Service) reviseMessage(ctx context.Context, conversation model.ConversationItem, senderType, senderID, messageID, body, action string) (MessageResult, error) {
+	body = strings.TrimSpace(body)
+	if action == model.MessageRevisionEdited && body == "" {
+		return MessageResult{}, newError(ErrorCodeValidation, "message body is required", nil)
+	}
+	if conversation.Status == model.ConversationStatusClosed || conversation.Status == model.ConversationStatusArchived {
+		return MessageResult{}, newError(ErrorCodeConflict, "conversation is closed", nil)
+	}
+
+	message, err := s.conversationMessage(ctx, conversation, messageID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+	if message.SenderType != senderType || message.SenderID != senderID {
+		return MessageResult{}, newError(ErrorCodeForbidden, "only the sender can change a message", nil)
+	}
+	if message.DeletedAt != "" {
+		return MessageResult{}, newError(ErrorCodeConflict, "message is deleted", nil)
+	}
+	if action == model.MessageRevisionEdited && message.Type != "" && message.Type != model.MessageTypeText && message.Type != model.MessageTypeNote {
+		return MessageResult{}, newError(ErrorCodeValidation, "only text messages and notes can be edited", nil)
+	}
+	if action == model.MessageRevisionEdited && body == message.Body {
+		if message.Attachments, err = s.signedAttachments(ctx, message.Attachments); err != nil {
+			return MessageResult{}, err
+		}
+		return MessageResult{Conversation: conversation, Message: message}, nil
+	}
+
+	nowStr := s.now().UTC().Format(time.RFC3339)
+	current := message.CreatedAt
+	if message.EditedAt != "" {
+		current = message.EditedAt
+	}
+	revisions := make([]model.MessageRevision, len(message.Revisions), len(message.Revisions)+1)
+	copy(revisions, message.Revisions)
+	revision := model.MessageRevision{
+		Body:       message.Body,
+		CreatedAt:  current,
+		ReplacedAt: nowStr,
+		ReplacedBy: senderID,
+		Action:     action,
+	}
+	message.Body = body
+	if action == model.MessageRevisionDeleted {
+		// The files stay in the blob store for the history.
+		revision.Attachments = message.Attachments
+		message.Attachments = nil
+		message.Content = nil
+		message.Mentions = nil
+		message.DeletedAt = nowStr
+	} else {
+		message.EditedAt = nowStr
+	}
+	message.Revisions = append(revisions, revision)
+
+	if err := s.repo.ReviseMessage(ctx, message); err != nil {
+		switch {
+		case errors.Is(err, ErrNotFound):
+			return MessageResult{}, newError(ErrorCodeNotFound, "message not found", err)
+		case errors.Is(err, ErrMessageChanged):
+			return MessageResult{}, newError(ErrorCodeConflict, "message was changed concurrently", err)
+		}
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to update message", err)
+	}
+	if s.search != nil {
+		s.indexMessage(message)
+	}
+	if message.Attachments, err = s.signedAttachments(ctx, message.Attachments); err != nil {
+		return MessageResult{}, err
+	}
+
+	return MessageResult{Conversation: conversation, Message: message}, nil
+}
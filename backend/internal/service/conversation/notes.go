@@ -0,0 +1,120 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"chat-app-backend/internal/model"
+
+	"github.com/google/uuid"
+)
+
+// mentionPattern matches an @handle at the start of the text or after a
+// space. A handle is an email address, the part of it before the @, or a user
+// name written without spaces.
+var mentionPattern = regexp.MustCompile(`(?:^|\s)@([\p{L}\p{N}][\p{L}\p{N}._+-]*(?:@[\p{L}\p{N}.-]+)?)`)
+
+// PostNote adds an internal note by the calling tenant user to a conversation.
+// Notes are stored with the messages but never shown to the visitor, and they
+// leave the conversation activity, assignment and unread counts alone. The
+// tenant users mentioned in body are listed in the Mentions of the note.
+func (s *Service) PostNote(ctx context.Context, identity Identity, conversationID, body string) (MessageResult, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return MessageResult{}, newError(ErrorCodeValidation, "note body is required", nil)
+	}
+
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	mentions, err := s.resolveMentions(ctx, identity, body)
+	if err != nil {
+		return MessageResult{}, err
+	}
+
+	messageID := uuid.NewString()
+	message := model.MessageItem{
+		PK:             model.MessagePK(conversation.ConversationID, messageID),
+		TenantID:       conversation.TenantID,
+		ConversationID: conversation.ConversationID,
+		MessageID:      messageID,
+		SenderType:     model.MessageSenderAgent,
+		SenderID:       identity.UserID,
+		Body:           body,
+		CreatedAt:      s.now().UTC().Format(time.RFC3339),
+		Type:           model.MessageTypeNote,
+		Mentions:       mentions,
+		VisitorCount:   conversation.VisitorMessageCount,
+		AgentCount:     conversation.AgentMessageCount,
+	}
+	if err := s.storeMessage(ctx, message); err != nil {
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to store note", err)
+	}
+
+	return MessageResult{Conversation: conversation, Message: message}, nil
+}
+
+// resolveMentions returns the IDs of the tenant users mentioned in body, other
+// than the author, in a stable order.
+func (s *Service) resolveMentions(ctx context.Context, identity Identity, body string) ([]string, error) {
+	matches := mentionPattern.FindAllStringSubmatch(body, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	users, err := s.repo.ListTenantUsers(ctx, identity.TenantID)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, newError(ErrorCodeInternal, "failed to list tenant users", err)
+	}
+	handles := make(map[string][]string)
+	for _, user := range users {
+		if user.UserID == "" || user.UserID == identity.UserID {
+			continue
+		}
+		for _, handle := range mentionHandles(user) {
+			handles[handle] = append(handles[handle], user.UserID)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var mentioned []string
+	for _, match := range matches {
+		handle := strings.ToLower(strings.TrimRight(match[1], "._-"))
+		for _, userID := range handles[handle] {
+			if !seen[userID] {
+				seen[userID] = true
+				mentioned = append(mentioned, userID)
+			}
+		}
+	}
+	sort.Strings(mentioned)
+	return mentioned, nil
+}
+
+// mentionHandles lists the lower-cased handles that mention user.
+func mentionHandles(user model.UserItem) []string {
+	var handles []string
+	if email := strings.ToLower(strings.TrimSpace(user.Email)); email != "" {
+		handles = append(handles, email)
+		if local, _, ok := strings.Cut(email, "@"); ok && local != "" {
+			handles = append(handles, local)
+		}
+	}
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, user.Name)
+	if name != "" {
+		handles = append(handles, name)
+	}
+	return handles
+}
@@ -0,0 +1,133 @@
+package conversation
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"chat-app-backend/internal/model"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// ErrInvalidCursor is returned by repositories when a pagination cursor cannot
+// be decoded.
+var ErrInvalidCursor = errors.New("conversation repository: invalid cursor")
+
+type MessageDirection string
+
+const (
+	MessageDirectionBefore MessageDirection = "before"
+	MessageDirectionAfter  MessageDirection = "after"
+)
+
+// PageQuery selects one page of a listing. Cursor is the NextCursor returned by
+// the previous page.
+type PageQuery struct {
+	Limit  int
+	Cursor string
+}
+
+// MessageQuery selects one page of messages. Pages walk back from the newest
+// message unless Direction is MessageDirectionAfter. Anchor starts the page
+// next to a given message; a Cursor resumes in the direction it was issued for.
+type MessageQuery struct {
+	Limit     int
+	Cursor    string
+	Direction MessageDirection
+	Anchor    *model.MessageItem
+}
+
+type ConversationPage struct {
+	Conversations []model.ConversationItem
+	NextCursor    string
+}
+
+// MessagePage holds messages in chronological order regardless of direction.
+type MessagePage struct {
+	Messages   []model.MessageItem
+	NextCursor string
+}
+
+type pageCursor struct {
+	Direction MessageDirection  `json:"d,omitempty"`
+	Key       map[string]string `json:"k"`
+}
+
+func encodeCursor(direction MessageDirection, key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	cursor := pageCursor{
+		Direction: direction,
+		Key:       make(map[string]string, len(key)),
+	}
+	for name, value := range key {
+		str, ok := value.(*types.AttributeValueMemberS)
+		if !ok {
+			return "", errors.New("cursor key attributes must be strings")
+		}
+		cursor.Key[name] = str.Value
+	}
+
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func decodeCursor(value string) (MessageDirection, map[string]types.AttributeValue, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return "", nil, ErrInvalidCursor
+	}
+
+	var cursor pageCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil || len(cursor.Key) == 0 {
+		return "", nil, ErrInvalidCursor
+	}
+	switch cursor.Direction {
+	case "", MessageDirectionBefore, MessageDirectionAfter:
+	default:
+		return "", nil, ErrInvalidCursor
+	}
+
+	key := make(map[string]types.AttributeValue, len(cursor.Key))
+	for name, attr := range cursor.Key {
+		key[name] = &types.AttributeValueMemberS{Value: attr}
+	}
+	return cursor.Direction, key, nil
+}
+
+// validStartKey reports whether key has exactly the shape of an index key in
+// the partition being queried: the table key, the partition attribute equal
+// to partitionValue and the sort attribute. Cursors come from clients, and
+// DynamoDB rejects a start key of any other shape or partition.
+func validStartKey(key map[string]types.AttributeValue, partitionAttr, partitionValue, sortAttr string) bool {
+	if len(key) != 3 {
+		return false
+	}
+	if stringAttr(key["pk"]) == "" || stringAttr(key[sortAttr]) == "" {
+		return false
+	}
+	return stringAttr(key[partitionAttr]) == partitionValue
+}
+
+func stringAttr(value types.AttributeValue) string {
+	if str, ok := value.(*types.AttributeValueMemberS); ok {
+		return str.Value
+	}
+	return ""
+}
+
+// messageStartKey builds the byConversation index key that positions a query
+// right next to message.
+func messageStartKey(message model.MessageItem) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk":             &types.AttributeValueMemberS{Value: message.PK},
+		"conversationId": &types.AttributeValueMemberS{Value: message.ConversationID},
+		"createdAt":      &types.AttributeValueMemberS{Value: message.CreatedAt},
+	}
+}
@@ -0,0 +1,203 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"chat-app-backend/internal/model"
+)
+
+type ReadReceiptResult struct {
+	Conversation model.ConversationItem
+	ReaderType   string
+	ReaderID     string
+	Marker       model.ReadMarker
+	UnreadCount  int
+	// Advanced is false when the participant had already read past the
+	// requested message and the stored marker was left unchanged.
+	Advanced bool
+}
+
+// MarkVisitorRead moves the visitor read marker to messageID, or to the newest
+// message when messageID is empty.
+func (s *Service) MarkVisitorRead(ctx context.Context, token, conversationID, messageID string) (ReadReceiptResult, error) {
+	conversationID = strings.TrimSpace(conversationID)
+	if conversationID == "" {
+		return ReadReceiptResult{}, newError(ErrorCodeValidation, "conversationId is required", nil)
+	}
+
+	access, err := s.ValidateVisitorAccess(token)
+	if err != nil {
+		return ReadReceiptResult{}, err
+	}
+	if access.ConversationID != conversationID {
+		return ReadReceiptResult{}, newError(ErrorCodeForbidden, "token does not match conversation", nil)
+	}
+
+	conversation, err := s.repo.GetConversation(ctx, access.TenantID, conversationID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return ReadReceiptResult{}, newError(ErrorCodeNotFound, "conversation not found", err)
+		}
+		return ReadReceiptResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
+	}
+	if conversation.VisitorID != access.VisitorID {
+		return ReadReceiptResult{}, newError(ErrorCodeForbidden, "token does not match conversation", nil)
+	}
+
+	result, err := s.markRead(ctx, conversation, model.ReadMarkerVisitor, model.MessageSenderAgent, messageID)
+	if err != nil {
+		return ReadReceiptResult{}, err
+	}
+	result.ReaderType = model.MessageSenderVisitor
+	result.ReaderID = access.VisitorID
+	result.UnreadCount = result.Conversation.UnreadForVisitor()
+	return result, nil
+}
+
+// MarkRead moves the read marker of the calling tenant user to messageID, or
+// to the newest message when messageID is empty.
+func (s *Service) MarkRead(ctx context.Context, identity Identity, conversationID, messageID string) (ReadReceiptResult, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return ReadReceiptResult{}, err
+	}
+
+	result, err := s.markRead(ctx, conversation, identity.UserID, model.MessageSenderVisitor, messageID)
+	if err != nil {
+		return ReadReceiptResult{}, err
+	}
+	result.ReaderType = model.MessageSenderAgent
+	result.ReaderID = identity.UserID
+	result.UnreadCount = result.Conversation.UnreadForUser(identity.UserID)
+	return result, nil
+}
+
+// markRead advances the marker of participant, who reads the messages sent by
+// counterpart. Markers never move backwards.
+func (s *Service) markRead(ctx context.Context, conversation model.ConversationItem, participant, counterpart, messageID string) (ReadReceiptResult, error) {
+	target, err := s.readTarget(ctx, conversation, strings.TrimSpace(messageID), participant == model.ReadMarkerVisitor)
+	if err != nil {
+		return ReadReceiptResult{}, err
+	}
+
+	// Timestamps have second precision, so a different message created in the
+	// same second as the current marker still advances it.
+	if existing, ok := conversation.ReadMarkers[participant]; ok &&
+		(existing.MessageCreatedAt > target.CreatedAt || existing.MessageID == target.MessageID) {
+		return ReadReceiptResult{
+			Conversation: conversation,
+			Marker:       existing,
+		}, nil
+	}
+
+	marker := model.ReadMarker{
+		MessageID:        target.MessageID,
+		MessageCreatedAt: target.CreatedAt,
+		ReadAt:           s.now().UTC().Format(time.RFC3339),
+		ReadCount:        target.CountFor(counterpart),
+	}
+	err = s.setReadMarker(ctx, &conversation, participant, marker)
+	if errors.Is(err, ErrReadMarkerBehind) {
+		// Another request moved the marker past target since we read it.
+		current, err := s.repo.GetConversation(ctx, conversation.TenantID, conversation.ConversationID)
+		if err != nil {
+			return ReadReceiptResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
+		}
+		return ReadReceiptResult{
+			Conversation: current,
+			Marker:       current.ReadMarkers[participant],
+		}, nil
+	}
+	if errors.Is(err, ErrReadMarkersMissing) {
+		return ReadReceiptResult{}, newError(ErrorCodeConflict, "read receipts are not available for this conversation yet", err)
+	}
+	if err != nil {
+		return ReadReceiptResult{}, newError(ErrorCodeInternal, "failed to update read marker", err)
+	}
+
+	return ReadReceiptResult{
+		Conversation: conversation,
+		Marker:       marker,
+		Advanced:     true,
+	}, nil
+}
+
+// readTarget loads the message a marker moves to: messageID, or the newest
+// message when it is empty.
+func (s *Service) readTarget(ctx context.Context, conversation model.ConversationItem, messageID string, forVisitor bool) (model.MessageItem, error) {
+	if messageID != "" {
+		message, err := s.repo.GetMessage(ctx, conversation.TenantID, conversation.ConversationID, messageID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return model.MessageItem{}, newError(ErrorCodeNotFound, "message not found", err)
+			}
+			return model.MessageItem{}, newError(ErrorCodeInternal, "failed to fetch message", err)
+		}
+		if forVisitor && !message.VisibleToVisitor() {
+			return model.MessageItem{}, newError(ErrorCodeNotFound, "message not found", nil)
+		}
+		return message, nil
+	}
+
+	// The visitor reads up to the newest message they can see, so notes
+	// after it are skipped.
+	query := MessageQuery{Limit: 1, Direction: MessageDirectionBefore}
+	if forVisitor {
+		query.Limit = 20
+	}
+	for {
+		page, err := s.repo.ListMessages(ctx, conversation.TenantID, conversation.ConversationID, query)
+		if err != nil {
+			return model.MessageItem{}, newError(ErrorCodeInternal, "failed to fetch latest message", err)
+		}
+		for i := len(page.Messages) - 1; i >= 0; i-- {
+			if !forVisitor || page.Messages[i].VisibleToVisitor() {
+				return page.Messages[i], nil
+			}
+		}
+		if page.NextCursor == "" {
+			return model.MessageItem{}, newError(ErrorCodeValidation, "conversation has no messages", nil)
+		}
+		query.Cursor = page.NextCursor
+	}
+}
+
+// markOwnMessageRead moves the sender marker to the message they just posted;
+// replying implies having read everything from the other side so far. A
+// marker that is already further along, or missing until the backfill
+// initialises it, is left alone.
+func (s *Service) markOwnMessageRead(ctx context.Context, conversation *model.ConversationItem, participant string, message model.MessageItem) error {
+	counterpart := model.MessageSenderAgent
+	if message.SenderType == model.MessageSenderAgent {
+		counterpart = model.MessageSenderVisitor
+	}
+
+	err := s.setReadMarker(ctx, conversation, participant, model.ReadMarker{
+		MessageID:        message.MessageID,
+		MessageCreatedAt: message.CreatedAt,
+		ReadAt:           message.CreatedAt,
+		ReadCount:        message.CountFor(counterpart),
+	})
+	if err != nil && !errors.Is(err, ErrReadMarkerBehind) && !errors.Is(err, ErrReadMarkersMissing) {
+		return newError(ErrorCodeInternal, "failed to update read marker", err)
+	}
+	return nil
+}
+
+// setReadMarker stores marker and mirrors it on conversation.
+func (s *Service) setReadMarker(ctx context.Context, conversation *model.ConversationItem, participant string, marker model.ReadMarker) error {
+	if err := s.repo.UpdateReadMarker(ctx, conversation.TenantID, conversation.ConversationID, participant, marker); err != nil {
+		return err
+	}
+
+	markers := make(map[string]model.ReadMarker, len(conversation.ReadMarkers)+1)
+	for key, value := range conversation.ReadMarkers {
+		markers[key] = value
+	}
+	markers[participant] = marker
+	conversation.ReadMarkers = markers
+	return nil
+}
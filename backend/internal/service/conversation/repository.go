@@ -5,7 +5,7 @@ import (
 	"chat-app-backend/internal/model"
 	"context"
 	"errors"
-	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -16,21 +16,73 @@ import (
 
 var ErrNotFound = errors.New("conversation repository: not found")
 
+// ErrAssignmentConflict is returned when an assignment was made against a
+// stale assignee because another request changed it first.
+var ErrAssignmentConflict = errors.New("conversation repository: assignment changed concurrently")
+
+// ErrRoutingCursorConflict is returned when the round-robin cursor moved since
+// it was read.
+var ErrRoutingCursorConflict = errors.New("conversation repository: routing cursor changed concurrently")
+
+// ErrReadMarkerBehind is returned when a read marker would move backwards
+// because the participant already read a later message.
+var ErrReadMarkerBehind = errors.New("conversation repository: read marker already past message")
+
+// ErrReadMarkersMissing is returned for conversations stored before read
+// receipts whose counters the backfill has not initialised yet.
+var ErrReadMarkersMissing = errors.New("conversation repository: read markers not initialised")
+
+// ErrReadCountersChanged is returned when message counters moved while the
+// backfill was recounting them.
+var ErrReadCountersChanged = errors.New("conversation repository: message counters changed concurrently")
+
+// ErrMessageChanged is returned when a message was edited or deleted since it
+// was read.
+var ErrMessageChanged = errors.New("conversation repository: message changed concurrently")
+
 type Repository interface {
 	GetTenant(ctx context.Context, tenantID string) (model.TenantItem, error)
 	GetTenantByAPIKey(ctx context.Context, apiKey string) (model.TenantItem, error)
 	GetUser(ctx context.Context, tenantID, userID string) (model.UserItem, error)
+	ListTenantUsers(ctx context.Context, tenantID string) ([]model.UserItem, error)
+	UpdateTenantRoutingCursor(ctx context.Context, tenantID, previous, userID string) error
 	GetVisitor(ctx context.Context, tenantID, visitorID string) (model.VisitorItem, error)
 	PutVisitor(ctx context.Context, visitor model.VisitorItem) error
+	GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error)
+	RecordCannedResponseUse(ctx context.Context, tenantID, responseID, usedAt string) error
 	CreateConversation(ctx context.Context, conversation model.ConversationItem) error
-	UpdateConversationActivity(ctx context.Context, tenantID, conversationID, updatedAt, lastMessageAt string, assignedUserID *string) error
+	UpdateConversationActivity(ctx context.Context, tenantID, conversationID, senderType, updatedAt, lastMessageAt string, assignment *model.AssignmentRecord) (model.ConversationItem, error)
 	UpdateConversationVisitorEmail(ctx context.Context, tenantID, conversationID, visitorEmail, updatedAt string) error
 	MarkConversationTenantStart(ctx context.Context, tenantID, conversationID, startedAt, userID string) error
+	UpdateConversationStatus(ctx context.Context, tenantID, conversationID string, update StatusUpdate) error
+	UpdateConversationAssignment(ctx context.Context, tenantID, conversationID string, record model.AssignmentRecord) error
+	UpdateReadMarker(ctx context.Context, tenantID, conversationID, participant string, marker model.ReadMarker) error
+	InitializeReadMarkers(ctx context.Context, conversation model.ConversationItem, seenVisitorCount, seenAgentCount int) error
 	GetConversation(ctx context.Context, tenantID, conversationID string) (model.ConversationItem, error)
-	ListConversations(ctx context.Context, tenantID string, limit int) ([]model.ConversationItem, error)
+	ListConversations(ctx context.Context, tenantID string, filter ConversationFilter, query PageQuery) (ConversationPage, error)
 	CountConversationsStartedBetween(ctx context.Context, tenantID string, start, end time.Time) (int, error)
+	CountOpenConversationsByAssignee(ctx context.Context, tenantID string) (map[string]int, error)
 	CreateMessage(ctx context.Context, message model.MessageItem) error
-	ListMessages(ctx context.Context, tenantID, conversationID string, limit int) ([]model.MessageItem, error)
+	GetMessage(ctx context.Context, tenantID, conversationID, messageID string) (model.MessageItem, error)
+	UpdateMessageCounters(ctx context.Context, message model.MessageItem) error
+	ReviseMessage(ctx context.Context, message model.MessageItem) error
+	ListMessages(ctx context.Context, tenantID, conversationID string, query MessageQuery) (MessagePage, error)
+	ScanMessages(ctx context.Context, visit func(model.MessageItem) error) error
+	ScanMessagesSince(ctx context.Context, since string, visit func(model.MessageItem) error) error
+	ScanConversations(ctx context.Context, visit func(model.ConversationItem) error) error
+	UpdateConversationIndexKeys(ctx context.Context, conversation model.ConversationItem) error
+}
+
+// StatusUpdate describes the full lifecycle state written by
+// UpdateConversationStatus. Empty close/archive fields are removed from the item.
+type StatusUpdate struct {
+	Status      model.ConversationStatus
+	UpdatedAt   string
+	ClosedAt    string
+	ClosedBy    string
+	CloseReason string
+	ArchivedAt  string
+	ArchivedBy  string
 }
 
 type DynamoRepository struct {
@@ -79,6 +131,64 @@ func (r *DynamoRepository) GetUser(ctx context.Context, tenantID, userID string)
 	return user, nil
 }
 
+func (r *DynamoRepository) ListTenantUsers(ctx context.Context, tenantID string) ([]model.UserItem, error) {
+	items, err := r.db.Client.QueryAll(
+		ctx,
+		model.UsersTable,
+		aws.String("byTenant"),
+		"tenantId = :tenantId",
+		map[string]types.AttributeValue{
+			":tenantId": &types.AttributeValueMemberS{Value: tenantID},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	users := make([]model.UserItem, 0, len(items))
+	for _, item := range items {
+		var user model.UserItem
+		if err := attributevalue.UnmarshalMap(item, &user); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// UpdateTenantRoutingCursor moves the round-robin cursor from previous to
+// userID. It fails with ErrRoutingCursorConflict when another conversation
+// moved the cursor first.
+func (r *DynamoRepository) UpdateTenantRoutingCursor(ctx context.Context, tenantID, previous, userID string) error {
+	condition := "#routingCursor = :previous"
+	if previous == "" {
+		condition = "attribute_not_exists(#routingCursor) OR #routingCursor = :previous"
+	}
+
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.TenantsTable,
+		map[string]types.AttributeValue{
+			"tenantId": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		"SET #routingCursor = :routingCursor",
+		condition,
+		map[string]types.AttributeValue{
+			":routingCursor": &types.AttributeValueMemberS{Value: userID},
+			":previous":      &types.AttributeValueMemberS{Value: previous},
+		},
+		map[string]string{
+			"#routingCursor": "routingCursor",
+		},
+		nil,
+	)
+	if isConditionFailed(err) {
+		return ErrRoutingCursorConflict
+	}
+	return err
+}
+
 func (r *DynamoRepository) GetTenantByAPIKey(ctx context.Context, apiKey string) (model.TenantItem, error) {
 	items, err := r.db.Client.QueryItems(
 		ctx,
@@ -152,12 +262,66 @@ func (r *DynamoRepository) PutVisitor(ctx context.Context, visitor model.Visitor
 	return r.db.Client.PutItem(ctx, model.VisitorsTable, visitor)
 }
 
+func (r *DynamoRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	var response model.CannedResponseItem
+	err := r.db.Client.GetItem(
+		ctx,
+		model.CannedResponsesTable,
+		map[string]types.AttributeValue{
+			"tenantId":   &types.AttributeValueMemberS{Value: tenantID},
+			"responseId": &types.AttributeValueMemberS{Value: responseID},
+		},
+		&response,
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return model.CannedResponseItem{}, ErrNotFound
+		}
+		return model.CannedResponseItem{}, err
+	}
+	return response, nil
+}
+
+// RecordCannedResponseUse counts one more message posted from a canned
+// response. It returns ErrNotFound when the response has been deleted.
+func (r *DynamoRepository) RecordCannedResponseUse(ctx context.Context, tenantID, responseID, usedAt string) error {
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.CannedResponsesTable,
+		map[string]types.AttributeValue{
+			"tenantId":   &types.AttributeValueMemberS{Value: tenantID},
+			"responseId": &types.AttributeValueMemberS{Value: responseID},
+		},
+		"ADD #usageCount :one SET #lastUsedAt = :usedAt",
+		"attribute_exists(responseId)",
+		map[string]types.AttributeValue{
+			":one":    &types.AttributeValueMemberN{Value: "1"},
+			":usedAt": &types.AttributeValueMemberS{Value: usedAt},
+		},
+		map[string]string{
+			"#usageCount": "usageCount",
+			"#lastUsedAt": "lastUsedAt",
+		},
+		nil,
+	)
+	if isConditionFailed(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
 func (r *DynamoRepository) CreateConversation(ctx context.Context, conversation model.ConversationItem) error {
+	conversation.SetIndexKeys()
 	return r.db.Client.PutItem(ctx, model.ConversationsTable, conversation)
 }
 
-func (r *DynamoRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, updatedAt, lastMessageAt string, assignedUserID *string) error {
-	updateExpr := "SET #updatedAt = :updatedAt, #lastMessageAt = :lastMessageAt"
+// UpdateConversationActivity records a new message from senderType, bumps the
+// matching message counter and returns the updated conversation, whose
+// counters place the new message. A non-nil assignment is applied in the same
+// write and fails with ErrAssignmentConflict when the conversation is no longer
+// assigned to assignment.PreviousUserID.
+func (r *DynamoRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, senderType, updatedAt, lastMessageAt string, assignment *model.AssignmentRecord) (model.ConversationItem, error) {
+	setParts := []string{"#updatedAt = :updatedAt", "#lastMessageAt = :lastMessageAt"}
 	exprValues := map[string]types.AttributeValue{
 		":updatedAt":     &types.AttributeValueMemberS{Value: updatedAt},
 		":lastMessageAt": &types.AttributeValueMemberS{Value: lastMessageAt},
@@ -167,23 +331,54 @@ func (r *DynamoRepository) UpdateConversationActivity(ctx context.Context, tenan
 		"#lastMessageAt": "lastMessageAt",
 	}
 
-	if assignedUserID != nil {
-		updateExpr += ", #assignedUserId = :assignedUserId"
-		exprValues[":assignedUserId"] = &types.AttributeValueMemberS{Value: *assignedUserID}
-		attrNames["#assignedUserId"] = "assignedUserId"
+	condition := "attribute_exists(pk)"
+	removeExpr := ""
+	if assignment != nil {
+		assignSet, assignRemove, assignCondition, err := assignmentExpression(tenantID, *assignment, exprValues, attrNames)
+		if err != nil {
+			return model.ConversationItem{}, err
+		}
+		setParts = append(setParts, assignSet...)
+		removeExpr = assignRemove
+		condition += " AND " + assignCondition
 	}
 
-	return r.db.Client.UpdateItem(
+	updateExpr := "SET " + strings.Join(setParts, ", ")
+	if removeExpr != "" {
+		updateExpr += " REMOVE " + removeExpr
+	}
+
+	switch senderType {
+	case model.MessageSenderVisitor:
+		updateExpr += " ADD #messageCount :one"
+		attrNames["#messageCount"] = "visitorMessageCount"
+		exprValues[":one"] = &types.AttributeValueMemberN{Value: "1"}
+	case model.MessageSenderAgent:
+		updateExpr += " ADD #messageCount :one"
+		attrNames["#messageCount"] = "agentMessageCount"
+		exprValues[":one"] = &types.AttributeValueMemberN{Value: "1"}
+	}
+
+	var updated model.ConversationItem
+	err := r.db.Client.UpdateItemWithCondition(
 		ctx,
 		model.ConversationsTable,
 		map[string]types.AttributeValue{
 			"pk": &types.AttributeValueMemberS{Value: model.ConversationPK(tenantID, conversationID)},
 		},
 		updateExpr,
+		condition,
 		exprValues,
 		attrNames,
-		nil,
+		&updated,
 	)
+	if isConditionFailed(err) {
+		return model.ConversationItem{}, r.conditionFailure(ctx, tenantID, conversationID, assignment != nil)
+	}
+	if err != nil {
+		return model.ConversationItem{}, err
+	}
+	return updated, nil
 }
 
 func (r *DynamoRepository) UpdateConversationVisitorEmail(ctx context.Context, tenantID, conversationID, visitorEmail, updatedAt string) error {
@@ -193,14 +388,16 @@ func (r *DynamoRepository) UpdateConversationVisitorEmail(ctx context.Context, t
 		map[string]types.AttributeValue{
 			"pk": &types.AttributeValueMemberS{Value: model.ConversationPK(tenantID, conversationID)},
 		},
-		"SET #visitorEmail = :visitorEmail, #updatedAt = :updatedAt",
+		"SET #visitorEmail = :visitorEmail, #tenantVisitorEmail = :tenantVisitorEmail, #updatedAt = :updatedAt",
 		map[string]types.AttributeValue{
-			":visitorEmail": &types.AttributeValueMemberS{Value: visitorEmail},
-			":updatedAt":    &types.AttributeValueMemberS{Value: updatedAt},
+			":visitorEmail":       &types.AttributeValueMemberS{Value: visitorEmail},
+			":tenantVisitorEmail": &types.AttributeValueMemberS{Value: model.TenantScopedKey(tenantID, visitorEmail)},
+			":updatedAt":          &types.AttributeValueMemberS{Value: updatedAt},
 		},
 		map[string]string{
-			"#visitorEmail": "visitorEmail",
-			"#updatedAt":    "updatedAt",
+			"#visitorEmail":       "visitorEmail",
+			"#tenantVisitorEmail": "tenantVisitorEmail",
+			"#updatedAt":          "updatedAt",
 		},
 		nil,
 	)
@@ -226,6 +423,261 @@ func (r *DynamoRepository) MarkConversationTenantStart(ctx context.Context, tena
 	)
 }
 
+func (r *DynamoRepository) UpdateConversationStatus(ctx context.Context, tenantID, conversationID string, update StatusUpdate) error {
+	setParts := []string{"#status = :status", "#tenantStatus = :tenantStatus", "#updatedAt = :updatedAt"}
+	removeParts := []string{}
+	exprValues := map[string]types.AttributeValue{
+		":status":       &types.AttributeValueMemberS{Value: string(update.Status)},
+		":tenantStatus": &types.AttributeValueMemberS{Value: model.TenantScopedKey(tenantID, string(update.Status))},
+		":updatedAt":    &types.AttributeValueMemberS{Value: update.UpdatedAt},
+	}
+	attrNames := map[string]string{
+		"#status":       "status",
+		"#tenantStatus": "tenantStatus",
+		"#updatedAt":    "updatedAt",
+	}
+
+	optional := []struct {
+		attr  string
+		value string
+	}{
+		{"closedAt", update.ClosedAt},
+		{"closedBy", update.ClosedBy},
+		{"closeReason", update.CloseReason},
+		{"archivedAt", update.ArchivedAt},
+		{"archivedBy", update.ArchivedBy},
+	}
+	for _, field := range optional {
+		name := "#" + field.attr
+		attrNames[name] = field.attr
+		if field.value == "" {
+			removeParts = append(removeParts, name)
+			continue
+		}
+		placeholder := ":" + field.attr
+		setParts = append(setParts, name+" = "+placeholder)
+		exprValues[placeholder] = &types.AttributeValueMemberS{Value: field.value}
+	}
+
+	updateExpr := "SET " + strings.Join(setParts, ", ")
+	if len(removeParts) > 0 {
+		updateExpr += " REMOVE " + strings.Join(removeParts, ", ")
+	}
+
+	// Without the condition an update of a missing conversation would create
+	// a stub item holding only the status fields.
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.ConversationsTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.ConversationPK(tenantID, conversationID)},
+		},
+		updateExpr,
+		"attribute_exists(pk)",
+		exprValues,
+		attrNames,
+		nil,
+	)
+	if isConditionFailed(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// UpdateConversationAssignment applies record and appends it to the history.
+// It fails with ErrAssignmentConflict when the conversation is no longer
+// assigned to record.PreviousUserID.
+func (r *DynamoRepository) UpdateConversationAssignment(ctx context.Context, tenantID, conversationID string, record model.AssignmentRecord) error {
+	exprValues := map[string]types.AttributeValue{
+		":updatedAt": &types.AttributeValueMemberS{Value: record.AssignedAt},
+	}
+	attrNames := map[string]string{
+		"#updatedAt": "updatedAt",
+	}
+
+	setParts, removeExpr, condition, err := assignmentExpression(tenantID, record, exprValues, attrNames)
+	if err != nil {
+		return err
+	}
+	updateExpr := "SET #updatedAt = :updatedAt, " + strings.Join(setParts, ", ")
+	if removeExpr != "" {
+		updateExpr += " REMOVE " + removeExpr
+	}
+
+	err = r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.ConversationsTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.ConversationPK(tenantID, conversationID)},
+		},
+		updateExpr,
+		"attribute_exists(pk) AND "+condition,
+		exprValues,
+		attrNames,
+		nil,
+	)
+	if isConditionFailed(err) {
+		return r.conditionFailure(ctx, tenantID, conversationID, true)
+	}
+	return err
+}
+
+// assignmentExpression adds the placeholders that apply record to exprValues
+// and attrNames. It returns the SET clauses, the REMOVE clause and the
+// condition that the conversation is still assigned to record.PreviousUserID.
+func assignmentExpression(tenantID string, record model.AssignmentRecord, exprValues map[string]types.AttributeValue, attrNames map[string]string) ([]string, string, string, error) {
+	recordValue, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	exprValues[":emptyList"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{}}
+	exprValues[":record"] = &types.AttributeValueMemberL{Value: []types.AttributeValue{
+		&types.AttributeValueMemberM{Value: recordValue},
+	}}
+	exprValues[":expectedAssignee"] = &types.AttributeValueMemberS{Value: record.PreviousUserID}
+	attrNames["#assignmentHistory"] = "assignmentHistory"
+	attrNames["#assignedUserId"] = "assignedUserId"
+	attrNames["#tenantAssignee"] = "tenantAssignee"
+
+	setParts := []string{
+		"#assignmentHistory = list_append(if_not_exists(#assignmentHistory, :emptyList), :record)",
+		"#tenantAssignee = :tenantAssignee",
+	}
+	removeExpr := ""
+	if record.AssignedUserID != "" {
+		setParts = append(setParts, "#assignedUserId = :assignedUserId")
+		exprValues[":assignedUserId"] = &types.AttributeValueMemberS{Value: record.AssignedUserID}
+		exprValues[":tenantAssignee"] = &types.AttributeValueMemberS{Value: model.TenantScopedKey(tenantID, record.AssignedUserID)}
+	} else {
+		removeExpr = "#assignedUserId"
+		exprValues[":tenantAssignee"] = &types.AttributeValueMemberS{Value: model.TenantScopedKey(tenantID, model.ConversationUnassigned)}
+	}
+
+	condition := "#assignedUserId = :expectedAssignee"
+	if record.PreviousUserID == "" {
+		condition = "(attribute_not_exists(#assignedUserId) OR #assignedUserId = :expectedAssignee)"
+	}
+	return setParts, removeExpr, condition, nil
+}
+
+// conditionFailure tells apart the two reasons a conditional conversation
+// update fails: the conversation is gone, or its assignee changed.
+func (r *DynamoRepository) conditionFailure(ctx context.Context, tenantID, conversationID string, assigning bool) error {
+	if !assigning {
+		return ErrNotFound
+	}
+	if _, err := r.GetConversation(ctx, tenantID, conversationID); err != nil {
+		return err
+	}
+	return ErrAssignmentConflict
+}
+
+// UpdateReadMarker stores the read marker of participant in one conditional
+// write. It fails with ErrReadMarkerBehind when the stored marker is on a later
+// message, and with ErrReadMarkersMissing for conversations the read counter
+// backfill has not reached yet.
+func (r *DynamoRepository) UpdateReadMarker(ctx context.Context, tenantID, conversationID, participant string, marker model.ReadMarker) error {
+	markerAttr, err := attributevalue.MarshalMap(marker)
+	if err != nil {
+		return err
+	}
+
+	err = r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.ConversationsTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.ConversationPK(tenantID, conversationID)},
+		},
+		"SET #readMarkers.#participant = :marker",
+		"attribute_exists(#readMarkers) AND (attribute_not_exists(#readMarkers.#participant) OR #readMarkers.#participant.#messageCreatedAt <= :messageCreatedAt)",
+		map[string]types.AttributeValue{
+			":marker":           &types.AttributeValueMemberM{Value: markerAttr},
+			":messageCreatedAt": &types.AttributeValueMemberS{Value: marker.MessageCreatedAt},
+		},
+		map[string]string{
+			"#readMarkers":      "readMarkers",
+			"#participant":      participant,
+			"#messageCreatedAt": "messageCreatedAt",
+		},
+		nil,
+	)
+	if !isConditionFailed(err) {
+		return err
+	}
+
+	conversation, err := r.GetConversation(ctx, tenantID, conversationID)
+	if err != nil {
+		return err
+	}
+	if conversation.ReadMarkers == nil {
+		return ErrReadMarkersMissing
+	}
+	return ErrReadMarkerBehind
+}
+
+// InitializeReadMarkers writes the message counters and read markers of a
+// conversation stored before read receipts. The write only lands while the
+// conversation has no read markers and its counters still hold the seen
+// values; otherwise it fails with ErrReadCountersChanged.
+func (r *DynamoRepository) InitializeReadMarkers(ctx context.Context, conversation model.ConversationItem, seenVisitorCount, seenAgentCount int) error {
+	markers := make(map[string]types.AttributeValue, len(conversation.ReadMarkers))
+	for participant, marker := range conversation.ReadMarkers {
+		markerAttr, err := attributevalue.MarshalMap(marker)
+		if err != nil {
+			return err
+		}
+		markers[participant] = &types.AttributeValueMemberM{Value: markerAttr}
+	}
+
+	values := map[string]types.AttributeValue{
+		":visitorCount": &types.AttributeValueMemberN{Value: strconv.Itoa(conversation.VisitorMessageCount)},
+		":agentCount":   &types.AttributeValueMemberN{Value: strconv.Itoa(conversation.AgentMessageCount)},
+		":markers":      &types.AttributeValueMemberM{Value: markers},
+	}
+	names := map[string]string{
+		"#visitorCount": "visitorMessageCount",
+		"#agentCount":   "agentMessageCount",
+		"#readMarkers":  "readMarkers",
+	}
+	condition := strings.Join([]string{
+		"attribute_exists(pk)",
+		"attribute_not_exists(#readMarkers)",
+		counterCondition("#visitorCount", ":seenVisitorCount", seenVisitorCount, values),
+		counterCondition("#agentCount", ":seenAgentCount", seenAgentCount, values),
+	}, " AND ")
+
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.ConversationsTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: conversation.PK},
+		},
+		"SET #visitorCount = :visitorCount, #agentCount = :agentCount, #readMarkers = :markers",
+		condition,
+		values,
+		names,
+		nil,
+	)
+	if isConditionFailed(err) {
+		if _, err := r.GetConversation(ctx, conversation.TenantID, conversation.ConversationID); err != nil {
+			return err
+		}
+		return ErrReadCountersChanged
+	}
+	return err
+}
+
+// counterCondition checks that a message counter still holds seen. Counters
+// are only ever created by ADD, so zero means the attribute is absent.
+func counterCondition(name, placeholder string, seen int, values map[string]types.AttributeValue) string {
+	if seen == 0 {
+		return "attribute_not_exists(" + name + ")"
+	}
+	values[placeholder] = &types.AttributeValueMemberN{Value: strconv.Itoa(seen)}
+	return name + " = " + placeholder
+}
+
 func (r *DynamoRepository) GetConversation(ctx context.Context, tenantID, conversationID string) (model.ConversationItem, error) {
 	var conversation model.ConversationItem
 	err := r.db.Client.GetItem(
@@ -245,56 +697,63 @@ func (r *DynamoRepository) GetConversation(ctx context.Context, tenantID, conver
 	return conversation, nil
 }
 
-func (r *DynamoRepository) ListConversations(ctx context.Context, tenantID string, limit int) ([]model.ConversationItem, error) {
+func (r *DynamoRepository) ListConversations(ctx context.Context, tenantID string, filter ConversationFilter, query PageQuery) (ConversationPage, error) {
+	plan := planConversationQuery(tenantID, filter)
+
+	var startKey map[string]types.AttributeValue
+	if query.Cursor != "" {
+		_, key, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return ConversationPage{}, err
+		}
+		// A cursor issued for another filter or tenant points into another
+		// index or partition.
+		if !plan.acceptsStartKey(key) {
+			return ConversationPage{}, ErrInvalidCursor
+		}
+		startKey = key
+	}
+
+	var filterExpr *string
+	if plan.filter != "" {
+		filterExpr = aws.String(plan.filter)
+	}
+
 	scanForward := false
-	items, err := r.db.Client.QueryItems(
+	result, err := r.db.Client.QueryPaginatedWithFilter(
 		ctx,
 		model.ConversationsTable,
-		aws.String("byTenant"),
-		"tenantId = :tenantId",
-		map[string]types.AttributeValue{
-			":tenantId": &types.AttributeValueMemberS{Value: tenantID},
-		},
-		nil,
+		aws.String(plan.index),
+		plan.keyCond,
+		filterExpr,
+		plan.values,
+		plan.names,
+		query.Limit,
+		startKey,
 		&scanForward,
 	)
-	if err != nil && !isIndexNotFound(err) {
-		return nil, err
-	}
-
-	if (err != nil && isIndexNotFound(err)) || items == nil {
-		items, err = r.db.Client.ScanItems(
-			ctx,
-			model.ConversationsTable,
-			"tenantId = :tenantId",
-			map[string]types.AttributeValue{
-				":tenantId": &types.AttributeValueMemberS{Value: tenantID},
-			},
-			nil,
-		)
-		if err != nil {
-			return nil, err
-		}
+	if err != nil {
+		return ConversationPage{}, err
 	}
 
-	conversations := make([]model.ConversationItem, 0, len(items))
-	for _, item := range items {
+	conversations := make([]model.ConversationItem, 0, len(result.Items))
+	for _, item := range result.Items {
 		var conversation model.ConversationItem
 		if err := attributevalue.UnmarshalMap(item, &conversation); err != nil {
-			return nil, err
+			return ConversationPage{}, err
 		}
 		conversations = append(conversations, conversation)
 	}
 
-	sort.Slice(conversations, func(i, j int) bool {
-		return conversations[i].LastMessageAt > conversations[j].LastMessageAt
-	})
-
-	if limit > 0 && len(conversations) > limit {
-		conversations = conversations[:limit]
+	nextCursor, err := encodeCursor("", result.LastEvaluatedKey)
+	if err != nil {
+		return ConversationPage{}, err
 	}
 
-	return conversations, nil
+	return ConversationPage{
+		Conversations: conversations,
+		NextCursor:    nextCursor,
+	}, nil
 }
 
 func (r *DynamoRepository) CountConversationsStartedBetween(ctx context.Context, tenantID string, start, end time.Time) (int, error) {
@@ -333,13 +792,91 @@ func (r *DynamoRepository) CountConversationsStartedBetween(ctx context.Context,
 	return count, nil
 }
 
+// CountOpenConversationsByAssignee counts the open conversations of each
+// assignee. It reads the byTenantStatus partition of open conversations only,
+// so its cost follows the open backlog rather than the tenant history.
+func (r *DynamoRepository) CountOpenConversationsByAssignee(ctx context.Context, tenantID string) (map[string]int, error) {
+	if tenantID == "" {
+		return nil, errors.New("tenantID is required")
+	}
+
+	items, err := r.db.Client.QueryAll(
+		ctx,
+		model.ConversationsTable,
+		aws.String("byTenantStatus"),
+		"tenantStatus = :tenantStatus",
+		map[string]types.AttributeValue{
+			":tenantStatus": &types.AttributeValueMemberS{Value: model.TenantScopedKey(tenantID, string(model.ConversationStatusOpen))},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, item := range items {
+		var conversation model.ConversationItem
+		if err := attributevalue.UnmarshalMap(item, &conversation); err != nil {
+			return nil, err
+		}
+		if conversation.AssignedUserID == "" {
+			continue
+		}
+		counts[conversation.AssignedUserID]++
+	}
+
+	return counts, nil
+}
+
 func (r *DynamoRepository) CreateMessage(ctx context.Context, message model.MessageItem) error {
 	return r.db.Client.PutItem(ctx, model.MessagesTable, message)
 }
 
-func (r *DynamoRepository) ListMessages(ctx context.Context, tenantID, conversationID string, limit int) ([]model.MessageItem, error) {
-	scanForward := true
-	items, err := r.db.Client.QueryItems(
+func (r *DynamoRepository) GetMessage(ctx context.Context, tenantID, conversationID, messageID string) (model.MessageItem, error) {
+	var message model.MessageItem
+	err := r.db.Client.GetItem(
+		ctx,
+		model.MessagesTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.MessagePK(conversationID, messageID)},
+		},
+		&message,
+	)
+	if err != nil {
+		if isNotFound(err) {
+			return model.MessageItem{}, ErrNotFound
+		}
+		return model.MessageItem{}, err
+	}
+	if message.TenantID != "" && message.TenantID != tenantID {
+		return model.MessageItem{}, ErrNotFound
+	}
+	return message, nil
+}
+
+func (r *DynamoRepository) ListMessages(ctx context.Context, tenantID, conversationID string, query MessageQuery) (MessagePage, error) {
+	direction := query.Direction
+	var startKey map[string]types.AttributeValue
+	switch {
+	case query.Cursor != "":
+		cursorDirection, key, err := decodeCursor(query.Cursor)
+		if err != nil {
+			return MessagePage{}, err
+		}
+		if !validStartKey(key, "conversationId", conversationID, "createdAt") {
+			return MessagePage{}, ErrInvalidCursor
+		}
+		direction = cursorDirection
+		startKey = key
+	case query.Anchor != nil:
+		startKey = messageStartKey(*query.Anchor)
+	}
+	if direction != MessageDirectionAfter {
+		direction = MessageDirectionBefore
+	}
+
+	scanForward := direction == MessageDirectionAfter
+	result, err := r.db.Client.QueryPaginated(
 		ctx,
 		model.MessagesTable,
 		aws.String("byConversation"),
@@ -347,57 +884,318 @@ func (r *DynamoRepository) ListMessages(ctx context.Context, tenantID, conversat
 		map[string]types.AttributeValue{
 			":conversationId": &types.AttributeValueMemberS{Value: conversationID},
 		},
-		nil,
+		query.Limit,
+		startKey,
 		&scanForward,
 	)
-	if err != nil && !isIndexNotFound(err) {
-		return nil, err
+	if err != nil {
+		return MessagePage{}, err
+	}
+
+	messages := make([]model.MessageItem, 0, len(result.Items))
+	for _, item := range result.Items {
+		var message model.MessageItem
+		if err := attributevalue.UnmarshalMap(item, &message); err != nil {
+			return MessagePage{}, err
+		}
+		if message.TenantID != "" && message.TenantID != tenantID {
+			continue
+		}
+		messages = append(messages, message)
 	}
 
-	if (err != nil && isIndexNotFound(err)) || items == nil {
-		items, err = r.db.Client.ScanItems(
+	if direction == MessageDirectionBefore {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+
+	nextCursor, err := encodeCursor(direction, result.LastEvaluatedKey)
+	if err != nil {
+		return MessagePage{}, err
+	}
+
+	return MessagePage{
+		Messages:   messages,
+		NextCursor: nextCursor,
+	}, nil
+}
+
+// UpdateMessageCounters stores the conversation counters of a message that
+// was posted before messages carried them.
+func (r *DynamoRepository) UpdateMessageCounters(ctx context.Context, message model.MessageItem) error {
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.MessagesTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.MessagePK(message.ConversationID, message.MessageID)},
+		},
+		"SET #visitorCount = :visitorCount, #agentCount = :agentCount",
+		"attribute_exists(pk)",
+		map[string]types.AttributeValue{
+			":visitorCount": &types.AttributeValueMemberN{Value: strconv.Itoa(message.VisitorCount)},
+			":agentCount":   &types.AttributeValueMemberN{Value: strconv.Itoa(message.AgentCount)},
+		},
+		map[string]string{
+			"#visitorCount": "visitorCount",
+			"#agentCount":   "agentCount",
+		},
+		nil,
+	)
+	if isConditionFailed(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// ReviseMessage stores the body, edit and delete times of message together
+// with its last revision, which records the body it replaces. The attachments,
+// content and mentions of a deleted message are removed with it. It fails with
+// ErrMessageChanged when the stored message has been deleted or holds other
+// revisions than the ones before it.
+func (r *DynamoRepository) ReviseMessage(ctx context.Context, message model.MessageItem) error {
+	if len(message.Revisions) == 0 {
+		return errors.New("conversation repository: revised message has no revision")
+	}
+	revision, err := attributevalue.MarshalMap(message.Revisions[len(message.Revisions)-1])
+	if err != nil {
+		return err
+	}
+	seen := len(message.Revisions) - 1
+
+	exprValues := map[string]types.AttributeValue{
+		":body":      &types.AttributeValueMemberS{Value: message.Body},
+		":emptyList": &types.AttributeValueMemberL{Value: []types.AttributeValue{}},
+		":revision": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+			&types.AttributeValueMemberM{Value: revision},
+		}},
+	}
+	attrNames := map[string]string{
+		"#body":      "body",
+		"#revisions": "revisions",
+		"#deletedAt": "deletedAt",
+	}
+	setParts := []string{
+		"#body = :body",
+		"#revisions = list_append(if_not_exists(#revisions, :emptyList), :revision)",
+	}
+	if message.EditedAt != "" {
+		setParts = append(setParts, "#editedAt = :editedAt")
+		exprValues[":editedAt"] = &types.AttributeValueMemberS{Value: message.EditedAt}
+		attrNames["#editedAt"] = "editedAt"
+	}
+	updateExpr := ""
+	if message.DeletedAt != "" {
+		setParts = append(setParts, "#deletedAt = :deletedAt")
+		exprValues[":deletedAt"] = &types.AttributeValueMemberS{Value: message.DeletedAt}
+		var removeParts []string
+		if len(message.Attachments) == 0 {
+			removeParts = append(removeParts, "#attachments")
+			attrNames["#attachments"] = "attachments"
+		}
+		if message.Content == nil {
+			removeParts = append(removeParts, "#content")
+			attrNames["#content"] = "content"
+		}
+		if len(message.Mentions) == 0 {
+			removeParts = append(removeParts, "#mentions")
+			attrNames["#mentions"] = "mentions"
+		}
+		if len(removeParts) > 0 {
+			updateExpr = " REMOVE " + strings.Join(removeParts, ", ")
+		}
+	}
+	updateExpr = "SET " + strings.Join(setParts, ", ") + updateExpr
+
+	condition := "attribute_exists(pk) AND attribute_not_exists(#deletedAt) AND attribute_not_exists(#revisions)"
+	if seen > 0 {
+		condition = "attribute_exists(pk) AND attribute_not_exists(#deletedAt) AND size(#revisions) = :seen"
+		exprValues[":seen"] = &types.AttributeValueMemberN{Value: strconv.Itoa(seen)}
+	}
+
+	err = r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.MessagesTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: model.MessagePK(message.ConversationID, message.MessageID)},
+		},
+		updateExpr,
+		condition,
+		exprValues,
+		attrNames,
+		nil,
+	)
+	if isConditionFailed(err) {
+		if _, err := r.GetMessage(ctx, message.TenantID, message.ConversationID, message.MessageID); err != nil {
+			return err
+		}
+		return ErrMessageChanged
+	}
+	return err
+}
+
+// ScanMessages walks every stored message across all tenants, page by page.
+func (r *DynamoRepository) ScanMessages(ctx context.Context, visit func(model.MessageItem) error) error {
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := r.db.Client.ScanPaginated(ctx, model.MessagesTable, 100, lastKey)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range result.Items {
+			var message model.MessageItem
+			if err := attributevalue.UnmarshalMap(item, &message); err != nil {
+				return err
+			}
+			if err := visit(message); err != nil {
+				return err
+			}
+		}
+
+		if !result.HasMore {
+			return nil
+		}
+		lastKey = result.LastEvaluatedKey
+	}
+}
+
+// ScanMessagesSince visits the messages created after since. It reads only
+// the conversations active since then, and their newer messages, instead of
+// the whole message table.
+func (r *DynamoRepository) ScanMessagesSince(ctx context.Context, since string, visit func(model.MessageItem) error) error {
+	conversations, err := r.db.Client.ScanAllWithFilter(
+		ctx,
+		model.ConversationsTable,
+		"#lastMessageAt > :since",
+		map[string]types.AttributeValue{
+			":since": &types.AttributeValueMemberS{Value: since},
+		},
+		map[string]string{
+			"#lastMessageAt": "lastMessageAt",
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range conversations {
+		var conversation model.ConversationItem
+		if err := attributevalue.UnmarshalMap(item, &conversation); err != nil {
+			return err
+		}
+
+		items, err := r.db.Client.QueryAll(
 			ctx,
 			model.MessagesTable,
-			"conversationId = :conversationId",
+			aws.String("byConversation"),
+			"conversationId = :conversationId AND createdAt > :since",
 			map[string]types.AttributeValue{
-				":conversationId": &types.AttributeValueMemberS{Value: conversationID},
+				":conversationId": &types.AttributeValueMemberS{Value: conversation.ConversationID},
+				":since":          &types.AttributeValueMemberS{Value: since},
 			},
-			nil,
 		)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		for _, messageItem := range items {
+			var message model.MessageItem
+			if err := attributevalue.UnmarshalMap(messageItem, &message); err != nil {
+				return err
+			}
+			if err := visit(message); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	messages := make([]model.MessageItem, 0, len(items))
-	for _, item := range items {
-		var message model.MessageItem
-		if err := attributevalue.UnmarshalMap(item, &message); err != nil {
-			return nil, err
+func (r *DynamoRepository) ScanConversations(ctx context.Context, visit func(model.ConversationItem) error) error {
+	var lastKey map[string]types.AttributeValue
+	for {
+		result, err := r.db.Client.ScanPaginated(ctx, model.ConversationsTable, 100, lastKey)
+		if err != nil {
+			return err
 		}
-		if message.TenantID != "" && message.TenantID != tenantID {
-			continue
+
+		for _, item := range result.Items {
+			var conversation model.ConversationItem
+			if err := attributevalue.UnmarshalMap(item, &conversation); err != nil {
+				return err
+			}
+			if err := visit(conversation); err != nil {
+				return err
+			}
 		}
-		messages = append(messages, message)
+
+		if !result.HasMore {
+			return nil
+		}
+		lastKey = result.LastEvaluatedKey
 	}
+}
+
+// UpdateConversationIndexKeys writes the filter index attributes of
+// conversation as computed by SetIndexKeys, removing the empty ones.
+func (r *DynamoRepository) UpdateConversationIndexKeys(ctx context.Context, conversation model.ConversationItem) error {
+	conversation.SetIndexKeys()
 
-	sort.Slice(messages, func(i, j int) bool {
-		ti := parseTime(messages[i].CreatedAt)
-		tj := parseTime(messages[j].CreatedAt)
-		return ti.Before(tj)
-	})
+	var setParts, removeParts []string
+	exprValues := map[string]types.AttributeValue{}
+	attrNames := map[string]string{}
+	for _, field := range []struct {
+		attr  string
+		value string
+	}{
+		{"tenantStatus", conversation.TenantStatus},
+		{"tenantAssignee", conversation.TenantAssignee},
+		{"tenantVisitor", conversation.TenantVisitor},
+		{"tenantVisitorEmail", conversation.TenantVisitorEmail},
+	} {
+		name := "#" + field.attr
+		attrNames[name] = field.attr
+		if field.value == "" {
+			removeParts = append(removeParts, name)
+			continue
+		}
+		placeholder := ":" + field.attr
+		setParts = append(setParts, name+" = "+placeholder)
+		exprValues[placeholder] = &types.AttributeValueMemberS{Value: field.value}
+	}
 
-	if limit > 0 && len(messages) > limit {
-		messages = messages[len(messages)-limit:]
+	updateExpr := "SET " + strings.Join(setParts, ", ")
+	if len(removeParts) > 0 {
+		updateExpr += " REMOVE " + strings.Join(removeParts, ", ")
 	}
 
-	return messages, nil
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.ConversationsTable,
+		map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: conversation.PK},
+		},
+		updateExpr,
+		"attribute_exists(pk)",
+		exprValues,
+		attrNames,
+		nil,
+	)
+	if isConditionFailed(err) {
+		return ErrNotFound
+	}
+	return err
 }
 
 func isNotFound(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "item not found")
 }
 
+func isConditionFailed(err error) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionErr)
+}
+
 func isIndexNotFound(err error) bool {
 	if err == nil {
 		return false
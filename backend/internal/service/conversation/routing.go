@@ -0,0 +1,130 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"chat-app-backend/internal/model"
+	tenantservice "chat-app-backend/internal/service/tenant"
+)
+
+// maxRoutingCursorAttempts bounds how often round-robin routing retries when
+// concurrent conversations keep moving the cursor.
+const maxRoutingCursorAttempts = 5
+
+// RoutingAssigner is recorded as AssignedBy for conversations assigned
+// automatically on creation.
+const RoutingAssigner = "routing"
+
+// AgentAvailability reports which tenant members can currently take new
+// conversations. Without one, every active member is considered online.
+type AgentAvailability interface {
+	AvailableAgents(ctx context.Context, tenantID string, userIDs []string) ([]string, error)
+}
+
+func (s *Service) SetAgentAvailability(availability AgentAvailability) {
+	s.availability = availability
+}
+
+// routeConversation picks the agent a new conversation should be assigned to
+// according to the tenant routing strategy. An empty result leaves the
+// conversation unassigned.
+func (s *Service) routeConversation(ctx context.Context, tenant model.TenantItem) (string, error) {
+	strategy := tenantservice.RoutingSettingsFromTenant(tenant).Strategy
+	if strategy == tenantservice.RoutingStrategyManual {
+		return "", nil
+	}
+
+	candidates, err := s.routingCandidates(ctx, tenant.TenantID)
+	if err != nil || len(candidates) == 0 {
+		return "", err
+	}
+
+	switch strategy {
+	case tenantservice.RoutingStrategyRoundRobin:
+		return s.nextRoundRobinAssignee(ctx, tenant, candidates)
+	case tenantservice.RoutingStrategyLeastOpen:
+		counts, err := s.repo.CountOpenConversationsByAssignee(ctx, tenant.TenantID)
+		if err != nil {
+			return "", err
+		}
+		return leastLoadedAgent(candidates, counts), nil
+	default:
+		return "", nil
+	}
+}
+
+// nextRoundRobinAssignee advances the tenant cursor past the agent it picks.
+// The cursor only moves when nobody else moved it since it was read, so
+// conversations created at the same time go to different agents.
+func (s *Service) nextRoundRobinAssignee(ctx context.Context, tenant model.TenantItem, candidates []string) (string, error) {
+	cursor := tenant.RoutingCursor
+	for attempt := 1; ; attempt++ {
+		next := nextRoundRobinAgent(candidates, cursor)
+		err := s.repo.UpdateTenantRoutingCursor(ctx, tenant.TenantID, cursor, next)
+		if err == nil {
+			return next, nil
+		}
+		if !errors.Is(err, ErrRoutingCursorConflict) {
+			return "", err
+		}
+		if attempt == maxRoutingCursorAttempts {
+			// Still a valid agent; only the rotation is off by one.
+			return next, nil
+		}
+
+		current, err := s.repo.GetTenant(ctx, tenant.TenantID)
+		if err != nil {
+			return "", err
+		}
+		cursor = current.RoutingCursor
+	}
+}
+
+// routingCandidates returns the sorted IDs of active tenant members that are
+// currently available.
+func (s *Service) routingCandidates(ctx context.Context, tenantID string) ([]string, error) {
+	users, err := s.repo.ListTenantUsers(ctx, tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := make([]string, 0, len(users))
+	for _, user := range users {
+		if !strings.EqualFold(user.Status, "active") || user.UserID == "" {
+			continue
+		}
+		userIDs = append(userIDs, user.UserID)
+	}
+
+	if s.availability != nil && len(userIDs) > 0 {
+		userIDs, err = s.availability.AvailableAgents(ctx, tenantID, userIDs)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(userIDs)
+	return userIDs, nil
+}
+
+func nextRoundRobinAgent(candidates []string, cursor string) string {
+	for _, candidate := range candidates {
+		if candidate > cursor {
+			return candidate
+		}
+	}
+	return candidates[0]
+}
+
+func leastLoadedAgent(candidates []string, counts map[string]int) string {
+	selected := candidates[0]
+	for _, candidate := range candidates[1:] {
+		if counts[candidate] < counts[selected] {
+			selected = candidate
+		}
+	}
+	return selected
+}
@@ -0,0 +1,193 @@
+package conversation
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"chat-app-backend/internal/model"
+	"chat-app-backend/internal/search"
+)
+
+const maxSearchQueryLength = 200
+
+type SearchHit struct {
+	Message      model.MessageItem
+	Snippet      string
+	Conversation model.ConversationItem
+}
+
+type SearchResult struct {
+	Query string
+	Hits  []SearchHit
+}
+
+// SetSearchIndex enables message search. Messages stored through the service
+// are indexed as they are written; RebuildSearchIndex backfills the rest.
+func (s *Service) SetSearchIndex(index *search.Index) {
+	s.search = index
+}
+
+// storeMessage persists message and adds it to the search index once the write
+// has succeeded.
+func (s *Service) storeMessage(ctx context.Context, message model.MessageItem) error {
+	if err := s.repo.CreateMessage(ctx, message); err != nil {
+		return err
+	}
+	if s.search != nil {
+		s.search.Add(searchDocument(message))
+	}
+	return nil
+}
+
+// RebuildSearchIndex walks the whole message table and swaps the index
+// contents for the result, keeping messages stored while the scan ran. It
+// returns the number of scanned messages.
+func (s *Service) RebuildSearchIndex(ctx context.Context) (int, error) {
+	if s.search == nil {
+		return 0, newError(ErrorCodeInternal, "search index is not configured", nil)
+	}
+
+	rebuild := s.search.StartRebuild()
+	count := 0
+	err := s.repo.ScanMessages(ctx, func(message model.MessageItem) error {
+		if !searchable(message) {
+			return nil
+		}
+		rebuild.Add(searchDocument(message))
+		count++
+		return nil
+	})
+	if err != nil {
+		rebuild.Abort()
+		return 0, newError(ErrorCodeInternal, "failed to scan messages", err)
+	}
+
+	rebuild.Commit()
+	return count, nil
+}
+
+// CatchUpSearchIndex adds the messages created after since, typically the
+// newest message of a loaded snapshot. It returns the number of messages
+// added.
+func (s *Service) CatchUpSearchIndex(ctx context.Context, since string) (int, error) {
+	if s.search == nil {
+		return 0, newError(ErrorCodeInternal, "search index is not configured", nil)
+	}
+
+	count := 0
+	err := s.repo.ScanMessagesSince(ctx, since, func(message model.MessageItem) error {
+		if !searchable(message) {
+			return nil
+		}
+		s.search.Add(searchDocument(message))
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, newError(ErrorCodeInternal, "failed to scan new messages", err)
+	}
+	return count, nil
+}
+
+// IndexMessage adds a message stored, edited or deleted by another server, as
+// seen on the shared event stream, to the search index.
+func (s *Service) IndexMessage(message model.MessageItem) {
+	if s.search == nil || message.TenantID == "" || message.MessageID == "" {
+		return
+	}
+	s.indexMessage(message)
+}
+
+// indexMessage brings the search index up to date with message, dropping it
+// once it is deleted.
+func (s *Service) indexMessage(message model.MessageItem) {
+	if message.SenderType == model.MessageSenderSystem {
+		return
+	}
+	if message.DeletedAt != "" {
+		s.search.Remove(message.TenantID, message.MessageID)
+		return
+	}
+	s.search.Add(searchDocument(message))
+}
+
+func (s *Service) SearchMessages(ctx context.Context, identity Identity, query string, limit int) (SearchResult, error) {
+	if identity.UserID == "" || identity.TenantID == "" {
+		return SearchResult{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
+	}
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return SearchResult{}, newError(ErrorCodeValidation, "q is required", nil)
+	}
+	if len(query) > maxSearchQueryLength {
+		return SearchResult{}, newError(ErrorCodeValidation, "q is too long", nil)
+	}
+	if s.search == nil {
+		return SearchResult{}, newError(ErrorCodeInternal, "search is not available", nil)
+	}
+
+	if _, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return SearchResult{}, newError(ErrorCodeUnauthorized, "user not found", err)
+		}
+		return SearchResult{}, newError(ErrorCodeInternal, "failed to verify user", err)
+	}
+
+	hits := s.search.Search(identity.TenantID, query, limit)
+	conversations := make(map[string]model.ConversationItem)
+	result := SearchResult{
+		Query: query,
+		Hits:  make([]SearchHit, 0, len(hits)),
+	}
+	for _, hit := range hits {
+		conversationID := hit.Document.ConversationID
+		conversation, ok := conversations[conversationID]
+		if !ok {
+			var err error
+			conversation, err = s.repo.GetConversation(ctx, identity.TenantID, conversationID)
+			if err != nil {
+				if errors.Is(err, ErrNotFound) {
+					continue
+				}
+				return SearchResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
+			}
+			conversations[conversationID] = conversation
+		}
+
+		result.Hits = append(result.Hits, SearchHit{
+			Message: model.MessageItem{
+				PK:             model.MessagePK(conversationID, hit.Document.MessageID),
+				TenantID:       hit.Document.TenantID,
+				ConversationID: conversationID,
+				MessageID:      hit.Document.MessageID,
+				SenderType:     hit.Document.SenderType,
+				SenderID:       hit.Document.SenderID,
+				Body:           hit.Document.Body,
+				CreatedAt:      hit.Document.CreatedAt,
+			},
+			Snippet:      hit.Snippet,
+			Conversation: conversation,
+		})
+	}
+
+	return result, nil
+}
+
+// searchable reports whether message belongs in the search index. System
+// messages only repeat conversation events and are left out.
+func searchable(message model.MessageItem) bool {
+	return message.TenantID != "" && message.MessageID != "" && message.DeletedAt == "" && message.SenderType != model.MessageSenderSystem
+}
+
+func searchDocument(message model.MessageItem) search.Document {
+	return search.Document{
+		TenantID:       message.TenantID,
+		ConversationID: message.ConversationID,
+		MessageID:      message.MessageID,
+		SenderType:     message.SenderType,
+		SenderID:       message.SenderID,
+		Body:           message.Body,
+		CreatedAt:      message.CreatedAt,
+	}
+}
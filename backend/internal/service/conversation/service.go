@@ -8,6 +8,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
 	"strings"
 	"time"
 
@@ -15,6 +16,8 @@ import (
 	"chat-app-backend/internal/env"
 	internaljwt "chat-app-backend/internal/jwt"
 	"chat-app-backend/internal/model"
+	"chat-app-backend/internal/search"
+	"chat-app-backend/internal/storage"
 
 	"github.com/google/uuid"
 )
@@ -78,20 +81,38 @@ type ConversationResult struct {
 	Conversation model.ConversationItem
 	VisitorToken string
 	Message      model.MessageItem
+	Assignment   *model.AssignmentRecord
 }
 
 type MessageResult struct {
 	Conversation model.ConversationItem
 	Message      model.MessageItem
+	Assignment   *model.AssignmentRecord
+}
+
+type AssignmentResult struct {
+	Conversation model.ConversationItem
+	Assignment   model.AssignmentRecord
 }
 
 type ListConversationsResult struct {
 	Conversations []model.ConversationItem
+	NextCursor    string
+}
+
+// ListMessagesParams pages through a conversation. Before and After are
+// message IDs; at most one of them may be set, and Cursor takes precedence.
+type ListMessagesParams struct {
+	Limit  int
+	Cursor string
+	Before string
+	After  string
 }
 
 type ListMessagesResult struct {
 	Conversation model.ConversationItem
 	Messages     []model.MessageItem
+	NextCursor   string
 }
 
 type ConversationUsageResult struct {
@@ -108,10 +129,15 @@ type VisitorAccess struct {
 }
 
 type Service struct {
-	repo Repository
-	now  func() time.Time
+	repo         Repository
+	now          func() time.Time
+	availability AgentAvailability
+	search       *search.Index
+	blobs        storage.BlobStore
 }
 
+const maxCloseReasonLength = 500
+
 var (
 	visitorTokenSecret = []byte(env.MustGet(env.UserSecretKey))
 	visitorTokenTTL    = 7 * 24 * time.Hour
@@ -245,22 +271,52 @@ func (s *Service) CreateConversation(ctx context.Context, params CreateConversat
 		LastMessageAt:  nowStr,
 	}
 
+	// Routing is best effort: when it fails the conversation starts
+	// unassigned, as it does when no agent is available.
+	assigneeID, err := s.routeConversation(ctx, tenant)
+	if err != nil {
+		log.Printf("failed to route conversation %s of tenant %s: %v", conversationID, tenantID, err)
+		assigneeID = ""
+	}
+
+	var assignment *model.AssignmentRecord
+	if assigneeID != "" {
+		record := model.AssignmentRecord{
+			AssignedUserID: assigneeID,
+			AssignedBy:     RoutingAssigner,
+			AssignedAt:     nowStr,
+		}
+		conversation.AssignedUserID = assigneeID
+		conversation.AssignmentHistory = []model.AssignmentRecord{record}
+		assignment = &record
+	}
+
+	messageID := uuid.NewString()
+	conversation.VisitorMessageCount = 1
+	conversation.ReadMarkers = map[string]model.ReadMarker{
+		model.ReadMarkerVisitor: {
+			MessageID:        messageID,
+			MessageCreatedAt: nowStr,
+			ReadAt:           nowStr,
+		},
+	}
+
 	if err := s.repo.CreateConversation(ctx, conversation); err != nil {
 		return ConversationResult{}, newError(ErrorCodeInternal, "failed to create conversation", err)
 	}
 
-	messageID := uuid.NewString()
 	message := model.MessageItem{
 		PK:             model.MessagePK(conversationID, messageID),
 		TenantID:       tenantID,
 		ConversationID: conversationID,
 		MessageID:      messageID,
-		SenderType:     "visitor",
+		SenderType:     model.MessageSenderVisitor,
 		SenderID:       visitorID,
 		Body:           messageBody,
 		CreatedAt:      nowStr,
+		VisitorCount:   conversation.VisitorMessageCount,
 	}
-	if err := s.repo.CreateMessage(ctx, message); err != nil {
+	if err := s.storeMessage(ctx, message); err != nil {
 		return ConversationResult{}, newError(ErrorCodeInternal, "failed to store message", err)
 	}
 
@@ -279,13 +335,12 @@ func (s *Service) CreateConversation(ctx context.Context, params CreateConversat
 		Conversation: conversation,
 		VisitorToken: token,
 		Message:      message,
+		Assignment:   assignment,
 	}, nil
 }
 
 func (s *Service) PostVisitorMessage(ctx context.Context, token, body string) (MessageResult, error) {
-	body = strings.TrimSpace(body)
-
-	if body == "" {
+	if strings.TrimSpace(body) == "" {
 		return MessageResult{}, newError(ErrorCodeValidation, "message body is required", nil)
 	}
 
@@ -294,6 +349,23 @@ func (s *Service) PostVisitorMessage(ctx context.Context, token, body string) (M
 		return MessageResult{}, err
 	}
 
+	return s.PostVisitorMessageWithAccess(ctx, access, body)
+}
+
+// PostVisitorMessageWithAccess stores a visitor message for access, which the
+// caller has already authenticated, such as through a websocket ticket.
+func (s *Service) PostVisitorMessageWithAccess(ctx context.Context, access VisitorAccess, body string) (MessageResult, error) {
+	return s.postVisitorMessage(ctx, access, messageDraft{Body: body})
+}
+
+// postVisitorMessage stores draft as a message of the visitor of access.
+func (s *Service) postVisitorMessage(ctx context.Context, access VisitorAccess, draft messageDraft) (MessageResult, error) {
+	draft.Body = strings.TrimSpace(draft.Body)
+
+	if draft.empty() {
+		return MessageResult{}, newError(ErrorCodeValidation, "message body is required", nil)
+	}
+
 	conversation, err := s.repo.GetConversation(ctx, access.TenantID, access.ConversationID)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
@@ -302,7 +374,7 @@ func (s *Service) PostVisitorMessage(ctx context.Context, token, body string) (M
 		return MessageResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
 	}
 
-	if conversation.Status == model.ConversationStatusClosed {
+	if conversation.Status == model.ConversationStatusClosed || conversation.Status == model.ConversationStatusArchived {
 		return MessageResult{}, newError(ErrorCodeConflict, "conversation is closed", nil)
 	}
 
@@ -319,18 +391,30 @@ func (s *Service) PostVisitorMessage(ctx context.Context, token, body string) (M
 		TenantID:       conversation.TenantID,
 		ConversationID: conversation.ConversationID,
 		MessageID:      messageID,
-		SenderType:     "visitor",
+		SenderType:     model.MessageSenderVisitor,
 		SenderID:       access.VisitorID,
-		Body:           body,
+		Body:           draft.Body,
 		CreatedAt:      nowStr,
+		Type:           draft.Type,
+		Content:        draft.Content,
+		Attachments:    draft.Attachments,
+	}
+
+	// The counters are bumped first so the stored message carries its place
+	// in the conversation.
+	conversation, err = s.repo.UpdateConversationActivity(ctx, conversation.TenantID, conversation.ConversationID, model.MessageSenderVisitor, nowStr, nowStr, nil)
+	if err != nil {
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to update conversation", err)
 	}
+	message.VisitorCount = conversation.VisitorMessageCount
+	message.AgentCount = conversation.AgentMessageCount
 
-	if err := s.repo.CreateMessage(ctx, message); err != nil {
+	if err := s.storeMessage(ctx, message); err != nil {
 		return MessageResult{}, newError(ErrorCodeInternal, "failed to store message", err)
 	}
 
-	if err := s.repo.UpdateConversationActivity(ctx, conversation.TenantID, conversation.ConversationID, nowStr, nowStr, nil); err != nil {
-		return MessageResult{}, newError(ErrorCodeInternal, "failed to update conversation", err)
+	if err := s.markOwnMessageRead(ctx, &conversation, model.ReadMarkerVisitor, message); err != nil {
+		return MessageResult{}, err
 	}
 
 	if existingVisitor, err := s.repo.GetVisitor(ctx, conversation.TenantID, access.VisitorID); err == nil {
@@ -353,9 +437,6 @@ func (s *Service) PostVisitorMessage(ctx context.Context, token, body string) (M
 		return MessageResult{}, newError(ErrorCodeInternal, "failed to update visitor", err)
 	}
 
-	conversation.LastMessageAt = nowStr
-	conversation.UpdatedAt = nowStr
-
 	return MessageResult{
 		Conversation: conversation,
 		Message:      message,
@@ -438,8 +519,13 @@ func (s *Service) AssignVisitorEmail(ctx context.Context, token, email string) (
 }
 
 func (s *Service) PostAgentMessage(ctx context.Context, identity Identity, conversationID, body string) (MessageResult, error) {
+	return s.postAgentMessage(ctx, identity, conversationID, messageDraft{Body: body})
+}
+
+// postAgentMessage stores draft as a message of the calling tenant user.
+func (s *Service) postAgentMessage(ctx context.Context, identity Identity, conversationID string, draft messageDraft) (MessageResult, error) {
 	conversationID = strings.TrimSpace(conversationID)
-	body = strings.TrimSpace(body)
+	draft.Body = strings.TrimSpace(draft.Body)
 
 	if identity.UserID == "" || identity.TenantID == "" {
 		return MessageResult{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
@@ -447,7 +533,7 @@ func (s *Service) PostAgentMessage(ctx context.Context, identity Identity, conve
 	if conversationID == "" {
 		return MessageResult{}, newError(ErrorCodeValidation, "conversationId is required", nil)
 	}
-	if body == "" {
+	if draft.empty() {
 		return MessageResult{}, newError(ErrorCodeValidation, "message body is required", nil)
 	}
 
@@ -466,6 +552,10 @@ func (s *Service) PostAgentMessage(ctx context.Context, identity Identity, conve
 		return MessageResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
 	}
 
+	if conversation.Status == model.ConversationStatusClosed || conversation.Status == model.ConversationStatusArchived {
+		return MessageResult{}, newError(ErrorCodeConflict, "conversation is closed", nil)
+	}
+
 	now := s.now().UTC()
 	nowStr := now.Format(time.RFC3339)
 
@@ -475,14 +565,13 @@ func (s *Service) PostAgentMessage(ctx context.Context, identity Identity, conve
 		TenantID:       identity.TenantID,
 		ConversationID: conversation.ConversationID,
 		MessageID:      messageID,
-		SenderType:     "agent",
+		SenderType:     model.MessageSenderAgent,
 		SenderID:       identity.UserID,
-		Body:           body,
+		Body:           draft.Body,
 		CreatedAt:      nowStr,
-	}
-
-	if err := s.repo.CreateMessage(ctx, message); err != nil {
-		return MessageResult{}, newError(ErrorCodeInternal, "failed to store message", err)
+		Type:           draft.Type,
+		Content:        draft.Content,
+		Attachments:    draft.Attachments,
 	}
 
 	if conversation.TenantStartedAt == "" {
@@ -493,33 +582,252 @@ func (s *Service) PostAgentMessage(ctx context.Context, identity Identity, conve
 		conversation.TenantStartedBy = identity.UserID
 	}
 
-	var assigned *string
+	// The first agent to reply to an unassigned conversation takes it. The
+	// assignment rides on the activity write so it only lands while the
+	// conversation is still unassigned.
+	var assignment *model.AssignmentRecord
 	if conversation.AssignedUserID == "" {
-		assigned = &identity.UserID
+		assignment = &model.AssignmentRecord{
+			AssignedUserID: identity.UserID,
+			AssignedBy:     identity.UserID,
+			AssignedAt:     nowStr,
+		}
 	}
 
-	if err := s.repo.UpdateConversationActivity(ctx, identity.TenantID, conversation.ConversationID, nowStr, nowStr, assigned); err != nil {
+	updated, err := s.repo.UpdateConversationActivity(ctx, identity.TenantID, conversation.ConversationID, model.MessageSenderAgent, nowStr, nowStr, assignment)
+	if errors.Is(err, ErrAssignmentConflict) {
+		// Someone else took the conversation meanwhile; keep their assignment.
+		assignment = nil
+		updated, err = s.repo.UpdateConversationActivity(ctx, identity.TenantID, conversation.ConversationID, model.MessageSenderAgent, nowStr, nowStr, nil)
+	}
+	if err != nil {
 		return MessageResult{}, newError(ErrorCodeInternal, "failed to update conversation", err)
 	}
+	conversation = updated
+	message.VisitorCount = conversation.VisitorMessageCount
+	message.AgentCount = conversation.AgentMessageCount
 
-	if assigned != nil {
-		conversation.AssignedUserID = *assigned
+	if err := s.storeMessage(ctx, message); err != nil {
+		return MessageResult{}, newError(ErrorCodeInternal, "failed to store message", err)
+	}
+
+	if err := s.markOwnMessageRead(ctx, &conversation, identity.UserID, message); err != nil {
+		return MessageResult{}, err
 	}
-	conversation.LastMessageAt = nowStr
-	conversation.UpdatedAt = nowStr
 
 	return MessageResult{
 		Conversation: conversation,
 		Message:      message,
+		Assignment:   assignment,
 	}, nil
 }
 
-func (s *Service) ListConversations(ctx context.Context, identity Identity, limit int) (ListConversationsResult, error) {
+// AssignConversation assigns the conversation to assigneeID, or clears the
+// assignment when assigneeID is empty.
+func (s *Service) AssignConversation(ctx context.Context, identity Identity, conversationID, assigneeID string) (AssignmentResult, error) {
+	assigneeID = strings.TrimSpace(assigneeID)
+
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return AssignmentResult{}, err
+	}
+
+	if conversation.Status == model.ConversationStatusArchived {
+		return AssignmentResult{}, newError(ErrorCodeConflict, "conversation is archived", nil)
+	}
+
+	if assigneeID == conversation.AssignedUserID {
+		if assigneeID == "" {
+			return AssignmentResult{}, newError(ErrorCodeConflict, "conversation is not assigned", nil)
+		}
+		return AssignmentResult{}, newError(ErrorCodeConflict, "conversation is already assigned to this user", nil)
+	}
+
+	if assigneeID != "" {
+		assignee, err := s.repo.GetUser(ctx, identity.TenantID, assigneeID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return AssignmentResult{}, newError(ErrorCodeValidation, "assignee is not a member of this tenant", err)
+			}
+			return AssignmentResult{}, newError(ErrorCodeInternal, "failed to verify assignee", err)
+		}
+		if !strings.EqualFold(assignee.Status, "active") {
+			return AssignmentResult{}, newError(ErrorCodeValidation, "assignee is not active", nil)
+		}
+	}
+
+	nowStr := s.now().UTC().Format(time.RFC3339)
+	record := model.AssignmentRecord{
+		AssignedUserID: assigneeID,
+		PreviousUserID: conversation.AssignedUserID,
+		AssignedBy:     identity.UserID,
+		AssignedAt:     nowStr,
+	}
+
+	if err := s.repo.UpdateConversationAssignment(ctx, conversation.TenantID, conversation.ConversationID, record); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return AssignmentResult{}, newError(ErrorCodeNotFound, "conversation not found", err)
+		}
+		if errors.Is(err, ErrAssignmentConflict) {
+			return AssignmentResult{}, newError(ErrorCodeConflict, "conversation assignment changed, reload and try again", err)
+		}
+		return AssignmentResult{}, newError(ErrorCodeInternal, "failed to update assignment", err)
+	}
+
+	conversation.AssignedUserID = assigneeID
+	conversation.AssignmentHistory = append(conversation.AssignmentHistory, record)
+	conversation.UpdatedAt = nowStr
+
+	return AssignmentResult{
+		Conversation: conversation,
+		Assignment:   record,
+	}, nil
+}
+
+func (s *Service) CloseConversation(ctx context.Context, identity Identity, conversationID, reason string) (model.ConversationItem, error) {
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxCloseReasonLength {
+		return model.ConversationItem{}, newError(ErrorCodeValidation, fmt.Sprintf("close reason must be at most %d characters", maxCloseReasonLength), nil)
+	}
+
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return model.ConversationItem{}, err
+	}
+
+	switch conversation.Status {
+	case model.ConversationStatusClosed:
+		return model.ConversationItem{}, newError(ErrorCodeConflict, "conversation is already closed", nil)
+	case model.ConversationStatusArchived:
+		return model.ConversationItem{}, newError(ErrorCodeConflict, "conversation is archived", nil)
+	}
+
+	nowStr := s.now().UTC().Format(time.RFC3339)
+	update := StatusUpdate{
+		Status:      model.ConversationStatusClosed,
+		UpdatedAt:   nowStr,
+		ClosedAt:    nowStr,
+		ClosedBy:    identity.UserID,
+		CloseReason: reason,
+	}
+
+	return s.applyStatusUpdate(ctx, conversation, update)
+}
+
+func (s *Service) ReopenConversation(ctx context.Context, identity Identity, conversationID string) (model.ConversationItem, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return model.ConversationItem{}, err
+	}
+
+	if conversation.Status == model.ConversationStatusOpen || conversation.Status == "" {
+		return model.ConversationItem{}, newError(ErrorCodeConflict, "conversation is already open", nil)
+	}
+
+	update := StatusUpdate{
+		Status:    model.ConversationStatusOpen,
+		UpdatedAt: s.now().UTC().Format(time.RFC3339),
+	}
+
+	return s.applyStatusUpdate(ctx, conversation, update)
+}
+
+func (s *Service) ArchiveConversation(ctx context.Context, identity Identity, conversationID string) (model.ConversationItem, error) {
+	conversation, err := s.agentConversation(ctx, identity, conversationID)
+	if err != nil {
+		return model.ConversationItem{}, err
+	}
+
+	if conversation.Status == model.ConversationStatusArchived {
+		return model.ConversationItem{}, newError(ErrorCodeConflict, "conversation is already archived", nil)
+	}
+
+	nowStr := s.now().UTC().Format(time.RFC3339)
+	update := StatusUpdate{
+		Status:      model.ConversationStatusArchived,
+		UpdatedAt:   nowStr,
+		ClosedAt:    conversation.ClosedAt,
+		ClosedBy:    conversation.ClosedBy,
+		CloseReason: conversation.CloseReason,
+		ArchivedAt:  nowStr,
+		ArchivedBy:  identity.UserID,
+	}
+	// Archiving an open conversation closes it implicitly.
+	if update.ClosedAt == "" {
+		update.ClosedAt = nowStr
+		update.ClosedBy = identity.UserID
+	}
+
+	return s.applyStatusUpdate(ctx, conversation, update)
+}
+
+func (s *Service) applyStatusUpdate(ctx context.Context, conversation model.ConversationItem, update StatusUpdate) (model.ConversationItem, error) {
+	if err := s.repo.UpdateConversationStatus(ctx, conversation.TenantID, conversation.ConversationID, update); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.ConversationItem{}, newError(ErrorCodeNotFound, "conversation not found", err)
+		}
+		return model.ConversationItem{}, newError(ErrorCodeInternal, "failed to update conversation status", err)
+	}
+
+	conversation.Status = update.Status
+	conversation.UpdatedAt = update.UpdatedAt
+	conversation.ClosedAt = update.ClosedAt
+	conversation.ClosedBy = update.ClosedBy
+	conversation.CloseReason = update.CloseReason
+	conversation.ArchivedAt = update.ArchivedAt
+	conversation.ArchivedBy = update.ArchivedBy
+
+	return conversation, nil
+}
+
+// GetConversation returns the conversation conversationID of the caller's
+// tenant.
+func (s *Service) GetConversation(ctx context.Context, identity Identity, conversationID string) (model.ConversationItem, error) {
+	return s.agentConversation(ctx, identity, conversationID)
+}
+
+// agentConversation verifies the caller belongs to the tenant and loads the
+// conversation scoped to that tenant.
+func (s *Service) agentConversation(ctx context.Context, identity Identity, conversationID string) (model.ConversationItem, error) {
+	conversationID = strings.TrimSpace(conversationID)
+
+	if identity.UserID == "" || identity.TenantID == "" {
+		return model.ConversationItem{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
+	}
+	if conversationID == "" {
+		return model.ConversationItem{}, newError(ErrorCodeValidation, "conversationId is required", nil)
+	}
+
+	if _, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.ConversationItem{}, newError(ErrorCodeUnauthorized, "user not found", err)
+		}
+		return model.ConversationItem{}, newError(ErrorCodeInternal, "failed to verify user", err)
+	}
+
+	conversation, err := s.repo.GetConversation(ctx, identity.TenantID, conversationID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.ConversationItem{}, newError(ErrorCodeNotFound, "conversation not found", err)
+		}
+		return model.ConversationItem{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
+	}
+
+	return conversation, nil
+}
+
+func (s *Service) ListConversations(ctx context.Context, identity Identity, filter ConversationFilter, query PageQuery) (ListConversationsResult, error) {
 	if identity.UserID == "" || identity.TenantID == "" {
 		return ListConversationsResult{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
 	}
-	if limit <= 0 || limit > 100 {
-		limit = 50
+	if query.Limit <= 0 || query.Limit > 200 {
+		query.Limit = 100
+	}
+	query.Cursor = strings.TrimSpace(query.Cursor)
+
+	filter, err := normalizeConversationFilter(filter)
+	if err != nil {
+		return ListConversationsResult{}, err
 	}
 
 	if _, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID); err != nil {
@@ -529,12 +837,18 @@ func (s *Service) ListConversations(ctx context.Context, identity Identity, limi
 		return ListConversationsResult{}, newError(ErrorCodeInternal, "failed to verify user", err)
 	}
 
-	conversations, err := s.repo.ListConversations(ctx, identity.TenantID, limit)
+	page, err := s.repo.ListConversations(ctx, identity.TenantID, filter, query)
 	if err != nil {
+		if errors.Is(err, ErrInvalidCursor) {
+			return ListConversationsResult{}, newError(ErrorCodeValidation, "invalid cursor", err)
+		}
 		return ListConversationsResult{}, newError(ErrorCodeInternal, "failed to list conversations", err)
 	}
 
-	return ListConversationsResult{Conversations: conversations}, nil
+	return ListConversationsResult{
+		Conversations: page.Conversations,
+		NextCursor:    page.NextCursor,
+	}, nil
 }
 
 func (s *Service) GetConversationUsage(ctx context.Context, identity Identity, start, end time.Time) (ConversationUsageResult, error) {
@@ -570,7 +884,7 @@ func (s *Service) GetConversationUsage(ctx context.Context, identity Identity, s
 	}, nil
 }
 
-func (s *Service) ListMessages(ctx context.Context, identity Identity, conversationID string, limit int) (ListMessagesResult, error) {
+func (s *Service) ListMessages(ctx context.Context, identity Identity, conversationID string, params ListMessagesParams) (ListMessagesResult, error) {
 	if identity.UserID == "" || identity.TenantID == "" {
 		return ListMessagesResult{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
 	}
@@ -580,10 +894,6 @@ func (s *Service) ListMessages(ctx context.Context, identity Identity, conversat
 		return ListMessagesResult{}, newError(ErrorCodeValidation, "conversationId is required", nil)
 	}
 
-	if limit <= 0 || limit > 200 {
-		limit = 100
-	}
-
 	conversation, err := s.repo.GetConversation(ctx, identity.TenantID, conversationID)
 	if err != nil {
 		if errors.Is(err, ErrNotFound) {
@@ -592,27 +902,15 @@ func (s *Service) ListMessages(ctx context.Context, identity Identity, conversat
 		return ListMessagesResult{}, newError(ErrorCodeInternal, "failed to fetch conversation", err)
 	}
 
-	messages, err := s.repo.ListMessages(ctx, identity.TenantID, conversationID, limit)
-	if err != nil {
-		return ListMessagesResult{}, newError(ErrorCodeInternal, "failed to list messages", err)
-	}
-
-	return ListMessagesResult{
-		Conversation: conversation,
-		Messages:     messages,
-	}, nil
+	return s.listMessagePage(ctx, conversation, params, false)
 }
 
-func (s *Service) ListVisitorMessages(ctx context.Context, token, conversationID string, limit int) (ListMessagesResult, error) {
+func (s *Service) ListVisitorMessages(ctx context.Context, token, conversationID string, params ListMessagesParams) (ListMessagesResult, error) {
 	conversationID = strings.TrimSpace(conversationID)
 	if conversationID == "" {
 		return ListMessagesResult{}, newError(ErrorCodeValidation, "conversationId is required", nil)
 	}
 
-	if limit <= 0 || limit > 200 {
-		limit = 100
-	}
-
 	access, err := s.ValidateVisitorAccess(token)
 	if err != nil {
 		return ListMessagesResult{}, err
@@ -634,14 +932,97 @@ func (s *Service) ListVisitorMessages(ctx context.Context, token, conversationID
 		return ListMessagesResult{}, newError(ErrorCodeForbidden, "token does not match conversation", nil)
 	}
 
-	messages, err := s.repo.ListMessages(ctx, access.TenantID, conversationID, limit)
-	if err != nil {
-		return ListMessagesResult{}, newError(ErrorCodeInternal, "failed to list messages", err)
+	return s.listMessagePage(ctx, conversation, params, true)
+}
+
+// listMessagePage reads one page of the messages of conversation. Pages for
+// the visitor leave out notes and keep reading until they are full, and a
+// note cannot be their anchor.
+func (s *Service) listMessagePage(ctx context.Context, conversation model.ConversationItem, params ListMessagesParams, forVisitor bool) (ListMessagesResult, error) {
+	query := MessageQuery{
+		Limit:     params.Limit,
+		Cursor:    strings.TrimSpace(params.Cursor),
+		Direction: MessageDirectionBefore,
+	}
+	if query.Limit <= 0 || query.Limit > 200 {
+		query.Limit = 100
+	}
+
+	before := strings.TrimSpace(params.Before)
+	after := strings.TrimSpace(params.After)
+	if before != "" && after != "" {
+		return ListMessagesResult{}, newError(ErrorCodeValidation, "before and after cannot be combined", nil)
+	}
+
+	if query.Cursor == "" && (before != "" || after != "") {
+		anchorID := before
+		if after != "" {
+			anchorID = after
+			query.Direction = MessageDirectionAfter
+		}
+		anchor, err := s.repo.GetMessage(ctx, conversation.TenantID, conversation.ConversationID, anchorID)
+		if err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return ListMessagesResult{}, newError(ErrorCodeNotFound, "message not found", err)
+			}
+			return ListMessagesResult{}, newError(ErrorCodeInternal, "failed to fetch message", err)
+		}
+		if forVisitor && !anchor.VisibleToVisitor() {
+			return ListMessagesResult{}, newError(ErrorCodeNotFound, "message not found", nil)
+		}
+		query.Anchor = &anchor
+	}
+
+	limit := query.Limit
+	var messages []model.MessageItem
+	var nextCursor string
+	for {
+		page, err := s.repo.ListMessages(ctx, conversation.TenantID, conversation.ConversationID, query)
+		if err != nil {
+			if errors.Is(err, ErrInvalidCursor) {
+				return ListMessagesResult{}, newError(ErrorCodeValidation, "invalid cursor", err)
+			}
+			return ListMessagesResult{}, newError(ErrorCodeInternal, "failed to list messages", err)
+		}
+		nextCursor = page.NextCursor
+
+		read := page.Messages
+		if forVisitor {
+			read = make([]model.MessageItem, 0, len(page.Messages))
+			for _, message := range page.Messages {
+				if message.VisibleToVisitor() {
+					read = append(read, message)
+				}
+			}
+		}
+		// Pages read backwards hold older messages than the ones before them.
+		if query.Direction == MessageDirectionAfter || messages == nil {
+			messages = append(messages, read...)
+		} else {
+			messages = append(read, messages...)
+		}
+
+		// Asking only for what is missing keeps the page from overflowing, so
+		// the cursor never skips a message.
+		if !forVisitor || len(messages) >= limit || nextCursor == "" {
+			break
+		}
+		query.Limit = limit - len(messages)
+		query.Cursor = nextCursor
+		query.Anchor = nil
+	}
+	if messages == nil {
+		messages = []model.MessageItem{}
+	}
+
+	if err := s.signAttachments(ctx, messages); err != nil {
+		return ListMessagesResult{}, err
 	}
 
 	return ListMessagesResult{
 		Conversation: conversation,
 		Messages:     messages,
+		NextCursor:   nextCursor,
 	}, nil
 }
 
@@ -1,13 +1,26 @@
 package conversation
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"chat-app-backend/internal/model"
+	"chat-app-backend/internal/search"
+	"chat-app-backend/internal/storage"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 type memoryRepository struct {
@@ -18,6 +31,7 @@ type memoryRepository struct {
 	conversations map[string]model.ConversationItem
 	messages      map[string][]model.MessageItem
 	keys          map[string]string
+	canned        map[string]model.CannedResponseItem
 }
 
 func newMemoryRepository() *memoryRepository {
@@ -28,6 +42,7 @@ func newMemoryRepository() *memoryRepository {
 		conversations: make(map[string]model.ConversationItem),
 		messages:      make(map[string][]model.MessageItem),
 		keys:          make(map[string]string),
+		canned:        make(map[string]model.CannedResponseItem),
 	}
 }
 
@@ -63,6 +78,33 @@ func (m *memoryRepository) GetUser(ctx context.Context, tenantID, userID string)
 	return user, nil
 }
 
+func (m *memoryRepository) ListTenantUsers(ctx context.Context, tenantID string) ([]model.UserItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var users []model.UserItem
+	for _, user := range m.users {
+		if user.TenantID == tenantID {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (m *memoryRepository) UpdateTenantRoutingCursor(ctx context.Context, tenantID, previous, userID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	tenant, ok := m.tenants[tenantID]
+	if !ok {
+		return ErrNotFound
+	}
+	if tenant.RoutingCursor != previous {
+		return ErrRoutingCursorConflict
+	}
+	tenant.RoutingCursor = userID
+	m.tenants[tenantID] = tenant
+	return nil
+}
+
 func (m *memoryRepository) GetVisitor(ctx context.Context, tenantID, visitorID string) (model.VisitorItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -81,6 +123,29 @@ func (m *memoryRepository) PutVisitor(ctx context.Context, visitor model.Visitor
 	return nil
 }
 
+func (m *memoryRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return model.CannedResponseItem{}, ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *memoryRepository) RecordCannedResponseUse(ctx context.Context, tenantID, responseID, usedAt string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return ErrNotFound
+	}
+	item.UsageCount++
+	item.LastUsedAt = usedAt
+	m.canned[responseID] = item
+	return nil
+}
+
 func (m *memoryRepository) CreateConversation(ctx context.Context, conversation model.ConversationItem) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -88,21 +153,31 @@ func (m *memoryRepository) CreateConversation(ctx context.Context, conversation
 	return nil
 }
 
-func (m *memoryRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, updatedAt, lastMessageAt string, assignedUserID *string) error {
+func (m *memoryRepository) UpdateConversationActivity(ctx context.Context, tenantID, conversationID, senderType, updatedAt, lastMessageAt string, assignment *model.AssignmentRecord) (model.ConversationItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	pk := model.ConversationPK(tenantID, conversationID)
 	conversation, ok := m.conversations[pk]
 	if !ok {
-		return ErrNotFound
+		return model.ConversationItem{}, ErrNotFound
+	}
+	if assignment != nil {
+		if conversation.AssignedUserID != assignment.PreviousUserID {
+			return model.ConversationItem{}, ErrAssignmentConflict
+		}
+		conversation.AssignedUserID = assignment.AssignedUserID
+		conversation.AssignmentHistory = append(conversation.AssignmentHistory, *assignment)
 	}
 	conversation.UpdatedAt = updatedAt
 	conversation.LastMessageAt = lastMessageAt
-	if assignedUserID != nil {
-		conversation.AssignedUserID = *assignedUserID
+	switch senderType {
+	case model.MessageSenderVisitor:
+		conversation.VisitorMessageCount++
+	case model.MessageSenderAgent:
+		conversation.AgentMessageCount++
 	}
 	m.conversations[pk] = conversation
-	return nil
+	return conversation, nil
 }
 
 func (m *memoryRepository) UpdateConversationVisitorEmail(ctx context.Context, tenantID, conversationID, visitorEmail, updatedAt string) error {
@@ -133,6 +208,67 @@ func (m *memoryRepository) MarkConversationTenantStart(ctx context.Context, tena
 	return nil
 }
 
+func (m *memoryRepository) UpdateConversationStatus(ctx context.Context, tenantID, conversationID string, update StatusUpdate) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return ErrNotFound
+	}
+	conversation.Status = update.Status
+	conversation.UpdatedAt = update.UpdatedAt
+	conversation.ClosedAt = update.ClosedAt
+	conversation.ClosedBy = update.ClosedBy
+	conversation.CloseReason = update.CloseReason
+	conversation.ArchivedAt = update.ArchivedAt
+	conversation.ArchivedBy = update.ArchivedBy
+	m.conversations[pk] = conversation
+	return nil
+}
+
+func (m *memoryRepository) UpdateConversationAssignment(ctx context.Context, tenantID, conversationID string, record model.AssignmentRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return ErrNotFound
+	}
+	if conversation.AssignedUserID != record.PreviousUserID {
+		return ErrAssignmentConflict
+	}
+	conversation.AssignedUserID = record.AssignedUserID
+	conversation.AssignmentHistory = append(conversation.AssignmentHistory, record)
+	conversation.UpdatedAt = record.AssignedAt
+	m.conversations[pk] = conversation
+	return nil
+}
+
+func (m *memoryRepository) UpdateReadMarker(ctx context.Context, tenantID, conversationID, participant string, marker model.ReadMarker) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pk := model.ConversationPK(tenantID, conversationID)
+	conversation, ok := m.conversations[pk]
+	if !ok {
+		return ErrNotFound
+	}
+	if conversation.ReadMarkers == nil {
+		return ErrReadMarkersMissing
+	}
+	if existing, ok := conversation.ReadMarkers[participant]; ok && existing.MessageCreatedAt > marker.MessageCreatedAt {
+		return ErrReadMarkerBehind
+	}
+	markers := make(map[string]model.ReadMarker, len(conversation.ReadMarkers)+1)
+	for key, value := range conversation.ReadMarkers {
+		markers[key] = value
+	}
+	markers[participant] = marker
+	conversation.ReadMarkers = markers
+	m.conversations[pk] = conversation
+	return nil
+}
+
 func (m *memoryRepository) GetConversation(ctx context.Context, tenantID, conversationID string) (model.ConversationItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -144,22 +280,31 @@ func (m *memoryRepository) GetConversation(ctx context.Context, tenantID, conver
 	return conversation, nil
 }
 
-func (m *memoryRepository) ListConversations(ctx context.Context, tenantID string, limit int) ([]model.ConversationItem, error) {
+func (m *memoryRepository) ListConversations(ctx context.Context, tenantID string, filter ConversationFilter, query PageQuery) (ConversationPage, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	items := make([]model.ConversationItem, 0)
-	for _, c := range m.conversations {
-		if c.TenantID == tenantID {
-			items = append(items, c)
+	for _, conv := range m.conversations {
+		if conv.TenantID == tenantID && filter.Matches(conv) {
+			items = append(items, conv)
 		}
 	}
-	sort.Slice(items, func(i, j int) bool {
-		return items[i].LastMessageAt > items[j].LastMessageAt
-	})
-	if limit > 0 && len(items) > limit {
-		items = items[:limit]
+	sort.Slice(items, func(i, j int) bool { return items[i].LastMessageAt > items[j].LastMessageAt })
+	offset := 0
+	if query.Cursor != "" {
+		parsed, err := strconv.Atoi(query.Cursor)
+		if err != nil || parsed < 0 || parsed > len(items) {
+			return ConversationPage{}, ErrInvalidCursor
+		}
+		offset = parsed
+	}
+	items = items[offset:]
+	page := ConversationPage{Conversations: items}
+	if query.Limit > 0 && len(items) > query.Limit {
+		page.Conversations = items[:query.Limit]
+		page.NextCursor = strconv.Itoa(offset + query.Limit)
 	}
-	return items, nil
+	return page, nil
 }
 
 func (m *memoryRepository) CountConversationsStartedBetween(ctx context.Context, tenantID string, start, end time.Time) (int, error) {
@@ -181,6 +326,18 @@ func (m *memoryRepository) CountConversationsStartedBetween(ctx context.Context,
 	return count, nil
 }
 
+func (m *memoryRepository) CountOpenConversationsByAssignee(ctx context.Context, tenantID string) (map[string]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counts := make(map[string]int)
+	for _, conversation := range m.conversations {
+		if conversation.TenantID == tenantID && conversation.Status == model.ConversationStatusOpen && conversation.AssignedUserID != "" {
+			counts[conversation.AssignedUserID]++
+		}
+	}
+	return counts, nil
+}
+
 func (m *memoryRepository) CreateMessage(ctx context.Context, message model.MessageItem) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -188,7 +345,65 @@ func (m *memoryRepository) CreateMessage(ctx context.Context, message model.Mess
 	return nil
 }
 
-func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversationID string, limit int) ([]model.MessageItem, error) {
+func (m *memoryRepository) GetMessage(ctx context.Context, tenantID, conversationID, messageID string) (model.MessageItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, msg := range m.messages[conversationID] {
+		if msg.MessageID == messageID && msg.TenantID == tenantID {
+			return msg, nil
+		}
+	}
+	return model.MessageItem{}, ErrNotFound
+}
+
+func (m *memoryRepository) UpdateMessageCounters(ctx context.Context, message model.MessageItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.messages[message.ConversationID] {
+		if msg.MessageID == message.MessageID {
+			m.messages[message.ConversationID][i].VisitorCount = message.VisitorCount
+			m.messages[message.ConversationID][i].AgentCount = message.AgentCount
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memoryRepository) ReviseMessage(ctx context.Context, message model.MessageItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, msg := range m.messages[message.ConversationID] {
+		if msg.MessageID == message.MessageID {
+			if msg.DeletedAt != "" || len(msg.Revisions) != len(message.Revisions)-1 {
+				return ErrMessageChanged
+			}
+			m.messages[message.ConversationID][i] = message
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memoryRepository) InitializeReadMarkers(ctx context.Context, conversation model.ConversationItem, seenVisitorCount, seenAgentCount int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.conversations[conversation.PK]
+	if !ok {
+		return ErrNotFound
+	}
+	if stored.ReadMarkers != nil || stored.VisitorMessageCount != seenVisitorCount || stored.AgentMessageCount != seenAgentCount {
+		return ErrReadCountersChanged
+	}
+	stored.VisitorMessageCount = conversation.VisitorMessageCount
+	stored.AgentMessageCount = conversation.AgentMessageCount
+	stored.ReadMarkers = conversation.ReadMarkers
+	m.conversations[conversation.PK] = stored
+	return nil
+}
+
+// ListMessages mirrors the Dynamo paging semantics using "direction:index"
+// cursors over the chronologically sorted messages.
+func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversationID string, query MessageQuery) (MessagePage, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	items := make([]model.MessageItem, 0)
@@ -197,15 +412,111 @@ func (m *memoryRepository) ListMessages(ctx context.Context, tenantID, conversat
 			items = append(items, msg)
 		}
 	}
-	sort.Slice(items, func(i, j int) bool {
-		ti := parseTime(items[i].CreatedAt)
-		tj := parseTime(items[j].CreatedAt)
-		return ti.Before(tj)
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt < items[j].CreatedAt })
+
+	direction := query.Direction
+	boundary := -1
+	if query.Cursor != "" {
+		parts := strings.SplitN(query.Cursor, ":", 2)
+		index, err := strconv.Atoi(parts[len(parts)-1])
+		if len(parts) != 2 || err != nil || index < 0 || index > len(items) {
+			return MessagePage{}, ErrInvalidCursor
+		}
+		direction = MessageDirection(parts[0])
+		boundary = index
+	} else if query.Anchor != nil {
+		for i, msg := range items {
+			if msg.MessageID == query.Anchor.MessageID {
+				boundary = i
+				if direction == MessageDirectionAfter {
+					boundary = i + 1
+				}
+			}
+		}
+	}
+
+	limit := query.Limit
+	if limit <= 0 {
+		limit = len(items)
+	}
+	page := MessagePage{}
+	if direction == MessageDirectionAfter {
+		start := boundary
+		if start < 0 {
+			start = 0
+		}
+		end := start + limit
+		if end < len(items) {
+			page.NextCursor = fmt.Sprintf("after:%d", end)
+		} else {
+			end = len(items)
+		}
+		page.Messages = items[start:end]
+		return page, nil
+	}
+	end := boundary
+	if end < 0 {
+		end = len(items)
+	}
+	start := end - limit
+	if start > 0 {
+		page.NextCursor = fmt.Sprintf("before:%d", start)
+	} else {
+		start = 0
+	}
+	page.Messages = items[start:end]
+	return page, nil
+}
+
+func (m *memoryRepository) ScanMessages(ctx context.Context, visit func(model.MessageItem) error) error {
+	m.mu.Lock()
+	var all []model.MessageItem
+	for _, items := range m.messages {
+		all = append(all, items...)
+	}
+	m.mu.Unlock()
+	for _, msg := range all {
+		if err := visit(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) ScanMessagesSince(ctx context.Context, since string, visit func(model.MessageItem) error) error {
+	return m.ScanMessages(ctx, func(message model.MessageItem) error {
+		if message.CreatedAt <= since {
+			return nil
+		}
+		return visit(message)
 	})
-	if limit > 0 && len(items) > limit {
-		items = items[len(items)-limit:]
+}
+
+func (m *memoryRepository) ScanConversations(ctx context.Context, visit func(model.ConversationItem) error) error {
+	m.mu.Lock()
+	all := make([]model.ConversationItem, 0, len(m.conversations))
+	for _, conversation := range m.conversations {
+		all = append(all, conversation)
+	}
+	m.mu.Unlock()
+	for _, conversation := range all {
+		if err := visit(conversation); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memoryRepository) UpdateConversationIndexKeys(ctx context.Context, conversation model.ConversationItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.conversations[conversation.PK]
+	if !ok {
+		return ErrNotFound
 	}
-	return items, nil
+	stored.SetIndexKeys()
+	m.conversations[conversation.PK] = stored
+	return nil
 }
 
 func useTestSecret(t *testing.T) {
@@ -399,7 +710,7 @@ func TestListVisitorMessages(t *testing.T) {
 		t.Fatalf("CreateConversation error: %v", err)
 	}
 
-	list, err := svc.ListVisitorMessages(context.Background(), result.VisitorToken, result.Conversation.ConversationID, 50)
+	list, err := svc.ListVisitorMessages(context.Background(), result.VisitorToken, result.Conversation.ConversationID, ListMessagesParams{Limit: 50})
 	if err != nil {
 		t.Fatalf("ListVisitorMessages error: %v", err)
 	}
@@ -430,7 +741,7 @@ func TestListVisitorMessagesRejectsMismatchedToken(t *testing.T) {
 		t.Fatalf("CreateConversation error: %v", err)
 	}
 
-	_, err = svc.ListVisitorMessages(context.Background(), result.VisitorToken, "other-conv", 50)
+	_, err = svc.ListVisitorMessages(context.Background(), result.VisitorToken, "other-conv", ListMessagesParams{Limit: 50})
 	if err == nil {
 		t.Fatal("expected error for mismatched conversation")
 	}
@@ -585,3 +896,1591 @@ func TestPostAgentMessageMarksTenantStart(t *testing.T) {
 		t.Fatalf("expected tenantStartedAt to remain %s, got %s", firstStart, stored.TenantStartedAt)
 	}
 }
+
+func TestCloseConversationRecordsReasonAndBlocksVisitor(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-close"
+	userID := "agent-close"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-close"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-close",
+		Message:      "Hello",
+		Visitor:      VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+	conversationID := created.Conversation.ConversationID
+
+	closed, err := svc.CloseConversation(context.Background(), identity, conversationID, "  resolved  ")
+	if err != nil {
+		t.Fatalf("CloseConversation error: %v", err)
+	}
+	if closed.Status != model.ConversationStatusClosed {
+		t.Fatalf("expected closed status, got %s", closed.Status)
+	}
+	if closed.CloseReason != "resolved" || closed.ClosedBy != userID || closed.ClosedAt == "" {
+		t.Fatalf("unexpected close details %+v", closed)
+	}
+
+	stored := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if stored.Status != model.ConversationStatusClosed || stored.ClosedBy != userID {
+		t.Fatalf("expected stored conversation to be closed, got %+v", stored)
+	}
+
+	if _, err := svc.PostVisitorMessage(context.Background(), created.VisitorToken, "Still there?"); err == nil {
+		t.Fatal("expected visitor message on closed conversation to fail")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	if _, err := svc.PostAgentMessage(context.Background(), identity, conversationID, "Following up"); err == nil {
+		t.Fatal("expected agent message on closed conversation to fail")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if count := len(repo.messages[conversationID]); count != 1 {
+		t.Fatalf("expected rejected messages not to be stored, got %d messages", count)
+	}
+
+	if _, err := svc.CloseConversation(context.Background(), identity, conversationID, ""); err == nil {
+		t.Fatal("expected error closing an already closed conversation")
+	}
+
+	reopened, err := svc.ReopenConversation(context.Background(), identity, conversationID)
+	if err != nil {
+		t.Fatalf("ReopenConversation error: %v", err)
+	}
+	if reopened.Status != model.ConversationStatusOpen || reopened.ClosedAt != "" || reopened.CloseReason != "" {
+		t.Fatalf("expected reopened conversation to clear close details, got %+v", reopened)
+	}
+
+	if _, err := svc.PostVisitorMessage(context.Background(), created.VisitorToken, "Thanks"); err != nil {
+		t.Fatalf("PostVisitorMessage after reopen error: %v", err)
+	}
+}
+
+func TestArchiveConversationClosesOpenConversation(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 1, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-archive"
+	userID := "agent-archive"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+	conversationID := "conv-archive"
+	repo.conversations[model.ConversationPK(tenantID, conversationID)] = model.ConversationItem{
+		PK:             model.ConversationPK(tenantID, conversationID),
+		ConversationID: conversationID,
+		TenantID:       tenantID,
+		VisitorID:      "visitor-1",
+		Status:         model.ConversationStatusOpen,
+		CreatedAt:      now.Add(-time.Hour).Format(time.RFC3339),
+		UpdatedAt:      now.Add(-time.Hour).Format(time.RFC3339),
+		LastMessageAt:  now.Add(-time.Hour).Format(time.RFC3339),
+	}
+
+	archived, err := svc.ArchiveConversation(context.Background(), Identity{UserID: userID, TenantID: tenantID}, conversationID)
+	if err != nil {
+		t.Fatalf("ArchiveConversation error: %v", err)
+	}
+	if archived.Status != model.ConversationStatusArchived {
+		t.Fatalf("expected archived status, got %s", archived.Status)
+	}
+	if archived.ArchivedBy != userID || archived.ClosedBy != userID || archived.ClosedAt == "" {
+		t.Fatalf("unexpected archive details %+v", archived)
+	}
+
+	_, err = svc.ArchiveConversation(context.Background(), Identity{UserID: userID, TenantID: tenantID}, conversationID)
+	if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict archiving twice, got %v", err)
+	}
+}
+
+func TestAssignConversationKeepsHistory(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-assign"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	for _, user := range []model.UserItem{
+		{UserID: "owner", Status: "active"},
+		{UserID: "agent-a", Status: "active"},
+		{UserID: "agent-b", Status: "active"},
+		{UserID: "agent-disabled", Status: "disabled"},
+	} {
+		user.PK = model.TenantScopedPK(tenantID, user.UserID)
+		user.TenantID = tenantID
+		repo.users[user.PK] = user
+	}
+	conversationID := "conv-assign"
+	repo.conversations[model.ConversationPK(tenantID, conversationID)] = model.ConversationItem{
+		PK:             model.ConversationPK(tenantID, conversationID),
+		ConversationID: conversationID,
+		TenantID:       tenantID,
+		VisitorID:      "visitor-1",
+		Status:         model.ConversationStatusOpen,
+		CreatedAt:      now.Format(time.RFC3339),
+		UpdatedAt:      now.Format(time.RFC3339),
+		LastMessageAt:  now.Format(time.RFC3339),
+	}
+	identity := Identity{UserID: "owner", TenantID: tenantID}
+
+	if _, err := svc.AssignConversation(context.Background(), identity, conversationID, "agent-a"); err != nil {
+		t.Fatalf("AssignConversation error: %v", err)
+	}
+	result, err := svc.AssignConversation(context.Background(), identity, conversationID, "agent-b")
+	if err != nil {
+		t.Fatalf("AssignConversation reassign error: %v", err)
+	}
+	if result.Assignment.PreviousUserID != "agent-a" || result.Assignment.AssignedUserID != "agent-b" {
+		t.Fatalf("unexpected assignment record %+v", result.Assignment)
+	}
+
+	if _, err := svc.AssignConversation(context.Background(), identity, conversationID, "agent-disabled"); err == nil {
+		t.Fatal("expected error assigning inactive user")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+
+	if _, err := svc.AssignConversation(context.Background(), identity, conversationID, "unknown"); err == nil {
+		t.Fatal("expected error assigning user outside tenant")
+	}
+
+	cleared, err := svc.AssignConversation(context.Background(), identity, conversationID, "")
+	if err != nil {
+		t.Fatalf("AssignConversation unassign error: %v", err)
+	}
+	if cleared.Conversation.AssignedUserID != "" {
+		t.Fatalf("expected assignment to be cleared, got %s", cleared.Conversation.AssignedUserID)
+	}
+
+	stored := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if len(stored.AssignmentHistory) != 3 {
+		t.Fatalf("expected 3 history entries, got %d", len(stored.AssignmentHistory))
+	}
+	if stored.AssignmentHistory[2].PreviousUserID != "agent-b" || stored.AssignmentHistory[2].AssignedBy != "owner" {
+		t.Fatalf("unexpected unassign record %+v", stored.AssignmentHistory[2])
+	}
+}
+
+// staleReadRepository serves conversations as they were before assignee took
+// them, mimicking a request that lost the race against a concurrent assignment.
+type staleReadRepository struct {
+	*memoryRepository
+	assignee string
+}
+
+func (r *staleReadRepository) GetConversation(ctx context.Context, tenantID, conversationID string) (model.ConversationItem, error) {
+	conversation, err := r.memoryRepository.GetConversation(ctx, tenantID, conversationID)
+	if err == nil && conversation.AssignedUserID == r.assignee {
+		conversation.AssignedUserID = ""
+	}
+	return conversation, err
+}
+
+func TestAssignmentsDoNotOverwriteConcurrentAssignment(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 2, 10, 0, 0, 0, time.UTC)
+	stale := &staleReadRepository{memoryRepository: repo, assignee: "agent-b"}
+	svc := NewWithRepository(stale, func() time.Time { return now })
+
+	tenantID := "tenant-race"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	for _, userID := range []string{"agent-a", "agent-b"} {
+		pk := model.TenantScopedPK(tenantID, userID)
+		repo.users[pk] = model.UserItem{PK: pk, TenantID: tenantID, UserID: userID, Status: "active"}
+	}
+	conversationID := "conv-race"
+	pk := model.ConversationPK(tenantID, conversationID)
+	repo.conversations[pk] = model.ConversationItem{
+		PK:              pk,
+		ConversationID:  conversationID,
+		TenantID:        tenantID,
+		Status:          model.ConversationStatusOpen,
+		AssignedUserID:  "agent-b",
+		TenantStartedAt: now.Format(time.RFC3339),
+	}
+
+	result, err := svc.PostAgentMessage(context.Background(), Identity{UserID: "agent-a", TenantID: tenantID}, conversationID, "I'll take this")
+	if err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+	if result.Assignment != nil {
+		t.Fatalf("expected no auto-assignment, got %+v", result.Assignment)
+	}
+	stored := repo.conversations[pk]
+	if stored.AssignedUserID != "agent-b" || len(stored.AssignmentHistory) != 0 {
+		t.Fatalf("expected agent-b to keep the conversation, got %+v", stored)
+	}
+	if stored.AgentMessageCount != 1 {
+		t.Fatalf("expected the message to be counted once, got %d", stored.AgentMessageCount)
+	}
+
+	_, err = svc.AssignConversation(context.Background(), Identity{UserID: "agent-a", TenantID: tenantID}, conversationID, "agent-a")
+	if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict assigning from a stale read, got %v", err)
+	}
+	if repo.conversations[pk].AssignedUserID != "agent-b" {
+		t.Fatalf("expected agent-b to keep the conversation")
+	}
+}
+
+type staticAvailability map[string]bool
+
+func (a staticAvailability) AvailableAgents(ctx context.Context, tenantID string, userIDs []string) ([]string, error) {
+	available := make([]string, 0, len(userIDs))
+	for _, id := range userIDs {
+		if a[id] {
+			available = append(available, id)
+		}
+	}
+	return available, nil
+}
+
+func newRoutingTenant(repo *memoryRepository, tenantID, strategy string, userIDs ...string) {
+	repo.tenants[tenantID] = model.TenantItem{
+		TenantID: tenantID,
+		Settings: map[string]interface{}{
+			"routing": map[string]interface{}{"strategy": strategy},
+		},
+	}
+	repo.keys["key-"+tenantID] = tenantID
+	for _, id := range userIDs {
+		repo.users[model.TenantScopedPK(tenantID, id)] = model.UserItem{
+			PK:       model.TenantScopedPK(tenantID, id),
+			TenantID: tenantID,
+			UserID:   id,
+			Status:   "active",
+		}
+	}
+}
+
+func TestCreateConversationRoundRobinRouting(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-rr"
+	newRoutingTenant(repo, tenantID, "round_robin", "agent-a", "agent-b", "agent-c")
+	svc.SetAgentAvailability(staticAvailability{"agent-a": true, "agent-c": true})
+
+	var assigned []string
+	for i := 0; i < 3; i++ {
+		result, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+			TenantAPIKey: "key-" + tenantID,
+			Message:      "Hello",
+		})
+		if err != nil {
+			t.Fatalf("CreateConversation error: %v", err)
+		}
+		if result.Assignment == nil || result.Assignment.AssignedBy != RoutingAssigner {
+			t.Fatalf("expected routing assignment, got %+v", result.Assignment)
+		}
+		stored := repo.conversations[result.Conversation.PK]
+		if stored.AssignedUserID != result.Assignment.AssignedUserID {
+			t.Fatalf("expected stored assignee %s, got %s", result.Assignment.AssignedUserID, stored.AssignedUserID)
+		}
+		assigned = append(assigned, stored.AssignedUserID)
+	}
+
+	expected := []string{"agent-a", "agent-c", "agent-a"}
+	for i := range expected {
+		if assigned[i] != expected[i] {
+			t.Fatalf("expected rotation %v, got %v", expected, assigned)
+		}
+	}
+}
+
+// racingCursorRepository moves the routing cursor to winner right before the
+// first cursor update, as a concurrently created conversation would.
+type racingCursorRepository struct {
+	*memoryRepository
+	winner string
+	raced  bool
+}
+
+func (r *racingCursorRepository) UpdateTenantRoutingCursor(ctx context.Context, tenantID, previous, userID string) error {
+	if !r.raced {
+		r.raced = true
+		if err := r.memoryRepository.UpdateTenantRoutingCursor(ctx, tenantID, previous, r.winner); err != nil {
+			return err
+		}
+	}
+	return r.memoryRepository.UpdateTenantRoutingCursor(ctx, tenantID, previous, userID)
+}
+
+func TestRoundRobinRoutingRetriesWhenCursorMoves(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(&racingCursorRepository{memoryRepository: repo, winner: "agent-a"}, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-race-rr"
+	newRoutingTenant(repo, tenantID, "round_robin", "agent-a", "agent-b")
+
+	result, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "key-" + tenantID,
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	if result.Assignment == nil || result.Assignment.AssignedUserID != "agent-b" {
+		t.Fatalf("expected the agent after the concurrent pick, got %+v", result.Assignment)
+	}
+	if cursor := repo.tenants[tenantID].RoutingCursor; cursor != "agent-b" {
+		t.Fatalf("expected cursor to advance to agent-b, got %s", cursor)
+	}
+}
+
+func TestCreateConversationLeastOpenRouting(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 3, 8, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-least"
+	newRoutingTenant(repo, tenantID, "least_open", "agent-a", "agent-b")
+	for i, id := range []string{"busy-1", "busy-2"} {
+		repo.conversations[model.ConversationPK(tenantID, id)] = model.ConversationItem{
+			PK:             model.ConversationPK(tenantID, id),
+			ConversationID: id,
+			TenantID:       tenantID,
+			Status:         model.ConversationStatusOpen,
+			AssignedUserID: "agent-a",
+			CreatedAt:      now.Add(-time.Duration(i+1) * time.Minute).Format(time.RFC3339),
+		}
+	}
+
+	result, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "key-" + tenantID,
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	if result.Conversation.AssignedUserID != "agent-b" {
+		t.Fatalf("expected least loaded agent-b, got %s", result.Conversation.AssignedUserID)
+	}
+}
+
+func TestCreateConversationManualRoutingLeavesUnassigned(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, nil)
+	useTestSecret(t)
+
+	tenantID := "tenant-manual"
+	newRoutingTenant(repo, tenantID, "manual", "agent-a")
+
+	result, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "key-" + tenantID,
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	if result.Assignment != nil || result.Conversation.AssignedUserID != "" {
+		t.Fatalf("expected conversation to stay unassigned, got %+v", result.Conversation)
+	}
+}
+
+type failingAvailability struct{}
+
+func (failingAvailability) AvailableAgents(ctx context.Context, tenantID string, userIDs []string) ([]string, error) {
+	return nil, errors.New("presence unavailable")
+}
+
+func TestCreateConversationStartsUnassignedWhenRoutingFails(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, nil)
+	useTestSecret(t)
+
+	tenantID := "tenant-routing-down"
+	newRoutingTenant(repo, tenantID, "round_robin", "agent-a")
+	svc.SetAgentAvailability(failingAvailability{})
+
+	result, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "key-" + tenantID,
+		Message:      "Hello",
+	})
+	if err != nil {
+		t.Fatalf("expected the conversation to start despite the routing failure, got %v", err)
+	}
+	if result.Assignment != nil || repo.conversations[result.Conversation.PK].AssignedUserID != "" {
+		t.Fatalf("expected conversation to stay unassigned, got %+v", result.Conversation)
+	}
+}
+
+func TestListMessagesPageSizes(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 4, 10, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+
+	tenantID := "tenant-sizes"
+	userID := "user-sizes"
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{PK: model.TenantScopedPK(tenantID, userID), TenantID: tenantID, UserID: userID}
+	conversationID := "conv-sizes"
+	repo.conversations[model.ConversationPK(tenantID, conversationID)] = model.ConversationItem{
+		PK:             model.ConversationPK(tenantID, conversationID),
+		ConversationID: conversationID,
+		TenantID:       tenantID,
+	}
+	for i := 0; i < 250; i++ {
+		messageID := fmt.Sprintf("msg-%03d", i)
+		repo.messages[conversationID] = append(repo.messages[conversationID], model.MessageItem{
+			PK:             model.MessagePK(conversationID, messageID),
+			TenantID:       tenantID,
+			ConversationID: conversationID,
+			MessageID:      messageID,
+			CreatedAt:      now.Add(time.Duration(i) * time.Second).Format(time.RFC3339),
+		})
+	}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+
+	for limit, want := range map[int]int{0: 100, 150: 150, 200: 200, 201: 100} {
+		page, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Limit: limit})
+		if err != nil {
+			t.Fatalf("ListMessages error: %v", err)
+		}
+		if len(page.Messages) != want {
+			t.Fatalf("expected limit %d to return %d messages, got %d", limit, want, len(page.Messages))
+		}
+	}
+}
+
+func TestListMessagesPaginatesAroundAnchor(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 6, 4, 10, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-page"
+	userID := "user-page"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+	conversationID := "conv-page"
+	repo.conversations[model.ConversationPK(tenantID, conversationID)] = model.ConversationItem{
+		PK:             model.ConversationPK(tenantID, conversationID),
+		ConversationID: conversationID,
+		TenantID:       tenantID,
+		Status:         model.ConversationStatusOpen,
+	}
+	for i := 0; i < 5; i++ {
+		messageID := fmt.Sprintf("msg-%d", i)
+		repo.messages[conversationID] = append(repo.messages[conversationID], model.MessageItem{
+			PK:             model.MessagePK(conversationID, messageID),
+			TenantID:       tenantID,
+			ConversationID: conversationID,
+			MessageID:      messageID,
+			Body:           messageID,
+			CreatedAt:      now.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+		})
+	}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+
+	latest, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListMessages error: %v", err)
+	}
+	if len(latest.Messages) != 2 || latest.Messages[0].MessageID != "msg-3" || latest.Messages[1].MessageID != "msg-4" {
+		t.Fatalf("unexpected latest page %+v", latest.Messages)
+	}
+	if latest.NextCursor == "" {
+		t.Fatal("expected cursor for older messages")
+	}
+
+	older, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Limit: 2, Cursor: latest.NextCursor})
+	if err != nil {
+		t.Fatalf("ListMessages cursor error: %v", err)
+	}
+	if len(older.Messages) != 2 || older.Messages[0].MessageID != "msg-1" {
+		t.Fatalf("unexpected older page %+v", older.Messages)
+	}
+
+	after, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Limit: 10, After: "msg-2"})
+	if err != nil {
+		t.Fatalf("ListMessages after error: %v", err)
+	}
+	if len(after.Messages) != 2 || after.Messages[0].MessageID != "msg-3" || after.NextCursor != "" {
+		t.Fatalf("unexpected after page %+v (cursor %q)", after.Messages, after.NextCursor)
+	}
+
+	if _, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Before: "msg-1", After: "msg-2"}); err == nil {
+		t.Fatal("expected error combining before and after")
+	}
+
+	if _, err := svc.ListMessages(context.Background(), identity, conversationID, ListMessagesParams{Cursor: "garbage"}); err == nil {
+		t.Fatal("expected error for invalid cursor")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeValidation {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	message := model.MessageItem{
+		PK:             model.MessagePK("conv-1", "msg-1"),
+		ConversationID: "conv-1",
+		CreatedAt:      "2024-06-04T10:00:00Z",
+	}
+
+	cursor, err := encodeCursor(MessageDirectionAfter, messageStartKey(message))
+	if err != nil {
+		t.Fatalf("encodeCursor error: %v", err)
+	}
+
+	direction, key, err := decodeCursor(cursor)
+	if err != nil {
+		t.Fatalf("decodeCursor error: %v", err)
+	}
+	if direction != MessageDirectionAfter {
+		t.Fatalf("expected direction after, got %s", direction)
+	}
+	if len(key) != 3 {
+		t.Fatalf("expected 3 key attributes, got %d", len(key))
+	}
+
+	if _, _, err := decodeCursor("not-a-cursor"); err != ErrInvalidCursor {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestCursorKeyMustMatchQuery(t *testing.T) {
+	message := model.MessageItem{
+		PK:             model.MessagePK("conv-1", "msg-1"),
+		ConversationID: "conv-1",
+		CreatedAt:      "2024-06-04T10:00:00Z",
+	}
+	if !validStartKey(messageStartKey(message), "conversationId", "conv-1", "createdAt") {
+		t.Fatal("expected message key to be accepted for its conversation")
+	}
+	if validStartKey(messageStartKey(message), "conversationId", "conv-2", "createdAt") {
+		t.Fatal("expected message key to be rejected for another conversation")
+	}
+
+	open := planConversationQuery("tenant-1", ConversationFilter{Status: model.ConversationStatusOpen})
+	key := map[string]types.AttributeValue{
+		"pk":            &types.AttributeValueMemberS{Value: model.ConversationPK("tenant-1", "conv-1")},
+		"tenantStatus":  &types.AttributeValueMemberS{Value: model.TenantScopedKey("tenant-1", "open")},
+		"lastMessageAt": &types.AttributeValueMemberS{Value: "2024-06-04T10:00:00Z"},
+	}
+	if !open.acceptsStartKey(key) {
+		t.Fatal("expected status cursor to be accepted by the status query")
+	}
+	if planConversationQuery("tenant-2", ConversationFilter{Status: model.ConversationStatusOpen}).acceptsStartKey(key) {
+		t.Fatal("expected cursor of another tenant to be rejected")
+	}
+	if planConversationQuery("tenant-1", ConversationFilter{}).acceptsStartKey(key) {
+		t.Fatal("expected cursor of another index to be rejected")
+	}
+
+	raw, _ := json.Marshal(map[string]interface{}{"d": "sideways", "k": map[string]string{"pk": "x"}})
+	if _, _, err := decodeCursor(base64.RawURLEncoding.EncodeToString(raw)); err != ErrInvalidCursor {
+		t.Fatalf("expected unknown direction to be rejected, got %v", err)
+	}
+}
+
+func TestListConversationsAppliesFilter(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, nil)
+
+	tenantID := "tenant-filter"
+	userID := "agent-filter"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+	for _, conv := range []model.ConversationItem{
+		{ConversationID: "mine-open", Status: model.ConversationStatusOpen, AssignedUserID: userID, CreatedAt: "2024-06-01T10:00:00Z"},
+		{ConversationID: "mine-closed", Status: model.ConversationStatusClosed, AssignedUserID: userID, CreatedAt: "2024-06-02T10:00:00Z"},
+		{ConversationID: "unassigned", Status: model.ConversationStatusOpen, CreatedAt: "2024-06-03T10:00:00Z"},
+	} {
+		conv.PK = model.ConversationPK(tenantID, conv.ConversationID)
+		conv.TenantID = tenantID
+		conv.LastMessageAt = conv.CreatedAt
+		repo.conversations[conv.PK] = conv
+	}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+
+	mine, err := svc.ListConversations(context.Background(), identity, ConversationFilter{
+		Status:         "OPEN",
+		AssignedUserID: userID,
+	}, PageQuery{})
+	if err != nil {
+		t.Fatalf("ListConversations error: %v", err)
+	}
+	if len(mine.Conversations) != 1 || mine.Conversations[0].ConversationID != "mine-open" {
+		t.Fatalf("unexpected filtered conversations %+v", mine.Conversations)
+	}
+
+	unassigned, err := svc.ListConversations(context.Background(), identity, ConversationFilter{Unassigned: true}, PageQuery{})
+	if err != nil {
+		t.Fatalf("ListConversations unassigned error: %v", err)
+	}
+	if len(unassigned.Conversations) != 1 || unassigned.Conversations[0].ConversationID != "unassigned" {
+		t.Fatalf("unexpected unassigned conversations %+v", unassigned.Conversations)
+	}
+
+	ranged, err := svc.ListConversations(context.Background(), identity, ConversationFilter{
+		CreatedFrom: "2024-06-02T00:00:00Z",
+		CreatedTo:   "2024-06-02T23:59:59+00:00",
+	}, PageQuery{})
+	if err != nil {
+		t.Fatalf("ListConversations range error: %v", err)
+	}
+	if len(ranged.Conversations) != 1 || ranged.Conversations[0].ConversationID != "mine-closed" {
+		t.Fatalf("unexpected ranged conversations %+v", ranged.Conversations)
+	}
+
+	for _, invalid := range []ConversationFilter{
+		{Status: "pending"},
+		{CreatedFrom: "yesterday"},
+		{CreatedFrom: "2024-06-03T00:00:00Z", CreatedTo: "2024-06-01T00:00:00Z"},
+		{Unassigned: true, AssignedUserID: userID},
+	} {
+		if _, err := svc.ListConversations(context.Background(), identity, invalid, PageQuery{}); err == nil {
+			t.Fatalf("expected validation error for %+v", invalid)
+		}
+	}
+}
+
+func TestPlanConversationQuerySelectsIndex(t *testing.T) {
+	cases := []struct {
+		filter ConversationFilter
+		index  string
+	}{
+		{ConversationFilter{}, "byTenant"},
+		{ConversationFilter{Status: model.ConversationStatusOpen}, "byTenantStatus"},
+		{ConversationFilter{Status: model.ConversationStatusOpen, Unassigned: true}, "byTenantAssignee"},
+		{ConversationFilter{VisitorEmail: "a@example.com", AssignedUserID: "u"}, "byVisitorEmail"},
+		{ConversationFilter{VisitorID: "v", VisitorEmail: "a@example.com"}, "byVisitor"},
+		{ConversationFilter{CreatedFrom: "2024-06-01T00:00:00Z"}, "byTenantCreated"},
+	}
+
+	for _, tc := range cases {
+		plan := planConversationQuery("tenant-1", tc.filter)
+		if plan.index != tc.index {
+			t.Fatalf("filter %+v: expected index %s, got %s", tc.filter, tc.index, plan.index)
+		}
+	}
+
+	plan := planConversationQuery("tenant-1", ConversationFilter{
+		Status:        model.ConversationStatusClosed,
+		MetadataKey:   "plan",
+		MetadataValue: "pro",
+		CreatedTo:     "2024-06-01T00:00:00Z",
+	})
+	if plan.filter != "#createdAt <= :createdAtTo AND #metadata.#metadataKey = :metadataValue" {
+		t.Fatalf("unexpected filter expression %q", plan.filter)
+	}
+}
+
+func TestSearchMessagesIndexesNewMessagesAndRebuilds(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	svc.SetSearchIndex(search.NewIndex())
+	useTestSecret(t)
+
+	tenantID := "tenant-search"
+	userID := "user-search"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+	conversationID := "conv-search"
+	repo.conversations[model.ConversationPK(tenantID, conversationID)] = model.ConversationItem{
+		PK:             model.ConversationPK(tenantID, conversationID),
+		ConversationID: conversationID,
+		TenantID:       tenantID,
+		VisitorID:      "visitor-1",
+		Status:         model.ConversationStatusOpen,
+	}
+	repo.messages[conversationID] = []model.MessageItem{{
+		PK:             model.MessagePK(conversationID, "msg-old"),
+		TenantID:       tenantID,
+		ConversationID: conversationID,
+		MessageID:      "msg-old",
+		SenderType:     "visitor",
+		Body:           "Refund for order 42",
+		CreatedAt:      now.Add(-time.Hour).Format(time.RFC3339),
+	}}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+
+	if _, err := svc.PostAgentMessage(context.Background(), identity, conversationID, "Your refund is on its way"); err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+
+	result, err := svc.SearchMessages(context.Background(), identity, "refund", 10)
+	if err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if len(result.Hits) != 1 {
+		t.Fatalf("expected only the new message before a rebuild, got %d hits", len(result.Hits))
+	}
+	if result.Hits[0].Conversation.ConversationID != conversationID {
+		t.Fatalf("expected parent conversation %s, got %+v", conversationID, result.Hits[0].Conversation)
+	}
+
+	count, err := svc.RebuildSearchIndex(context.Background())
+	if err != nil {
+		t.Fatalf("RebuildSearchIndex error: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("expected 2 indexed messages, got %d", count)
+	}
+
+	result, err = svc.SearchMessages(context.Background(), identity, "refund", 10)
+	if err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if len(result.Hits) != 2 {
+		t.Fatalf("expected 2 hits after rebuild, got %d", len(result.Hits))
+	}
+	if result.Hits[1].Snippet != "<mark>Refund</mark> for order 42" {
+		t.Fatalf("unexpected snippet %q", result.Hits[1].Snippet)
+	}
+
+	otherTenant := "tenant-other"
+	repo.users[model.TenantScopedPK(otherTenant, "user-other")] = model.UserItem{
+		PK:       model.TenantScopedPK(otherTenant, "user-other"),
+		TenantID: otherTenant,
+		UserID:   "user-other",
+	}
+	result, err = svc.SearchMessages(context.Background(), Identity{UserID: "user-other", TenantID: otherTenant}, "refund", 10)
+	if err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if len(result.Hits) != 0 {
+		t.Fatalf("expected no cross-tenant hits, got %d", len(result.Hits))
+	}
+
+	if _, err := svc.SearchMessages(context.Background(), identity, "   ", 10); err == nil {
+		t.Fatal("expected empty query to be rejected")
+	}
+}
+
+func TestCatchUpSearchIndexAddsOnlyNewerMessages(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, time.Now)
+	index := search.NewIndex()
+	svc.SetSearchIndex(index)
+
+	for i, body := range []string{"refund in snapshot", "refund after snapshot"} {
+		message := model.MessageItem{
+			TenantID:       "tenant-1",
+			ConversationID: "conv-1",
+			MessageID:      fmt.Sprintf("msg-%d", i),
+			Body:           body,
+			CreatedAt:      fmt.Sprintf("2024-06-0%dT10:00:00Z", i+1),
+		}
+		repo.messages[message.ConversationID] = append(repo.messages[message.ConversationID], message)
+	}
+
+	added, err := svc.CatchUpSearchIndex(context.Background(), "2024-06-01T10:00:00Z")
+	if err != nil {
+		t.Fatalf("CatchUpSearchIndex error: %v", err)
+	}
+	if added != 1 || index.Len() != 1 {
+		t.Fatalf("expected only the newer message to be added, got %d (index %d)", added, index.Len())
+	}
+
+	svc.IndexMessage(model.MessageItem{TenantID: "tenant-1", ConversationID: "conv-2", MessageID: "msg-remote", Body: "refund from another server"})
+	if hits := index.Search("tenant-1", "refund", 10); len(hits) != 2 {
+		t.Fatalf("expected the remote message to be searchable, got %+v", hits)
+	}
+}
+
+func TestReadMarkersTrackUnreadCounts(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-read"
+	userID := "user-read"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["read-key"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, userID),
+		TenantID: tenantID,
+		UserID:   userID,
+	}
+	identity := Identity{UserID: userID, TenantID: tenantID}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "read-key",
+		Message:      "First",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+
+	for _, body := range []string{"Second", "Third"} {
+		now = now.Add(time.Minute)
+		if _, err := svc.PostVisitorMessage(context.Background(), created.VisitorToken, body); err != nil {
+			t.Fatalf("PostVisitorMessage error: %v", err)
+		}
+	}
+
+	stored := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if unread := stored.UnreadForUser(userID); unread != 3 {
+		t.Fatalf("expected 3 unread visitor messages, got %d", unread)
+	}
+
+	result, err := svc.MarkRead(context.Background(), identity, conversationID, created.Message.MessageID)
+	if err != nil {
+		t.Fatalf("MarkRead error: %v", err)
+	}
+	if !result.Advanced || result.UnreadCount != 2 {
+		t.Fatalf("expected marker to advance with 2 unread, got %+v", result)
+	}
+
+	result, err = svc.MarkRead(context.Background(), identity, conversationID, "")
+	if err != nil {
+		t.Fatalf("MarkRead latest error: %v", err)
+	}
+	if result.UnreadCount != 0 {
+		t.Fatalf("expected no unread messages, got %d", result.UnreadCount)
+	}
+
+	result, err = svc.MarkRead(context.Background(), identity, conversationID, created.Message.MessageID)
+	if err != nil {
+		t.Fatalf("MarkRead older error: %v", err)
+	}
+	if result.Advanced || result.UnreadCount != 0 {
+		t.Fatalf("expected marker not to move backwards, got %+v", result)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := svc.PostAgentMessage(context.Background(), identity, conversationID, "Reply"); err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+	stored = repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if unread := stored.UnreadForVisitor(); unread != 1 {
+		t.Fatalf("expected 1 unread agent message for visitor, got %d", unread)
+	}
+
+	visitorResult, err := svc.MarkVisitorRead(context.Background(), created.VisitorToken, conversationID, "")
+	if err != nil {
+		t.Fatalf("MarkVisitorRead error: %v", err)
+	}
+	if visitorResult.ReaderType != model.MessageSenderVisitor || visitorResult.UnreadCount != 0 {
+		t.Fatalf("unexpected visitor receipt %+v", visitorResult)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := svc.PostVisitorMessage(context.Background(), created.VisitorToken, "Fourth"); err != nil {
+		t.Fatalf("PostVisitorMessage error: %v", err)
+	}
+	now = now.Add(time.Minute)
+	if _, err := svc.PostAgentMessage(context.Background(), identity, conversationID, "Second reply"); err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+	stored = repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if unread := stored.UnreadForUser(userID); unread != 0 {
+		t.Fatalf("expected replying to mark visitor messages read, got %d unread", unread)
+	}
+}
+
+func TestBackfillIndexKeysUpdatesOnlyStaleConversations(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, time.Now)
+
+	legacy := model.ConversationItem{
+		PK:             model.ConversationPK("tenant-1", "conv-legacy"),
+		ConversationID: "conv-legacy",
+		TenantID:       "tenant-1",
+		VisitorID:      "visitor-1",
+		VisitorEmail:   "visitor@example.com",
+		Status:         model.ConversationStatusClosed,
+		AssignedUserID: "agent-1",
+	}
+	current := model.ConversationItem{
+		PK:             model.ConversationPK("tenant-1", "conv-current"),
+		ConversationID: "conv-current",
+		TenantID:       "tenant-1",
+		Status:         model.ConversationStatusOpen,
+	}
+	current.SetIndexKeys()
+	repo.conversations[legacy.PK] = legacy
+	repo.conversations[current.PK] = current
+
+	updated, err := svc.BackfillIndexKeys(context.Background())
+	if err != nil {
+		t.Fatalf("BackfillIndexKeys error: %v", err)
+	}
+	if updated != 1 {
+		t.Fatalf("expected only the legacy conversation to be updated, got %d", updated)
+	}
+
+	stored := repo.conversations[legacy.PK]
+	if stored.TenantStatus != "tenant-1#closed" || stored.TenantAssignee != "tenant-1#agent-1" ||
+		stored.TenantVisitor != "tenant-1#visitor-1" || stored.TenantVisitorEmail != "tenant-1#visitor@example.com" {
+		t.Fatalf("unexpected index keys %+v", stored)
+	}
+
+	if updated, err := svc.BackfillIndexKeys(context.Background()); err != nil || updated != 0 {
+		t.Fatalf("expected a second run to be a no-op, got %d, %v", updated, err)
+	}
+}
+
+func TestBackfillReadCountersNumbersLegacyMessages(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := NewWithRepository(repo, time.Now)
+
+	legacy := model.ConversationItem{
+		PK:             model.ConversationPK("tenant-1", "conv-legacy"),
+		ConversationID: "conv-legacy",
+		TenantID:       "tenant-1",
+		VisitorID:      "visitor-1",
+		Status:         model.ConversationStatusOpen,
+		AssignedUserID: "agent-1",
+	}
+	repo.conversations[legacy.PK] = legacy
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1"}
+	repo.users[model.TenantScopedPK("tenant-1", "agent-2")] = model.UserItem{
+		PK:       model.TenantScopedPK("tenant-1", "agent-2"),
+		TenantID: "tenant-1",
+		UserID:   "agent-2",
+	}
+	for i, sender := range []string{model.MessageSenderVisitor, model.MessageSenderVisitor, model.MessageSenderAgent, model.MessageSenderVisitor} {
+		senderID := "visitor-1"
+		if sender == model.MessageSenderAgent {
+			senderID = "agent-1"
+		}
+		repo.messages[legacy.ConversationID] = append(repo.messages[legacy.ConversationID], model.MessageItem{
+			TenantID:       "tenant-1",
+			ConversationID: legacy.ConversationID,
+			MessageID:      fmt.Sprintf("msg-%d", i+1),
+			SenderType:     sender,
+			SenderID:       senderID,
+			CreatedAt:      fmt.Sprintf("2024-01-01T10:00:0%dZ", i),
+		})
+	}
+
+	updated, err := svc.BackfillReadCounters(context.Background())
+	if err != nil {
+		t.Fatalf("BackfillReadCounters error: %v", err)
+	}
+	if updated != 1 {
+		t.Fatalf("expected the legacy conversation to be initialised, got %d", updated)
+	}
+
+	stored := repo.conversations[legacy.PK]
+	if stored.VisitorMessageCount != 3 || stored.AgentMessageCount != 1 {
+		t.Fatalf("unexpected counters %+v", stored)
+	}
+	if unread := stored.UnreadForUser("agent-1"); unread != 1 {
+		t.Fatalf("expected the agent to have 1 unread message, got %d", unread)
+	}
+	if unread := stored.UnreadForVisitor(); unread != 0 {
+		t.Fatalf("expected the visitor to have read the agent reply, got %d", unread)
+	}
+	if last := repo.messages[legacy.ConversationID][3]; last.VisitorCount != 3 || last.AgentCount != 1 {
+		t.Fatalf("unexpected counters on the last message %+v", last)
+	}
+
+	result, err := svc.MarkRead(context.Background(), Identity{TenantID: "tenant-1", UserID: "agent-2"}, legacy.ConversationID, "msg-2")
+	if err != nil {
+		t.Fatalf("MarkRead error: %v", err)
+	}
+	if result.UnreadCount != 1 {
+		t.Fatalf("expected 1 unread message after reading msg-2, got %d", result.UnreadCount)
+	}
+
+	if updated, err := svc.BackfillReadCounters(context.Background()); err != nil || updated != 0 {
+		t.Fatalf("expected a second run to be a no-op, got %d, %v", updated, err)
+	}
+}
+
+func TestEditAndDeleteMessageKeepRevisionsForAdmins(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 7, 1, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	svc.SetSearchIndex(search.NewIndex())
+	useTestSecret(t)
+
+	tenantID := "tenant-edit"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-edit"] = tenantID
+	for userID, role := range map[string]string{"agent-edit": "member", "admin-edit": "admin"} {
+		repo.users[model.TenantScopedPK(tenantID, userID)] = model.UserItem{
+			PK:       model.TenantScopedPK(tenantID, userID),
+			TenantID: tenantID,
+			UserID:   userID,
+			Role:     role,
+		}
+	}
+	agent := Identity{UserID: "agent-edit", TenantID: tenantID}
+	admin := Identity{UserID: "admin-edit", TenantID: tenantID}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-edit",
+		Message:      "Hello",
+		Visitor:      VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+	visitorMessageID := created.Message.MessageID
+
+	posted, err := svc.PostAgentMessage(context.Background(), agent, conversationID, "Your refund is late")
+	if err != nil {
+		t.Fatalf("PostAgentMessage error: %v", err)
+	}
+	messageID := posted.Message.MessageID
+
+	if _, err := svc.EditAgentMessage(context.Background(), admin, conversationID, messageID, "Taken over"); err == nil {
+		t.Fatal("expected editing another agent's message to fail")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeForbidden {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+	if _, err := svc.DeleteAgentMessage(context.Background(), agent, conversationID, visitorMessageID); err == nil {
+		t.Fatal("expected deleting the visitor's message to fail")
+	}
+
+	now = now.Add(time.Minute)
+	edited, err := svc.EditAgentMessage(context.Background(), agent, conversationID, messageID, "  Your refund is on its way  ")
+	if err != nil {
+		t.Fatalf("EditAgentMessage error: %v", err)
+	}
+	if edited.Message.Body != "Your refund is on its way" || edited.Message.EditedAt != now.Format(time.RFC3339) {
+		t.Fatalf("unexpected edited message %+v", edited.Message)
+	}
+	if hits := svc.search.Search(tenantID, "late", 10); len(hits) != 0 {
+		t.Fatalf("expected the old body to leave the search index, got %+v", hits)
+	}
+
+	now = now.Add(time.Minute)
+	deleted, err := svc.DeleteVisitorMessage(context.Background(), created.VisitorToken, conversationID, visitorMessageID)
+	if err != nil {
+		t.Fatalf("DeleteVisitorMessage error: %v", err)
+	}
+	if deleted.Message.Body != "" || deleted.Message.DeletedAt != now.Format(time.RFC3339) {
+		t.Fatalf("expected a tombstone, got %+v", deleted.Message)
+	}
+	if hits := svc.search.Search(tenantID, "hello", 10); len(hits) != 0 {
+		t.Fatalf("expected the deleted message to leave the search index, got %+v", hits)
+	}
+	if _, err := svc.EditVisitorMessage(context.Background(), created.VisitorToken, conversationID, visitorMessageID, "Hi"); err == nil {
+		t.Fatal("expected editing a deleted message to fail")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+
+	if _, err := svc.GetMessageHistory(context.Background(), agent, conversationID, messageID); err == nil {
+		t.Fatal("expected members to be refused the message history")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeForbidden {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+	history, err := svc.GetMessageHistory(context.Background(), admin, conversationID, visitorMessageID)
+	if err != nil {
+		t.Fatalf("GetMessageHistory error: %v", err)
+	}
+	if len(history.Revisions) != 1 {
+		t.Fatalf("expected one revision, got %+v", history.Revisions)
+	}
+	revision := history.Revisions[0]
+	if revision.Body != "Hello" || revision.Action != model.MessageRevisionDeleted || revision.ReplacedBy != created.Conversation.VisitorID {
+		t.Fatalf("unexpected revision %+v", revision)
+	}
+}
+
+func TestPostAttachmentEnforcesTenantLimits(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	dir := t.TempDir()
+	blobs, err := storage.NewLocalStore(dir, "http://files.test/attachments", []byte("blob-secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore error: %v", err)
+	}
+	svc.SetBlobStore(blobs)
+
+	tenantID := "tenant-files"
+	repo.tenants[tenantID] = model.TenantItem{
+		TenantID: tenantID,
+		Settings: map[string]interface{}{
+			"attachments": map[string]interface{}{
+				"maxBytes":     int64(1024),
+				"allowedTypes": []interface{}{"image/*"},
+			},
+		},
+	}
+	repo.keys["api-key-files"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, "admin-files")] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, "admin-files"),
+		TenantID: tenantID,
+		UserID:   "admin-files",
+		Role:     "admin",
+	}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-files",
+		Message:      "My checkout fails",
+		Visitor:      VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+
+	upload := func(name, contentType string, content []byte) AttachmentUpload {
+		return AttachmentUpload{FileName: name, ContentType: contentType, Size: int64(len(content)), Body: bytes.NewReader(content)}
+	}
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 100)...)
+
+	for name, tc := range map[string]AttachmentUpload{
+		"disguised type": upload("shot.png", "image/png", []byte("just some text")),
+		"too large":      upload("big.png", "image/png", append(png, make([]byte, 1024)...)),
+		"empty":          upload("empty.png", "image/png", nil),
+	} {
+		if _, err := svc.PostVisitorAttachment(context.Background(), created.VisitorToken, conversationID, "", tc); err == nil {
+			t.Fatalf("%s: expected the attachment to be rejected", name)
+		} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeValidation {
+			t.Fatalf("%s: expected validation error, got %v", name, err)
+		}
+	}
+
+	posted, err := svc.PostVisitorAttachment(context.Background(), created.VisitorToken, conversationID, "", upload("../../etc/shot.png", "application/octet-stream", png))
+	if err != nil {
+		t.Fatalf("PostVisitorAttachment error: %v", err)
+	}
+	if len(posted.Message.Attachments) != 1 {
+		t.Fatalf("expected one attachment, got %+v", posted.Message)
+	}
+	attachment := posted.Message.Attachments[0]
+	if attachment.FileName != "shot.png" || attachment.ContentType != "image/png" || attachment.Size != int64(len(png)) || attachment.URL == "" {
+		t.Fatalf("unexpected attachment %+v", attachment)
+	}
+	if stored, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(attachment.Key))); err != nil || !bytes.Equal(stored, png) {
+		t.Fatalf("expected the blob under its key, got %q, %v", stored, err)
+	}
+
+	list, err := svc.ListVisitorMessages(context.Background(), created.VisitorToken, conversationID, ListMessagesParams{Limit: 50})
+	if err != nil {
+		t.Fatalf("ListVisitorMessages error: %v", err)
+	}
+	last := list.Messages[len(list.Messages)-1]
+	if len(last.Attachments) != 1 || last.Attachments[0].URL == "" || last.Attachments[0].Key != attachment.Key {
+		t.Fatalf("expected listed message to carry a signed attachment, got %+v", last)
+	}
+
+	deleted, err := svc.DeleteVisitorMessage(context.Background(), created.VisitorToken, conversationID, posted.Message.MessageID)
+	if err != nil {
+		t.Fatalf("DeleteVisitorMessage error: %v", err)
+	}
+	if len(deleted.Message.Attachments) != 0 {
+		t.Fatalf("expected deleted message to drop its attachments, got %+v", deleted.Message.Attachments)
+	}
+	history, err := svc.GetMessageHistory(context.Background(), Identity{UserID: "admin-files", TenantID: tenantID}, conversationID, posted.Message.MessageID)
+	if err != nil {
+		t.Fatalf("GetMessageHistory error: %v", err)
+	}
+	if len(history.Revisions) != 1 || len(history.Revisions[0].Attachments) != 1 || history.Revisions[0].Attachments[0].URL == "" {
+		t.Fatalf("expected the revision to keep the signed attachment, got %+v", history.Revisions)
+	}
+}
+
+func TestStructuredMessagesValidateContentAndKeepPlainBody(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 8, 5, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	svc.SetSearchIndex(search.NewIndex())
+	useTestSecret(t)
+
+	tenantID := "tenant-rich"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-rich"] = tenantID
+	repo.users[model.TenantScopedPK(tenantID, "agent-rich")] = model.UserItem{
+		PK:       model.TenantScopedPK(tenantID, "agent-rich"),
+		TenantID: tenantID,
+		UserID:   "agent-rich",
+		Name:     "Anna",
+	}
+	agent := Identity{UserID: "agent-rich", TenantID: tenantID}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-rich",
+		Message:      "I want to upgrade",
+		Visitor:      VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+	ctx := context.Background()
+
+	for name, input := range map[string]MessageInput{
+		"unknown type":        {Type: "carousel", Body: "Pick one"},
+		"system":              {Type: model.MessageTypeSystem, Body: "Anna joined"},
+		"no replies":          {Type: model.MessageTypeQuickReplies, Body: "Pick one"},
+		"no prompt":           {Type: model.MessageTypeQuickReplies, Content: model.MessageContent{QuickReplies: []model.QuickReply{{Label: "Yes"}}}},
+		"card without url":    {Type: model.MessageTypeCard, Content: model.MessageContent{Card: &model.MessageCard{Title: "Pricing"}}},
+		"card with script":    {Type: model.MessageTypeCard, Content: model.MessageContent{Card: &model.MessageCard{Title: "Pricing", URL: "javascript:alert(1)"}}},
+		"select w/o options":  {Type: model.MessageTypeForm, Body: "Details", Content: model.MessageContent{Form: &model.MessageForm{Fields: []model.FormField{{Name: "plan", Type: model.FormFieldSelect}}}}},
+		"invalid field name":  {Type: model.MessageTypeForm, Body: "Details", Content: model.MessageContent{Form: &model.MessageForm{Fields: []model.FormField{{Name: "first name"}}}}},
+		"unknown field type":  {Type: model.MessageTypeForm, Body: "Details", Content: model.MessageContent{Form: &model.MessageForm{Fields: []model.FormField{{Name: "date", Type: "date"}}}}},
+		"form response agent": {Type: model.MessageTypeFormResponse},
+	} {
+		if _, err := svc.PostAgentContent(ctx, agent, conversationID, input); err == nil {
+			t.Fatalf("%s: expected the message to be rejected", name)
+		} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeValidation {
+			t.Fatalf("%s: expected validation error, got %v", name, err)
+		}
+	}
+	if _, err := svc.PostVisitorContent(ctx, created.VisitorToken, conversationID, MessageInput{
+		Type:    model.MessageTypeCard,
+		Content: model.MessageContent{Card: &model.MessageCard{Title: "Free stuff", URL: "https://example.com"}},
+	}); err == nil {
+		t.Fatal("expected visitors to be unable to post cards")
+	}
+
+	replies, err := svc.PostAgentContent(ctx, agent, conversationID, MessageInput{
+		Type:    model.MessageTypeQuickReplies,
+		Body:    "Which plan?",
+		Content: model.MessageContent{QuickReplies: []model.QuickReply{{Label: " Pro "}, {Label: "Team", Value: "team-plan"}}},
+	})
+	if err != nil {
+		t.Fatalf("PostAgentContent quick replies error: %v", err)
+	}
+	if replies.Message.Body != "Which plan?\n- Pro\n- Team" || replies.Message.Content.QuickReplies[0].Value != "Pro" {
+		t.Fatalf("unexpected quick replies message %+v %+v", replies.Message, replies.Message.Content)
+	}
+	if _, err := svc.EditAgentMessage(ctx, agent, conversationID, replies.Message.MessageID, "Changed"); err == nil {
+		t.Fatal("expected editing quick replies to fail")
+	}
+
+	form, err := svc.PostAgentContent(ctx, agent, conversationID, MessageInput{
+		Type: model.MessageTypeForm,
+		Content: model.MessageContent{
+			Text: "Tell us about your team",
+			Form: &model.MessageForm{Fields: []model.FormField{
+				{Name: "email", Label: "Work email", Type: model.FormFieldEmail, Required: true},
+				{Name: "seats", Type: model.FormFieldNumber},
+				{Name: "plan", Label: "Plan", Type: model.FormFieldSelect, Options: []string{"Pro", "Team"}},
+			}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("PostAgentContent form error: %v", err)
+	}
+	if form.Message.Body != "Tell us about your team\nPlease reply with: Work email, seats, Plan" {
+		t.Fatalf("unexpected form body %q", form.Message.Body)
+	}
+
+	respond := func(formMessageID string, values map[string]string) (MessageResult, error) {
+		return svc.PostVisitorContent(ctx, created.VisitorToken, conversationID, MessageInput{
+			Type:    model.MessageTypeFormResponse,
+			Content: model.MessageContent{FormResponse: &model.FormResponse{FormMessageID: formMessageID, Values: values}},
+		})
+	}
+	for name, tc := range map[string]struct {
+		formMessageID string
+		values        map[string]string
+	}{
+		"missing required": {form.Message.MessageID, map[string]string{"seats": "5"}},
+		"invalid email":    {form.Message.MessageID, map[string]string{"email": "not-an-email"}},
+		"not a number":     {form.Message.MessageID, map[string]string{"email": "a@example.com", "seats": "five"}},
+		"unknown option":   {form.Message.MessageID, map[string]string{"email": "a@example.com", "plan": "Enterprise"}},
+		"unknown field":    {form.Message.MessageID, map[string]string{"email": "a@example.com", "phone": "123"}},
+		"not a form":       {replies.Message.MessageID, map[string]string{"email": "a@example.com"}},
+	} {
+		if _, err := respond(tc.formMessageID, tc.values); err == nil {
+			t.Fatalf("%s: expected the form response to be rejected", name)
+		}
+	}
+
+	answered, err := respond(form.Message.MessageID, map[string]string{"email": " A@Example.com ", "plan": "Team"})
+	if err != nil {
+		t.Fatalf("form response error: %v", err)
+	}
+	if answered.Message.Type != model.MessageTypeFormResponse || answered.Message.Body != "Work email: a@example.com\nPlan: Team" {
+		t.Fatalf("unexpected form response %+v", answered.Message)
+	}
+
+	before := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	joined, err := svc.RecordSystemEvent(ctx, before, model.SystemEventAgentJoined, "agent-rich")
+	if err != nil {
+		t.Fatalf("RecordSystemEvent error: %v", err)
+	}
+	if joined.Message.SenderType != model.MessageSenderSystem || joined.Message.Body != "Anna joined the conversation" || joined.Message.Content.Event.ActorName != "Anna" {
+		t.Fatalf("unexpected system message %+v", joined.Message)
+	}
+	after := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if after.VisitorMessageCount != before.VisitorMessageCount || after.AgentMessageCount != before.AgentMessageCount {
+		t.Fatalf("expected system messages to leave the counts alone, got %+v", after)
+	}
+	if _, err := svc.RecordSystemEvent(ctx, before, "agent.waved", ""); err == nil {
+		t.Fatal("expected unknown system events to be rejected")
+	}
+
+	hits, err := svc.SearchMessages(ctx, agent, "conversation", 10)
+	if err != nil {
+		t.Fatalf("SearchMessages error: %v", err)
+	}
+	if len(hits.Hits) != 0 {
+		t.Fatalf("expected system messages to stay out of search, got %+v", hits.Hits)
+	}
+	if _, err := svc.RebuildSearchIndex(ctx); err != nil {
+		t.Fatalf("RebuildSearchIndex error: %v", err)
+	}
+	if hits, _ = svc.SearchMessages(ctx, agent, "conversation", 10); len(hits.Hits) != 0 {
+		t.Fatalf("expected a rebuild to skip system messages, got %+v", hits.Hits)
+	}
+}
+
+func TestPostNoteResolvesMentionsAndLeavesActivityAlone(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 8, 6, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-notes"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-notes"] = tenantID
+	for userID, user := range map[string]model.UserItem{
+		"user-anna": {Name: "Anna", Email: "anna@example.com"},
+		"user-ben":  {Name: "Ben Smith", Email: "ben.smith@example.com"},
+		"user-cleo": {Name: "Cleo", Email: "cleo@example.org"},
+	} {
+		user.PK = model.TenantScopedPK(tenantID, userID)
+		user.TenantID = tenantID
+		user.UserID = userID
+		repo.users[user.PK] = user
+	}
+	author := Identity{UserID: "user-anna", TenantID: tenantID}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-notes",
+		Message:      "Where is my parcel?",
+		Visitor:      VisitorParams{Name: "Visitor"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+	ctx := context.Background()
+
+	if _, err := svc.PostNote(ctx, author, conversationID, "   "); err == nil {
+		t.Fatal("expected an empty note to be rejected")
+	}
+
+	posted, err := svc.PostNote(ctx, author, conversationID, "@anna asked @ben.smith, @Cleo@example.org and @nobody. Mail me at anna@example.com")
+	if err != nil {
+		t.Fatalf("PostNote error: %v", err)
+	}
+	if got := posted.Message.Mentions; len(got) != 2 || got[0] != "user-ben" || got[1] != "user-cleo" {
+		t.Fatalf("expected ben and cleo to be mentioned, got %v", got)
+	}
+
+	stored := repo.conversations[model.ConversationPK(tenantID, conversationID)]
+	if stored.AssignedUserID != "" || stored.TenantStartedAt != "" || stored.AgentMessageCount != 0 {
+		t.Fatalf("expected the note to leave the conversation alone, got %+v", stored)
+	}
+
+	visitorPage, err := svc.ListVisitorMessages(ctx, created.VisitorToken, conversationID, ListMessagesParams{})
+	if err != nil {
+		t.Fatalf("ListVisitorMessages error: %v", err)
+	}
+	for _, message := range visitorPage.Messages {
+		if message.MessageID == posted.Message.MessageID {
+			t.Fatal("expected the visitor not to see the note")
+		}
+	}
+	agentPage, err := svc.ListMessages(ctx, author, conversationID, ListMessagesParams{})
+	if err != nil {
+		t.Fatalf("ListMessages error: %v", err)
+	}
+	if len(agentPage.Messages) != 2 {
+		t.Fatalf("expected agents to see the note, got %d messages", len(agentPage.Messages))
+	}
+
+	if _, err := svc.EditAgentMessage(ctx, author, conversationID, posted.Message.MessageID, "Parcel found"); err != nil {
+		t.Fatalf("expected notes to be editable, got %v", err)
+	}
+	deleted, err := svc.DeleteAgentMessage(ctx, author, conversationID, posted.Message.MessageID)
+	if err != nil {
+		t.Fatalf("DeleteAgentMessage error: %v", err)
+	}
+	if deleted.Message.Type != model.MessageTypeNote || len(deleted.Message.Mentions) != 0 {
+		t.Fatalf("expected a note tombstone without mentions, got %+v", deleted.Message)
+	}
+}
+
+func TestPostCannedResponseFillsPlaceholders(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 8, 7, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time { return now })
+	useTestSecret(t)
+
+	tenantID := "tenant-canned"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-canned"] = tenantID
+	agent := model.UserItem{PK: model.TenantScopedPK(tenantID, "user-ana"), TenantID: tenantID, UserID: "user-ana", Name: "Ana"}
+	repo.users[agent.PK] = agent
+	identity := Identity{UserID: agent.UserID, TenantID: tenantID}
+
+	created, err := svc.CreateConversation(context.Background(), CreateConversationParams{
+		TenantAPIKey: "api-key-canned",
+		Message:      "Hello?",
+		Visitor:      VisitorParams{Name: "Jo"},
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+	visitorPK := model.VisitorPK(tenantID, created.Conversation.VisitorID)
+	visitor := repo.visitors[visitorPK]
+	visitor.Email = "jo@example.com"
+	repo.visitors[visitorPK] = visitor
+
+	repo.canned["greeting"] = model.CannedResponseItem{
+		TenantID:   tenantID,
+		ResponseID: "greeting",
+		Title:      "Greeting",
+		Body:       "Hi {{visitor.name|there}}, {{agent.name}} here. We will write to {{visitor.email}}.",
+	}
+	repo.canned["other-tenant"] = model.CannedResponseItem{TenantID: "tenant-other", ResponseID: "other-tenant", Body: "Not yours"}
+	ctx := context.Background()
+
+	if _, err := svc.PostCannedResponse(ctx, identity, conversationID, "other-tenant"); err == nil {
+		t.Fatal("expected another tenant's canned response to be rejected")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	posted, err := svc.PostCannedResponse(ctx, identity, conversationID, "greeting")
+	if err != nil {
+		t.Fatalf("PostCannedResponse error: %v", err)
+	}
+	if want := "Hi Jo, Ana here. We will write to jo@example.com."; posted.Message.Body != want {
+		t.Fatalf("expected rendered body %q, got %q", want, posted.Message.Body)
+	}
+	if posted.Message.SenderType != model.MessageSenderAgent || posted.Conversation.AgentMessageCount != 1 {
+		t.Fatalf("expected an agent message, got %+v", posted.Message)
+	}
+	if repo.canned["greeting"].UsageCount != 0 {
+		t.Fatal("expected posting alone not to count the use")
+	}
+
+	if err := svc.RecordCannedResponseUse(ctx, identity, "greeting"); err != nil {
+		t.Fatalf("RecordCannedResponseUse error: %v", err)
+	}
+	if used := repo.canned["greeting"]; used.UsageCount != 1 || used.LastUsedAt != now.Format(time.RFC3339) {
+		t.Fatalf("expected one recorded use, got %+v", used)
+	}
+}
+
+func TestVisitorPagesAndReadMarkersSkipNotes(t *testing.T) {
+	repo := newMemoryRepository()
+	now := time.Date(2024, 8, 8, 9, 0, 0, 0, time.UTC)
+	svc := NewWithRepository(repo, func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	})
+	useTestSecret(t)
+
+	tenantID := "tenant-hidden"
+	repo.tenants[tenantID] = model.TenantItem{TenantID: tenantID}
+	repo.keys["api-key-hidden"] = tenantID
+	agent := model.UserItem{PK: model.TenantScopedPK(tenantID, "user-ana"), TenantID: tenantID, UserID: "user-ana"}
+	repo.users[agent.PK] = agent
+	identity := Identity{UserID: agent.UserID, TenantID: tenantID}
+	ctx := context.Background()
+
+	created, err := svc.CreateConversation(ctx, CreateConversationParams{
+		TenantAPIKey: "api-key-hidden",
+		Message:      "visitor 1",
+	})
+	if err != nil {
+		t.Fatalf("CreateConversation error: %v", err)
+	}
+	conversationID := created.Conversation.ConversationID
+	token := created.VisitorToken
+
+	var noteIDs []string
+	for i := 1; i <= 3; i++ {
+		if _, err := svc.PostAgentMessage(ctx, identity, conversationID, fmt.Sprintf("agent %d", i)); err != nil {
+			t.Fatalf("PostAgentMessage error: %v", err)
+		}
+		note, err := svc.PostNote(ctx, identity, conversationID, fmt.Sprintf("note %d", i))
+		if err != nil {
+			t.Fatalf("PostNote error: %v", err)
+		}
+		noteIDs = append(noteIDs, note.Message.MessageID)
+	}
+
+	first, err := svc.ListVisitorMessages(ctx, token, conversationID, ListMessagesParams{Limit: 2})
+	if err != nil {
+		t.Fatalf("ListVisitorMessages error: %v", err)
+	}
+	if len(first.Messages) != 2 || first.Messages[0].Body != "agent 2" || first.Messages[1].Body != "agent 3" || first.NextCursor == "" {
+		t.Fatalf("expected a full page of the newest visible messages, got %+v", first.Messages)
+	}
+	second, err := svc.ListVisitorMessages(ctx, token, conversationID, ListMessagesParams{Limit: 2, Cursor: first.NextCursor})
+	if err != nil {
+		t.Fatalf("ListVisitorMessages error: %v", err)
+	}
+	if len(second.Messages) != 2 || second.Messages[0].Body != "visitor 1" || second.Messages[1].Body != "agent 1" {
+		t.Fatalf("expected the next full page, got %+v", second.Messages)
+	}
+
+	if _, err := svc.ListVisitorMessages(ctx, token, conversationID, ListMessagesParams{Before: noteIDs[0]}); err == nil {
+		t.Fatal("expected a note to be refused as an anchor")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+
+	if _, err := svc.MarkVisitorRead(ctx, token, conversationID, noteIDs[1]); err == nil {
+		t.Fatal("expected a note to be refused as a read marker")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+	read, err := svc.MarkVisitorRead(ctx, token, conversationID, "")
+	if err != nil {
+		t.Fatalf("MarkVisitorRead error: %v", err)
+	}
+	for _, noteID := range noteIDs {
+		if read.Marker.MessageID == noteID {
+			t.Fatal("expected the visitor marker to skip the trailing note")
+		}
+	}
+	if read.UnreadCount != 0 {
+		t.Fatalf("expected everything visible to be read, got %d unread", read.UnreadCount)
+	}
+}
@@ -0,0 +1,190 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"strings"
+
+	"chat-app-backend/internal/model"
+)
+
+const (
+	// DefaultAttachmentMaxBytes is the attachment size limit of tenants that
+	// have not set one.
+	DefaultAttachmentMaxBytes int64 = 10 << 20
+	// MaxAttachmentBytes is the largest size limit a tenant may set.
+	MaxAttachmentBytes int64 = 25 << 20
+)
+
+const maxAttachmentTypes = 50
+
+var defaultAttachmentTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"text/plain",
+}
+
+// AttachmentSettings limit the files sent in a tenant's conversations.
+// AllowedTypes holds MIME types, where "image/*" allows every image type.
+type AttachmentSettings struct {
+	MaxBytes     int64
+	AllowedTypes []string
+}
+
+type AttachmentSettingsInput struct {
+	MaxBytes     int64
+	AllowedTypes []string
+}
+
+func defaultAttachmentSettings() AttachmentSettings {
+	return AttachmentSettings{
+		MaxBytes:     DefaultAttachmentMaxBytes,
+		AllowedTypes: append([]string(nil), defaultAttachmentTypes...),
+	}
+}
+
+func AttachmentSettingsFromTenant(tenant model.TenantItem) AttachmentSettings {
+	return attachmentSettingsFromMap(tenant.Settings)
+}
+
+// Allows reports whether files of contentType may be attached.
+func (a AttachmentSettings) Allows(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, allowed := range a.AllowedTypes {
+		if allowed == mediaType {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(mediaType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func attachmentSettingsFromMap(settings map[string]interface{}) AttachmentSettings {
+	result := defaultAttachmentSettings()
+	if settings == nil {
+		return result
+	}
+
+	attachmentsMap, ok := settings["attachments"].(map[string]interface{})
+	if !ok {
+		return result
+	}
+
+	switch val := attachmentsMap["maxBytes"].(type) {
+	case float64:
+		result.MaxBytes = int64(val)
+	case int64:
+		result.MaxBytes = val
+	case int:
+		result.MaxBytes = int64(val)
+	}
+	if result.MaxBytes <= 0 || result.MaxBytes > MaxAttachmentBytes {
+		result.MaxBytes = DefaultAttachmentMaxBytes
+	}
+
+	if rawTypes, ok := attachmentsMap["allowedTypes"].([]interface{}); ok {
+		types := make([]string, 0, len(rawTypes))
+		for _, raw := range rawTypes {
+			if val, ok := raw.(string); ok {
+				types = append(types, val)
+			}
+		}
+		result.AllowedTypes = types
+	}
+
+	return result
+}
+
+func (a AttachmentSettings) toMap() map[string]interface{} {
+	types := make([]interface{}, len(a.AllowedTypes))
+	for i, allowed := range a.AllowedTypes {
+		types[i] = allowed
+	}
+	return map[string]interface{}{
+		"maxBytes":     a.MaxBytes,
+		"allowedTypes": types,
+	}
+}
+
+func normalizeAttachmentSettings(input AttachmentSettingsInput) (AttachmentSettings, error) {
+	settings := defaultAttachmentSettings()
+
+	if input.MaxBytes != 0 {
+		if input.MaxBytes < 0 || input.MaxBytes > MaxAttachmentBytes {
+			return AttachmentSettings{}, newError(ErrorCodeValidation, fmt.Sprintf("maxBytes must be between 1 and %d", MaxAttachmentBytes), nil)
+		}
+		settings.MaxBytes = input.MaxBytes
+	}
+
+	if input.AllowedTypes != nil {
+		if len(input.AllowedTypes) > maxAttachmentTypes {
+			return AttachmentSettings{}, newError(ErrorCodeValidation, fmt.Sprintf("allowedTypes cannot list more than %d types", maxAttachmentTypes), nil)
+		}
+		seen := make(map[string]bool, len(input.AllowedTypes))
+		types := make([]string, 0, len(input.AllowedTypes))
+		for _, raw := range input.AllowedTypes {
+			allowed := strings.ToLower(strings.TrimSpace(raw))
+			if !validAttachmentType(allowed) {
+				return AttachmentSettings{}, newError(ErrorCodeValidation, fmt.Sprintf("%q is not a MIME type", raw), nil)
+			}
+			if !seen[allowed] {
+				seen[allowed] = true
+				types = append(types, allowed)
+			}
+		}
+		settings.AllowedTypes = types
+	}
+
+	return settings, nil
+}
+
+// validAttachmentType accepts type/subtype and type/* without parameters.
+func validAttachmentType(value string) bool {
+	if prefix, ok := strings.CutSuffix(value, "/*"); ok {
+		value = prefix + "/any"
+	}
+	mediaType, params, err := mime.ParseMediaType(value)
+	return err == nil && len(params) == 0 && mediaType == value && strings.Count(value, "/") == 1
+}
+
+func (s *Service) GetAttachmentSettings(ctx context.Context, identity Identity, tenantID string) (AttachmentSettings, error) {
+	_, tenant, err := s.ensureOwnerAccess(ctx, identity, tenantID)
+	if err != nil {
+		return AttachmentSettings{}, err
+	}
+	return attachmentSettingsFromMap(tenant.Settings), nil
+}
+
+func (s *Service) UpdateAttachmentSettings(ctx context.Context, identity Identity, tenantID string, params AttachmentSettingsInput) (AttachmentSettings, error) {
+	_, tenant, err := s.ensureOwnerAccess(ctx, identity, tenantID)
+	if err != nil {
+		return AttachmentSettings{}, err
+	}
+
+	normalized, err := normalizeAttachmentSettings(params)
+	if err != nil {
+		return AttachmentSettings{}, err
+	}
+
+	nextSettings := cloneSettings(tenant.Settings)
+	nextSettings["attachments"] = normalized.toMap()
+
+	if _, err := s.repo.UpdateTenantSettings(ctx, tenant.TenantID, nextSettings); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return AttachmentSettings{}, newError(ErrorCodeNotFound, "tenant not found", err)
+		}
+		return AttachmentSettings{}, newError(ErrorCodeInternal, "failed to update attachment settings", err)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,271 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"chat-app-backend/internal/model"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxCannedResponseTitle  = 100
+	maxCannedResponseBody   = 5000
+	maxCannedResponseFolder = 60
+)
+
+// Canned response placeholders filled in from the conversation an agent
+// posts the reply to.
+const (
+	PlaceholderVisitorName  = "visitor.name"
+	PlaceholderVisitorEmail = "visitor.email"
+	PlaceholderAgentName    = "agent.name"
+)
+
+var cannedResponsePlaceholders = map[string]bool{
+	PlaceholderVisitorName:  true,
+	PlaceholderVisitorEmail: true,
+	PlaceholderAgentName:    true,
+}
+
+// Roles that may change the canned responses of other tenant users.
+var cannedResponseManagerRoles = map[string]bool{
+	"owner": true,
+	"admin": true,
+}
+
+// placeholderPattern matches {{name}} and {{name|fallback}}, where the
+// fallback is used when the value of name is empty.
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([a-z]+\.[a-z]+)\s*(?:\|([^{}]*))?\}\}`)
+
+var shortcutPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+type CannedResponseInput struct {
+	Title    string
+	Shortcut string
+	Folder   string
+	Body     string
+}
+
+// RenderCannedResponse fills the placeholders of body with vars. Placeholders
+// without a value are replaced by their fallback, or removed.
+func RenderCannedResponse(body string, vars map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(body, func(match string) string {
+		parts := placeholderPattern.FindStringSubmatch(match)
+		if value := strings.TrimSpace(vars[parts[1]]); value != "" {
+			return value
+		}
+		return strings.TrimSpace(parts[2])
+	})
+}
+
+// ListCannedResponses returns the canned responses of the caller's tenant
+// ordered by folder and title. A non-empty folder limits the list to it.
+func (s *Service) ListCannedResponses(ctx context.Context, identity Identity, folder string) ([]model.CannedResponseItem, error) {
+	if _, err := s.ensureMemberAccess(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	items, err := s.repo.ListCannedResponses(ctx, identity.TenantID)
+	if err != nil {
+		return nil, newError(ErrorCodeInternal, "failed to list canned responses", err)
+	}
+
+	folder = strings.TrimSpace(folder)
+	responses := make([]model.CannedResponseItem, 0, len(items))
+	for _, item := range items {
+		if folder != "" && !strings.EqualFold(item.Folder, folder) {
+			continue
+		}
+		responses = append(responses, item)
+	}
+
+	sort.Slice(responses, func(i, j int) bool {
+		a, b := responses[i], responses[j]
+		if !strings.EqualFold(a.Folder, b.Folder) {
+			return strings.ToLower(a.Folder) < strings.ToLower(b.Folder)
+		}
+		return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+	})
+	return responses, nil
+}
+
+func (s *Service) CreateCannedResponse(ctx context.Context, identity Identity, input CannedResponseInput) (model.CannedResponseItem, error) {
+	normalized, err := normalizeCannedResponse(input)
+	if err != nil {
+		return model.CannedResponseItem{}, err
+	}
+
+	if _, err := s.ensureMemberAccess(ctx, identity); err != nil {
+		return model.CannedResponseItem{}, err
+	}
+	if err := s.ensureShortcutFree(ctx, identity.TenantID, normalized.Shortcut, ""); err != nil {
+		return model.CannedResponseItem{}, err
+	}
+
+	item := model.CannedResponseItem{
+		TenantID:   identity.TenantID,
+		ResponseID: uuid.NewString(),
+		Title:      normalized.Title,
+		Shortcut:   normalized.Shortcut,
+		Folder:     normalized.Folder,
+		Body:       normalized.Body,
+		CreatedBy:  identity.UserID,
+		CreatedAt:  s.now().UTC().Format(time.RFC3339),
+	}
+	if err := s.repo.CreateCannedResponse(ctx, item); err != nil {
+		return model.CannedResponseItem{}, newError(ErrorCodeInternal, "failed to create canned response", err)
+	}
+	return item, nil
+}
+
+// UpdateCannedResponse replaces the contents of a canned response. Only its
+// author and tenant owners or admins may change it.
+func (s *Service) UpdateCannedResponse(ctx context.Context, identity Identity, responseID string, input CannedResponseInput) (model.CannedResponseItem, error) {
+	normalized, err := normalizeCannedResponse(input)
+	if err != nil {
+		return model.CannedResponseItem{}, err
+	}
+
+	existing, err := s.manageableCannedResponse(ctx, identity, responseID)
+	if err != nil {
+		return model.CannedResponseItem{}, err
+	}
+	if err := s.ensureShortcutFree(ctx, identity.TenantID, normalized.Shortcut, existing.ResponseID); err != nil {
+		return model.CannedResponseItem{}, err
+	}
+
+	existing.Title = normalized.Title
+	existing.Shortcut = normalized.Shortcut
+	existing.Folder = normalized.Folder
+	existing.Body = normalized.Body
+	existing.UpdatedAt = s.now().UTC().Format(time.RFC3339)
+
+	updated, err := s.repo.UpdateCannedResponse(ctx, existing)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.CannedResponseItem{}, newError(ErrorCodeNotFound, "canned response not found", err)
+		}
+		return model.CannedResponseItem{}, newError(ErrorCodeInternal, "failed to update canned response", err)
+	}
+	return updated, nil
+}
+
+// DeleteCannedResponse removes a canned response. Only its author and tenant
+// owners or admins may delete it.
+func (s *Service) DeleteCannedResponse(ctx context.Context, identity Identity, responseID string) error {
+	existing, err := s.manageableCannedResponse(ctx, identity, responseID)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.DeleteCannedResponse(ctx, existing.TenantID, existing.ResponseID); err != nil {
+		return newError(ErrorCodeInternal, "failed to delete canned response", err)
+	}
+	return nil
+}
+
+// manageableCannedResponse loads a canned response of the caller's tenant
+// that the caller may change.
+func (s *Service) manageableCannedResponse(ctx context.Context, identity Identity, responseID string) (model.CannedResponseItem, error) {
+	responseID = strings.TrimSpace(responseID)
+	if responseID == "" {
+		return model.CannedResponseItem{}, newError(ErrorCodeValidation, "responseId is required", nil)
+	}
+
+	user, err := s.ensureMemberAccess(ctx, identity)
+	if err != nil {
+		return model.CannedResponseItem{}, err
+	}
+
+	item, err := s.repo.GetCannedResponse(ctx, identity.TenantID, responseID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.CannedResponseItem{}, newError(ErrorCodeNotFound, "canned response not found", err)
+		}
+		return model.CannedResponseItem{}, newError(ErrorCodeInternal, "failed to load canned response", err)
+	}
+
+	if item.CreatedBy != user.UserID && !cannedResponseManagerRoles[user.Role] {
+		return model.CannedResponseItem{}, newError(ErrorCodeForbidden, "only the author or tenant admins can change this canned response", nil)
+	}
+	return item, nil
+}
+
+// ensureShortcutFree reports a conflict when another canned response of the
+// tenant than ignoreID already uses shortcut.
+func (s *Service) ensureShortcutFree(ctx context.Context, tenantID, shortcut, ignoreID string) error {
+	if shortcut == "" {
+		return nil
+	}
+	items, err := s.repo.ListCannedResponses(ctx, tenantID)
+	if err != nil {
+		return newError(ErrorCodeInternal, "failed to list canned responses", err)
+	}
+	for _, item := range items {
+		if item.ResponseID != ignoreID && item.Shortcut == shortcut {
+			return newError(ErrorCodeConflict, fmt.Sprintf("shortcut /%s is already in use", shortcut), nil)
+		}
+	}
+	return nil
+}
+
+// ensureMemberAccess returns the active tenant user of identity.
+func (s *Service) ensureMemberAccess(ctx context.Context, identity Identity) (model.UserItem, error) {
+	if identity.UserID == "" || identity.TenantID == "" {
+		return model.UserItem{}, newError(ErrorCodeUnauthorized, "invalid user identity", nil)
+	}
+
+	user, err := s.repo.GetUser(ctx, identity.TenantID, identity.UserID)
+	if err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return model.UserItem{}, newError(ErrorCodeUnauthorized, "user not found for tenant", err)
+		}
+		return model.UserItem{}, newError(ErrorCodeInternal, "failed to fetch user", err)
+	}
+	if user.Status != "active" {
+		return model.UserItem{}, newError(ErrorCodeForbidden, "user is not active", nil)
+	}
+	return user, nil
+}
+
+func normalizeCannedResponse(input CannedResponseInput) (CannedResponseInput, error) {
+	normalized := CannedResponseInput{
+		Title:    strings.TrimSpace(input.Title),
+		Shortcut: strings.ToLower(strings.TrimPrefix(strings.TrimSpace(input.Shortcut), "/")),
+		Folder:   strings.TrimSpace(input.Folder),
+		Body:     strings.TrimSpace(input.Body),
+	}
+
+	if normalized.Title == "" {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, "title is required", nil)
+	}
+	if utf8.RuneCountInString(normalized.Title) > maxCannedResponseTitle {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, fmt.Sprintf("title must be at most %d characters", maxCannedResponseTitle), nil)
+	}
+	if normalized.Body == "" {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, "body is required", nil)
+	}
+	if utf8.RuneCountInString(normalized.Body) > maxCannedResponseBody {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, fmt.Sprintf("body must be at most %d characters", maxCannedResponseBody), nil)
+	}
+	if utf8.RuneCountInString(normalized.Folder) > maxCannedResponseFolder {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, fmt.Sprintf("folder must be at most %d characters", maxCannedResponseFolder), nil)
+	}
+	if normalized.Shortcut != "" && !shortcutPattern.MatchString(normalized.Shortcut) {
+		return CannedResponseInput{}, newError(ErrorCodeValidation, "shortcut may only hold lowercase letters, digits, - and _ and be at most 32 characters", nil)
+	}
+
+	for _, match := range placeholderPattern.FindAllStringSubmatch(normalized.Body, -1) {
+		if !cannedResponsePlaceholders[match[1]] {
+			return CannedResponseInput{}, newError(ErrorCodeValidation, fmt.Sprintf("unknown placeholder {{%s}}", match[1]), nil)
+		}
+	}
+	return normalized, nil
+}
@@ -34,6 +34,11 @@ type Repository interface {
 	CreateTenantAPIKey(ctx context.Context, item model.TenantAPIKeyItem) error
 	DeleteTenantAPIKey(ctx context.Context, tenantID, keyID string) error
 	GetTenantAPIKey(ctx context.Context, tenantID, keyID string) (model.TenantAPIKeyItem, error)
+	ListCannedResponses(ctx context.Context, tenantID string) ([]model.CannedResponseItem, error)
+	GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error)
+	CreateCannedResponse(ctx context.Context, item model.CannedResponseItem) error
+	UpdateCannedResponse(ctx context.Context, item model.CannedResponseItem) (model.CannedResponseItem, error)
+	DeleteCannedResponse(ctx context.Context, tenantID, responseID string) error
 }
 
 type DynamoRepository struct {
@@ -233,6 +238,106 @@ func (r *DynamoRepository) GetTenantAPIKey(ctx context.Context, tenantID, keyID
 	return key, nil
 }
 
+func (r *DynamoRepository) ListCannedResponses(ctx context.Context, tenantID string) ([]model.CannedResponseItem, error) {
+	items, err := r.db.Client.QueryItems(
+		ctx,
+		model.CannedResponsesTable,
+		nil,
+		"tenantId = :tenantId",
+		map[string]types.AttributeValue{
+			":tenantId": &types.AttributeValueMemberS{Value: tenantID},
+		},
+		nil,
+		nil,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	responses := make([]model.CannedResponseItem, 0, len(items))
+	for _, item := range items {
+		var response model.CannedResponseItem
+		if err := attributevalue.UnmarshalMap(item, &response); err != nil {
+			return nil, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, nil
+}
+
+func (r *DynamoRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	var response model.CannedResponseItem
+	err := r.db.Client.GetItem(
+		ctx,
+		model.CannedResponsesTable,
+		map[string]types.AttributeValue{
+			"tenantId":   &types.AttributeValueMemberS{Value: tenantID},
+			"responseId": &types.AttributeValueMemberS{Value: responseID},
+		},
+		&response,
+	)
+	if err != nil {
+		if isNotFoundError(err) {
+			return model.CannedResponseItem{}, ErrNotFound
+		}
+		return model.CannedResponseItem{}, err
+	}
+	return response, nil
+}
+
+func (r *DynamoRepository) CreateCannedResponse(ctx context.Context, item model.CannedResponseItem) error {
+	return r.db.Client.PutItem(ctx, model.CannedResponsesTable, item)
+}
+
+// UpdateCannedResponse rewrites the editable fields of an existing response
+// and leaves its usage count alone.
+func (r *DynamoRepository) UpdateCannedResponse(ctx context.Context, item model.CannedResponseItem) (model.CannedResponseItem, error) {
+	var updated model.CannedResponseItem
+	err := r.db.Client.UpdateItemWithCondition(
+		ctx,
+		model.CannedResponsesTable,
+		map[string]types.AttributeValue{
+			"tenantId":   &types.AttributeValueMemberS{Value: item.TenantID},
+			"responseId": &types.AttributeValueMemberS{Value: item.ResponseID},
+		},
+		"SET #title = :title, #shortcut = :shortcut, #folder = :folder, #body = :body, #updatedAt = :updatedAt",
+		"attribute_exists(responseId)",
+		map[string]types.AttributeValue{
+			":title":     &types.AttributeValueMemberS{Value: item.Title},
+			":shortcut":  &types.AttributeValueMemberS{Value: item.Shortcut},
+			":folder":    &types.AttributeValueMemberS{Value: item.Folder},
+			":body":      &types.AttributeValueMemberS{Value: item.Body},
+			":updatedAt": &types.AttributeValueMemberS{Value: item.UpdatedAt},
+		},
+		map[string]string{
+			"#title":     "title",
+			"#shortcut":  "shortcut",
+			"#folder":    "folder",
+			"#body":      "body",
+			"#updatedAt": "updatedAt",
+		},
+		&updated,
+	)
+	if err != nil {
+		if isConditionFailed(err) {
+			return model.CannedResponseItem{}, ErrNotFound
+		}
+		return model.CannedResponseItem{}, err
+	}
+	return updated, nil
+}
+
+func (r *DynamoRepository) DeleteCannedResponse(ctx context.Context, tenantID, responseID string) error {
+	return r.db.Client.DeleteItem(
+		ctx,
+		model.CannedResponsesTable,
+		map[string]types.AttributeValue{
+			"tenantId":   &types.AttributeValueMemberS{Value: tenantID},
+			"responseId": &types.AttributeValueMemberS{Value: responseID},
+		},
+	)
+}
+
 func (r *DynamoRepository) GetUser(ctx context.Context, tenantID, userID string) (model.UserItem, error) {
 	var user model.UserItem
 	err := r.db.Client.GetItem(
@@ -454,6 +559,11 @@ func isNotFoundError(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "item not found")
 }
 
+func isConditionFailed(err error) bool {
+	var conditionErr *types.ConditionalCheckFailedException
+	return errors.As(err, &conditionErr)
+}
+
 func isIndexNotFound(err error) bool {
 	return err != nil && strings.Contains(strings.ToLower(err.Error()), "index does not exist")
 }
@@ -0,0 +1,125 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"chat-app-backend/internal/model"
+)
+
+type RoutingStrategy string
+
+const (
+	RoutingStrategyManual     RoutingStrategy = "manual"
+	RoutingStrategyRoundRobin RoutingStrategy = "round_robin"
+	RoutingStrategyLeastOpen  RoutingStrategy = "least_open"
+)
+
+type RoutingSettings struct {
+	Strategy RoutingStrategy
+}
+
+type RoutingSettingsInput struct {
+	Strategy string
+}
+
+func defaultRoutingSettings() RoutingSettings {
+	return RoutingSettings{
+		Strategy: RoutingStrategyManual,
+	}
+}
+
+func RoutingSettingsFromTenant(tenant model.TenantItem) RoutingSettings {
+	return routingSettingsFromMap(tenant.Settings)
+}
+
+func routingSettingsFromMap(settings map[string]interface{}) RoutingSettings {
+	result := defaultRoutingSettings()
+	if settings == nil {
+		return result
+	}
+
+	routingRaw, ok := settings["routing"]
+	if !ok {
+		return result
+	}
+
+	routingMap, ok := routingRaw.(map[string]interface{})
+	if !ok {
+		return result
+	}
+
+	if val, ok := routingMap["strategy"].(string); ok {
+		if strategy, valid := parseRoutingStrategy(val); valid {
+			result.Strategy = strategy
+		}
+	}
+
+	return result
+}
+
+func parseRoutingStrategy(value string) (RoutingStrategy, bool) {
+	switch RoutingStrategy(strings.ToLower(strings.TrimSpace(value))) {
+	case RoutingStrategyManual:
+		return RoutingStrategyManual, true
+	case RoutingStrategyRoundRobin:
+		return RoutingStrategyRoundRobin, true
+	case RoutingStrategyLeastOpen:
+		return RoutingStrategyLeastOpen, true
+	default:
+		return "", false
+	}
+}
+
+func (r RoutingSettings) toMap() map[string]interface{} {
+	return map[string]interface{}{
+		"strategy": string(r.Strategy),
+	}
+}
+
+func normalizeRoutingSettings(input RoutingSettingsInput) (RoutingSettings, error) {
+	settings := defaultRoutingSettings()
+
+	if trimmed := strings.TrimSpace(input.Strategy); trimmed != "" {
+		strategy, ok := parseRoutingStrategy(trimmed)
+		if !ok {
+			return RoutingSettings{}, newError(ErrorCodeValidation, "strategy must be one of manual, round_robin or least_open", nil)
+		}
+		settings.Strategy = strategy
+	}
+
+	return settings, nil
+}
+
+func (s *Service) GetRoutingSettings(ctx context.Context, identity Identity, tenantID string) (RoutingSettings, error) {
+	_, tenant, err := s.ensureOwnerAccess(ctx, identity, tenantID)
+	if err != nil {
+		return RoutingSettings{}, err
+	}
+	return routingSettingsFromMap(tenant.Settings), nil
+}
+
+func (s *Service) UpdateRoutingSettings(ctx context.Context, identity Identity, tenantID string, params RoutingSettingsInput) (RoutingSettings, error) {
+	_, tenant, err := s.ensureOwnerAccess(ctx, identity, tenantID)
+	if err != nil {
+		return RoutingSettings{}, err
+	}
+
+	normalized, err := normalizeRoutingSettings(params)
+	if err != nil {
+		return RoutingSettings{}, err
+	}
+
+	nextSettings := cloneSettings(tenant.Settings)
+	nextSettings["routing"] = normalized.toMap()
+
+	if _, err := s.repo.UpdateTenantSettings(ctx, tenant.TenantID, nextSettings); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			return RoutingSettings{}, newError(ErrorCodeNotFound, "tenant not found", err)
+		}
+		return RoutingSettings{}, newError(ErrorCodeInternal, "failed to update routing settings", err)
+	}
+
+	return normalized, nil
+}
@@ -18,6 +18,7 @@ type memoryRepository struct {
 	usersByEmail map[string]map[string]string
 	invites      map[string]model.TenantInviteItem
 	keys         map[string]map[string]model.TenantAPIKeyItem
+	canned       map[string]model.CannedResponseItem
 }
 
 func newMemoryRepository() *memoryRepository {
@@ -27,6 +28,7 @@ func newMemoryRepository() *memoryRepository {
 		usersByEmail: make(map[string]map[string]string),
 		invites:      make(map[string]model.TenantInviteItem),
 		keys:         make(map[string]map[string]model.TenantAPIKeyItem),
+		canned:       make(map[string]model.CannedResponseItem),
 	}
 }
 
@@ -257,6 +259,65 @@ func (m *memoryRepository) GetTenantAPIKey(ctx context.Context, tenantID, keyID
 	return model.TenantAPIKeyItem{}, ErrNotFound
 }
 
+func (m *memoryRepository) ListCannedResponses(ctx context.Context, tenantID string) ([]model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	responses := make([]model.CannedResponseItem, 0)
+	for _, item := range m.canned {
+		if item.TenantID == tenantID {
+			responses = append(responses, item)
+		}
+	}
+	return responses, nil
+}
+
+func (m *memoryRepository) GetCannedResponse(ctx context.Context, tenantID, responseID string) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	item, ok := m.canned[responseID]
+	if !ok || item.TenantID != tenantID {
+		return model.CannedResponseItem{}, ErrNotFound
+	}
+	return item, nil
+}
+
+func (m *memoryRepository) CreateCannedResponse(ctx context.Context, item model.CannedResponseItem) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.canned[item.ResponseID] = item
+	return nil
+}
+
+func (m *memoryRepository) UpdateCannedResponse(ctx context.Context, item model.CannedResponseItem) (model.CannedResponseItem, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	existing, ok := m.canned[item.ResponseID]
+	if !ok || existing.TenantID != item.TenantID {
+		return model.CannedResponseItem{}, ErrNotFound
+	}
+	existing.Title = item.Title
+	existing.Shortcut = item.Shortcut
+	existing.Folder = item.Folder
+	existing.Body = item.Body
+	existing.UpdatedAt = item.UpdatedAt
+	m.canned[item.ResponseID] = existing
+	return existing, nil
+}
+
+func (m *memoryRepository) DeleteCannedResponse(ctx context.Context, tenantID, responseID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if item, ok := m.canned[responseID]; ok && item.TenantID == tenantID {
+		delete(m.canned, responseID)
+	}
+	return nil
+}
+
 func (m *memoryRepository) GetTenantByAPIKey(ctx context.Context, apiKey string) (model.TenantItem, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -507,6 +568,63 @@ func TestPublicWidgetSettings(t *testing.T) {
 	}
 }
 
+func TestUpdateRoutingSettingsPreservesWidget(t *testing.T) {
+	repo := newMemoryRepository()
+	service := newService(repo)
+
+	now := fixedNow().Format(time.RFC3339)
+	tenant := model.TenantItem{
+		TenantID: "tenant-1",
+		Name:     "Acme",
+		Plan:     "starter",
+		Seats:    1,
+		Created:  now,
+		Settings: map[string]interface{}{
+			"widget": map[string]interface{}{
+				"bubbleText": "Chat with Acme",
+			},
+		},
+	}
+	repo.tenants[tenant.TenantID] = tenant
+
+	owner := model.UserItem{
+		PK:        model.TenantScopedPK(tenant.TenantID, "owner-1"),
+		TenantID:  tenant.TenantID,
+		UserID:    "owner-1",
+		Email:     "owner@example.com",
+		Role:      "owner",
+		Status:    "active",
+		CreatedAt: now,
+	}
+	repo.CreateUser(context.Background(), owner)
+
+	identity := Identity{UserID: owner.UserID, TenantID: tenant.TenantID, Email: owner.Email}
+
+	if _, err := service.UpdateRoutingSettings(context.Background(), identity, tenant.TenantID, RoutingSettingsInput{
+		Strategy: "sticky",
+	}); err == nil {
+		t.Fatal("expected validation error for unknown strategy")
+	}
+
+	settings, err := service.UpdateRoutingSettings(context.Background(), identity, tenant.TenantID, RoutingSettingsInput{
+		Strategy: "round_robin",
+	})
+	if err != nil {
+		t.Fatalf("UpdateRoutingSettings error: %v", err)
+	}
+	if settings.Strategy != RoutingStrategyRoundRobin {
+		t.Fatalf("unexpected strategy %s", settings.Strategy)
+	}
+
+	saved := repo.tenants[tenant.TenantID]
+	if RoutingSettingsFromTenant(saved).Strategy != RoutingStrategyRoundRobin {
+		t.Fatalf("repository not updated: %+v", saved.Settings)
+	}
+	if widget := WidgetSettingsFromTenant(saved); widget.BubbleText != "Chat with Acme" {
+		t.Fatalf("widget settings lost: %+v", widget)
+	}
+}
+
 func TestListTenantAPIKeys(t *testing.T) {
 	repo := newMemoryRepository()
 	service := newService(repo)
@@ -1620,3 +1738,174 @@ func TestAddUserRequiresOwner(t *testing.T) {
 		t.Fatalf("expected forbidden error, got %v", err)
 	}
 }
+
+func TestUpdateAttachmentSettings(t *testing.T) {
+	repo := newMemoryRepository()
+	service := newService(repo)
+
+	now := fixedNow().Format(time.RFC3339)
+	tenant := model.TenantItem{
+		TenantID: "tenant-1",
+		Name:     "Acme",
+		Plan:     "starter",
+		Seats:    1,
+		Created:  now,
+	}
+	repo.tenants[tenant.TenantID] = tenant
+
+	owner := model.UserItem{
+		PK:        model.TenantScopedPK(tenant.TenantID, "owner-1"),
+		TenantID:  tenant.TenantID,
+		UserID:    "owner-1",
+		Email:     "owner@example.com",
+		Role:      "owner",
+		Status:    "active",
+		CreatedAt: now,
+	}
+	repo.CreateUser(context.Background(), owner)
+
+	identity := Identity{UserID: owner.UserID, TenantID: tenant.TenantID, Email: owner.Email}
+
+	defaults, err := service.GetAttachmentSettings(context.Background(), identity, tenant.TenantID)
+	if err != nil {
+		t.Fatalf("GetAttachmentSettings error: %v", err)
+	}
+	if defaults.MaxBytes != DefaultAttachmentMaxBytes || !defaults.Allows("image/png") || defaults.Allows("application/zip") {
+		t.Fatalf("unexpected default settings %+v", defaults)
+	}
+
+	if _, err := service.UpdateAttachmentSettings(context.Background(), identity, tenant.TenantID, AttachmentSettingsInput{
+		MaxBytes: MaxAttachmentBytes + 1,
+	}); err == nil {
+		t.Fatal("expected validation error for a limit above the maximum")
+	}
+	if _, err := service.UpdateAttachmentSettings(context.Background(), identity, tenant.TenantID, AttachmentSettingsInput{
+		AllowedTypes: []string{"images"},
+	}); err == nil {
+		t.Fatal("expected validation error for a malformed type")
+	}
+
+	settings, err := service.UpdateAttachmentSettings(context.Background(), identity, tenant.TenantID, AttachmentSettingsInput{
+		MaxBytes:     1 << 20,
+		AllowedTypes: []string{" Image/* ", "application/pdf", "image/*"},
+	})
+	if err != nil {
+		t.Fatalf("UpdateAttachmentSettings error: %v", err)
+	}
+	if len(settings.AllowedTypes) != 2 {
+		t.Fatalf("expected normalized, deduplicated types, got %v", settings.AllowedTypes)
+	}
+
+	saved := AttachmentSettingsFromTenant(repo.tenants[tenant.TenantID])
+	if saved.MaxBytes != 1<<20 {
+		t.Fatalf("repository not updated: %+v", saved)
+	}
+	if !saved.Allows("image/heic") || !saved.Allows("application/pdf") || saved.Allows("text/plain") {
+		t.Fatalf("unexpected allowed types %v", saved.AllowedTypes)
+	}
+}
+
+func TestCannedResponses(t *testing.T) {
+	repo := newMemoryRepository()
+	service := newService(repo)
+	ctx := context.Background()
+
+	now := fixedNow().Format(time.RFC3339)
+	repo.tenants["tenant-1"] = model.TenantItem{TenantID: "tenant-1", Name: "Acme", Plan: "starter", Seats: 3, Created: now}
+	for _, user := range []model.UserItem{
+		{UserID: "owner-1", Email: "owner@example.com", Role: "owner"},
+		{UserID: "member-1", Email: "member@example.com", Role: "member"},
+		{UserID: "member-2", Email: "other@example.com", Role: "member"},
+	} {
+		user.PK = model.TenantScopedPK("tenant-1", user.UserID)
+		user.TenantID = "tenant-1"
+		user.Status = "active"
+		user.CreatedAt = now
+		repo.CreateUser(ctx, user)
+	}
+	owner := Identity{UserID: "owner-1", TenantID: "tenant-1"}
+	member := Identity{UserID: "member-1", TenantID: "tenant-1"}
+	other := Identity{UserID: "member-2", TenantID: "tenant-1"}
+
+	if _, err := service.CreateCannedResponse(ctx, member, CannedResponseInput{Title: "Hi", Body: "Hello {{visitor.phone}}"}); err == nil {
+		t.Fatal("expected unknown placeholder to be rejected")
+	}
+	if _, err := service.CreateCannedResponse(ctx, member, CannedResponseInput{Title: "Hi", Shortcut: "two words", Body: "Hello"}); err == nil {
+		t.Fatal("expected invalid shortcut to be rejected")
+	}
+
+	greeting, err := service.CreateCannedResponse(ctx, member, CannedResponseInput{
+		Title:    "Greeting",
+		Shortcut: "/Hello",
+		Folder:   "Sales",
+		Body:     "Hi {{visitor.name|there}}, {{ agent.name }} here.",
+	})
+	if err != nil {
+		t.Fatalf("CreateCannedResponse error: %v", err)
+	}
+	if greeting.Shortcut != "hello" || greeting.CreatedBy != member.UserID || greeting.CreatedAt != now {
+		t.Fatalf("unexpected canned response %+v", greeting)
+	}
+	if _, err := service.CreateCannedResponse(ctx, other, CannedResponseInput{Title: "Hey", Shortcut: "hello", Body: "Hey"}); err == nil {
+		t.Fatal("expected duplicate shortcut to conflict")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeConflict {
+		t.Fatalf("expected conflict error, got %v", err)
+	}
+	if _, err := service.CreateCannedResponse(ctx, other, CannedResponseInput{Title: "Refunds", Folder: "Billing", Body: "We refund within 14 days."}); err != nil {
+		t.Fatalf("CreateCannedResponse error: %v", err)
+	}
+
+	all, err := service.ListCannedResponses(ctx, member, "")
+	if err != nil {
+		t.Fatalf("ListCannedResponses error: %v", err)
+	}
+	if len(all) != 2 || all[0].Folder != "Billing" || all[1].Folder != "Sales" {
+		t.Fatalf("expected responses ordered by folder, got %+v", all)
+	}
+	sales, err := service.ListCannedResponses(ctx, member, "sales")
+	if err != nil || len(sales) != 1 || sales[0].ResponseID != greeting.ResponseID {
+		t.Fatalf("expected only the sales folder, got %+v (%v)", sales, err)
+	}
+
+	if _, err := service.UpdateCannedResponse(ctx, other, greeting.ResponseID, CannedResponseInput{Title: "Mine", Body: "Mine"}); err == nil {
+		t.Fatal("expected another member's edit to be forbidden")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeForbidden {
+		t.Fatalf("expected forbidden error, got %v", err)
+	}
+
+	repo.canned[greeting.ResponseID] = func(item model.CannedResponseItem) model.CannedResponseItem {
+		item.UsageCount = 4
+		return item
+	}(repo.canned[greeting.ResponseID])
+	updated, err := service.UpdateCannedResponse(ctx, owner, greeting.ResponseID, CannedResponseInput{Title: "Welcome", Shortcut: "hello", Body: "Welcome!"})
+	if err != nil {
+		t.Fatalf("UpdateCannedResponse error: %v", err)
+	}
+	if updated.Title != "Welcome" || updated.Folder != "" || updated.UsageCount != 4 || updated.UpdatedAt != now {
+		t.Fatalf("unexpected updated response %+v", updated)
+	}
+
+	if err := service.DeleteCannedResponse(ctx, other, greeting.ResponseID); err == nil {
+		t.Fatal("expected another member's delete to be forbidden")
+	}
+	if err := service.DeleteCannedResponse(ctx, member, greeting.ResponseID); err != nil {
+		t.Fatalf("DeleteCannedResponse error: %v", err)
+	}
+	if err := service.DeleteCannedResponse(ctx, member, greeting.ResponseID); err == nil {
+		t.Fatal("expected deleting a missing response to fail")
+	} else if svcErr, ok := err.(*Error); !ok || svcErr.Code != ErrorCodeNotFound {
+		t.Fatalf("expected not found error, got %v", err)
+	}
+}
+
+func TestRenderCannedResponse(t *testing.T) {
+	body := "Hi {{visitor.name|there}}, this is {{ agent.name }}. We will write to {{visitor.email}}."
+	got := RenderCannedResponse(body, map[string]string{
+		PlaceholderAgentName:    "Ana",
+		PlaceholderVisitorEmail: "jo@example.com",
+	})
+	want := "Hi there, this is Ana. We will write to jo@example.com."
+	if got != want {
+		t.Fatalf("RenderCannedResponse = %q, want %q", got, want)
+	}
+}
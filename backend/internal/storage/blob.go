@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"chat-app-backend/internal/env"
+)
+
+// Blob store kinds selectable through CHAT_BLOB_STORE.
+const (
+	BlobStoreLocal = "local"
+	BlobStoreS3    = "s3"
+)
+
+const defaultBlobDir = "data/attachments"
+
+var (
+	// ErrNotFound is returned for keys that hold no blob.
+	ErrNotFound = errors.New("storage: blob not found")
+	// ErrInvalidKey is returned for keys that are empty or leave the store.
+	ErrInvalidKey = errors.New("storage: invalid blob key")
+	// ErrSizeMismatch is returned by Put when the body is shorter or longer
+	// than the size it was stored with.
+	ErrSizeMismatch = errors.New("storage: blob size mismatch")
+)
+
+// BlobStore keeps the contents of message attachments. Keys are
+// slash-separated paths such as tenant/conversation/attachment.
+type BlobStore interface {
+	// Put stores size bytes read from body under key.
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error
+	// Delete removes the blob of key. Deleting a missing blob is not an error.
+	Delete(ctx context.Context, key string) error
+	// SignedURL returns a URL anyone holding it can download the blob of key
+	// from until it expires.
+	SignedURL(ctx context.Context, key string, opts URLOptions) (string, error)
+}
+
+// URLOptions describes a signed download URL. ContentType and FileName are
+// sent back with the download so browsers name and render it right.
+type URLOptions struct {
+	TTL         time.Duration
+	ContentType string
+	FileName    string
+}
+
+// NewBlobStoreFromEnv returns the blob store selected by CHAT_BLOB_STORE. The
+// local store is the default and keeps blobs under CHAT_BLOB_DIR, signing URLs
+// for the download route at CHAT_BLOB_URL, which must name the public server
+// as browsers reach it. The S3 store keeps them in
+// CHAT_S3_BUCKET, at CHAT_S3_ENDPOINT for S3-compatible services.
+func NewBlobStoreFromEnv() (BlobStore, error) {
+	switch kind := env.GetOrDefault(env.BlobStore, BlobStoreLocal); kind {
+	case BlobStoreLocal:
+		baseURL := env.Get(env.BlobURL)
+		if baseURL == "" {
+			return nil, fmt.Errorf("storage: %s is required by the %s blob store", env.BlobURL, BlobStoreLocal)
+		}
+		return NewLocalStore(
+			env.GetOrDefault(env.BlobDir, defaultBlobDir),
+			baseURL,
+			[]byte(env.MustGet(env.UserSecretKey)),
+		)
+	case BlobStoreS3:
+		bucket := env.Get(env.S3Bucket)
+		if bucket == "" {
+			return nil, fmt.Errorf("storage: %s is required by the %s blob store", env.S3Bucket, BlobStoreS3)
+		}
+		return NewS3Store(S3Config{
+			Bucket:          bucket,
+			Endpoint:        env.Get(env.S3Endpoint),
+			Region:          env.GetOrDefault(env.S3Region, env.Get(env.AWSRegion)),
+			AccessKeyID:     env.Get(env.AWSID),
+			SecretAccessKey: env.Get(env.AWSSecret),
+			SessionToken:    env.Get(env.AWSToken),
+		})
+	default:
+		return nil, fmt.Errorf("storage: unknown %s %q", env.BlobStore, kind)
+	}
+}
+
+// validKey reports whether key is a relative slash-separated path without
+// empty, dot or dot-dot segments.
+func validKey(key string) bool {
+	if key == "" || strings.ContainsRune(key, '\\') {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// contentDisposition names a download after fileName.
+func contentDisposition(fileName string) string {
+	if fileName == "" {
+		return ""
+	}
+	return fmt.Sprintf("attachment; filename*=UTF-8''%s", escapeFileName(fileName))
+}
+
+// escapeFileName percent-encodes fileName for the RFC 5987 filename* form.
+func escapeFileName(fileName string) string {
+	var b strings.Builder
+	for _, c := range []byte(fileName) {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '-', c == '_':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidSignature is returned for download URLs that were not signed
+	// by the store or were altered.
+	ErrInvalidSignature = errors.New("storage: invalid download signature")
+	// ErrExpired is returned for download URLs past their expiry.
+	ErrExpired = errors.New("storage: download URL expired")
+)
+
+// LocalStore keeps blobs as files under a directory. Its signed URLs point at
+// a download route, served through Open, that checks their HMAC signature.
+type LocalStore struct {
+	dir     string
+	baseURL string
+	secret  []byte
+	now     func() time.Time
+}
+
+// Download is a blob opened through a signed URL. The caller closes Content.
+type Download struct {
+	Content     *os.File
+	ModTime     time.Time
+	ContentType string
+	FileName    string
+}
+
+// NewLocalStore returns a store keeping blobs under dir, which is created if
+// needed. Signed URLs are baseURL followed by the key, signed with secret.
+func NewLocalStore(dir, baseURL string, secret []byte) (*LocalStore, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("storage: local blob store needs a signing secret")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("storage: create blob directory: %w", err)
+	}
+	return &LocalStore{
+		dir:     dir,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		secret:  secret,
+		now:     time.Now,
+	}, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return fmt.Errorf("storage: create blob directory: %w", err)
+	}
+
+	// The blob is written next to its final path and renamed into place, so
+	// a failed upload never leaves a partial file under the key.
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("storage: create blob: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	written, err := io.Copy(tmp, io.LimitReader(body, size+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("storage: write blob: %w", err)
+	}
+	if written != size {
+		return ErrSizeMismatch
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("storage: store blob: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("storage: delete blob: %w", err)
+	}
+	return nil
+}
+
+func (s *LocalStore) SignedURL(ctx context.Context, key string, opts URLOptions) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	expires := strconv.FormatInt(s.now().Add(opts.TTL).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	if opts.ContentType != "" {
+		query.Set("type", opts.ContentType)
+	}
+	if opts.FileName != "" {
+		query.Set("name", opts.FileName)
+	}
+	query.Set("signature", s.sign(key, expires, opts.ContentType, opts.FileName))
+
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return s.baseURL + "/" + strings.Join(segments, "/") + "?" + query.Encode(), nil
+}
+
+// Open checks the signature in query, as produced by SignedURL, and opens the
+// blob of key.
+func (s *LocalStore) Open(key string, query url.Values) (Download, error) {
+	expires := query.Get("expires")
+	contentType := query.Get("type")
+	fileName := query.Get("name")
+
+	expected := s.sign(key, expires, contentType, fileName)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return Download{}, ErrInvalidSignature
+	}
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return Download{}, ErrInvalidSignature
+	}
+	if s.now().Unix() > expiresAt {
+		return Download{}, ErrExpired
+	}
+
+	path, err := s.path(key)
+	if err != nil {
+		return Download{}, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return Download{}, ErrNotFound
+		}
+		return Download{}, fmt.Errorf("storage: open blob: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return Download{}, fmt.Errorf("storage: stat blob: %w", err)
+	}
+	return Download{
+		Content:     file,
+		ModTime:     info.ModTime(),
+		ContentType: contentType,
+		FileName:    fileName,
+	}, nil
+}
+
+// ContentDisposition is the Content-Disposition header of the download.
+func (d Download) ContentDisposition() string {
+	return contentDisposition(d.FileName)
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, filepath.FromSlash(key)), nil
+}
+
+func (s *LocalStore) sign(key, expires, contentType, fileName string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte("blob\n" + key + "\n" + expires + "\n" + contentType + "\n" + fileName))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"chat-app-backend/internal/env"
+)
+
+func TestLocalStoreSignedURLRoundTrip(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir(), "http://files.test/attachments/", []byte("secret"))
+	if err != nil {
+		t.Fatalf("NewLocalStore error: %v", err)
+	}
+	now := time.Date(2024, 8, 1, 9, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	key := "tenant/conversation/file"
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	if err := store.Put(ctx, "tenant/conversation/short", strings.NewReader("hi"), 5, "text/plain"); !errors.Is(err, ErrSizeMismatch) {
+		t.Fatalf("expected size mismatch, got %v", err)
+	}
+	if err := store.Put(ctx, "../escape", strings.NewReader("x"), 1, "text/plain"); !errors.Is(err, ErrInvalidKey) {
+		t.Fatalf("expected invalid key, got %v", err)
+	}
+
+	signed, err := store.SignedURL(ctx, key, URLOptions{TTL: time.Minute, ContentType: "text/plain", FileName: "notes 1.txt"})
+	if err != nil {
+		t.Fatalf("SignedURL error: %v", err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed URL: %v", err)
+	}
+	if parsed.Path != "/attachments/"+key {
+		t.Fatalf("unexpected signed URL path %q", parsed.Path)
+	}
+
+	download, err := store.Open(key, parsed.Query())
+	if err != nil {
+		t.Fatalf("Open error: %v", err)
+	}
+	body, _ := io.ReadAll(download.Content)
+	download.Content.Close()
+	if string(body) != "hello" || download.ContentType != "text/plain" {
+		t.Fatalf("unexpected download %q %+v", body, download)
+	}
+	if got := download.ContentDisposition(); got != "attachment; filename*=UTF-8''notes%201.txt" {
+		t.Fatalf("unexpected content disposition %q", got)
+	}
+
+	tampered := parsed.Query()
+	tampered.Set("type", "text/html")
+	if _, err := store.Open(key, tampered); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected tampered URL to be rejected, got %v", err)
+	}
+	if _, err := store.Open("tenant/conversation/other", parsed.Query()); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("expected URL for another key to be rejected, got %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if _, err := store.Open(key, parsed.Query()); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected expired URL to be rejected, got %v", err)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("expected deleting a missing blob to succeed, got %v", err)
+	}
+	now = now.Add(-2 * time.Minute)
+	if _, err := store.Open(key, parsed.Query()); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected deleted blob to be missing, got %v", err)
+	}
+}
+
+func TestNewBlobStoreFromEnvRequiresLocalBlobURL(t *testing.T) {
+	t.Setenv(env.BlobStore, BlobStoreLocal)
+	t.Setenv(env.BlobDir, t.TempDir())
+	t.Setenv(env.UserSecretKey, "secret")
+	t.Setenv(env.BlobURL, "")
+
+	if _, err := NewBlobStoreFromEnv(); err == nil || !strings.Contains(err.Error(), env.BlobURL) {
+		t.Fatalf("expected the local store to require %s, got %v", env.BlobURL, err)
+	}
+
+	t.Setenv(env.BlobURL, "http://localhost:82/api/public/v1/attachments")
+	if _, err := NewBlobStoreFromEnv(); err != nil {
+		t.Fatalf("NewBlobStoreFromEnv error: %v", err)
+	}
+}
@@ -0,0 +1,157 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// maxPresignTTL is the longest validity S3 accepts for a presigned URL.
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// S3Config locates the bucket of an S3Store. Endpoint is set for
+// S3-compatible services such as MinIO, which are addressed path-style;
+// without it the bucket is addressed on AWS virtual-host style. Without
+// an access key the default AWS credential chain is used.
+type S3Config struct {
+	Bucket          string
+	Endpoint        string
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// S3Store keeps blobs in an S3 bucket. Downloads go straight to the bucket
+// through presigned URLs.
+type S3Store struct {
+	bucket    string
+	client    *s3.Client
+	presigner *s3.PresignClient
+}
+
+func NewS3Store(config S3Config) (*S3Store, error) {
+	if config.Bucket == "" {
+		return nil, errors.New("storage: S3 blob store needs a bucket")
+	}
+	if config.Region == "" {
+		return nil, errors.New("storage: S3 blob store needs a region")
+	}
+
+	cfg, err := loadS3Config(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+			o.UsePathStyle = true
+			// S3-compatible services may not take the checksums the SDK
+			// adds by default, and cannot be sent trailing ones over HTTP.
+			o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		}
+	})
+	return &S3Store{
+		bucket:    config.Bucket,
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+	}, nil
+}
+
+func loadS3Config(config S3Config) (aws.Config, error) {
+	loadOpts := []func(*awsconfig.LoadOptions) error{
+		awsconfig.WithRegion(config.Region),
+	}
+	if config.AccessKeyID != "" && config.SecretAccessKey != "" {
+		loadOpts = append(loadOpts, awsconfig.WithCredentialsProvider(
+			aws.NewCredentialsCache(credentials.NewStaticCredentialsProvider(config.AccessKeyID, config.SecretAccessKey, config.SessionToken)),
+		))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(context.Background(), loadOpts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("storage: load aws config: %w", err)
+	}
+	return cfg, nil
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          io.LimitReader(body, size),
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	// The body is streamed, so it is sent unsigned rather than read twice
+	// to hash it.
+	_, err := s.client.PutObject(ctx, input, s3.WithAPIOptions(v4.SwapComputePayloadSHA256ForUnsignedPayloadMiddleware))
+	if err != nil {
+		return fmt.Errorf("storage: put blob: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if !validKey(key) {
+		return ErrInvalidKey
+	}
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("storage: delete blob: %w", err)
+	}
+	return nil
+}
+
+func (s *S3Store) SignedURL(ctx context.Context, key string, opts URLOptions) (string, error) {
+	if !validKey(key) {
+		return "", ErrInvalidKey
+	}
+	ttl := opts.TTL
+	if ttl <= 0 || ttl > maxPresignTTL {
+		ttl = maxPresignTTL
+	}
+
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}
+	if opts.ContentType != "" {
+		input.ResponseContentType = aws.String(opts.ContentType)
+	}
+	if disposition := contentDisposition(opts.FileName); disposition != "" {
+		input.ResponseContentDisposition = aws.String(disposition)
+	}
+
+	signed, err := s.presigner.PresignGetObject(ctx, input, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("storage: presign download: %w", err)
+	}
+	return signed.URL, nil
+}
+
+// isNotFound reports whether S3 answered err with 404, which some
+// S3-compatible services send for deleting a missing object.
+func isNotFound(err error) bool {
+	var respErr *awshttp.ResponseError
+	return errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusNotFound
+}
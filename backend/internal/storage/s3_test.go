@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestS3StoreSignsRequestsAndPresignsDownloads(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		objects = map[string]string{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-central-1/s3/aws4_request") {
+			http.Error(w, "unsigned request", http.StatusForbidden)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = r.Header.Get("Content-Type") + ":" + string(body)
+			w.WriteHeader(http.StatusOK)
+		case http.MethodDelete:
+			if _, ok := objects[r.URL.Path]; !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			delete(objects, r.URL.Path)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{
+		Bucket:          "chat-files",
+		Endpoint:        server.URL + "/",
+		Region:          "eu-central-1",
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+	})
+	if err != nil {
+		t.Fatalf("NewS3Store error: %v", err)
+	}
+
+	ctx := context.Background()
+	key := "tenant/conversation/file"
+	if err := store.Put(ctx, key, strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatalf("Put error: %v", err)
+	}
+	mu.Lock()
+	stored := objects["/chat-files/"+key]
+	mu.Unlock()
+	if stored != "text/plain:hello" {
+		t.Fatalf("unexpected stored object %q", stored)
+	}
+
+	signed, err := store.SignedURL(ctx, key, URLOptions{TTL: 30 * 24 * time.Hour, ContentType: "text/plain", FileName: "notes.txt"})
+	if err != nil {
+		t.Fatalf("SignedURL error: %v", err)
+	}
+	parsed, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed URL: %v", err)
+	}
+	query := parsed.Query()
+	if parsed.Path != "/chat-files/"+key || query.Get("X-Amz-Signature") == "" || query.Get("X-Amz-Expires") != "604800" {
+		t.Fatalf("unexpected presigned URL %q", signed)
+	}
+	if query.Get("response-content-type") != "text/plain" || query.Get("response-content-disposition") != "attachment; filename*=UTF-8''notes.txt" {
+		t.Fatalf("expected the download headers in the presigned URL, got %q", signed)
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete error: %v", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("expected deleting a missing object to succeed, got %v", err)
+	}
+}
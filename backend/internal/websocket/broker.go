@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+
+	"chat-app-backend/internal/env"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Broker kinds selectable through CHAT_BROKER.
+const (
+	BrokerRedis  = "redis"
+	BrokerMemory = "memory"
+)
+
+// Broker carries room events between the servers and keeps the room logs
+// reconnecting clients replay from.
+type Broker interface {
+	// Publish appends event to the log of roomID and delivers it to the
+	// subscribers of the room. It returns the event with its sequence number
+	// set.
+	Publish(ctx context.Context, roomID string, event Event) (Event, error)
+	// PublishEphemeral delivers event without logging it. It is meant for
+	// events such as typing that are not replayed.
+	PublishEphemeral(ctx context.Context, roomID string, event Event) error
+	// Since returns the logged events of roomID after lastSeq and the current
+	// sequence of the room. It reports resync when the log can no longer fill
+	// the gap and the client has to reload its state.
+	Since(ctx context.Context, roomID string, lastSeq int64) ([]Event, int64, bool, error)
+	// Subscribe calls handle with every payload published to a room whose ID
+	// matches the glob pattern, until ctx is done or the subscription fails.
+	Subscribe(ctx context.Context, pattern string, handle func(roomID, payload string)) error
+}
+
+// NewBrokerFromEnv returns the broker selected by CHAT_BROKER. The Redis
+// broker is the default and connects to CHAT_REDIS_URL. The memory broker is
+// refused: it only reaches subscribers in the same process, and the client,
+// public and websocket servers each run in their own.
+func NewBrokerFromEnv() (Broker, error) {
+	switch kind := env.GetOrDefault(env.ChatBroker, BrokerRedis); kind {
+	case BrokerRedis:
+		addr := env.Get(env.ChatRedisURL)
+		if addr == "" {
+			return nil, fmt.Errorf("websocket broker: %s is required by the %s broker", env.ChatRedisURL, BrokerRedis)
+		}
+		return NewRedisBroker(redis.NewClient(&redis.Options{
+			Addr:     addr,
+			Password: env.Get(env.ChatRedisPass),
+			DB:       0,
+		})), nil
+	case BrokerMemory:
+		return nil, fmt.Errorf("websocket broker: the %s broker cannot connect the client, public and websocket servers, which run as separate processes; set %s=%s", BrokerMemory, env.ChatBroker, BrokerRedis)
+	default:
+		return nil, fmt.Errorf("websocket broker: unknown %s %q", env.ChatBroker, kind)
+	}
+}
@@ -0,0 +1,191 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+)
+
+// memorySubscriberBuffer is how many payloads a memory subscriber may fall
+// behind before it is cut off, like Redis does with slow pub/sub clients.
+const memorySubscriberBuffer = 1024
+
+// MemoryBroker is a Broker for a single process. It lets tests run the
+// realtime path without Redis.
+type MemoryBroker struct {
+	mu          sync.Mutex
+	now         func() time.Time
+	size        int
+	ttl         time.Duration
+	rooms       map[string]*memoryRoomLog
+	subscribers map[*memorySubscriber]struct{}
+	nextPrune   time.Time
+	// presence and tickets are shared by everything built on this broker,
+	// the way their Redis stores are shared by every replica.
+	presence PresenceStore
+	tickets  TicketStore
+}
+
+type memoryRoomLog struct {
+	seq       int64
+	events    []Event
+	expiresAt time.Time
+}
+
+type memorySubscriber struct {
+	pattern  string
+	messages chan memoryMessage
+}
+
+type memoryMessage struct {
+	roomID  string
+	payload string
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		now:         time.Now,
+		size:        eventLogSize,
+		ttl:         eventLogTTL,
+		rooms:       make(map[string]*memoryRoomLog),
+		subscribers: make(map[*memorySubscriber]struct{}),
+		presence:    NewMemoryPresenceStore(),
+		tickets:     NewMemoryTicketStore(time.Now),
+	}
+}
+
+func (b *MemoryBroker) Publish(ctx context.Context, roomID string, event Event) (Event, error) {
+	if roomID == "" {
+		return event, fmt.Errorf("websocket publish: roomID required")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	b.pruneLocked(now)
+	room := b.roomLocked(roomID, now)
+	if room == nil {
+		room = &memoryRoomLog{}
+		b.rooms[roomID] = room
+	}
+	room.seq++
+	event.Seq = room.seq
+	room.events = append(room.events, event)
+	if len(room.events) > b.size {
+		room.events = append([]Event(nil), room.events[len(room.events)-b.size:]...)
+	}
+	room.expiresAt = now.Add(b.ttl)
+
+	return event, b.deliverLocked(roomID, event)
+}
+
+func (b *MemoryBroker) PublishEphemeral(ctx context.Context, roomID string, event Event) error {
+	if roomID == "" {
+		return fmt.Errorf("websocket publish: roomID required")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.deliverLocked(roomID, event)
+}
+
+func (b *MemoryBroker) Since(ctx context.Context, roomID string, lastSeq int64) ([]Event, int64, bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	room := b.roomLocked(roomID, b.now())
+	if room == nil {
+		missed, resync := replayWindow(lastSeq, 0, nil)
+		return missed, 0, resync, nil
+	}
+
+	var events []Event
+	for _, event := range room.events {
+		if event.Seq > lastSeq {
+			events = append(events, event)
+		}
+	}
+	missed, resync := replayWindow(lastSeq, room.seq, events)
+	return missed, room.seq, resync, nil
+}
+
+func (b *MemoryBroker) Subscribe(ctx context.Context, pattern string, handle func(roomID, payload string)) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("websocket subscribe: %w", err)
+	}
+
+	subscriber := &memorySubscriber{
+		pattern:  pattern,
+		messages: make(chan memoryMessage, memorySubscriberBuffer),
+	}
+	b.mu.Lock()
+	b.subscribers[subscriber] = struct{}{}
+	b.mu.Unlock()
+
+	defer func() {
+		b.mu.Lock()
+		delete(b.subscribers, subscriber)
+		b.mu.Unlock()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-subscriber.messages:
+			if !ok {
+				return fmt.Errorf("websocket subscribe: subscriber fell behind")
+			}
+			handle(msg.roomID, msg.payload)
+		}
+	}
+}
+
+// roomLocked returns the log of roomID, or nil when it has none or it expired.
+func (b *MemoryBroker) roomLocked(roomID string, now time.Time) *memoryRoomLog {
+	room, ok := b.rooms[roomID]
+	if !ok || !now.Before(room.expiresAt) {
+		return nil
+	}
+	return room
+}
+
+// pruneLocked drops the logs that expired, at most once per TTL.
+func (b *MemoryBroker) pruneLocked(now time.Time) {
+	if now.Before(b.nextPrune) {
+		return
+	}
+	for roomID, room := range b.rooms {
+		if !now.Before(room.expiresAt) {
+			delete(b.rooms, roomID)
+		}
+	}
+	b.nextPrune = now.Add(b.ttl)
+}
+
+// deliverLocked queues event for every subscriber of roomID. Subscribers whose
+// queue is full are cut off; their Subscribe call returns an error.
+func (b *MemoryBroker) deliverLocked(roomID string, event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("websocket publish: marshal event: %w", err)
+	}
+
+	msg := memoryMessage{roomID: roomID, payload: string(payload)}
+	for subscriber := range b.subscribers {
+		if matched, _ := path.Match(subscriber.pattern, roomID); !matched {
+			continue
+		}
+		select {
+		case subscriber.messages <- msg:
+		default:
+			delete(b.subscribers, subscriber)
+			close(subscriber.messages)
+		}
+	}
+	return nil
+}
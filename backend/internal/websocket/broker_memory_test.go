@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"chat-app-backend/internal/env"
+)
+
+// waitForSubscribers blocks until broker has count subscribers.
+func waitForSubscribers(t *testing.T, broker *MemoryBroker, count int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		broker.mu.Lock()
+		subscribed := len(broker.subscribers)
+		broker.mu.Unlock()
+		if subscribed == count {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("expected %d subscribers", count)
+}
+
+func TestMemoryBrokerSequencesAndReplays(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	broker := NewMemoryBroker()
+	broker.now = func() time.Time { return now }
+	broker.size = 3
+
+	for i := 1; i <= 4; i++ {
+		event, err := broker.Publish(ctx, "conv-1", Event{Type: EventMessageCreated, ID: "e"})
+		if err != nil {
+			t.Fatalf("Publish error: %v", err)
+		}
+		if event.Seq != int64(i) {
+			t.Fatalf("expected seq %d, got %d", i, event.Seq)
+		}
+	}
+
+	missed, current, resync, err := broker.Since(ctx, "conv-1", 2)
+	if err != nil || resync || current != 4 || len(missed) != 2 || missed[0].Seq != 3 {
+		t.Fatalf("unexpected replay %+v current %d resync %v err %v", missed, current, resync, err)
+	}
+	if _, _, resync, _ := broker.Since(ctx, "conv-1", 0); !resync {
+		t.Fatal("expected resync once the gap was trimmed from the log")
+	}
+	if missed, _, resync, _ := broker.Since(ctx, "conv-2", 0); resync || len(missed) != 0 {
+		t.Fatal("expected nothing to replay in a room without events")
+	}
+
+	now = now.Add(eventLogTTL)
+	if _, current, resync, _ := broker.Since(ctx, "conv-1", 4); !resync || current != 0 {
+		t.Fatalf("expected an expired log to require a resync, got current %d", current)
+	}
+}
+
+func TestMemoryBrokerSubscribeMatchesPatterns(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	broker := NewMemoryBroker()
+
+	received := make(chan string, 10)
+	done := make(chan error, 1)
+	go func() {
+		done <- broker.Subscribe(ctx, tenantNotificationPattern, func(roomID, payload string) {
+			received <- roomID
+		})
+	}()
+	waitForSubscribers(t, broker, 1)
+
+	if _, err := broker.Publish(ctx, "conv-1", Event{Type: EventMessageCreated, ID: "e1"}); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+	if err := broker.PublishEphemeral(ctx, TenantNotificationRoomID("tenant-1"), Event{Type: EventTypingStart, ID: "e2"}); err != nil {
+		t.Fatalf("PublishEphemeral error: %v", err)
+	}
+	if roomID := <-received; roomID != "tenant:tenant-1:notifications" {
+		t.Fatalf("expected only the notification room, got %s", roomID)
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("expected Subscribe to stop with ctx, got %v", err)
+	}
+	waitForSubscribers(t, broker, 0)
+}
+
+func TestHandlerRelaysBrokerEventsToRoomClients(t *testing.T) {
+	broker := NewMemoryBroker()
+	hub := newTestHub(nil)
+	handler := NewHandler(hub, broker)
+	go handler.RelayRoomEvents()
+	waitForSubscribers(t, broker, 1)
+
+	client := newHubTestClient("conv-1", "agent-1", "conn-1")
+	hub.Register <- client
+
+	event, err := NewEvent(EventMessageRead, time.Now(), ReadEvent{ConversationID: "conv-1"})
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+	if _, err := broker.Publish(context.Background(), "conv-1", event); err != nil {
+		t.Fatalf("Publish error: %v", err)
+	}
+
+	select {
+	case msg := <-client.Message:
+		if msg.Event == nil || msg.Event.ID != event.ID || msg.Event.Seq != 1 {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the published event to reach the room")
+	}
+}
+
+func TestNewBrokerFromEnvRefusesMemoryBroker(t *testing.T) {
+	t.Setenv(env.ChatBroker, BrokerMemory)
+	broker, err := NewBrokerFromEnv()
+	if err == nil || broker != nil {
+		t.Fatalf("expected the memory broker to be refused, got %v", broker)
+	}
+	if !strings.Contains(err.Error(), "separate processes") {
+		t.Fatalf("expected the error to explain why, got %v", err)
+	}
+}
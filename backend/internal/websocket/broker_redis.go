@@ -0,0 +1,94 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// roomChannelPrefix namespaces the Redis channels of rooms, so that a
+// subscriber can follow all of them with a single pattern.
+const roomChannelPrefix = "ws:room:"
+
+// roomChannel is the Redis channel events of roomID are published on.
+func roomChannel(roomID string) string {
+	return roomChannelPrefix + roomID
+}
+
+// roomFromChannel returns the room a channel built by roomChannel belongs to.
+func roomFromChannel(channel string) (string, bool) {
+	roomID := strings.TrimPrefix(channel, roomChannelPrefix)
+	if roomID == "" || roomID == channel {
+		return "", false
+	}
+	return roomID, true
+}
+
+// RedisBroker publishes room events on Redis channels and keeps the room logs
+// in Redis, so every replica sees every event.
+type RedisBroker struct {
+	client *redis.Client
+	events *eventLog
+}
+
+func NewRedisBroker(client *redis.Client) *RedisBroker {
+	return &RedisBroker{
+		client: client,
+		events: newEventLog(client),
+	}
+}
+
+func (b *RedisBroker) Publish(ctx context.Context, roomID string, event Event) (Event, error) {
+	if roomID == "" {
+		return event, fmt.Errorf("websocket publish: roomID required")
+	}
+	sequenced, err := b.events.append(ctx, roomID, event)
+	if err != nil {
+		return event, fmt.Errorf("websocket publish: %w", err)
+	}
+	return sequenced, nil
+}
+
+func (b *RedisBroker) PublishEphemeral(ctx context.Context, roomID string, event Event) error {
+	if roomID == "" {
+		return fmt.Errorf("websocket publish: roomID required")
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("websocket publish: marshal event: %w", err)
+	}
+	if err := b.client.Publish(ctx, roomChannel(roomID), payload).Err(); err != nil {
+		return fmt.Errorf("websocket publish: %w", err)
+	}
+	return nil
+}
+
+func (b *RedisBroker) Since(ctx context.Context, roomID string, lastSeq int64) ([]Event, int64, bool, error) {
+	return b.events.since(ctx, roomID, lastSeq)
+}
+
+func (b *RedisBroker) Subscribe(ctx context.Context, pattern string, handle func(roomID, payload string)) error {
+	subscriber := b.client.PSubscribe(ctx, roomChannel(pattern))
+	defer subscriber.Close()
+	if _, err := subscriber.Receive(ctx); err != nil {
+		return fmt.Errorf("websocket subscribe: %w", err)
+	}
+
+	ch := subscriber.Channel()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case msg, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("websocket subscribe: subscription closed")
+			}
+			if roomID, ok := roomFromChannel(msg.Channel); ok {
+				handle(roomID, msg.Payload)
+			}
+		}
+	}
+}
@@ -1,21 +1,42 @@
 package websocket
 
 import (
+	"errors"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+var errClientClosed = errors.New("websocket client closed")
+
+// frameWriter is where the frames of a client are written: its websocket, or
+// the response of the SSE stream or long poll it is served through.
+type frameWriter interface {
+	WriteJSON(v interface{}) error
+}
+
 type WSClient struct {
-	Conn     *websocket.Conn
-	Message  chan *WSMessage
-	ID       string
-	RoomID   string
-	done     chan struct{} // Signal for coordinating goroutine shutdown
-	mu       sync.Mutex    // Mutex for connection access
-	isClosed bool          // Flag to track connection state
+	Conn       *websocket.Conn
+	Message    chan *WSMessage
+	ID         string
+	RoomID     string
+	SenderType string        // SenderVisitor or SenderAgent, reported on client events
+	TenantID   string        // Tenant the participant belongs to, used for presence
+	Protocol   string        // ProtocolEnvelope or ProtocolLegacy
+	writer     frameWriter   // Conn, or the HTTP response of other transports
+	mux        *muxConn      // Set on the socket and subscriptions of an agent socket
+	lastSeq    int64         // Highest room log sequence written, guarded by the socket mutex
+	recent     eventIDWindow // IDs of the last events written, guarded by the socket mutex
+	resync     atomic.Bool   // Set by the hub after dropping messages for the client
+	resyncSeq  atomic.Int64  // Highest room sequence the hub knew of when it dropped
+	connID     string        // Identifies this socket in the presence store
+	presence   chan string   // Presence statuses requested by the client
+	done       chan struct{} // Signal for coordinating goroutine shutdown
+	mu         sync.Mutex    // Mutex for connection access
+	isClosed   bool          // Flag to track connection state
 }
 
 func (cl *WSClient) keepAlive() {
@@ -51,25 +72,37 @@ func (cl *WSClient) writeMessage() {
 		cl.mu.Unlock()
 	}()
 
+	var kicked <-chan struct{}
+	if cl.mux != nil {
+		kicked = cl.mux.kicked
+	}
+
 	for {
 		select {
 		case <-cl.done:
 			return
+		case <-kicked:
+			log.Printf("Client %s dropped by the hub", cl.ID)
+			return
 		case msg, ok := <-cl.Message:
 			if !ok {
 				log.Printf("Client %s message channel closed", cl.ID)
 				return
 			}
 
-			cl.mu.Lock()
-			if cl.isClosed {
-				cl.mu.Unlock()
+			if err := cl.sendPendingResyncs(); err != nil {
+				log.Printf("Error sending resync to client %s: %v", cl.ID, err)
 				return
 			}
-			err := cl.Conn.WriteJSON(msg)
-			cl.mu.Unlock()
-
-			if err != nil {
+			target := cl.route(msg)
+			if target == nil {
+				// The subscription ended while the event was queued.
+				continue
+			}
+			if err := target.send(msg); err != nil {
+				if err == errClientClosed {
+					return
+				}
 				log.Printf("Error sending message to client %s: %v", cl.ID, err)
 				return
 			}
@@ -77,17 +110,198 @@ func (cl *WSClient) writeMessage() {
 	}
 }
 
-func (cl *WSClient) readMessage(hub *Hub) {
+// reportPresence hands status to the presence tracker, keeping only the most
+// recent request when the tracker is busy.
+func (cl *WSClient) reportPresence(status string) {
+	select {
+	case cl.presence <- status:
+	default:
+		select {
+		case <-cl.presence:
+		default:
+		}
+		select {
+		case cl.presence <- status:
+		default:
+		}
+	}
+}
+
+func (cl *WSClient) presenceConnection() PresenceConnection {
+	conn := PresenceConnection{
+		ConnectionID:    cl.connID,
+		TenantID:        cl.TenantID,
+		ParticipantType: cl.SenderType,
+		ParticipantID:   cl.ID,
+	}
+	if cl.RoomID != TenantNotificationRoomID(cl.TenantID) {
+		conn.ConversationID = cl.RoomID
+	}
+	return conn
+}
+
+// send writes msg unless the client already received it, either as its room
+// log entry or as an event with the same ID.
+func (cl *WSClient) send(msg *WSMessage) error {
+	owner := cl.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	return cl.sendLocked(owner, msg)
+}
+
+// sendLocked is send with the mutex of owner, the client holding the socket,
+// already held.
+func (cl *WSClient) sendLocked(owner *WSClient, msg *WSMessage) error {
+	if msg.Event != nil {
+		if msg.Event.Seq != 0 && msg.Event.Seq <= cl.lastSeq {
+			return nil
+		}
+		if !cl.recent.add(msg.Event.ID) {
+			return nil
+		}
+		if msg.Event.Seq != 0 {
+			cl.lastSeq = msg.Event.Seq
+		}
+	}
+
+	if owner.isClosed {
+		return errClientClosed
+	}
+	return owner.writer.WriteJSON(cl.frame(msg))
+}
+
+// owner returns the client holding the socket cl writes to: cl itself, or the
+// agent socket a subscription belongs to.
+func (cl *WSClient) owner() *WSClient {
+	if cl.mux != nil {
+		return cl.mux.conn
+	}
+	return cl
+}
+
+// seq returns the highest room sequence written to cl.
+func (cl *WSClient) seq() int64 {
+	owner := cl.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	return cl.lastSeq
+}
+
+// setSeq moves the room sequence of cl to seq, such as after a resync.
+func (cl *WSClient) setSeq(seq int64) {
+	owner := cl.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	cl.lastSeq = seq
+}
+
+// requestResync asks the writer to send resync.required before its next
+// message. seq is the highest room sequence the hub knew of; the client
+// reloads its state and the writer skips the queued events it covers.
+func (cl *WSClient) requestResync(seq int64) {
+	for {
+		current := cl.resyncSeq.Load()
+		if seq <= current || cl.resyncSeq.CompareAndSwap(current, seq) {
+			break
+		}
+	}
+	cl.resync.Store(true)
+	if cl.mux != nil {
+		cl.mux.resync.Store(true)
+	}
+}
+
+// sendPendingResyncs writes the resync.required requested for cl or, on an
+// agent socket, for any of its subscriptions.
+func (cl *WSClient) sendPendingResyncs() error {
+	if cl.mux == nil {
+		return cl.sendPendingResync()
+	}
+	if !cl.mux.resync.Swap(false) {
+		return nil
+	}
+	for _, member := range cl.mux.members() {
+		if err := member.sendPendingResync(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendPendingResync writes the resync.required requested by the hub, if any.
+func (cl *WSClient) sendPendingResync() error {
+	if !cl.resync.Swap(false) {
+		return nil
+	}
+	owner := cl.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+
+	seq := cl.resyncSeq.Load()
+	if seq < cl.lastSeq {
+		seq = cl.lastSeq
+	}
+	cl.lastSeq = seq
+
+	now := time.Now()
+	event, err := NewEvent(EventResyncRequired, now, ResyncEvent{
+		RoomID: cl.RoomID,
+		Reason: ResyncReasonSlowConsumer,
+		Seq:    seq,
+	})
+	if err != nil {
+		return err
+	}
+	return cl.sendLocked(owner, newEventMessage(cl.RoomID, event, now))
+}
+
+// frame returns what is written to the socket for msg: the event envelope for
+// clients on ProtocolEnvelope, the legacy frame otherwise. Subscriptions of an
+// agent socket tag the envelope with their conversation.
+func (cl *WSClient) frame(msg *WSMessage) interface{} {
+	if msg.Event != nil && cl.Protocol == ProtocolEnvelope {
+		if cl.isSubscription() {
+			return taggedEvent{Event: msg.Event, ConversationID: cl.RoomID}
+		}
+		return msg.Event
+	}
+	return msg
+}
+
+// reply writes frame, an answer to a frame of the client, straight to the
+// socket. Replies bypass the room sequence, so any goroutine may send them.
+func (cl *WSClient) reply(frame interface{}) error {
+	owner := cl.owner()
+	owner.mu.Lock()
+	defer owner.mu.Unlock()
+	if owner.isClosed {
+		return errClientClosed
+	}
+	return owner.writer.WriteJSON(frame)
+}
+
+// readMessage handles the frames of the client until it disconnects.
+// message.send frames are handled one at a time, so a client's messages are
+// stored in the order it sent them.
+func (cl *WSClient) readMessage(h *Handler) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Recovered from panic in readMessage: %v", r)
 		}
 
+		if cl.mux != nil {
+			for _, sub := range cl.mux.removeAll() {
+				h.typing.disconnect(sub)
+				h.hub.Unregister <- sub
+			}
+		}
+		h.typing.disconnect(cl)
+
 		if cl.done != nil {
 			close(cl.done)
 		}
 
-		hub.Unregister <- cl
+		h.hub.Unregister <- cl
 		log.Printf("Client %s disconnected from room %s", cl.ID, cl.RoomID)
 	}()
 
@@ -107,10 +321,93 @@ func (cl *WSClient) readMessage(hub *Hub) {
 			break
 		}
 
-		hub.Broadcast <- &WSMessage{
-			Content:   string(message),
-			RoomID:    cl.RoomID,
-			Timestamp: time.Now().Unix(),
+		frame, ok := parseClientFrame(message)
+		if !ok {
+			// Clients only send typed frames; anything else is dropped rather
+			// than relayed to the room.
+			continue
+		}
+		switch frame.Type {
+		case FrameMessageSend:
+			h.sendMessage(cl, frame)
+		case FrameSubscribe:
+			h.subscribe(cl, frame)
+		case FrameUnsubscribe:
+			h.unsubscribe(cl, frame)
+		case FramePresenceAway, FramePresenceActive:
+			status, _ := presenceFrameStatus(frame.Type)
+			cl.reportPresence(status)
+		default:
+			if target, err := cl.frameTarget(frame); err == nil {
+				h.typing.handle(target, frame.Type)
+			}
+		}
+	}
+}
+
+// frameTarget returns the client of the room frame is meant for. Frames of
+// an agent socket name their conversation, which must be subscribed; frames of
+// other sockets are for their only room.
+func (cl *WSClient) frameTarget(frame clientFrame) (*WSClient, error) {
+	if frame.ConversationID == "" || frame.ConversationID == cl.RoomID {
+		return cl, nil
+	}
+	if cl.mux != nil {
+		if sub := cl.mux.subscription(frame.ConversationID); sub != nil {
+			return sub, nil
 		}
+		return nil, &CommandError{Code: CommandErrorForbidden, Message: "not subscribed to this conversation"}
+	}
+	return nil, &CommandError{Code: CommandErrorForbidden, Message: "this socket is for another conversation"}
+}
+
+// route returns the client msg is written for: cl, or the subscription of an
+// agent socket for the room of msg. It returns nil for rooms no longer
+// subscribed.
+func (cl *WSClient) route(msg *WSMessage) *WSClient {
+	if cl.mux == nil || msg.RoomID == cl.RoomID {
+		return cl
+	}
+	return cl.mux.subscription(msg.RoomID)
+}
+
+// isSubscription reports whether cl is a conversation subscription of an
+// agent socket rather than a socket of its own.
+func (cl *WSClient) isSubscription() bool {
+	return cl.mux != nil && cl.mux.conn != cl
+}
+
+// eventIDWindowSize is how many event IDs a connection remembers. It only has
+// to cover events that can reach the socket twice in quick succession, such
+// as an unlogged event relayed again after a Redis reconnect.
+const eventIDWindowSize = 256
+
+// eventIDWindow remembers the IDs of the most recent events written to one
+// connection.
+type eventIDWindow struct {
+	ids  []string
+	seen map[string]struct{}
+	next int
+}
+
+// add records id and reports whether it was new. Empty IDs are always new.
+func (w *eventIDWindow) add(id string) bool {
+	if id == "" {
+		return true
+	}
+	if w.seen == nil {
+		w.ids = make([]string, eventIDWindowSize)
+		w.seen = make(map[string]struct{}, eventIDWindowSize)
+	}
+	if _, ok := w.seen[id]; ok {
+		return false
+	}
+
+	if evicted := w.ids[w.next]; evicted != "" {
+		delete(w.seen, evicted)
 	}
+	w.ids[w.next] = id
+	w.seen[id] = struct{}{}
+	w.next = (w.next + 1) % len(w.ids)
+	return true
 }
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+)
+
+// messageSendTimeout bounds storing the message of one message.send frame.
+const messageSendTimeout = 10 * time.Second
+
+// Frame types written to a client in reply to its message.send frame.
+const (
+	FrameMessageAck   = "message.ack"
+	FrameMessageError = "message.error"
+)
+
+// Codes of the errors in message.error frames. A MessageSender may report
+// codes of its own through CommandError.
+const (
+	CommandErrorValidation  = "validation_error"
+	CommandErrorForbidden   = "forbidden"
+	CommandErrorUnavailable = "unavailable"
+	CommandErrorInternal    = "internal_error"
+)
+
+// MessageCommand is a message.send frame together with the identity of the
+// socket it arrived on.
+type MessageCommand struct {
+	ClientID       string
+	ConversationID string
+	TenantID       string
+	SenderType     string
+	SenderID       string
+	Body           string
+}
+
+// MessageSender stores the messages clients send over their sockets. It
+// publishes them to the room like any other message and returns the stored
+// message, which is acknowledged to the sending client.
+type MessageSender interface {
+	SendMessage(ctx context.Context, cmd MessageCommand) (interface{}, error)
+}
+
+// CommandError is a failure reported to the client in a message.error frame.
+// Other errors are logged and reported as CommandErrorInternal.
+type CommandError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *CommandError) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// messageAckFrame acknowledges a message.send frame with the stored message.
+type messageAckFrame struct {
+	Type     string      `json:"type"`
+	ClientID string      `json:"clientId"`
+	Message  interface{} `json:"message"`
+}
+
+// messageErrorFrame rejects a message.send frame.
+type messageErrorFrame struct {
+	Type     string       `json:"type"`
+	ClientID string       `json:"clientId"`
+	Error    CommandError `json:"error"`
+}
+
+// SetMessageSender sets what stores the messages sent over sockets; without
+// one, message.send frames are rejected.
+func (h *Handler) SetMessageSender(sender MessageSender) {
+	h.messages = sender
+}
+
+// sendMessage stores the message of a message.send frame and acknowledges it
+// to cl. The reply may reach the client before or after the message.created
+// event of the same message; clients match both by message ID.
+func (h *Handler) sendMessage(cl *WSClient, frame clientFrame) {
+	message, err := h.storeMessage(cl, frame)
+	if err != nil {
+		var cmdErr *CommandError
+		if !errors.As(err, &cmdErr) {
+			log.Printf("message.send from client %s in room %s failed: %v", cl.ID, cl.RoomID, err)
+			cmdErr = &CommandError{Code: CommandErrorInternal, Message: "failed to send message"}
+		}
+		err = cl.reply(messageErrorFrame{Type: FrameMessageError, ClientID: frame.ClientID, Error: *cmdErr})
+	} else {
+		err = cl.reply(messageAckFrame{Type: FrameMessageAck, ClientID: frame.ClientID, Message: message})
+	}
+	if err != nil && err != errClientClosed {
+		log.Printf("Error replying to message.send from client %s: %v", cl.ID, err)
+	}
+}
+
+// storeMessage authorizes frame against the role of cl and hands it to the
+// message sender.
+func (h *Handler) storeMessage(cl *WSClient, frame clientFrame) (interface{}, error) {
+	if frame.ClientID == "" {
+		return nil, &CommandError{Code: CommandErrorValidation, Message: "clientId is required"}
+	}
+	target, err := cl.frameTarget(frame)
+	if err != nil {
+		return nil, err
+	}
+	// Visitor sockets only ever join their own conversation, and agent
+	// sockets only rooms they were authorized for, so the room decides where
+	// a message goes; notification rooms take no messages.
+	if isNotificationRoom(target.RoomID) {
+		return nil, &CommandError{Code: CommandErrorForbidden, Message: "messages can only be sent to a conversation"}
+	}
+	if target.SenderType != SenderVisitor && target.SenderType != SenderAgent {
+		return nil, &CommandError{Code: CommandErrorForbidden, Message: "this connection cannot send messages"}
+	}
+	if h.messages == nil {
+		return nil, &CommandError{Code: CommandErrorUnavailable, Message: "messages cannot be sent over this socket"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), messageSendTimeout)
+	defer cancel()
+	return h.messages.SendMessage(ctx, MessageCommand{
+		ClientID:       frame.ClientID,
+		ConversationID: target.RoomID,
+		TenantID:       target.TenantID,
+		SenderType:     target.SenderType,
+		SenderID:       target.ID,
+		Body:           frame.Body,
+	})
+}
@@ -0,0 +1,127 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// eventLogSize bounds how many events each room keeps for replay.
+	eventLogSize = 500
+	// eventLogTTL drops the log of a room that has been quiet for this long.
+	eventLogTTL = 24 * time.Hour
+)
+
+// appendEventScript assigns the next sequence number of a room, splices it
+// into the marshaled event, stores the result in the bounded log and
+// publishes it. Doing all of it in one script keeps the log and the channel
+// in the same order across replicas.
+var appendEventScript = redis.NewScript(`
+local seq = redis.call('INCR', KEYS[1])
+local entry = '{"seq":' .. seq .. ',' .. string.sub(ARGV[1], 2)
+redis.call('ZADD', KEYS[2], seq, entry)
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -(tonumber(ARGV[2]) + 1))
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+redis.call('PUBLISH', ARGV[4], entry)
+return seq
+`)
+
+// eventLog is the per-room, sequence-numbered event history kept in Redis so
+// that any ws-server replica can replay what a reconnecting client missed.
+type eventLog struct {
+	client *redis.Client
+	size   int64
+	ttl    time.Duration
+}
+
+func newEventLog(client *redis.Client) *eventLog {
+	return &eventLog{
+		client: client,
+		size:   eventLogSize,
+		ttl:    eventLogTTL,
+	}
+}
+
+// Room IDs are wrapped in a hash tag so both keys of a room share a slot.
+func eventLogSeqKey(roomID string) string {
+	return "ws:{" + roomID + "}:seq"
+}
+
+func eventLogKey(roomID string) string {
+	return "ws:{" + roomID + "}:log"
+}
+
+// append records event in the log of roomID, publishes it to the room channel
+// and returns it with its sequence number set.
+func (l *eventLog) append(ctx context.Context, roomID string, event Event) (Event, error) {
+	event.Seq = 0
+	raw, err := json.Marshal(event)
+	if err != nil {
+		return Event{}, fmt.Errorf("event log: marshal event: %w", err)
+	}
+
+	seq, err := appendEventScript.Run(ctx, l.client,
+		[]string{eventLogSeqKey(roomID), eventLogKey(roomID)},
+		string(raw), l.size, l.ttl.Milliseconds(), roomChannel(roomID),
+	).Int64()
+	if err != nil {
+		return Event{}, fmt.Errorf("event log: append: %w", err)
+	}
+
+	event.Seq = seq
+	return event, nil
+}
+
+// since returns the events of roomID after lastSeq. It reports resync when the
+// log can no longer fill the gap and the client has to reload its state.
+func (l *eventLog) since(ctx context.Context, roomID string, lastSeq int64) ([]Event, int64, bool, error) {
+	pipe := l.client.Pipeline()
+	seqCmd := pipe.Get(ctx, eventLogSeqKey(roomID))
+	entriesCmd := pipe.ZRangeByScore(ctx, eventLogKey(roomID), &redis.ZRangeBy{
+		Min: "(" + strconv.FormatInt(lastSeq, 10),
+		Max: "+inf",
+	})
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, 0, false, fmt.Errorf("event log: read: %w", err)
+	}
+
+	current, err := seqCmd.Int64()
+	if err != nil && err != redis.Nil {
+		return nil, 0, false, fmt.Errorf("event log: read sequence: %w", err)
+	}
+
+	events := make([]Event, 0, len(entriesCmd.Val()))
+	for _, entry := range entriesCmd.Val() {
+		event, ok := parseEvent([]byte(entry))
+		if !ok {
+			return nil, current, true, nil
+		}
+		events = append(events, event)
+	}
+
+	missed, resync := replayWindow(lastSeq, current, events)
+	return missed, current, resync, nil
+}
+
+// replayWindow decides what to replay to a client that last saw lastSeq when
+// the room is at current and the log holds events, oldest first.
+func replayWindow(lastSeq, current int64, events []Event) ([]Event, bool) {
+	if lastSeq > current {
+		// The sequence restarted after the log expired.
+		return nil, true
+	}
+	if lastSeq == current {
+		return nil, false
+	}
+	if len(events) == 0 || events[0].Seq != lastSeq+1 {
+		// The missed events were trimmed from the log.
+		return nil, true
+	}
+	return events, false
+}
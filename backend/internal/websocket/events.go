@@ -0,0 +1,195 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"chat-app-backend/internal/dto"
+
+	"github.com/google/uuid"
+)
+
+// EventSchemaVersion is stamped on every event. Bump it when a payload changes
+// in a way existing clients cannot safely ignore.
+const EventSchemaVersion = 1
+
+// Event types delivered to conversation and tenant notification rooms.
+const (
+	EventConversationCreated  = "conversation.created"
+	EventConversationClosed   = "conversation.closed"
+	EventConversationReopened = "conversation.reopened"
+	EventConversationArchived = "conversation.archived"
+	EventMessageCreated       = "message.created"
+	EventMessageUpdated       = "message.updated"
+	EventMessageDeleted       = "message.deleted"
+	EventMessageRead          = "message.read"
+	EventAssignmentChanged    = "assignment.changed"
+	EventResyncRequired       = "resync.required"
+	EventPresenceChanged      = "presence.changed"
+	EventNoteMentioned        = "note.mentioned"
+	EventTypingStart          = FrameTypingStart
+	EventTypingStop           = FrameTypingStop
+)
+
+// Event is the envelope of every server-sent event. Payload holds one of the
+// payload types below, as selected by Type. Seq is the position of the event
+// in the room log; it is zero for events that are not logged, such as typing.
+type Event struct {
+	Seq        int64           `json:"seq,omitempty"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	ID         string          `json:"id"`
+	OccurredAt string          `json:"occurredAt"`
+	Payload    json.RawMessage `json:"payload"`
+}
+
+// ConversationEvent is the payload of conversation.closed, conversation.reopened
+// and conversation.archived.
+type ConversationEvent struct {
+	Conversation dto.ConversationMetadata `json:"conversation"`
+}
+
+// MessageEvent is the payload of conversation.created, message.created,
+// message.updated, message.deleted and note.mentioned. The message of
+// message.deleted is the tombstone left in its place.
+type MessageEvent struct {
+	Conversation dto.ConversationMetadata `json:"conversation"`
+	Message      dto.MessageResponse      `json:"message"`
+}
+
+// AssignmentEvent is the payload of assignment.changed.
+type AssignmentEvent struct {
+	Conversation dto.ConversationMetadata     `json:"conversation"`
+	Assignment   dto.AssignmentRecordResponse `json:"assignment"`
+}
+
+// ReadEvent is the payload of message.read.
+type ReadEvent struct {
+	ConversationID string `json:"conversationId"`
+	ReaderType     string `json:"readerType"`
+	ReaderID       string `json:"readerId"`
+	MessageID      string `json:"messageId"`
+	ReadAt         string `json:"readAt"`
+}
+
+// TypingEvent is the payload of typing.start and typing.stop.
+type TypingEvent struct {
+	ConversationID string `json:"conversationId"`
+	SenderType     string `json:"senderType"`
+	SenderID       string `json:"senderId"`
+	ExpiresAt      string `json:"expiresAt,omitempty"`
+}
+
+// Resync reasons reported on resync.required.
+const (
+	ResyncReasonReplayGap    = "replay_gap"
+	ResyncReasonSlowConsumer = "slow_consumer"
+)
+
+// ResyncEvent is the payload of resync.required. The client should reload the
+// conversation over HTTP and treat Seq as its new lastSeq.
+type ResyncEvent struct {
+	RoomID string `json:"roomId"`
+	Reason string `json:"reason"`
+	Seq    int64  `json:"seq"`
+}
+
+// NewEvent wraps payload in an envelope with a fresh ID.
+func NewEvent(eventType string, occurredAt time.Time, payload interface{}) (Event, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, fmt.Errorf("websocket event %s: marshal payload: %w", eventType, err)
+	}
+	return Event{
+		Type:       eventType,
+		Version:    EventSchemaVersion,
+		ID:         uuid.NewString(),
+		OccurredAt: occurredAt.UTC().Format(time.RFC3339),
+		Payload:    raw,
+	}, nil
+}
+
+// DecodePayload unmarshals the payload into v.
+func (e Event) DecodePayload(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// legacyContent renders the event the way rooms carried it before the
+// envelope: the payload fields flattened next to type and broadcastedAt.
+func (e Event) legacyContent() (string, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(e.Payload, &fields); err != nil {
+		return "", fmt.Errorf("websocket event %s: payload is not an object: %w", e.Type, err)
+	}
+
+	eventType, _ := json.Marshal(e.Type)
+	occurredAt, _ := json.Marshal(e.OccurredAt)
+	fields["type"] = eventType
+	fields["broadcastedAt"] = occurredAt
+	if e.Seq != 0 {
+		fields["seq"] = json.RawMessage(strconv.FormatInt(e.Seq, 10))
+	}
+
+	content, err := json.Marshal(fields)
+	if err != nil {
+		return "", fmt.Errorf("websocket event %s: marshal legacy content: %w", e.Type, err)
+	}
+	return string(content), nil
+}
+
+// parseEvent decodes raw as an event envelope. It reports false for anything
+// else, such as payloads published by older replicas.
+func parseEvent(raw []byte) (Event, bool) {
+	var event Event
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return Event{}, false
+	}
+	if event.Type == "" || event.Version == 0 || event.ID == "" || len(event.Payload) == 0 {
+		return Event{}, false
+	}
+	return event, true
+}
+
+// newEventMessage prepares event for delivery to roomID. The legacy rendering
+// is computed once here rather than per client.
+func newEventMessage(roomID string, event Event, now time.Time) *WSMessage {
+	content, err := event.legacyContent()
+	if err != nil {
+		content = string(event.Payload)
+	}
+	return &WSMessage{
+		Content:   content,
+		RoomID:    roomID,
+		Timestamp: now.Unix(),
+		Event:     &event,
+	}
+}
+
+// messageFromPayload turns a payload received from Redis into a room message.
+func messageFromPayload(roomID, payload string, now time.Time) *WSMessage {
+	if event, ok := parseEvent([]byte(payload)); ok {
+		msg := newEventMessage(roomID, event, now)
+		msg.sender = eventSender(event)
+		return msg
+	}
+	return &WSMessage{
+		Content:   payload,
+		RoomID:    roomID,
+		Timestamp: now.Unix(),
+	}
+}
+
+// eventSender returns the participant that sent the frame behind a typing
+// event, and nobody for every other event.
+func eventSender(event Event) participant {
+	if event.Type != EventTypingStart && event.Type != EventTypingStop {
+		return participant{}
+	}
+	var payload TypingEvent
+	if err := event.DecodePayload(&payload); err != nil {
+		return participant{}
+	}
+	return participant{senderType: payload.SenderType, senderID: payload.SenderID}
+}
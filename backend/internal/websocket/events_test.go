@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"chat-app-backend/internal/dto"
+)
+
+func TestNewEventWrapsPayloadInEnvelope(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	event, err := NewEvent(EventMessageRead, now, ReadEvent{ConversationID: "conv-1", ReaderType: SenderAgent, ReaderID: "agent-1", MessageID: "msg-1"})
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+	if event.Type != EventMessageRead || event.Version != EventSchemaVersion || event.ID == "" {
+		t.Fatalf("unexpected envelope %+v", event)
+	}
+	if event.OccurredAt != "2024-06-01T12:00:00Z" {
+		t.Fatalf("unexpected occurredAt %s", event.OccurredAt)
+	}
+
+	raw, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("marshal event: %v", err)
+	}
+	parsed, ok := parseEvent(raw)
+	if !ok {
+		t.Fatalf("expected %s to parse as an event", raw)
+	}
+	var payload ReadEvent
+	if err := parsed.DecodePayload(&payload); err != nil {
+		t.Fatalf("decode payload: %v", err)
+	}
+	if payload.ConversationID != "conv-1" || payload.MessageID != "msg-1" {
+		t.Fatalf("unexpected payload %+v", payload)
+	}
+}
+
+func TestEventMessagesRenderPerClientProtocol(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	event, err := NewEvent(EventMessageCreated, now, MessageEvent{
+		Conversation: dto.ConversationMetadata{ConversationID: "conv-1"},
+		Message:      dto.MessageResponse{MessageID: "msg-1", Body: "Hello"},
+	})
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+	raw, _ := json.Marshal(event)
+	msg := messageFromPayload("conv-1", string(raw), now)
+
+	modern := &WSClient{Protocol: ProtocolEnvelope}
+	if frame, ok := modern.frame(msg).(*Event); !ok || frame.ID != event.ID {
+		t.Fatalf("expected envelope frame, got %#v", modern.frame(msg))
+	}
+
+	legacy := &WSClient{Protocol: ProtocolLegacy}
+	frame, ok := legacy.frame(msg).(*WSMessage)
+	if !ok {
+		t.Fatalf("expected legacy frame, got %#v", legacy.frame(msg))
+	}
+	var content struct {
+		Type          string              `json:"type"`
+		BroadcastedAt string              `json:"broadcastedAt"`
+		Message       dto.MessageResponse `json:"message"`
+	}
+	if err := json.Unmarshal([]byte(frame.Content), &content); err != nil {
+		t.Fatalf("decode legacy content: %v", err)
+	}
+	if content.Type != EventMessageCreated || content.BroadcastedAt != event.OccurredAt || content.Message.Body != "Hello" {
+		t.Fatalf("unexpected legacy content %+v", content)
+	}
+
+	passthrough := messageFromPayload("conv-1", "plain text", now)
+	if passthrough.Event != nil || modern.frame(passthrough) != passthrough {
+		t.Fatalf("expected non-event payloads to pass through unchanged")
+	}
+}
+
+func TestNegotiateProtocolDefaultsToLegacy(t *testing.T) {
+	cases := map[string]string{
+		"/ws":                 ProtocolLegacy,
+		"/ws?protocol=legacy": ProtocolLegacy,
+		"/ws?protocol=v2":     ProtocolLegacy,
+		"/ws?protocol=v1":     ProtocolEnvelope,
+	}
+	for target, want := range cases {
+		if got := NegotiateProtocol(httptest.NewRequest("GET", target, nil)); got != want {
+			t.Fatalf("NegotiateProtocol(%s) = %s, want %s", target, got, want)
+		}
+	}
+
+	msg := newEventMessage("conv-1", Event{Type: EventMessageRead, Payload: json.RawMessage(`{}`)}, time.Now())
+	if _, ok := (&WSClient{}).frame(msg).(*WSMessage); !ok {
+		t.Fatal("expected clients without a negotiated protocol to get legacy frames")
+	}
+}
+
+func TestReplayWindow(t *testing.T) {
+	logged := []Event{{Seq: 4}, {Seq: 5}, {Seq: 6}}
+
+	missed, resync := replayWindow(3, 6, logged)
+	if resync || len(missed) != 3 {
+		t.Fatalf("expected 3 events to replay, got %d (resync %v)", len(missed), resync)
+	}
+	if missed, resync := replayWindow(6, 6, nil); resync || len(missed) != 0 {
+		t.Fatalf("expected nothing to replay for an up to date client")
+	}
+	if _, resync := replayWindow(1, 6, logged); !resync {
+		t.Fatal("expected resync when the gap was trimmed from the log")
+	}
+	if _, resync := replayWindow(9, 2, []Event{{Seq: 1}, {Seq: 2}}); !resync {
+		t.Fatal("expected resync when the sequence restarted")
+	}
+	if _, resync := replayWindow(0, 3, nil); !resync {
+		t.Fatal("expected resync when the log expired")
+	}
+}
+
+func TestSendSkipsEventsAlreadyReplayed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	event, err := NewEvent(EventMessageCreated, now, MessageEvent{})
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+	event.Seq = 7
+
+	cl := &WSClient{lastSeq: 7, isClosed: true}
+	if err := cl.send(newEventMessage("conv-1", event, now)); err != nil {
+		t.Fatalf("expected replayed event to be skipped, got %v", err)
+	}
+
+	event.Seq = 8
+	if err := cl.send(newEventMessage("conv-1", event, now)); err != errClientClosed {
+		t.Fatalf("expected newer event to reach the connection, got %v", err)
+	}
+	if cl.lastSeq != 8 {
+		t.Fatalf("expected lastSeq to advance to 8, got %d", cl.lastSeq)
+	}
+}
+
+func TestSendSkipsDuplicateEventIDs(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	event, err := NewEvent(EventTypingStart, now, TypingEvent{ConversationID: "conv-1"})
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+
+	cl := &WSClient{isClosed: true}
+	if err := cl.send(newEventMessage("conv-1", event, now)); err != errClientClosed {
+		t.Fatalf("expected the first copy to reach the connection, got %v", err)
+	}
+	if err := cl.send(newEventMessage("conv-1", event, now)); err != nil {
+		t.Fatalf("expected the duplicate to be skipped, got %v", err)
+	}
+
+	for i := 0; i < eventIDWindowSize; i++ {
+		cl.recent.add(fmt.Sprintf("other-%d", i))
+	}
+	if err := cl.send(newEventMessage("conv-1", event, now)); err != errClientClosed {
+		t.Fatalf("expected IDs to be forgotten once the window moved on, got %v", err)
+	}
+}
+
+func TestRoomChannels(t *testing.T) {
+	channel := roomChannel("conv-1")
+	if channel != "ws:room:conv-1" {
+		t.Fatalf("unexpected channel %s", channel)
+	}
+	if roomID, ok := roomFromChannel(channel); !ok || roomID != "conv-1" {
+		t.Fatalf("expected conv-1, got %q (%v)", roomID, ok)
+	}
+	if _, ok := roomFromChannel("conv-1"); ok {
+		t.Fatal("expected channels without the room prefix to be ignored")
+	}
+}
@@ -0,0 +1,37 @@
+package websocket
+
+import (
+	"context"
+	"strings"
+)
+
+// tenantNotificationPattern matches every tenant notification room. It also
+// matches the personal rooms nested under a tenant, which FollowTenantEvents
+// skips.
+const tenantNotificationPattern = "tenant:*:notifications"
+
+// FollowTenantEvents calls handle with every event published to a tenant
+// notification room by any server sharing broker until ctx is done or the
+// subscription fails. Servers that keep derived state, such as the search
+// index, use it to see writes made elsewhere.
+func FollowTenantEvents(ctx context.Context, broker Broker, handle func(tenantID string, event Event)) error {
+	return broker.Subscribe(ctx, tenantNotificationPattern, func(roomID, payload string) {
+		tenantID, ok := tenantFromNotificationRoom(roomID)
+		if !ok {
+			return
+		}
+		if event, ok := parseEvent([]byte(payload)); ok {
+			handle(tenantID, event)
+		}
+	})
+}
+
+// tenantFromNotificationRoom returns the tenant of a room built by
+// TenantNotificationRoomID.
+func tenantFromNotificationRoom(roomID string) (string, bool) {
+	tenantID := strings.TrimSuffix(strings.TrimPrefix(roomID, "tenant:"), ":notifications")
+	if tenantID == "" || strings.Contains(tenantID, ":") || TenantNotificationRoomID(tenantID) != roomID {
+		return "", false
+	}
+	return tenantID, true
+}
@@ -1,21 +1,20 @@
 package websocket
 
 import (
-	"chat-app-backend/internal/env"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 )
 
-var (
-	upgrader    websocket.Upgrader
-	redisClient *redis.Client
-)
+var upgrader websocket.Upgrader
 
 func init() {
 	upgrader = websocket.Upgrader{
@@ -25,70 +24,82 @@ func init() {
 			return true
 		},
 	}
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     env.Get("CHAT_REDIS_URL"),
-		Password: env.Get("CHAT_REDIS_PASS"),
-		DB:       0,
-	})
 }
 
 type Handler struct {
-	hub         *Hub
-	redisClient *redis.Client
+	hub             *Hub
+	broker          Broker
+	presence        *Presence
+	typing          *typingRelay
+	messages        MessageSender
+	conversations   ConversationAuthorizer
+	draining        chan struct{} // Closed once Drain starts
+	drainOnce       sync.Once
+	reconnectSpread time.Duration // Set by Drain before draining is closed
 }
 
-func NewHandler(h *Hub) *Handler {
-	return &Handler{
-		hub:         h,
-		redisClient: redisClient,
+// NewHandler returns a handler serving the rooms of h with the events of
+// broker. RelayRoomEvents must run alongside it for published events to reach
+// the rooms.
+func NewHandler(h *Hub, broker Broker) *Handler {
+	handler := &Handler{
+		hub:      h,
+		broker:   broker,
+		presence: NewPresence(broker),
+		draining: make(chan struct{}),
 	}
+	handler.typing = newTypingRelay(time.Now, handler.publishTyping)
+	return handler
 }
 
-func (h *Handler) subscribeToRoomChannel(roomID string) {
-	// Check if already subscribed
-	if _, exists := h.hub.Rooms[roomID]; !exists {
-		log.Printf("Room %s not found for subscription", roomID)
-		return
-	}
-
-	log.Printf("Subscribing to Redis channel: %s", roomID)
-	subscriber := h.redisClient.Subscribe(context.Background(), roomID)
-	defer subscriber.Close()
+// SetPresence replaces the presence tracker; nil disables presence tracking.
+func (h *Handler) SetPresence(presence *Presence) {
+	h.presence = presence
+}
 
-	ch := subscriber.Channel()
-	for msg := range ch {
-		log.Printf("Received message from Redis channel '%s': %s", roomID, msg.Payload)
+// relayRetryDelay is how long RelayRoomEvents waits before subscribing again
+// after the subscription failed.
+const relayRetryDelay = 2 * time.Second
 
-		h.hub.Broadcast <- &WSMessage{
-			Content:   msg.Payload,
-			RoomID:    roomID,
-			Timestamp: time.Now().Unix(),
-		}
+// RelayRoomEvents hands every event published to any room to the hub, which
+// delivers it to the clients of this replica in that room. A single broker
+// subscription serves all rooms, so joining and leaving rooms never touches
+// the broker.
+func (h *Handler) RelayRoomEvents() {
+	for {
+		err := h.relayRoomEvents(context.Background())
+		log.Printf("Room event relay stopped: %v", err)
+		time.Sleep(relayRetryDelay)
 	}
-	log.Printf("Unsubscribed from Redis channel: %s", roomID)
 }
 
-func (h *Handler) CreateRoom(id string) {
-	log.Printf("[WEBSOCKET_DEBUG]: CreateRoom Start")
-	if _, exists := h.hub.Rooms[id]; exists {
-		return
-	}
+func (h *Handler) relayRoomEvents(ctx context.Context) error {
+	return h.broker.Subscribe(ctx, "*", func(roomID, payload string) {
+		h.hub.Broadcast <- messageFromPayload(roomID, payload, time.Now())
+	})
+}
 
-	room := &Room{
-		Id:      id,
-		Clients: make(map[string]*WSClient),
+func (h *Handler) publishTyping(roomID string, event Event) {
+	if err := h.broker.PublishEphemeral(context.Background(), roomID, event); err != nil {
+		log.Printf("failed to publish typing event for room %s: %v", roomID, err)
 	}
-
-	h.hub.Rooms[id] = room
-	setRooms(len(h.hub.Rooms))
-
-	// Ensure Redis subscription for the room only once
-	go h.subscribeToRoomChannel(id)
-	log.Printf("[WEBSOCKET_DEBUG]: CreateRoom End")
 }
 
-func (h *Handler) JoinRoom(w http.ResponseWriter, r *http.Request, roomId, userId string) {
+// JoinRoom upgrades the request and registers the client in roomId. Clients
+// reconnecting with a lastSeq query parameter first receive the events they
+// missed, or a resync.required event when the room log no longer has them.
+// The connection counts towards the presence of userId in tenantID.
+func (h *Handler) JoinRoom(w http.ResponseWriter, r *http.Request, roomId, userId, senderType, tenantID string) {
 	log.Printf("[WEBSOCKET_DEBUG]: JoinRoom Start")
+	if h.refuseWhileDraining(w) {
+		return
+	}
+	lastSeq, replay, err := parseLastSeq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -100,29 +111,177 @@ func (h *Handler) JoinRoom(w http.ResponseWriter, r *http.Request, roomId, userI
 		return
 	}
 
-	cl := &WSClient{
-		Conn:     conn,
-		Message:  make(chan *WSMessage, 10),
-		ID:       userId,
-		RoomID:   roomId,
-		done:     make(chan struct{}),
-		isClosed: false,
-	}
-
-	h.hub.Register <- cl
+	cl := h.newClient(roomId, userId, senderType, tenantID, NegotiateProtocol(r), conn)
+	cl.Conn = conn
+	h.register(cl, lastSeq, replay)
 
+	go h.trackPresence(cl)
 	go cl.keepAlive()
 	go cl.writeMessage()
-	go cl.readMessage(h.hub)
+	go cl.readMessage(h)
 	log.Printf("[WEBSOCKET_DEBUG]: JoinRoom End")
 }
 
+// newClient returns a client of roomId whose frames are written to writer.
+func (h *Handler) newClient(roomId, userId, senderType, tenantID, protocol string, writer frameWriter) *WSClient {
+	return &WSClient{
+		Message:    make(chan *WSMessage, h.hub.clientBuffer(roomId)),
+		ID:         userId,
+		RoomID:     roomId,
+		SenderType: senderType,
+		TenantID:   tenantID,
+		Protocol:   protocol,
+		writer:     writer,
+		connID:     uuid.NewString(),
+		presence:   make(chan string, 1),
+		done:       make(chan struct{}),
+		isClosed:   false,
+	}
+}
+
+// register adds cl to its room. When replay is set, cl first receives the
+// events after lastSeq, or a resync.required event when the room log no
+// longer has them.
+func (h *Handler) register(cl *WSClient, lastSeq int64, replay bool) {
+	if !replay {
+		h.hub.Register <- cl
+		return
+	}
+
+	// The replay is written before the client joins the hub, so a slow replay
+	// cannot fill cl.Message and get the client dropped. A second, short pass
+	// after registering covers what was published during the replay; live
+	// events it overlaps with are skipped by the writer through lastSeq.
+	cl.lastSeq = lastSeq
+	h.replay(cl, lastSeq, replayTimeout)
+
+	h.hub.Register <- cl
+
+	h.replay(cl, cl.seq(), replayGapTimeout)
+}
+
+func parseLastSeq(r *http.Request) (int64, bool, error) {
+	raw := r.URL.Query().Get("lastSeq")
+	if raw == "" {
+		return 0, false, nil
+	}
+	lastSeq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || lastSeq < 0 {
+		return 0, false, fmt.Errorf("invalid lastSeq")
+	}
+	return lastSeq, true, nil
+}
+
+const (
+	// replayTimeout bounds reading the events a reconnecting client missed.
+	replayTimeout = 5 * time.Second
+	// replayGapTimeout bounds the pass that runs once the client is registered
+	// and live events are already queueing for it.
+	replayGapTimeout = time.Second
+)
+
+func (h *Handler) replay(cl *WSClient, lastSeq int64, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	now := time.Now()
+	missed, current, resync, err := h.broker.Since(ctx, cl.RoomID, lastSeq)
+	if err != nil {
+		log.Printf("Replay for client %s in room %s failed: %v", cl.ID, cl.RoomID, err)
+		resync = true
+	}
+
+	if resync {
+		event, _ := NewEvent(EventResyncRequired, now, ResyncEvent{
+			RoomID: cl.RoomID,
+			Reason: ResyncReasonReplayGap,
+			Seq:    current,
+		})
+		if err := cl.send(newEventMessage(cl.RoomID, event, now)); err != nil {
+			log.Printf("Error sending resync to client %s: %v", cl.ID, err)
+		}
+		cl.setSeq(current)
+		return
+	}
+
+	for _, event := range missed {
+		if err := cl.send(newEventMessage(cl.RoomID, event, now)); err != nil {
+			log.Printf("Error replaying events to client %s: %v", cl.ID, err)
+			return
+		}
+	}
+}
+
+// trackPresence keeps the presence record of cl alive until it disconnects.
+func (h *Handler) trackPresence(cl *WSClient) {
+	if h.presence == nil || cl.TenantID == "" {
+		return
+	}
+
+	ctx := context.Background()
+	conn := cl.presenceConnection()
+	if err := h.presence.Connect(ctx, conn); err != nil {
+		log.Printf("Presence connect failed for client %s: %v", cl.ID, err)
+	}
+	conn.Status = PresenceOnline
+
+	ticker := time.NewTicker(presenceHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-cl.done:
+			if err := h.presence.Disconnect(ctx, conn); err != nil {
+				log.Printf("Presence disconnect failed for client %s: %v", cl.ID, err)
+			}
+			return
+		case status := <-cl.presence:
+			if err := h.presence.SetStatus(ctx, conn, status); err != nil {
+				log.Printf("Presence update failed for client %s: %v", cl.ID, err)
+				continue
+			}
+			conn.Status = status
+		case <-ticker.C:
+			if err := h.presence.Heartbeat(ctx, conn); err != nil {
+				log.Printf("Presence heartbeat failed for client %s: %v", cl.ID, err)
+			}
+		}
+	}
+}
+
+// MaintainPresence periodically clears the presence of connections whose
+// replica stopped sending heartbeats. Every replica runs it, but only the one
+// holding the sweep lock for an interval does the work.
+func (h *Handler) MaintainPresence() {
+	if h.presence == nil {
+		return
+	}
+
+	ticker := time.NewTicker(presenceSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := h.presence.Sweep(context.Background()); err != nil {
+			log.Printf("Presence sweep failed: %v", err)
+		}
+	}
+}
+
+// MaintainTyping publishes typing.stop for the indicators of this replica's
+// sockets that timed out without one.
+func (h *Handler) MaintainTyping() {
+	ticker := time.NewTicker(typingSweepInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		h.typing.sweep()
+	}
+}
+
 func (h *Handler) GetRooms(w http.ResponseWriter, r *http.Request) {
 	rooms := make([]RoomRes, 0)
 
-	for _, room := range h.hub.Rooms {
+	for _, id := range h.hub.RoomIDs() {
 		rooms = append(rooms, RoomRes{
-			ID: room.Id,
+			ID: id,
 		})
 	}
 
@@ -131,22 +290,12 @@ func (h *Handler) GetRooms(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(rooms)
 }
 
-func (h *Handler) NotifyRoom(roomID string, payload interface{}) {
+func (h *Handler) NotifyRoom(roomID string, event Event) {
 	if h == nil || h.hub == nil {
 		return
 	}
 
-	messageJSON, err := json.Marshal(payload)
-	if err != nil {
-		log.Printf("failed to marshal websocket payload for room %s: %v", roomID, err)
-		return
-	}
-
-	h.hub.Broadcast <- &WSMessage{
-		Content:   string(messageJSON),
-		RoomID:    roomID,
-		Timestamp: time.Now().Unix(),
-	}
+	h.hub.Broadcast <- newEventMessage(roomID, event, time.Now())
 }
 
 // func (h *Handler) Notify(createdMessage *dto.ChatMessageWithUserClientDTO, websocketRoomId string) {
@@ -167,9 +316,3 @@ func (h *Handler) NotifyRoom(roomID string, payload interface{}) {
 // 		log.Printf("Error publishing notification to Redis: %v", err)
 // 	}
 // }
-
-func (h *Handler) SubscribeToRedisChannels() {
-	for _, room := range h.hub.Rooms {
-		go h.subscribeToRoomChannel(room.Id)
-	}
-}
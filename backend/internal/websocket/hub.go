@@ -1,69 +1,192 @@
 package websocket
 
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// roomIdleTimeout is how long a room stays open after its last client left,
+	// so a quick reconnect finds it instead of recreating it.
+	roomIdleTimeout = time.Minute
+	// roomSweepInterval is how often idle rooms are torn down.
+	roomSweepInterval = 15 * time.Second
+)
+
+// Hub owns the rooms of this replica. Rooms and their clients are only read
+// and written by the Run goroutine; everything else goes through the hub
+// channels or do.
 type Hub struct {
-	Rooms      map[string]*Room
+	rooms      map[string]*Room
 	Register   chan *WSClient
 	Unregister chan *WSClient
 	Broadcast  chan *WSMessage
+	calls      chan func()
+	now        func() time.Time
+	policies   map[string]ConsumerPolicy
+	blocked    map[chan *WSMessage]*blockedQueue // Pending sends of PolicyBlock, by client queue
 }
 
 func NewHub() *Hub {
 	return &Hub{
-		Rooms:      make(map[string]*Room),
+		rooms:      make(map[string]*Room),
 		Register:   make(chan *WSClient),
 		Unregister: make(chan *WSClient),
 		Broadcast:  make(chan *WSMessage),
+		calls:      make(chan func()),
+		now:        time.Now,
+		policies:   DefaultConsumerPolicies(),
+		blocked:    make(map[chan *WSMessage]*blockedQueue),
+	}
+}
+
+// SetConsumerPolicies replaces the slow-consumer policies of the room types in
+// policies. It must be called before Run.
+func (h *Hub) SetConsumerPolicies(policies map[string]ConsumerPolicy) error {
+	for roomType, policy := range policies {
+		if _, ok := h.policies[roomType]; !ok {
+			return fmt.Errorf("websocket policy: unknown room type %q", roomType)
+		}
+		if err := policy.validate(); err != nil {
+			return fmt.Errorf("websocket policy: %s rooms: %w", roomType, err)
+		}
+		h.policies[roomType] = policy
 	}
+	return nil
+}
+
+// clientBuffer is the message buffer size of clients joining roomID.
+func (h *Hub) clientBuffer(roomID string) int {
+	return h.policies[roomTypeOf(roomID)].Buffer
 }
 
 func (h *Hub) Run() {
+	sweep := time.NewTicker(roomSweepInterval)
+	defer sweep.Stop()
+
 	for {
 		select {
 		case client := <-h.Register:
-			room, ok := h.Rooms[client.RoomID]
-			if !ok {
-				// Handle the case where the room does not exist
-				// For example, create a new room or log an error
-				// In this example, we simply log and ignore the client registration
-				continue
+			room := h.openRoom(client.RoomID)
+			room.Clients[client.connID] = client
+			room.emptySince = time.Time{}
+			if !client.isSubscription() {
+				incConnections()
 			}
-			room.Clients[client.ID] = client
-			incConnections()
 
 		case client := <-h.Unregister:
-			room, ok := h.Rooms[client.RoomID]
+			room, ok := h.rooms[client.RoomID]
 			if !ok {
-				// Handle the case where the room does not exist
-				// Just log a message and ignore the client unregistration
 				continue
 			}
-			if _, ok := room.Clients[client.ID]; ok {
-				delete(room.Clients, client.ID)
-				close(client.Message)
-				decConnections()
+			// The hub may already have dropped the client, and the same
+			// connection ID must not remove a newer client.
+			if existing, ok := room.Clients[client.connID]; ok && existing == client {
+				h.removeClient(room, client)
 			}
 
 		case message := <-h.Broadcast:
-			room, ok := h.Rooms[message.RoomID]
-			if !ok {
-				// Handle the case where the room does not exist
-				// Just log a message and ignore the broadcast
-				continue
-			}
-			delivered := 0
-			for _, client := range room.Clients {
-				select {
-				case client.Message <- message:
-					delivered++
-				default:
-					close(client.Message)
-					delete(room.Clients, client.ID)
-					decConnections()
-				}
-			}
-			if delivered > 0 {
-				addDelivered(delivered)
-			}
+			h.deliver(message)
+
+		case call := <-h.calls:
+			call()
+
+		case <-sweep.C:
+			h.closeIdleRooms(h.now())
 		}
 	}
 }
+
+// do runs fn on the Run goroutine and waits for it to return.
+func (h *Hub) do(fn func()) {
+	done := make(chan struct{})
+	h.calls <- func() {
+		fn()
+		close(done)
+	}
+	<-done
+}
+
+// RoomIDs returns the IDs of the rooms currently open on this replica.
+func (h *Hub) RoomIDs() []string {
+	var ids []string
+	h.do(func() {
+		ids = make([]string, 0, len(h.rooms))
+		for id := range h.rooms {
+			ids = append(ids, id)
+		}
+	})
+	return ids
+}
+
+// openRoom returns the room roomID, creating it when this replica has no
+// client in it yet.
+func (h *Hub) openRoom(roomID string) *Room {
+	if room, ok := h.rooms[roomID]; ok {
+		return room
+	}
+
+	room := &Room{
+		Id:      roomID,
+		Clients: make(map[string]*WSClient),
+	}
+	h.rooms[roomID] = room
+	setRooms(len(h.rooms))
+	return room
+}
+
+// removeClient detaches client from room and closes its message channel,
+// unless the members of an agent socket share it. The room starts idling once
+// its last client is gone.
+func (h *Hub) removeClient(room *Room, client *WSClient) {
+	delete(room.Clients, client.connID)
+	if client.mux == nil {
+		h.stopBlocked(client)
+		close(client.Message)
+	}
+	if !client.isSubscription() {
+		decConnections()
+	}
+	if len(room.Clients) == 0 {
+		room.emptySince = h.now()
+	}
+}
+
+// closeIdleRooms tears down the rooms that have been empty for
+// roomIdleTimeout.
+func (h *Hub) closeIdleRooms(now time.Time) {
+	for id, room := range h.rooms {
+		if len(room.Clients) > 0 || room.emptySince.IsZero() || now.Sub(room.emptySince) < roomIdleTimeout {
+			continue
+		}
+		delete(h.rooms, id)
+	}
+	setRooms(len(h.rooms))
+}
+
+// deliver sends message to every client in its room, except the sockets of
+// the participant that caused it. Clients whose buffer is full are handled by
+// the slow-consumer policy of the room.
+func (h *Hub) deliver(message *WSMessage) {
+	room, ok := h.rooms[message.RoomID]
+	if !ok {
+		// Nobody on this replica is in the room; the broker subscription
+		// still hands us its events.
+		return
+	}
+	if message.Event != nil && message.Event.Seq > room.lastSeq {
+		room.lastSeq = message.Event.Seq
+	}
+	delivered := 0
+	for _, client := range room.Clients {
+		if message.sender.senderID != "" && client.ID == message.sender.senderID && client.SenderType == message.sender.senderType {
+			continue
+		}
+		if h.enqueue(room, client, message) {
+			delivered++
+		}
+	}
+	if delivered > 0 {
+		addDelivered(delivered)
+	}
+}
@@ -0,0 +1,117 @@
+package websocket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestHub(now *time.Time) *Hub {
+	hub := NewHub()
+	if now != nil {
+		hub.now = func() time.Time { return *now }
+	}
+	go hub.Run()
+	return hub
+}
+
+func newHubTestClient(roomID, id, connID string) *WSClient {
+	return &WSClient{
+		ID:         id,
+		RoomID:     roomID,
+		SenderType: SenderAgent,
+		Message:    make(chan *WSMessage, 10),
+		connID:     connID,
+	}
+}
+
+func TestHubConcurrentJoinsAndLeaves(t *testing.T) {
+	hub := newTestHub(nil)
+
+	const workers = 50
+	const rounds = 20
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			roomID := fmt.Sprintf("conv-%d", w%5)
+			for i := 0; i < rounds; i++ {
+				client := newHubTestClient(roomID, fmt.Sprintf("agent-%d", w), fmt.Sprintf("conn-%d-%d", w, i))
+				hub.Register <- client
+				hub.Broadcast <- &WSMessage{RoomID: roomID, Content: "hello"}
+				if i%5 == 0 {
+					hub.RoomIDs()
+				}
+				hub.Unregister <- client
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	var rooms, clients int
+	hub.do(func() {
+		rooms = len(hub.rooms)
+		for _, room := range hub.rooms {
+			clients += len(room.Clients)
+		}
+	})
+	if rooms != 5 || clients != 0 {
+		t.Fatalf("expected 5 empty rooms, got %d rooms with %d clients", rooms, clients)
+	}
+
+	hub.do(func() { hub.closeIdleRooms(time.Now().Add(roomIdleTimeout)) })
+	if ids := hub.RoomIDs(); len(ids) != 0 {
+		t.Fatalf("expected idle rooms to be closed, got %v", ids)
+	}
+}
+
+func TestHubClosesRoomOnlyAfterIdleTimeout(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	hub := newTestHub(&now)
+
+	first := newHubTestClient("conv-1", "agent-1", "conn-1")
+	hub.Register <- first
+	hub.Unregister <- first
+
+	hub.do(func() { hub.closeIdleRooms(now.Add(roomIdleTimeout / 2)) })
+	if ids := hub.RoomIDs(); len(ids) != 1 {
+		t.Fatalf("expected the room to idle before closing, got %v", ids)
+	}
+
+	second := newHubTestClient("conv-1", "agent-1", "conn-2")
+	hub.Register <- second
+	hub.do(func() { hub.closeIdleRooms(now.Add(2 * roomIdleTimeout)) })
+	if ids := hub.RoomIDs(); len(ids) != 1 {
+		t.Fatalf("expected an occupied room to stay open, got %v", ids)
+	}
+
+	now = now.Add(2 * roomIdleTimeout)
+	hub.Unregister <- second
+	hub.do(func() { hub.closeIdleRooms(now.Add(roomIdleTimeout)) })
+	if ids := hub.RoomIDs(); len(ids) != 0 {
+		t.Fatalf("expected the room to close, got %v", ids)
+	}
+}
+
+func TestHubKeepsOtherSocketsOfSameParticipant(t *testing.T) {
+	hub := newTestHub(nil)
+
+	tab1 := newHubTestClient("conv-1", "agent-1", "conn-1")
+	tab2 := newHubTestClient("conv-1", "agent-1", "conn-2")
+	hub.Register <- tab1
+	hub.Register <- tab2
+	hub.Unregister <- tab1
+
+	hub.Broadcast <- &WSMessage{RoomID: "conv-1", Content: "hello"}
+	hub.do(func() {})
+	select {
+	case msg := <-tab2.Message:
+		if msg.Content != "hello" {
+			t.Fatalf("unexpected message %+v", msg)
+		}
+	default:
+		t.Fatal("expected the remaining socket to receive the broadcast")
+	}
+}
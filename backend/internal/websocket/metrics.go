@@ -21,10 +21,30 @@ var (
 			Help: "Total websocket messages delivered to clients.",
 		},
 	)
+	wsMessagesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_app_ws_messages_dropped_total",
+			Help: "Total websocket messages dropped for slow clients, by room type and reason.",
+		},
+		[]string{"room_type", "reason"},
+	)
+	wsSlowConsumerDisconnects = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "chat_app_ws_slow_consumer_disconnects_total",
+			Help: "Total websocket clients disconnected for not keeping up, by room type and policy.",
+		},
+		[]string{"room_type", "policy"},
+	)
+)
+
+// Reasons reported on chat_app_ws_messages_dropped_total.
+const (
+	dropReasonOverflow  = "overflow"
+	dropReasonCoalesced = "coalesced"
 )
 
 func init() {
-	prometheus.MustRegister(wsConnections, wsRooms, wsMessagesDelivered)
+	prometheus.MustRegister(wsConnections, wsRooms, wsMessagesDelivered, wsMessagesDropped, wsSlowConsumerDisconnects)
 }
 
 func incConnections() {
@@ -42,3 +62,13 @@ func setRooms(count int) {
 func addDelivered(count int) {
 	wsMessagesDelivered.Add(float64(count))
 }
+
+func addDropped(roomType, reason string, count int) {
+	if count > 0 {
+		wsMessagesDropped.WithLabelValues(roomType, reason).Add(float64(count))
+	}
+}
+
+func incSlowConsumerDisconnects(roomType, policy string) {
+	wsSlowConsumerDisconnects.WithLabelValues(roomType, policy).Inc()
+}
@@ -0,0 +1,265 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// maxSubscriptions bounds how many conversations one agent socket follows.
+	maxSubscriptions = 500
+	// subscribeTimeout bounds authorizing one subscribe frame.
+	subscribeTimeout = 5 * time.Second
+)
+
+// Frame types written to an agent socket in reply to its subscribe and
+// unsubscribe frames.
+const (
+	FrameSubscribed        = "subscribed"
+	FrameUnsubscribed      = "unsubscribed"
+	FrameSubscriptionError = "subscription.error"
+)
+
+// ConversationAuthorizer decides whether an agent may follow a conversation
+// over its agent socket. It returns a *CommandError for refusals the client
+// can act on.
+type ConversationAuthorizer interface {
+	AuthorizeConversation(ctx context.Context, tenantID, userID, conversationID string) error
+}
+
+// SetConversationAuthorizer sets what authorizes the subscriptions of agent
+// sockets; without one, subscribe frames are rejected.
+func (h *Handler) SetConversationAuthorizer(authorizer ConversationAuthorizer) {
+	h.conversations = authorizer
+}
+
+// muxConn is an agent socket together with the conversations it subscribed
+// to. Each subscription is a client of its conversation room that shares the
+// socket's queue and connection ID but keeps its own place in the room log,
+// so the hub delivers to it like to any other client.
+type muxConn struct {
+	conn     *WSClient
+	mu       sync.Mutex
+	subs     map[string]*WSClient // Subscriptions by conversation ID
+	resync   atomic.Bool          // Set when any member has a resync pending
+	kicked   chan struct{}        // Closed when the hub drops the socket
+	kickOnce sync.Once
+}
+
+func newMuxConn(conn *WSClient) *muxConn {
+	return &muxConn{
+		conn:   conn,
+		subs:   make(map[string]*WSClient),
+		kicked: make(chan struct{}),
+	}
+}
+
+// subscription returns the subscription of roomID, or nil.
+func (m *muxConn) subscription(roomID string) *WSClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.subs[roomID]
+}
+
+// add records sub unless the socket already follows maxSubscriptions
+// conversations.
+func (m *muxConn) add(sub *WSClient) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.subs) >= maxSubscriptions {
+		return false
+	}
+	m.subs[sub.RoomID] = sub
+	return true
+}
+
+// remove forgets the subscription of roomID and returns it, or nil.
+func (m *muxConn) remove(roomID string) *WSClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub := m.subs[roomID]
+	delete(m.subs, roomID)
+	return sub
+}
+
+// removeAll forgets every subscription and returns them.
+func (m *muxConn) removeAll() []*WSClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	subs := make([]*WSClient, 0, len(m.subs))
+	for roomID, sub := range m.subs {
+		subs = append(subs, sub)
+		delete(m.subs, roomID)
+	}
+	return subs
+}
+
+// members returns the socket's own client followed by its subscriptions.
+func (m *muxConn) members() []*WSClient {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := make([]*WSClient, 0, len(m.subs)+1)
+	members = append(members, m.conn)
+	for _, sub := range m.subs {
+		members = append(members, sub)
+	}
+	return members
+}
+
+// kick makes the writer close the socket. The hub uses it instead of closing
+// the queue, which the socket's members share.
+func (m *muxConn) kick() {
+	m.kickOnce.Do(func() {
+		close(m.kicked)
+	})
+}
+
+// taggedEvent is an event of a subscribed conversation as written to an
+// agent socket.
+type taggedEvent struct {
+	*Event
+	ConversationID string `json:"conversationId"`
+}
+
+// subscriptionFrame answers a subscribe or unsubscribe frame.
+type subscriptionFrame struct {
+	Type           string        `json:"type"`
+	ConversationID string        `json:"conversationId"`
+	Error          *CommandError `json:"error,omitempty"`
+}
+
+// JoinAgent upgrades the request to an agent socket. It starts out in roomId,
+// the notification room of the agent, and follows the conversations the
+// agent subscribes to with subscribe frames; their events arrive tagged with
+// conversationId. Agent sockets always use ProtocolEnvelope.
+func (h *Handler) JoinAgent(w http.ResponseWriter, r *http.Request, roomId, userId, tenantID string) {
+	if h.refuseWhileDraining(w) {
+		return
+	}
+	lastSeq, replay, err := parseLastSeq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cl := h.newClient(roomId, userId, SenderAgent, tenantID, ProtocolEnvelope, conn)
+	cl.Conn = conn
+	cl.mux = newMuxConn(cl)
+	h.register(cl, lastSeq, replay)
+
+	go h.trackPresence(cl)
+	go cl.keepAlive()
+	go cl.writeMessage()
+	go cl.readMessage(h)
+}
+
+// subscribe starts delivering the events of the conversation of frame to the
+// agent socket cl, after the events following frame.LastSeq when it is set.
+func (h *Handler) subscribe(cl *WSClient, frame clientFrame) {
+	sub, err := h.addSubscription(cl, frame)
+	reply := subscriptionFrame{Type: FrameSubscribed, ConversationID: frame.ConversationID}
+	if err != nil {
+		reply = subscriptionFrame{Type: FrameSubscriptionError, ConversationID: frame.ConversationID, Error: subscriptionError(cl, frame, err)}
+	}
+	if err := cl.reply(reply); err != nil && err != errClientClosed {
+		log.Printf("Error replying to subscribe from client %s: %v", cl.ID, err)
+	}
+	if sub == nil {
+		return
+	}
+
+	// The subscription joins its room once the client knows about it, so no
+	// event of the conversation arrives before the reply.
+	var lastSeq int64
+	if frame.LastSeq != nil {
+		lastSeq = *frame.LastSeq
+	}
+	h.register(sub, lastSeq, frame.LastSeq != nil)
+}
+
+// addSubscription authorizes frame and records its subscription on cl. It
+// returns no subscription for a conversation cl already follows.
+func (h *Handler) addSubscription(cl *WSClient, frame clientFrame) (*WSClient, error) {
+	if cl.mux == nil {
+		return nil, &CommandError{Code: CommandErrorForbidden, Message: "only agent sockets can subscribe"}
+	}
+	if frame.ConversationID == "" || frame.ConversationID == cl.RoomID {
+		return nil, &CommandError{Code: CommandErrorValidation, Message: "conversationId must name a conversation"}
+	}
+	if frame.LastSeq != nil && *frame.LastSeq < 0 {
+		return nil, &CommandError{Code: CommandErrorValidation, Message: "lastSeq must not be negative"}
+	}
+	if cl.mux.subscription(frame.ConversationID) != nil {
+		return nil, nil
+	}
+	if h.conversations == nil {
+		return nil, &CommandError{Code: CommandErrorUnavailable, Message: "subscriptions are not available"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), subscribeTimeout)
+	defer cancel()
+	if err := h.conversations.AuthorizeConversation(ctx, cl.TenantID, cl.ID, frame.ConversationID); err != nil {
+		return nil, err
+	}
+
+	sub := &WSClient{
+		Message:    cl.Message,
+		ID:         cl.ID,
+		RoomID:     frame.ConversationID,
+		SenderType: SenderAgent,
+		TenantID:   cl.TenantID,
+		Protocol:   ProtocolEnvelope,
+		writer:     cl.writer,
+		mux:        cl.mux,
+		connID:     cl.connID,
+	}
+	if !cl.mux.add(sub) {
+		return nil, &CommandError{Code: CommandErrorValidation, Message: "too many subscriptions"}
+	}
+	return sub, nil
+}
+
+// subscriptionError is the error reported for a failed subscribe frame.
+// Other errors are logged and reported as CommandErrorInternal.
+func subscriptionError(cl *WSClient, frame clientFrame, err error) *CommandError {
+	var cmdErr *CommandError
+	if errors.As(err, &cmdErr) {
+		return cmdErr
+	}
+	log.Printf("subscribe from client %s to conversation %s failed: %v", cl.ID, frame.ConversationID, err)
+	return &CommandError{Code: CommandErrorInternal, Message: "failed to subscribe"}
+}
+
+// unsubscribe stops delivering the events of the conversation of frame to
+// the agent socket cl. Events of it that are already queued are skipped.
+func (h *Handler) unsubscribe(cl *WSClient, frame clientFrame) {
+	reply := subscriptionFrame{Type: FrameUnsubscribed, ConversationID: frame.ConversationID}
+	var sub *WSClient
+	if cl.mux != nil && frame.ConversationID != "" {
+		sub = cl.mux.remove(frame.ConversationID)
+	}
+	if sub == nil {
+		reply = subscriptionFrame{
+			Type:           FrameSubscriptionError,
+			ConversationID: frame.ConversationID,
+			Error:          &CommandError{Code: CommandErrorValidation, Message: "not subscribed to this conversation"},
+		}
+	} else {
+		h.typing.disconnect(sub)
+		h.hub.Unregister <- sub
+	}
+	if err := cl.reply(reply); err != nil && err != errClientClosed {
+		log.Printf("Error replying to unsubscribe from client %s: %v", cl.ID, err)
+	}
+}
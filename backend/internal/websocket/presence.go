@@ -0,0 +1,357 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Presence statuses reported for tenant users and visitors.
+const (
+	PresenceOnline  = "online"
+	PresenceAway    = "away"
+	PresenceOffline = "offline"
+)
+
+const (
+	// presenceHeartbeatInterval is how often every connection refreshes its
+	// presence record.
+	presenceHeartbeatInterval = 30 * time.Second
+	// presenceTTL expires the record of a connection whose replica stopped
+	// sending heartbeats, for example because it crashed.
+	presenceTTL = 75 * time.Second
+	// presenceSweepInterval is how often expired records are cleared. Only the
+	// replica holding the sweep lock for the interval does it.
+	presenceSweepInterval = 30 * time.Second
+)
+
+// PresenceConnection is the heartbeat record of a single socket.
+type PresenceConnection struct {
+	ConnectionID    string
+	TenantID        string
+	ParticipantType string
+	ParticipantID   string
+	ConversationID  string
+	Status          string
+	LastSeenAt      time.Time
+	ExpiresAt       time.Time
+}
+
+// PresenceEntry is the presence of one participant across all its sockets.
+type PresenceEntry struct {
+	ParticipantType string
+	ParticipantID   string
+	Status          string
+	ConversationIDs []string
+	LastSeenAt      time.Time
+}
+
+// PresenceTransition reports how a store operation changed the presence of
+// one participant. Previous equals Entry.Status when nothing changed.
+type PresenceTransition struct {
+	Entry    PresenceEntry
+	Previous string
+}
+
+func (t PresenceTransition) changed() bool {
+	return t.Previous != t.Entry.Status
+}
+
+// PresenceFilter narrows Presence.List. Empty fields match everything.
+type PresenceFilter struct {
+	ParticipantType string
+	ConversationID  string
+}
+
+// PresenceEvent is the payload of presence.changed.
+type PresenceEvent struct {
+	ParticipantType string   `json:"participantType"`
+	ParticipantID   string   `json:"participantId"`
+	Status          string   `json:"status"`
+	PreviousStatus  string   `json:"previousStatus"`
+	ConversationIDs []string `json:"conversationIds,omitempty"`
+	LastSeenAt      string   `json:"lastSeenAt"`
+}
+
+// PresenceStore keeps the heartbeat records of every replica. Put, Remove
+// and Expire apply the record change and recompute the participant status in
+// one atomic step, so exactly one caller observes each transition.
+type PresenceStore interface {
+	Put(ctx context.Context, conn PresenceConnection) (PresenceTransition, error)
+	Remove(ctx context.Context, conn PresenceConnection, now time.Time) (PresenceTransition, error)
+	// Expire removes the records of tenantID that expired by now and returns
+	// the transitions it caused.
+	Expire(ctx context.Context, tenantID string, now time.Time) ([]PresenceTransition, error)
+	Participants(ctx context.Context, tenantID string, now time.Time) ([]PresenceEntry, error)
+	// Statuses returns the status of each participant that is not offline.
+	Statuses(ctx context.Context, tenantID, participantType string, participantIDs []string) (map[string]string, error)
+	Tenants(ctx context.Context) ([]string, error)
+	// AcquireSweep reports whether the caller may sweep for the next ttl.
+	AcquireSweep(ctx context.Context, ttl time.Duration) (bool, error)
+}
+
+// Presence tracks which tenant users and visitors are connected and emits
+// presence.changed to the tenant notification room when that changes.
+type Presence struct {
+	store   PresenceStore
+	now     func() time.Time
+	publish func(roomID string, event Event)
+}
+
+// NewPresence returns a Presence that keeps its records next to the room logs
+// of broker and publishes presence.changed through it.
+func NewPresence(broker Broker) *Presence {
+	var store PresenceStore
+	switch b := broker.(type) {
+	case *RedisBroker:
+		store = newRedisPresenceStore(b.client)
+	case *MemoryBroker:
+		store = b.presence
+	default:
+		store = NewMemoryPresenceStore()
+	}
+	return NewPresenceWithStore(store, time.Now, func(roomID string, event Event) {
+		if _, err := broker.Publish(context.Background(), roomID, event); err != nil {
+			log.Printf("failed to publish presence event for room %s: %v", roomID, err)
+		}
+	})
+}
+
+func NewPresenceWithStore(store PresenceStore, now func() time.Time, publish func(roomID string, event Event)) *Presence {
+	if now == nil {
+		now = time.Now
+	}
+	return &Presence{
+		store:   store,
+		now:     now,
+		publish: publish,
+	}
+}
+
+// Connect records a new socket with status online.
+func (p *Presence) Connect(ctx context.Context, conn PresenceConnection) error {
+	conn.Status = PresenceOnline
+	return p.put(ctx, conn)
+}
+
+// Heartbeat extends the record of a socket that is still open.
+func (p *Presence) Heartbeat(ctx context.Context, conn PresenceConnection) error {
+	return p.put(ctx, conn)
+}
+
+// SetStatus switches a socket between online and away.
+func (p *Presence) SetStatus(ctx context.Context, conn PresenceConnection, status string) error {
+	if status != PresenceOnline && status != PresenceAway {
+		return fmt.Errorf("presence: invalid status %q", status)
+	}
+	conn.Status = status
+	return p.put(ctx, conn)
+}
+
+// Disconnect removes the record of a closed socket.
+func (p *Presence) Disconnect(ctx context.Context, conn PresenceConnection) error {
+	transition, err := p.store.Remove(ctx, conn, p.now())
+	if err != nil {
+		return fmt.Errorf("presence: remove connection: %w", err)
+	}
+	return p.notify(conn.TenantID, transition)
+}
+
+// Sweep clears the records whose heartbeats stopped and announces the
+// participants that went offline because of it. It does nothing when another
+// replica swept during the current interval.
+func (p *Presence) Sweep(ctx context.Context) error {
+	acquired, err := p.store.AcquireSweep(ctx, presenceSweepInterval)
+	if err != nil {
+		return fmt.Errorf("presence: acquire sweep: %w", err)
+	}
+	if !acquired {
+		return nil
+	}
+
+	tenants, err := p.store.Tenants(ctx)
+	if err != nil {
+		return fmt.Errorf("presence: list tenants: %w", err)
+	}
+
+	now := p.now()
+	for _, tenantID := range tenants {
+		transitions, err := p.store.Expire(ctx, tenantID, now)
+		if err != nil {
+			return fmt.Errorf("presence: expire connections: %w", err)
+		}
+		for _, transition := range transitions {
+			if err := p.notify(tenantID, transition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// List returns the presence of every participant of tenantID that matches
+// filter and is not offline.
+func (p *Presence) List(ctx context.Context, tenantID string, filter PresenceFilter) ([]PresenceEntry, error) {
+	participants, err := p.store.Participants(ctx, tenantID, p.now())
+	if err != nil {
+		return nil, fmt.Errorf("presence: list participants: %w", err)
+	}
+
+	entries := make([]PresenceEntry, 0, len(participants))
+	for _, entry := range participants {
+		if filter.ParticipantType != "" && entry.ParticipantType != filter.ParticipantType {
+			continue
+		}
+		if filter.ConversationID != "" && !containsString(entry.ConversationIDs, filter.ConversationID) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].ParticipantType != entries[j].ParticipantType {
+			return entries[i].ParticipantType < entries[j].ParticipantType
+		}
+		return entries[i].ParticipantID < entries[j].ParticipantID
+	})
+	return entries, nil
+}
+
+// AvailableAgents returns the userIDs with an online socket. It lets the
+// conversation service route new conversations to connected agents only.
+func (p *Presence) AvailableAgents(ctx context.Context, tenantID string, userIDs []string) ([]string, error) {
+	statuses, err := p.store.Statuses(ctx, tenantID, SenderAgent, userIDs)
+	if err != nil {
+		return nil, fmt.Errorf("presence: read statuses: %w", err)
+	}
+
+	available := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if statuses[userID] == PresenceOnline {
+			available = append(available, userID)
+		}
+	}
+	return available, nil
+}
+
+func (p *Presence) put(ctx context.Context, conn PresenceConnection) error {
+	now := p.now()
+	conn.LastSeenAt = now
+	conn.ExpiresAt = now.Add(presenceTTL)
+
+	transition, err := p.store.Put(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("presence: store connection: %w", err)
+	}
+	return p.notify(conn.TenantID, transition)
+}
+
+// notify publishes presence.changed for transition when the status changed.
+func (p *Presence) notify(tenantID string, transition PresenceTransition) error {
+	if !transition.changed() || p.publish == nil {
+		return nil
+	}
+
+	entry := transition.Entry
+	event, err := NewEvent(EventPresenceChanged, p.now(), PresenceEvent{
+		ParticipantType: entry.ParticipantType,
+		ParticipantID:   entry.ParticipantID,
+		Status:          entry.Status,
+		PreviousStatus:  transition.Previous,
+		ConversationIDs: entry.ConversationIDs,
+		LastSeenAt:      entry.LastSeenAt.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	p.publish(TenantNotificationRoomID(tenantID), event)
+	return nil
+}
+
+// aggregatePresence folds the live connections of one participant into its
+// entry: online when any socket is online, away when all are away, offline
+// without any. removed supplies the conversation and last-seen time of a
+// participant that just went offline.
+func aggregatePresence(participantType, participantID string, conns []PresenceConnection, removed *PresenceConnection, now time.Time) PresenceEntry {
+	entry := PresenceEntry{
+		ParticipantType: participantType,
+		ParticipantID:   participantID,
+		Status:          PresenceOffline,
+	}
+	for _, conn := range conns {
+		if !now.Before(conn.ExpiresAt) {
+			continue
+		}
+		if conn.Status == PresenceOnline {
+			entry.Status = PresenceOnline
+		} else if entry.Status == PresenceOffline {
+			entry.Status = PresenceAway
+		}
+		entry.ConversationIDs = appendConversation(entry.ConversationIDs, conn.ConversationID)
+		if conn.LastSeenAt.After(entry.LastSeenAt) {
+			entry.LastSeenAt = conn.LastSeenAt
+		}
+	}
+
+	if entry.Status == PresenceOffline && removed != nil {
+		entry.ConversationIDs = appendConversation(nil, removed.ConversationID)
+		entry.LastSeenAt = removed.LastSeenAt
+	}
+	return entry
+}
+
+func appendConversation(ids []string, conversationID string) []string {
+	if conversationID == "" || containsString(ids, conversationID) {
+		return ids
+	}
+	ids = append(ids, conversationID)
+	sort.Strings(ids)
+	return ids
+}
+
+func participantKey(participantType, participantID string) string {
+	return participantType + ":" + participantID
+}
+
+func splitParticipantKey(key string) (string, string) {
+	participantType, participantID, _ := strings.Cut(key, ":")
+	return participantType, participantID
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
+
+// TenantNotificationRoomID is the room every agent of tenantID listens on.
+func TenantNotificationRoomID(tenantID string) string {
+	tenantID = strings.TrimSpace(tenantID)
+	if tenantID == "" {
+		return ""
+	}
+	return fmt.Sprintf("tenant:%s:notifications", tenantID)
+}
+
+// UserNotificationRoomID is the personal room of one agent of tenantID. Events
+// meant for that agent only, such as being assigned a conversation, go there.
+func UserNotificationRoomID(tenantID, userID string) string {
+	tenantID = strings.TrimSpace(tenantID)
+	userID = strings.TrimSpace(userID)
+	if tenantID == "" || userID == "" {
+		return ""
+	}
+	return fmt.Sprintf("tenant:%s:user:%s:notifications", tenantID, userID)
+}
+
+// isNotificationRoom reports whether roomID is a tenant or personal
+// notification room rather than a conversation.
+func isNotificationRoom(roomID string) bool {
+	return strings.HasPrefix(roomID, "tenant:") && strings.HasSuffix(roomID, ":notifications")
+}
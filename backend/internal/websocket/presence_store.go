@@ -0,0 +1,439 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// presenceRecord is how a connection is stored in Redis. Times are unix
+// milliseconds so the transition script can compare them.
+type presenceRecord struct {
+	ConnectionID   string `json:"connectionId"`
+	ConversationID string `json:"conversationId,omitempty"`
+	Status         string `json:"status"`
+	LastSeenMs     int64  `json:"lastSeenMs"`
+	ExpiresAtMs    int64  `json:"expiresAtMs"`
+}
+
+// presenceTransitionScript changes one connection record and recomputes the
+// status of its participant in the same step, so that concurrent replicas
+// never both observe (and announce) the same transition.
+//
+// KEYS: participant connections hash, tenant status hash, tenant expiry set.
+// ARGV: op (put, remove or expire), participant key, connection id, record,
+// expiry in ms, now in ms, key TTL in ms.
+//
+// It returns the previous status, the new status, the last-seen time in ms
+// and the conversation IDs of the participant.
+var presenceTransitionScript = redis.NewScript(`
+local participant = ARGV[2]
+local member = participant .. '|' .. ARGV[3]
+local now = tonumber(ARGV[6])
+local before = redis.call('HGET', KEYS[2], participant) or 'offline'
+local removed = false
+
+if ARGV[1] == 'put' then
+  redis.call('HSET', KEYS[1], ARGV[3], ARGV[4])
+  redis.call('ZADD', KEYS[3], ARGV[5], member)
+else
+  if ARGV[1] == 'expire' then
+    local score = redis.call('ZSCORE', KEYS[3], member)
+    if score and tonumber(score) > now then
+      return {before, before, '0'}
+    end
+  end
+  removed = redis.call('HGET', KEYS[1], ARGV[3])
+  redis.call('HDEL', KEYS[1], ARGV[3])
+  redis.call('ZREM', KEYS[3], member)
+  if not removed then
+    return {before, before, '0'}
+  end
+end
+
+local after = 'offline'
+local lastSeen = 0
+local conversations = {}
+local fields = redis.call('HGETALL', KEYS[1])
+for i = 1, #fields, 2 do
+  local record = cjson.decode(fields[i + 1])
+  if record.expiresAtMs > now then
+    if record.status == 'online' then
+      after = 'online'
+    elseif after == 'offline' then
+      after = 'away'
+    end
+    if record.lastSeenMs > lastSeen then
+      lastSeen = record.lastSeenMs
+    end
+    if record.conversationId then
+      table.insert(conversations, record.conversationId)
+    end
+  end
+end
+
+if after == 'offline' then
+  redis.call('HDEL', KEYS[2], participant)
+  if removed then
+    local record = cjson.decode(removed)
+    lastSeen = record.lastSeenMs
+    if record.conversationId then
+      table.insert(conversations, record.conversationId)
+    end
+  end
+else
+  redis.call('HSET', KEYS[2], participant, after)
+end
+
+for i = 1, 3 do
+  redis.call('PEXPIRE', KEYS[i], ARGV[7])
+end
+return {before, after, tostring(lastSeen), unpack(conversations)}
+`)
+
+const (
+	presenceTenantsKey   = "presence:tenants"
+	presenceSweepLockKey = "presence:sweep"
+)
+
+// Every key of a tenant shares a hash tag so the transition script can touch
+// them together.
+func presenceConnectionsKey(tenantID, participant string) string {
+	return "presence:{" + tenantID + "}:connections:" + participant
+}
+
+func presenceStatusKey(tenantID string) string {
+	return "presence:{" + tenantID + "}:status"
+}
+
+func presenceExpiryKey(tenantID string) string {
+	return "presence:{" + tenantID + "}:expiry"
+}
+
+// redisPresenceStore keeps, per tenant, a hash of connection records for each
+// participant, a hash of participant statuses and a sorted set of connection
+// expiries used by the sweep.
+type redisPresenceStore struct {
+	client *redis.Client
+}
+
+func newRedisPresenceStore(client *redis.Client) *redisPresenceStore {
+	return &redisPresenceStore{client: client}
+}
+
+func (s *redisPresenceStore) Put(ctx context.Context, conn PresenceConnection) (PresenceTransition, error) {
+	record, err := json.Marshal(presenceRecord{
+		ConnectionID:   conn.ConnectionID,
+		ConversationID: conn.ConversationID,
+		Status:         conn.Status,
+		LastSeenMs:     conn.LastSeenAt.UnixMilli(),
+		ExpiresAtMs:    conn.ExpiresAt.UnixMilli(),
+	})
+	if err != nil {
+		return PresenceTransition{}, err
+	}
+	if err := s.client.SAdd(ctx, presenceTenantsKey, conn.TenantID).Err(); err != nil {
+		return PresenceTransition{}, err
+	}
+	return s.transition(ctx, "put", conn.TenantID, participantKey(conn.ParticipantType, conn.ParticipantID), conn.ConnectionID, string(record), conn.ExpiresAt.UnixMilli(), conn.LastSeenAt)
+}
+
+func (s *redisPresenceStore) Remove(ctx context.Context, conn PresenceConnection, now time.Time) (PresenceTransition, error) {
+	return s.transition(ctx, "remove", conn.TenantID, participantKey(conn.ParticipantType, conn.ParticipantID), conn.ConnectionID, "", 0, now)
+}
+
+func (s *redisPresenceStore) Expire(ctx context.Context, tenantID string, now time.Time) ([]PresenceTransition, error) {
+	members, err := s.client.ZRangeByScore(ctx, presenceExpiryKey(tenantID), &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(now.UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var transitions []PresenceTransition
+	for _, member := range members {
+		separator := strings.LastIndex(member, "|")
+		if separator < 0 {
+			continue
+		}
+		transition, err := s.transition(ctx, "expire", tenantID, member[:separator], member[separator+1:], "", 0, now)
+		if err != nil {
+			return nil, err
+		}
+		if transition.changed() {
+			transitions = append(transitions, transition)
+		}
+	}
+
+	remaining, err := s.client.ZCard(ctx, presenceExpiryKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if remaining == 0 {
+		if err := s.client.SRem(ctx, presenceTenantsKey, tenantID).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return transitions, nil
+}
+
+func (s *redisPresenceStore) transition(ctx context.Context, op, tenantID, participant, connectionID, record string, expiresAtMs int64, now time.Time) (PresenceTransition, error) {
+	keys := []string{
+		presenceConnectionsKey(tenantID, participant),
+		presenceStatusKey(tenantID),
+		presenceExpiryKey(tenantID),
+	}
+	result, err := presenceTransitionScript.Run(ctx, s.client, keys,
+		op, participant, connectionID, record, expiresAtMs, now.UnixMilli(), (2 * presenceTTL).Milliseconds(),
+	).StringSlice()
+	if err != nil {
+		return PresenceTransition{}, err
+	}
+	if len(result) < 3 {
+		return PresenceTransition{}, fmt.Errorf("unexpected presence script result %v", result)
+	}
+
+	participantType, participantID := splitParticipantKey(participant)
+	entry := PresenceEntry{
+		ParticipantType: participantType,
+		ParticipantID:   participantID,
+		Status:          result[1],
+	}
+	if lastSeenMs, err := strconv.ParseInt(result[2], 10, 64); err == nil && lastSeenMs > 0 {
+		entry.LastSeenAt = time.UnixMilli(lastSeenMs).UTC()
+	}
+	for _, conversationID := range result[3:] {
+		entry.ConversationIDs = appendConversation(entry.ConversationIDs, conversationID)
+	}
+	return PresenceTransition{Entry: entry, Previous: result[0]}, nil
+}
+
+func (s *redisPresenceStore) Participants(ctx context.Context, tenantID string, now time.Time) ([]PresenceEntry, error) {
+	statuses, err := s.client.HGetAll(ctx, presenceStatusKey(tenantID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make([]string, 0, len(statuses))
+	pipe := s.client.Pipeline()
+	cmds := make([]*redis.StringStringMapCmd, 0, len(statuses))
+	for participant := range statuses {
+		participants = append(participants, participant)
+		cmds = append(cmds, pipe.HGetAll(ctx, presenceConnectionsKey(tenantID, participant)))
+	}
+	if len(cmds) > 0 {
+		if _, err := pipe.Exec(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	entries := make([]PresenceEntry, 0, len(participants))
+	for i, participant := range participants {
+		conns := make([]PresenceConnection, 0, len(cmds[i].Val()))
+		for _, raw := range cmds[i].Val() {
+			var record presenceRecord
+			if err := json.Unmarshal([]byte(raw), &record); err != nil {
+				continue
+			}
+			conns = append(conns, PresenceConnection{
+				ConnectionID:   record.ConnectionID,
+				ConversationID: record.ConversationID,
+				Status:         record.Status,
+				LastSeenAt:     time.UnixMilli(record.LastSeenMs).UTC(),
+				ExpiresAt:      time.UnixMilli(record.ExpiresAtMs).UTC(),
+			})
+		}
+
+		participantType, participantID := splitParticipantKey(participant)
+		entry := aggregatePresence(participantType, participantID, conns, nil, now)
+		if entry.Status != PresenceOffline {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *redisPresenceStore) Statuses(ctx context.Context, tenantID, participantType string, participantIDs []string) (map[string]string, error) {
+	statuses := make(map[string]string, len(participantIDs))
+	if len(participantIDs) == 0 {
+		return statuses, nil
+	}
+
+	fields := make([]string, len(participantIDs))
+	for i, participantID := range participantIDs {
+		fields[i] = participantKey(participantType, participantID)
+	}
+	values, err := s.client.HMGet(ctx, presenceStatusKey(tenantID), fields...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, value := range values {
+		if status, ok := value.(string); ok {
+			statuses[participantIDs[i]] = status
+		}
+	}
+	return statuses, nil
+}
+
+func (s *redisPresenceStore) Tenants(ctx context.Context) ([]string, error) {
+	return s.client.SMembers(ctx, presenceTenantsKey).Result()
+}
+
+func (s *redisPresenceStore) AcquireSweep(ctx context.Context, ttl time.Duration) (bool, error) {
+	return s.client.SetNX(ctx, presenceSweepLockKey, "1", ttl).Result()
+}
+
+// MemoryPresenceStore is a PresenceStore for a single process, used by tests
+// and single-replica setups without Redis.
+type MemoryPresenceStore struct {
+	mu       sync.Mutex
+	conns    map[string]map[string]map[string]PresenceConnection
+	statuses map[string]map[string]string
+}
+
+func NewMemoryPresenceStore() *MemoryPresenceStore {
+	return &MemoryPresenceStore{
+		conns:    make(map[string]map[string]map[string]PresenceConnection),
+		statuses: make(map[string]map[string]string),
+	}
+}
+
+func (s *MemoryPresenceStore) Put(_ context.Context, conn PresenceConnection) (PresenceTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	participant := participantKey(conn.ParticipantType, conn.ParticipantID)
+	if s.conns[conn.TenantID] == nil {
+		s.conns[conn.TenantID] = make(map[string]map[string]PresenceConnection)
+	}
+	if s.conns[conn.TenantID][participant] == nil {
+		s.conns[conn.TenantID][participant] = make(map[string]PresenceConnection)
+	}
+	before := s.status(conn.TenantID, participant)
+	s.conns[conn.TenantID][participant][conn.ConnectionID] = conn
+	return s.recompute(conn.TenantID, participant, before, nil, conn.LastSeenAt), nil
+}
+
+func (s *MemoryPresenceStore) Remove(_ context.Context, conn PresenceConnection, now time.Time) (PresenceTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.remove(conn.TenantID, participantKey(conn.ParticipantType, conn.ParticipantID), conn.ConnectionID, now), nil
+}
+
+func (s *MemoryPresenceStore) Expire(_ context.Context, tenantID string, now time.Time) ([]PresenceTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var transitions []PresenceTransition
+	for participant, conns := range s.conns[tenantID] {
+		for connectionID, conn := range conns {
+			if now.Before(conn.ExpiresAt) {
+				continue
+			}
+			if transition := s.remove(tenantID, participant, connectionID, now); transition.changed() {
+				transitions = append(transitions, transition)
+			}
+		}
+	}
+	if len(s.conns[tenantID]) == 0 {
+		delete(s.conns, tenantID)
+	}
+	return transitions, nil
+}
+
+func (s *MemoryPresenceStore) remove(tenantID, participant, connectionID string, now time.Time) PresenceTransition {
+	before := s.status(tenantID, participant)
+	conn, ok := s.conns[tenantID][participant][connectionID]
+	if !ok {
+		participantType, participantID := splitParticipantKey(participant)
+		return PresenceTransition{
+			Entry:    PresenceEntry{ParticipantType: participantType, ParticipantID: participantID, Status: before},
+			Previous: before,
+		}
+	}
+	delete(s.conns[tenantID][participant], connectionID)
+	transition := s.recompute(tenantID, participant, before, &conn, now)
+	if len(s.conns[tenantID][participant]) == 0 {
+		delete(s.conns[tenantID], participant)
+	}
+	return transition
+}
+
+func (s *MemoryPresenceStore) recompute(tenantID, participant, before string, removed *PresenceConnection, now time.Time) PresenceTransition {
+	participantType, participantID := splitParticipantKey(participant)
+	conns := make([]PresenceConnection, 0, len(s.conns[tenantID][participant]))
+	for _, conn := range s.conns[tenantID][participant] {
+		conns = append(conns, conn)
+	}
+
+	entry := aggregatePresence(participantType, participantID, conns, removed, now)
+	if s.statuses[tenantID] == nil {
+		s.statuses[tenantID] = make(map[string]string)
+	}
+	if entry.Status == PresenceOffline {
+		delete(s.statuses[tenantID], participant)
+	} else {
+		s.statuses[tenantID][participant] = entry.Status
+	}
+	return PresenceTransition{Entry: entry, Previous: before}
+}
+
+func (s *MemoryPresenceStore) status(tenantID, participant string) string {
+	if status, ok := s.statuses[tenantID][participant]; ok {
+		return status
+	}
+	return PresenceOffline
+}
+
+func (s *MemoryPresenceStore) Participants(_ context.Context, tenantID string, now time.Time) ([]PresenceEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]PresenceEntry, 0, len(s.conns[tenantID]))
+	for participant, byID := range s.conns[tenantID] {
+		conns := make([]PresenceConnection, 0, len(byID))
+		for _, conn := range byID {
+			conns = append(conns, conn)
+		}
+		participantType, participantID := splitParticipantKey(participant)
+		if entry := aggregatePresence(participantType, participantID, conns, nil, now); entry.Status != PresenceOffline {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (s *MemoryPresenceStore) Statuses(_ context.Context, tenantID, participantType string, participantIDs []string) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := make(map[string]string, len(participantIDs))
+	for _, participantID := range participantIDs {
+		if status, ok := s.statuses[tenantID][participantKey(participantType, participantID)]; ok {
+			statuses[participantID] = status
+		}
+	}
+	return statuses, nil
+}
+
+func (s *MemoryPresenceStore) Tenants(_ context.Context) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tenants := make([]string, 0, len(s.conns))
+	for tenantID := range s.conns {
+		tenants = append(tenants, tenantID)
+	}
+	return tenants, nil
+}
+
+func (s *MemoryPresenceStore) AcquireSweep(context.Context, time.Duration) (bool, error) {
+	return true, nil
+}
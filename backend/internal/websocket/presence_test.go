@@ -0,0 +1,173 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recordedPresence struct {
+	roomID string
+	event  PresenceEvent
+}
+
+func newTestPresence(now *time.Time) (*Presence, *[]recordedPresence) {
+	var published []recordedPresence
+	presence := NewPresenceWithStore(NewMemoryPresenceStore(), func() time.Time { return *now }, func(roomID string, event Event) {
+		var payload PresenceEvent
+		if err := event.DecodePayload(&payload); err != nil {
+			panic(err)
+		}
+		published = append(published, recordedPresence{roomID: roomID, event: payload})
+	})
+	return presence, &published
+}
+
+func TestPresenceAnnouncesOnlyParticipantTransitions(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	presence, published := newTestPresence(&now)
+
+	tab1 := PresenceConnection{ConnectionID: "c1", TenantID: "tenant-1", ParticipantType: SenderAgent, ParticipantID: "agent-1"}
+	tab2 := PresenceConnection{ConnectionID: "c2", TenantID: "tenant-1", ParticipantType: SenderAgent, ParticipantID: "agent-1", ConversationID: "conv-1"}
+
+	if err := presence.Connect(ctx, tab1); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	if err := presence.Connect(ctx, tab2); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	if len(*published) != 1 {
+		t.Fatalf("expected a single online event for two sockets, got %+v", *published)
+	}
+	first := (*published)[0]
+	if first.roomID != "tenant:tenant-1:notifications" || first.event.Status != PresenceOnline || first.event.PreviousStatus != PresenceOffline {
+		t.Fatalf("unexpected online event %+v", first)
+	}
+
+	if err := presence.SetStatus(ctx, tab1, PresenceAway); err != nil {
+		t.Fatalf("SetStatus error: %v", err)
+	}
+	if len(*published) != 1 {
+		t.Fatalf("expected no event while another socket is online, got %+v", *published)
+	}
+	if err := presence.SetStatus(ctx, tab2, PresenceAway); err != nil {
+		t.Fatalf("SetStatus error: %v", err)
+	}
+	if len(*published) != 2 || (*published)[1].event.Status != PresenceAway {
+		t.Fatalf("expected an away event, got %+v", *published)
+	}
+
+	if err := presence.Disconnect(ctx, tab1); err != nil {
+		t.Fatalf("Disconnect error: %v", err)
+	}
+	if err := presence.Disconnect(ctx, tab2); err != nil {
+		t.Fatalf("Disconnect error: %v", err)
+	}
+	if len(*published) != 3 {
+		t.Fatalf("expected an offline event after the last socket closed, got %+v", *published)
+	}
+	last := (*published)[2].event
+	if last.Status != PresenceOffline || last.PreviousStatus != PresenceAway || len(last.ConversationIDs) != 1 || last.ConversationIDs[0] != "conv-1" {
+		t.Fatalf("unexpected offline event %+v", last)
+	}
+
+	if err := presence.Disconnect(ctx, tab2); err != nil {
+		t.Fatalf("repeated Disconnect error: %v", err)
+	}
+	if len(*published) != 3 {
+		t.Fatalf("expected repeated disconnect to be silent, got %+v", *published)
+	}
+}
+
+func TestPresenceSweepExpiresStaleConnections(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	presence, published := newTestPresence(&now)
+
+	visitor := PresenceConnection{ConnectionID: "v1", TenantID: "tenant-1", ParticipantType: SenderVisitor, ParticipantID: "visitor-1", ConversationID: "conv-1"}
+	agent := PresenceConnection{ConnectionID: "a1", TenantID: "tenant-1", ParticipantType: SenderAgent, ParticipantID: "agent-1"}
+	if err := presence.Connect(ctx, visitor); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+	if err := presence.Connect(ctx, agent); err != nil {
+		t.Fatalf("Connect error: %v", err)
+	}
+
+	now = now.Add(presenceTTL - time.Second)
+	if err := presence.Heartbeat(ctx, PresenceConnection{ConnectionID: "a1", TenantID: "tenant-1", ParticipantType: SenderAgent, ParticipantID: "agent-1", Status: PresenceOnline}); err != nil {
+		t.Fatalf("Heartbeat error: %v", err)
+	}
+
+	now = now.Add(2 * time.Second)
+	if err := presence.Sweep(ctx); err != nil {
+		t.Fatalf("Sweep error: %v", err)
+	}
+	if len(*published) != 3 {
+		t.Fatalf("expected the visitor to go offline, got %+v", *published)
+	}
+	if event := (*published)[2].event; event.ParticipantID != "visitor-1" || event.Status != PresenceOffline {
+		t.Fatalf("unexpected sweep event %+v", event)
+	}
+
+	entries, err := presence.List(ctx, "tenant-1", PresenceFilter{})
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ParticipantID != "agent-1" {
+		t.Fatalf("expected only the agent to remain, got %+v", entries)
+	}
+
+	available, err := presence.AvailableAgents(ctx, "tenant-1", []string{"agent-1", "agent-2"})
+	if err != nil {
+		t.Fatalf("AvailableAgents error: %v", err)
+	}
+	if len(available) != 1 || available[0] != "agent-1" {
+		t.Fatalf("expected agent-1 to be available, got %v", available)
+	}
+}
+
+func TestPresenceListFilters(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	presence, _ := newTestPresence(&now)
+
+	for _, conn := range []PresenceConnection{
+		{ConnectionID: "v1", TenantID: "tenant-1", ParticipantType: SenderVisitor, ParticipantID: "visitor-1", ConversationID: "conv-1"},
+		{ConnectionID: "v2", TenantID: "tenant-1", ParticipantType: SenderVisitor, ParticipantID: "visitor-2", ConversationID: "conv-2"},
+		{ConnectionID: "a1", TenantID: "tenant-1", ParticipantType: SenderAgent, ParticipantID: "agent-1", ConversationID: "conv-1"},
+		{ConnectionID: "x1", TenantID: "tenant-2", ParticipantType: SenderAgent, ParticipantID: "agent-9"},
+	} {
+		if err := presence.Connect(ctx, conn); err != nil {
+			t.Fatalf("Connect error: %v", err)
+		}
+	}
+
+	visitors, err := presence.List(ctx, "tenant-1", PresenceFilter{ParticipantType: SenderVisitor})
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(visitors) != 2 || visitors[0].ParticipantID != "visitor-1" || visitors[1].ParticipantID != "visitor-2" {
+		t.Fatalf("unexpected visitors %+v", visitors)
+	}
+
+	inConversation, err := presence.List(ctx, "tenant-1", PresenceFilter{ConversationID: "conv-1"})
+	if err != nil {
+		t.Fatalf("List error: %v", err)
+	}
+	if len(inConversation) != 2 {
+		t.Fatalf("expected agent and visitor in conv-1, got %+v", inConversation)
+	}
+}
+
+func TestNotificationRoomIDs(t *testing.T) {
+	if tenantID, ok := tenantFromNotificationRoom(TenantNotificationRoomID("tenant-1")); !ok || tenantID != "tenant-1" {
+		t.Fatalf("expected tenant-1, got %q (%v)", tenantID, ok)
+	}
+	if _, ok := tenantFromNotificationRoom(UserNotificationRoomID("tenant-1", "agent-1")); ok {
+		t.Fatal("expected personal rooms not to count as tenant rooms")
+	}
+	if _, ok := tenantFromNotificationRoom("conv-1"); ok {
+		t.Fatal("expected conversation rooms not to count as tenant rooms")
+	}
+}
@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// Sender types reported on events that originate from a connected client.
+const (
+	SenderVisitor = "visitor"
+	SenderAgent   = "agent"
+)
+
+// Wire protocols a client can negotiate with the protocol query parameter.
+// ProtocolLegacy keeps the pre-envelope frames, where every event arrives as a
+// JSON string in the content field of {content, roomId, timestamp}.
+const (
+	ProtocolEnvelope = "v1"
+	ProtocolLegacy   = "legacy"
+)
+
+// Frame types clients may send over a conversation socket.
+const (
+	FrameTypingStart    = "typing.start"
+	FrameTypingStop     = "typing.stop"
+	FramePresenceAway   = "presence.away"
+	FramePresenceActive = "presence.active"
+	FrameMessageSend    = "message.send"
+	FrameSubscribe      = "subscribe"
+	FrameUnsubscribe    = "unsubscribe"
+)
+
+// clientFrame is the typed envelope of a frame sent by a client.
+type clientFrame struct {
+	Type           string `json:"type"`
+	ClientID       string `json:"clientId,omitempty"` // Set by the client on message.send to match the reply
+	Body           string `json:"body,omitempty"`
+	ConversationID string `json:"conversationId,omitempty"` // Room of the frame on agent sockets
+	LastSeq        *int64 `json:"lastSeq,omitempty"`        // Where a subscribe resumes the room log
+}
+
+// NegotiateProtocol reports the wire protocol requested by r. Clients opt in
+// to ProtocolEnvelope with protocol=v1; everyone else, including clients
+// deployed before the envelope existed, keeps ProtocolLegacy.
+func NegotiateProtocol(r *http.Request) string {
+	if r.URL.Query().Get("protocol") == ProtocolEnvelope {
+		return ProtocolEnvelope
+	}
+	return ProtocolLegacy
+}
+
+// parseClientFrame decodes raw as a typed frame. It reports false for frames
+// that are not JSON objects with a known type.
+func parseClientFrame(raw []byte) (clientFrame, bool) {
+	var frame clientFrame
+	if err := json.Unmarshal(raw, &frame); err != nil {
+		return clientFrame{}, false
+	}
+	switch frame.Type {
+	case FrameTypingStart, FrameTypingStop, FramePresenceAway, FramePresenceActive, FrameMessageSend,
+		FrameSubscribe, FrameUnsubscribe:
+		return frame, true
+	default:
+		return clientFrame{}, false
+	}
+}
+
+func newTypingEvent(eventType string, key typingKey, expiresAt, now time.Time) (Event, error) {
+	payload := TypingEvent{
+		ConversationID: key.roomID,
+		SenderType:     key.senderType,
+		SenderID:       key.senderID,
+	}
+	if !expiresAt.IsZero() {
+		payload.ExpiresAt = expiresAt.UTC().Format(time.RFC3339)
+	}
+
+	return NewEvent(eventType, now, payload)
+}
+
+// presenceFrameStatus maps a presence frame to the status it requests.
+func presenceFrameStatus(frameType string) (string, bool) {
+	switch frameType {
+	case FramePresenceAway:
+		return PresenceAway, true
+	case FramePresenceActive:
+		return PresenceOnline, true
+	default:
+		return "", false
+	}
+}
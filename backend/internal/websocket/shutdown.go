@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// drainPollInterval is how often Drain checks whether every client left.
+	drainPollInterval = 50 * time.Millisecond
+	// drainCloseTimeout bounds writing the close frame to one socket, and how
+	// long the socket then waits for the client to answer it.
+	drainCloseTimeout = time.Second
+)
+
+// drainHint is the reason of the close frame sent to sockets on shutdown.
+type drainHint struct {
+	ReconnectAfterMs int64 `json:"reconnectAfterMs"`
+}
+
+// Drain shuts the handler down for a deploy. It refuses new connections,
+// closes every socket with CloseServiceRestart and a reconnect-after hint,
+// ends event streams with a retry field and answers waiting long polls. Each
+// client is told to come back after a random delay of up to spread, so the
+// clients of this replica do not land on the others all at once. Drain
+// returns once every client left, or with ctx.Err() when ctx is done first.
+func (h *Handler) Drain(ctx context.Context, spread time.Duration) error {
+	h.drainOnce.Do(func() {
+		h.reconnectSpread = spread
+		close(h.draining)
+	})
+
+	for _, cl := range h.sockets() {
+		cl.closeForRestart(h.reconnectAfter())
+	}
+
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		if h.clientCount() == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// refuseWhileDraining answers 503 to connections opened during Drain and
+// reports whether it did.
+func (h *Handler) refuseWhileDraining(w http.ResponseWriter) bool {
+	select {
+	case <-h.draining:
+	default:
+		return false
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(h.reconnectAfter().Round(time.Second)/time.Second)))
+	http.Error(w, "server is shutting down", http.StatusServiceUnavailable)
+	return true
+}
+
+// reconnectAfter picks when a drained client should reconnect.
+func (h *Handler) reconnectAfter() time.Duration {
+	if h.reconnectSpread <= 0 {
+		return 0
+	}
+	return rand.N(h.reconnectSpread)
+}
+
+// sockets returns the websocket clients of the hub, one per connection.
+func (h *Handler) sockets() []*WSClient {
+	var sockets []*WSClient
+	h.hub.do(func() {
+		for _, room := range h.hub.rooms {
+			for _, cl := range room.Clients {
+				if cl.Conn != nil && !cl.isSubscription() {
+					sockets = append(sockets, cl)
+				}
+			}
+		}
+	})
+	return sockets
+}
+
+// clientCount returns how many clients the hub still has.
+func (h *Handler) clientCount() int {
+	count := 0
+	h.hub.do(func() {
+		for _, room := range h.hub.rooms {
+			count += len(room.Clients)
+		}
+	})
+	return count
+}
+
+// closeForRestart sends cl the close frame of a server restart, asking it to
+// reconnect after the given delay. The socket is torn down once the client
+// answers, or after drainCloseTimeout.
+func (cl *WSClient) closeForRestart(after time.Duration) {
+	reason, _ := json.Marshal(drainHint{ReconnectAfterMs: after.Milliseconds()})
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	if cl.isClosed {
+		return
+	}
+	deadline := time.Now().Add(drainCloseTimeout)
+	err := cl.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseServiceRestart, string(reason)), deadline)
+	if err != nil {
+		log.Printf("Error closing client %s for restart: %v", cl.ID, err)
+	}
+	cl.isClosed = true
+	cl.Conn.SetReadDeadline(deadline)
+}
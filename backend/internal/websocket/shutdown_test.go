@@ -0,0 +1,62 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestDrainClosesSocketsWithReconnectHint(t *testing.T) {
+	hub := NewHub()
+	go hub.Run()
+	handler := NewHandler(hub, NewMemoryBroker())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.JoinRoom(w, r, "conv-1", "visitor-1", SenderVisitor, "")
+	}))
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http")
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	for deadline := time.Now().Add(2 * time.Second); handler.clientCount() == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the socket to join its room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	drained := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		drained <- handler.Drain(ctx, 2*time.Second)
+	}()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	closeErr, ok := err.(*websocket.CloseError)
+	if !ok || closeErr.Code != websocket.CloseServiceRestart {
+		t.Fatalf("expected a service restart close frame, got %v", err)
+	}
+	var hint drainHint
+	if err := json.Unmarshal([]byte(closeErr.Text), &hint); err != nil || hint.ReconnectAfterMs < 0 || hint.ReconnectAfterMs >= 2000 {
+		t.Fatalf("expected a reconnect hint within the spread, got %q", closeErr.Text)
+	}
+	if err := <-drained; err != nil {
+		t.Fatalf("expected Drain to finish once the socket left, got %v", err)
+	}
+
+	_, res, err := websocket.DefaultDialer.Dial(url, nil)
+	if err == nil || res == nil || res.StatusCode != http.StatusServiceUnavailable || res.Header.Get("Retry-After") == "" {
+		t.Fatalf("expected new sockets to be refused while draining, got %v", err)
+	}
+}
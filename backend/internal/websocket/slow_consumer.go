@@ -0,0 +1,350 @@
+package websocket
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"chat-app-backend/internal/env"
+)
+
+// Slow-consumer policies, applied when a client's message buffer is full.
+const (
+	// PolicyDropOldest drops the oldest queued message to make room.
+	PolicyDropOldest = "drop_oldest"
+	// PolicyCoalesce first merges queued messages that supersede each other,
+	// such as typing and presence updates of one participant, and drops the
+	// oldest message only when that does not free a slot.
+	PolicyCoalesce = "coalesce"
+	// PolicyBlock waits up to BlockTimeout for a free slot and disconnects the
+	// client after that. The wait runs beside the hub, so other clients keep
+	// receiving meanwhile.
+	PolicyBlock = "block"
+	// PolicyDisconnect closes the client right away.
+	PolicyDisconnect = "disconnect"
+)
+
+// Room types a ConsumerPolicy applies to.
+const (
+	RoomTypeConversation = "conversation"
+	RoomTypeNotification = "notification"
+)
+
+// ConsumerPolicy is how the hub treats the clients of one room type.
+type ConsumerPolicy struct {
+	Policy       string
+	Buffer       int
+	BlockTimeout time.Duration
+}
+
+func (p ConsumerPolicy) validate() error {
+	switch p.Policy {
+	case PolicyDropOldest, PolicyCoalesce, PolicyDisconnect:
+	case PolicyBlock:
+		if p.BlockTimeout <= 0 {
+			return fmt.Errorf("block timeout must be positive")
+		}
+	default:
+		return fmt.Errorf("unknown policy %q", p.Policy)
+	}
+	if p.Buffer < 1 {
+		return fmt.Errorf("buffer must be at least 1")
+	}
+	return nil
+}
+
+// DefaultConsumerPolicies keeps agents connected through bursts: superseded
+// indicators are merged, and anything else lost is repaired by a resync.
+func DefaultConsumerPolicies() map[string]ConsumerPolicy {
+	return map[string]ConsumerPolicy{
+		RoomTypeConversation: {Policy: PolicyCoalesce, Buffer: 64, BlockTimeout: 100 * time.Millisecond},
+		RoomTypeNotification: {Policy: PolicyCoalesce, Buffer: 256, BlockTimeout: 100 * time.Millisecond},
+	}
+}
+
+// ConsumerPoliciesFromEnv returns DefaultConsumerPolicies with the overrides
+// of CHAT_WS_*_POLICY, CHAT_WS_*_BUFFER and CHAT_WS_BLOCK_TIMEOUT applied.
+func ConsumerPoliciesFromEnv() (map[string]ConsumerPolicy, error) {
+	policies := DefaultConsumerPolicies()
+	overrides := map[string][2]string{
+		RoomTypeConversation: {env.WSConversationPolicy, env.WSConversationBuffer},
+		RoomTypeNotification: {env.WSNotificationPolicy, env.WSNotificationBuffer},
+	}
+
+	var blockTimeout time.Duration
+	if raw := env.Get(env.WSBlockTimeout); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil {
+			return nil, fmt.Errorf("websocket policy: invalid %s %q: %w", env.WSBlockTimeout, raw, err)
+		}
+		blockTimeout = parsed
+	}
+
+	for roomType, keys := range overrides {
+		policy := policies[roomType]
+		if raw := env.Get(keys[0]); raw != "" {
+			policy.Policy = raw
+		}
+		if raw := env.Get(keys[1]); raw != "" {
+			buffer, err := strconv.Atoi(raw)
+			if err != nil {
+				return nil, fmt.Errorf("websocket policy: invalid %s %q: %w", keys[1], raw, err)
+			}
+			policy.Buffer = buffer
+		}
+		if blockTimeout != 0 {
+			policy.BlockTimeout = blockTimeout
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("websocket policy: %s rooms: %w", roomType, err)
+		}
+		policies[roomType] = policy
+	}
+	return policies, nil
+}
+
+func roomTypeOf(roomID string) string {
+	if isNotificationRoom(roomID) {
+		return RoomTypeNotification
+	}
+	return RoomTypeConversation
+}
+
+// enqueue hands message to client, applying the policy of the room when the
+// client's buffer is full. It reports false when the client was disconnected.
+func (h *Hub) enqueue(room *Room, client *WSClient, message *WSMessage) bool {
+	// Messages queue up behind a blocked one to keep their order.
+	if queue, ok := h.blocked[client.Message]; ok {
+		if queue.push(message) {
+			return true
+		}
+		delete(h.blocked, client.Message)
+	}
+
+	select {
+	case client.Message <- message:
+		return true
+	default:
+	}
+
+	roomType := roomTypeOf(room.Id)
+	policy := h.policies[roomType]
+	switch policy.Policy {
+	case PolicyDropOldest:
+		h.pushDroppingOldest(room, client, message)
+		return true
+
+	case PolicyCoalesce:
+		pending := drainMessages(client.Message)
+		kept := coalesceMessages(append(pending, message))
+		addDropped(roomType, dropReasonCoalesced, len(pending)+1-len(kept))
+		for _, queued := range kept {
+			h.pushDroppingOldest(room, client, queued)
+		}
+		return true
+
+	case PolicyBlock:
+		queue := &blockedQueue{
+			pending: []*WSMessage{message},
+			stop:    make(chan struct{}),
+			done:    make(chan struct{}),
+		}
+		h.blocked[client.Message] = queue
+		go h.sendBlocked(client, queue, policy.BlockTimeout)
+		return true
+	}
+
+	h.removeClient(room, client)
+	if client.mux != nil {
+		client.mux.kick()
+	}
+	incSlowConsumerDisconnects(roomType, policy.Policy)
+	return false
+}
+
+// blockedQueue holds the messages of a client whose buffer filled up under
+// PolicyBlock, while a goroutine of its own waits for the client to take them.
+type blockedQueue struct {
+	mu       sync.Mutex
+	pending  []*WSMessage
+	finished bool          // Set once the goroutine stopped taking messages
+	stop     chan struct{} // Closed by the hub to end the goroutine
+	done     chan struct{} // Closed when the goroutine returned
+}
+
+// push adds message to the queue. It reports false once the goroutine has
+// finished, and the message must be queued for the client directly.
+func (q *blockedQueue) push(message *WSMessage) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.finished {
+		return false
+	}
+	q.pending = append(q.pending, message)
+	return true
+}
+
+func (q *blockedQueue) next() (*WSMessage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pending) == 0 {
+		q.finished = true
+		return nil, false
+	}
+	message := q.pending[0]
+	q.pending = q.pending[1:]
+	return message, true
+}
+
+// sendBlocked hands the queued messages to client, waiting up to timeout for
+// each, and has the hub disconnect the client when a wait runs out.
+func (h *Hub) sendBlocked(client *WSClient, queue *blockedQueue, timeout time.Duration) {
+	defer close(queue.done)
+	for {
+		message, ok := queue.next()
+		if !ok {
+			return
+		}
+		timer := time.NewTimer(timeout)
+		select {
+		case client.Message <- message:
+			timer.Stop()
+			continue
+		case <-queue.stop:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		select {
+		case h.calls <- func() { h.disconnectBlocked(client, queue) }:
+		case <-queue.stop:
+		}
+		return
+	}
+}
+
+// disconnectBlocked drops a client that did not take a blocked message in
+// time, unless it already left.
+func (h *Hub) disconnectBlocked(client *WSClient, queue *blockedQueue) {
+	if h.blocked[client.Message] == queue {
+		delete(h.blocked, client.Message)
+	}
+	room, ok := h.rooms[client.RoomID]
+	if !ok || room.Clients[client.connID] != client {
+		return
+	}
+	h.removeClient(room, client)
+	if client.mux != nil {
+		client.mux.kick()
+	}
+	incSlowConsumerDisconnects(roomTypeOf(room.Id), PolicyBlock)
+}
+
+// stopBlocked ends the wait for a blocked client before its message channel
+// is closed.
+func (h *Hub) stopBlocked(client *WSClient) {
+	queue, ok := h.blocked[client.Message]
+	if !ok {
+		return
+	}
+	delete(h.blocked, client.Message)
+	close(queue.stop)
+	<-queue.done
+}
+
+// pushDroppingOldest queues message for client, dropping the oldest queued
+// messages while the buffer is full. Each drop asks the client to resync up
+// to the newest event the room has seen.
+func (h *Hub) pushDroppingOldest(room *Room, client *WSClient, message *WSMessage) {
+	for {
+		select {
+		case client.Message <- message:
+			return
+		default:
+		}
+		select {
+		case dropped := <-client.Message:
+			// The request must be visible before the writer takes the
+			// next message, so it is made before queueing message.
+			h.resyncDropped(room, client, dropped)
+			addDropped(roomTypeOf(room.Id), dropReasonOverflow, 1)
+		default:
+		}
+	}
+}
+
+// resyncDropped asks the client that dropped was queued for to resync. On an
+// agent socket the queue holds the events of all its rooms, so that is the
+// member in the room of dropped rather than client.
+func (h *Hub) resyncDropped(room *Room, client *WSClient, dropped *WSMessage) {
+	if client.mux == nil || dropped.RoomID == room.Id {
+		client.requestResync(room.lastSeq)
+		return
+	}
+	other, ok := h.rooms[dropped.RoomID]
+	if !ok {
+		return
+	}
+	if member, ok := other.Clients[client.connID]; ok {
+		member.requestResync(other.lastSeq)
+	}
+}
+
+func drainMessages(queue chan *WSMessage) []*WSMessage {
+	var pending []*WSMessage
+	for {
+		select {
+		case msg := <-queue:
+			pending = append(pending, msg)
+		default:
+			return pending
+		}
+	}
+}
+
+// coalesceMessages keeps only the newest of the messages sharing a coalesce
+// key, preserving the order of what remains.
+func coalesceMessages(messages []*WSMessage) []*WSMessage {
+	seen := make(map[string]bool)
+	kept := make([]*WSMessage, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		key := coalesceKey(messages[i])
+		if key != "" {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		kept = append(kept, messages[i])
+	}
+	for i, j := 0, len(kept)-1; i < j; i, j = i+1, j-1 {
+		kept[i], kept[j] = kept[j], kept[i]
+	}
+	return kept
+}
+
+// coalesceKey identifies the state a message reports on when a newer message
+// with the same key makes it obsolete. Other messages have no key. Keys are
+// scoped to the room, as the queue of an agent socket holds several.
+func coalesceKey(msg *WSMessage) string {
+	if msg.Event == nil {
+		return ""
+	}
+	switch msg.Event.Type {
+	case EventTypingStart, EventTypingStop:
+		var payload TypingEvent
+		if err := msg.Event.DecodePayload(&payload); err != nil {
+			return ""
+		}
+		return msg.RoomID + ":typing:" + payload.ConversationID + ":" + participantKey(payload.SenderType, payload.SenderID)
+	case EventPresenceChanged:
+		var payload PresenceEvent
+		if err := msg.Event.DecodePayload(&payload); err != nil {
+			return ""
+		}
+		return msg.RoomID + ":presence:" + participantKey(payload.ParticipantType, payload.ParticipantID)
+	}
+	return ""
+}
@@ -0,0 +1,233 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func newPolicyTestHub(t *testing.T, roomType string, policy ConsumerPolicy) *Hub {
+	t.Helper()
+	hub := NewHub()
+	if err := hub.SetConsumerPolicies(map[string]ConsumerPolicy{roomType: policy}); err != nil {
+		t.Fatalf("SetConsumerPolicies error: %v", err)
+	}
+	go hub.Run()
+	return hub
+}
+
+func newPolicyTestClient(hub *Hub, roomID, connID string) *WSClient {
+	client := newHubTestClient(roomID, "agent-1", connID)
+	client.Message = make(chan *WSMessage, hub.clientBuffer(roomID))
+	hub.Register <- client
+	return client
+}
+
+func testEventMessage(t *testing.T, roomID string, seq int64, eventType string, payload interface{}) *WSMessage {
+	t.Helper()
+	event, err := NewEvent(eventType, time.Now(), payload)
+	if err != nil {
+		t.Fatalf("NewEvent error: %v", err)
+	}
+	event.Seq = seq
+	return newEventMessage(roomID, event, time.Now())
+}
+
+func queuedSeqs(client *WSClient) []int64 {
+	var seqs []int64
+	for _, msg := range drainMessages(client.Message) {
+		seqs = append(seqs, msg.Event.Seq)
+	}
+	return seqs
+}
+
+func TestDropOldestPolicyKeepsNewestAndRequestsResync(t *testing.T) {
+	hub := newPolicyTestHub(t, RoomTypeConversation, ConsumerPolicy{Policy: PolicyDropOldest, Buffer: 2})
+	client := newPolicyTestClient(hub, "conv-1", "conn-1")
+
+	for seq := int64(1); seq <= 3; seq++ {
+		hub.Broadcast <- testEventMessage(t, "conv-1", seq, EventMessageCreated, MessageEvent{})
+	}
+	hub.do(func() {})
+
+	if !client.resync.Load() || client.resyncSeq.Load() != 3 {
+		t.Fatalf("expected a resync up to seq 3, got %v at %d", client.resync.Load(), client.resyncSeq.Load())
+	}
+	if seqs := queuedSeqs(client); len(seqs) != 2 || seqs[0] != 2 || seqs[1] != 3 {
+		t.Fatalf("expected the two newest events to stay queued, got %v", seqs)
+	}
+}
+
+func TestCoalescePolicyMergesSupersededEvents(t *testing.T) {
+	hub := newPolicyTestHub(t, RoomTypeNotification, ConsumerPolicy{Policy: PolicyCoalesce, Buffer: 2})
+	roomID := TenantNotificationRoomID("tenant-1")
+	client := newPolicyTestClient(hub, roomID, "conn-1")
+
+	hub.Broadcast <- testEventMessage(t, roomID, 1, EventPresenceChanged, PresenceEvent{ParticipantType: SenderAgent, ParticipantID: "agent-2", Status: PresenceOnline})
+	hub.Broadcast <- testEventMessage(t, roomID, 2, EventAssignmentChanged, AssignmentEvent{})
+	hub.Broadcast <- testEventMessage(t, roomID, 3, EventPresenceChanged, PresenceEvent{ParticipantType: SenderAgent, ParticipantID: "agent-2", Status: PresenceAway})
+	hub.do(func() {})
+
+	if client.resync.Load() {
+		t.Fatal("expected coalescing to avoid a resync")
+	}
+	if seqs := queuedSeqs(client); len(seqs) != 2 || seqs[0] != 2 || seqs[1] != 3 {
+		t.Fatalf("expected the older presence event to be merged away, got %v", seqs)
+	}
+
+	for seq := int64(4); seq <= 6; seq++ {
+		hub.Broadcast <- testEventMessage(t, roomID, seq, EventAssignmentChanged, AssignmentEvent{})
+	}
+	hub.do(func() {})
+	if !client.resync.Load() {
+		t.Fatal("expected a resync once events could not be merged")
+	}
+}
+
+func TestBlockPolicyDisconnectsAfterDeadline(t *testing.T) {
+	hub := newPolicyTestHub(t, RoomTypeConversation, ConsumerPolicy{Policy: PolicyBlock, Buffer: 1, BlockTimeout: 200 * time.Millisecond})
+	client := newPolicyTestClient(hub, "conv-1", "conn-1")
+
+	hub.Broadcast <- testEventMessage(t, "conv-1", 1, EventMessageCreated, MessageEvent{})
+	hub.Broadcast <- testEventMessage(t, "conv-1", 2, EventMessageCreated, MessageEvent{})
+	for want := int64(1); want <= 2; want++ {
+		select {
+		case msg := <-client.Message:
+			if msg.Event.Seq != want {
+				t.Fatalf("expected seq %d, got %d", want, msg.Event.Seq)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected the blocked event %d once the reader caught up", want)
+		}
+	}
+
+	hub.Broadcast <- testEventMessage(t, "conv-1", 3, EventMessageCreated, MessageEvent{})
+	hub.Broadcast <- testEventMessage(t, "conv-1", 4, EventMessageCreated, MessageEvent{})
+	waitForRoomClients(t, hub, "conv-1", 0)
+}
+
+func TestBlockedClientDoesNotStallOtherRooms(t *testing.T) {
+	hub := newPolicyTestHub(t, RoomTypeConversation, ConsumerPolicy{Policy: PolicyBlock, Buffer: 1, BlockTimeout: 500 * time.Millisecond})
+	stalled := newPolicyTestClient(hub, "conv-1", "conn-1")
+	other := newPolicyTestClient(hub, "conv-2", "conn-2")
+
+	hub.Broadcast <- testEventMessage(t, "conv-1", 1, EventMessageCreated, MessageEvent{})
+	hub.Broadcast <- testEventMessage(t, "conv-1", 2, EventMessageCreated, MessageEvent{})
+
+	sent := time.Now()
+	hub.Broadcast <- testEventMessage(t, "conv-2", 1, EventMessageCreated, MessageEvent{})
+	select {
+	case msg := <-other.Message:
+		if msg.RoomID != "conv-2" {
+			t.Fatalf("expected the conv-2 event, got one of %s", msg.RoomID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected conv-2 to receive while conv-1 is blocked")
+	}
+	if waited := time.Since(sent); waited >= 250*time.Millisecond {
+		t.Fatalf("expected conv-2 to receive well before the block timeout, took %v", waited)
+	}
+
+	waitForRoomClients(t, hub, "conv-1", 0)
+	var seqs []int64
+	for msg := range stalled.Message {
+		seqs = append(seqs, msg.Event.Seq)
+	}
+	if len(seqs) != 1 || seqs[0] != 1 {
+		t.Fatalf("expected only the first event to reach the stalled client, got %v", seqs)
+	}
+	if ids := roomClientIDs(hub, "conv-2"); len(ids) != 1 {
+		t.Fatalf("expected conv-2 to keep its client, got %v", ids)
+	}
+}
+
+func TestWriterSendsRequestedResyncAndSkipsCoveredEvents(t *testing.T) {
+	cl := &WSClient{RoomID: "conv-1", lastSeq: 2, isClosed: true}
+	cl.requestResync(5)
+	cl.requestResync(4)
+
+	if err := cl.sendPendingResync(); err != errClientClosed {
+		t.Fatalf("expected the resync to reach the connection, got %v", err)
+	}
+	if cl.lastSeq != 5 || cl.resync.Load() {
+		t.Fatalf("expected lastSeq 5 and no pending resync, got %d (%v)", cl.lastSeq, cl.resync.Load())
+	}
+	if err := cl.send(testEventMessage(t, "conv-1", 5, EventMessageCreated, MessageEvent{})); err != nil {
+		t.Fatalf("expected an event covered by the resync to be skipped, got %v", err)
+	}
+	if err := cl.sendPendingResync(); err != nil {
+		t.Fatalf("expected nothing to send without a request, got %v", err)
+	}
+}
+
+func TestConsumerPoliciesFromEnv(t *testing.T) {
+	t.Setenv("CHAT_WS_CONVERSATION_POLICY", PolicyBlock)
+	t.Setenv("CHAT_WS_CONVERSATION_BUFFER", "32")
+	t.Setenv("CHAT_WS_BLOCK_TIMEOUT", "250ms")
+
+	policies, err := ConsumerPoliciesFromEnv()
+	if err != nil {
+		t.Fatalf("ConsumerPoliciesFromEnv error: %v", err)
+	}
+	if got := policies[RoomTypeConversation]; got.Policy != PolicyBlock || got.Buffer != 32 || got.BlockTimeout != 250*time.Millisecond {
+		t.Fatalf("unexpected conversation policy %+v", got)
+	}
+	if got := policies[RoomTypeNotification]; got.Policy != PolicyCoalesce || got.Buffer != 256 {
+		t.Fatalf("expected the notification default, got %+v", got)
+	}
+
+	t.Setenv("CHAT_WS_NOTIFICATION_BUFFER", "0")
+	if _, err := ConsumerPoliciesFromEnv(); err == nil {
+		t.Fatal("expected an empty buffer to be rejected")
+	}
+}
+
+func roomClientIDs(hub *Hub, roomID string) []string {
+	var ids []string
+	hub.do(func() {
+		if room, ok := hub.rooms[roomID]; ok {
+			for id := range room.Clients {
+				ids = append(ids, id)
+			}
+		}
+	})
+	return ids
+}
+
+// waitForRoomClients waits for roomID to hold count clients.
+func waitForRoomClients(t *testing.T, hub *Hub, roomID string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ids := roomClientIDs(hub, roomID)
+		if len(ids) == count {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d clients in %s, got %v", count, roomID, ids)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDroppedSubscriptionEventResyncsItsConversation(t *testing.T) {
+	hub := newPolicyTestHub(t, RoomTypeNotification, ConsumerPolicy{Policy: PolicyDropOldest, Buffer: 1})
+	roomID := TenantNotificationRoomID("tenant-1")
+	socket := newHubTestClient(roomID, "agent-1", "conn-1")
+	socket.Message = make(chan *WSMessage, 1)
+	socket.mux = newMuxConn(socket)
+	sub := &WSClient{Message: socket.Message, ID: "agent-1", RoomID: "conv-1", SenderType: SenderAgent, mux: socket.mux, connID: "conn-1"}
+	socket.mux.add(sub)
+	hub.Register <- socket
+	hub.Register <- sub
+
+	hub.Broadcast <- testEventMessage(t, "conv-1", 4, EventMessageCreated, MessageEvent{})
+	hub.Broadcast <- testEventMessage(t, roomID, 1, EventAssignmentChanged, AssignmentEvent{})
+	hub.do(func() {})
+
+	if !sub.resync.Load() || sub.resyncSeq.Load() != 4 || socket.resync.Load() {
+		t.Fatalf("expected the conversation to resync up to seq 4, got %v at %d (socket %v)", sub.resync.Load(), sub.resyncSeq.Load(), socket.resync.Load())
+	}
+	if !socket.mux.resync.Load() {
+		t.Fatal("expected the socket to be told a member has a resync pending")
+	}
+}
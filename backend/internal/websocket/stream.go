@@ -0,0 +1,266 @@
+package websocket
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// streamHeartbeatInterval is how often an idle SSE stream gets a comment
+	// line, so proxies do not time it out.
+	streamHeartbeatInterval = 15 * time.Second
+	// longPollTimeout is how long a long poll waits for an event before it is
+	// answered empty.
+	longPollTimeout = 25 * time.Second
+)
+
+// StreamRoom serves the events of roomId as Server-Sent Events, for clients
+// whose network blocks websocket upgrades. Each message carries the same
+// envelope a v1 socket receives, with the room sequence as the event ID, so
+// a reconnecting EventSource resumes through Last-Event-ID like a socket does
+// through lastSeq. The stream counts towards the presence of userId.
+func (h *Handler) StreamRoom(w http.ResponseWriter, r *http.Request, roomId, userId, senderType, tenantID string) {
+	if h.refuseWhileDraining(w) {
+		return
+	}
+	lastSeq, replay, err := parseStreamLastSeq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	out := &sseWriter{w: w, rc: http.NewResponseController(w)}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := out.rc.Flush(); err != nil {
+		log.Printf("Event stream for room %s cannot be flushed: %v", roomId, err)
+		return
+	}
+
+	cl := h.newClient(roomId, userId, senderType, tenantID, ProtocolEnvelope, out)
+	h.register(cl, lastSeq, replay)
+	go h.trackPresence(cl)
+
+	defer func() {
+		cl.mu.Lock()
+		cl.isClosed = true
+		cl.mu.Unlock()
+		close(cl.done)
+		h.hub.Unregister <- cl
+	}()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.draining:
+			// EventSource reconnects on its own once the stream ends; the
+			// retry field spreads those reconnects out.
+			if err := out.retry(h.reconnectAfter()); err != nil {
+				log.Printf("Error sending retry to event stream of client %s: %v", cl.ID, err)
+			}
+			return
+		case msg, ok := <-cl.Message:
+			if !ok {
+				return
+			}
+			if err := cl.sendPendingResync(); err != nil {
+				return
+			}
+			if err := cl.send(msg); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if err := out.comment("keepalive"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// pollResponse is the answer to a long poll. Clients pass LastSeq as the
+// lastSeq of their next poll.
+type pollResponse struct {
+	Events  []interface{} `json:"events"`
+	LastSeq int64         `json:"lastSeq"`
+}
+
+// PollRoom answers a long poll for the events of roomId after the lastSeq
+// query parameter, as soon as there is one or empty after longPollTimeout.
+// Without lastSeq it only waits for new events. Unlogged events such as
+// typing indicators only reach a client while one of its polls is waiting,
+// and polls do not count towards presence.
+func (h *Handler) PollRoom(w http.ResponseWriter, r *http.Request, roomId, userId, senderType, tenantID string) {
+	if h.refuseWhileDraining(w) {
+		return
+	}
+	lastSeq, replay, err := parseLastSeq(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	batch := &pollWriter{}
+	cl := h.newClient(roomId, userId, senderType, tenantID, ProtocolEnvelope, batch)
+	h.hub.Register <- cl
+	defer func() {
+		h.hub.Unregister <- cl
+	}()
+
+	// The client is registered before its cursor is read, so nothing
+	// published in between is missed; what it receives twice is skipped
+	// through lastSeq.
+	if replay {
+		cl.lastSeq = lastSeq
+		h.replay(cl, lastSeq, replayTimeout)
+	} else {
+		cl.lastSeq = h.currentSeq(roomId)
+	}
+
+	timeout := time.NewTimer(longPollTimeout)
+	defer timeout.Stop()
+
+wait:
+	for len(batch.frames) == 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-timeout.C:
+			break wait
+		case <-h.draining:
+			break wait
+		case msg, ok := <-cl.Message:
+			if !ok {
+				break wait
+			}
+			h.pollSend(cl, msg)
+		}
+	}
+
+	// Take along what queued up meanwhile.
+	for more := true; more; {
+		select {
+		case msg, ok := <-cl.Message:
+			if !ok {
+				more = false
+				continue
+			}
+			h.pollSend(cl, msg)
+		default:
+			more = false
+		}
+	}
+
+	frames := batch.frames
+	if frames == nil {
+		frames = []interface{}{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(pollResponse{Events: frames, LastSeq: cl.lastSeq}); err != nil {
+		log.Printf("Error answering poll of client %s in room %s: %v", cl.ID, roomId, err)
+	}
+}
+
+func (h *Handler) pollSend(cl *WSClient, msg *WSMessage) {
+	if err := cl.sendPendingResync(); err != nil {
+		log.Printf("Error adding resync to poll of client %s: %v", cl.ID, err)
+	}
+	if err := cl.send(msg); err != nil {
+		log.Printf("Error adding event to poll of client %s: %v", cl.ID, err)
+	}
+}
+
+// currentSeq returns the newest sequence of the log of roomID, or 0 when it
+// cannot be read.
+func (h *Handler) currentSeq(roomID string) int64 {
+	ctx, cancel := context.WithTimeout(context.Background(), replayGapTimeout)
+	defer cancel()
+
+	_, current, _, err := h.broker.Since(ctx, roomID, 0)
+	if err != nil {
+		log.Printf("Reading the sequence of room %s failed: %v", roomID, err)
+		return 0
+	}
+	return current
+}
+
+// parseStreamLastSeq reads where an SSE client resumes: the Last-Event-ID
+// header an EventSource sends on reconnect, or the lastSeq query parameter of
+// a client switching over from a socket.
+func parseStreamLastSeq(r *http.Request) (int64, bool, error) {
+	raw := strings.TrimSpace(r.Header.Get("Last-Event-ID"))
+	if raw == "" {
+		return parseLastSeq(r)
+	}
+	lastSeq, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || lastSeq < 0 {
+		return 0, false, fmt.Errorf("invalid Last-Event-ID")
+	}
+	return lastSeq, true, nil
+}
+
+// sseWriter writes frames as Server-Sent Events.
+type sseWriter struct {
+	w  http.ResponseWriter
+	rc *http.ResponseController
+}
+
+func (s *sseWriter) WriteJSON(v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	if event, ok := v.(*Event); ok && event.Seq != 0 {
+		fmt.Fprintf(&buf, "id: %d\n", event.Seq)
+	}
+	buf.WriteString("data: ")
+	buf.Write(raw)
+	buf.WriteString("\n\n")
+
+	if _, err := s.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// retry sets how long the client waits before reconnecting once the stream
+// ends.
+func (s *sseWriter) retry(after time.Duration) error {
+	if _, err := fmt.Fprintf(s.w, "retry: %d\n\n", after.Milliseconds()); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// comment writes an SSE comment line, which clients ignore.
+func (s *sseWriter) comment(text string) error {
+	if _, err := fmt.Fprintf(s.w, ": %s\n\n", text); err != nil {
+		return err
+	}
+	return s.rc.Flush()
+}
+
+// pollWriter collects the frames of a long poll until it is answered.
+type pollWriter struct {
+	frames []interface{}
+}
+
+func (p *pollWriter) WriteJSON(v interface{}) error {
+	p.frames = append(p.frames, v)
+	return nil
+}
@@ -0,0 +1,178 @@
+package websocket
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// ticketTTL is how long a connection ticket can be redeemed after it was
+// issued.
+const ticketTTL = 30 * time.Second
+
+// Roles a connection ticket is issued for.
+const (
+	TicketRoleVisitor = "visitor"
+	TicketRoleAgent   = "agent"
+)
+
+// ErrTicketInvalid is returned when a ticket does not exist, expired or was
+// already redeemed.
+var ErrTicketInvalid = errors.New("websocket ticket invalid")
+
+// Ticket is the identity a connection ticket stands for. Visitor tickets are
+// bound to their conversation; agent tickets open any room of their tenant.
+type Ticket struct {
+	Role           string `json:"role"`
+	TenantID       string `json:"tenantId"`
+	ParticipantID  string `json:"participantId"`
+	ConversationID string `json:"conversationId,omitempty"`
+}
+
+// TicketStore keeps issued tickets until they are redeemed or expire. Take
+// must remove the ticket in the same step it reads it, so that a ticket is
+// redeemed at most once across every replica.
+type TicketStore interface {
+	Put(ctx context.Context, id string, ticket Ticket, ttl time.Duration) error
+	Take(ctx context.Context, id string) (Ticket, error)
+}
+
+// Tickets issues and redeems the short-lived, single-use tickets sockets
+// authenticate with, so long-lived tokens stay out of websocket URLs.
+type Tickets struct {
+	store TicketStore
+	now   func() time.Time
+}
+
+// NewTickets returns Tickets kept next to the room logs of broker, which the
+// servers issuing and redeeming tickets share.
+func NewTickets(broker Broker) *Tickets {
+	var store TicketStore
+	switch b := broker.(type) {
+	case *RedisBroker:
+		store = newRedisTicketStore(b.client)
+	case *MemoryBroker:
+		store = b.tickets
+	default:
+		store = NewMemoryTicketStore(time.Now)
+	}
+	return NewTicketsWithStore(store, time.Now)
+}
+
+func NewTicketsWithStore(store TicketStore, now func() time.Time) *Tickets {
+	if now == nil {
+		now = time.Now
+	}
+	return &Tickets{store: store, now: now}
+}
+
+// Issue stores ticket and returns its ID and expiry.
+func (t *Tickets) Issue(ctx context.Context, ticket Ticket) (string, time.Time, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, fmt.Errorf("websocket ticket: generate id: %w", err)
+	}
+	id := base64.RawURLEncoding.EncodeToString(raw)
+
+	if err := t.store.Put(ctx, id, ticket, ticketTTL); err != nil {
+		return "", time.Time{}, fmt.Errorf("websocket ticket: store: %w", err)
+	}
+	return id, t.now().Add(ticketTTL), nil
+}
+
+// Redeem consumes the ticket id. It returns ErrTicketInvalid for unknown,
+// expired and already redeemed tickets.
+func (t *Tickets) Redeem(ctx context.Context, id string) (Ticket, error) {
+	if id == "" {
+		return Ticket{}, ErrTicketInvalid
+	}
+	return t.store.Take(ctx, id)
+}
+
+type redisTicketStore struct {
+	client *redis.Client
+}
+
+func newRedisTicketStore(client *redis.Client) *redisTicketStore {
+	return &redisTicketStore{client: client}
+}
+
+func ticketKey(id string) string {
+	return "ws:ticket:" + id
+}
+
+func (s *redisTicketStore) Put(ctx context.Context, id string, ticket Ticket, ttl time.Duration) error {
+	raw, err := json.Marshal(ticket)
+	if err != nil {
+		return err
+	}
+	return s.client.Set(ctx, ticketKey(id), raw, ttl).Err()
+}
+
+func (s *redisTicketStore) Take(ctx context.Context, id string) (Ticket, error) {
+	raw, err := s.client.GetDel(ctx, ticketKey(id)).Bytes()
+	if err == redis.Nil {
+		return Ticket{}, ErrTicketInvalid
+	}
+	if err != nil {
+		return Ticket{}, fmt.Errorf("websocket ticket: take: %w", err)
+	}
+
+	var ticket Ticket
+	if err := json.Unmarshal(raw, &ticket); err != nil {
+		return Ticket{}, fmt.Errorf("websocket ticket: decode: %w", err)
+	}
+	return ticket, nil
+}
+
+// MemoryTicketStore is a TicketStore for a single process.
+type MemoryTicketStore struct {
+	mu      sync.Mutex
+	now     func() time.Time
+	tickets map[string]memoryTicket
+}
+
+type memoryTicket struct {
+	ticket    Ticket
+	expiresAt time.Time
+}
+
+func NewMemoryTicketStore(now func() time.Time) *MemoryTicketStore {
+	if now == nil {
+		now = time.Now
+	}
+	return &MemoryTicketStore{now: now, tickets: make(map[string]memoryTicket)}
+}
+
+func (s *MemoryTicketStore) Put(ctx context.Context, id string, ticket Ticket, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for key, stored := range s.tickets {
+		if !now.Before(stored.expiresAt) {
+			delete(s.tickets, key)
+		}
+	}
+	s.tickets[id] = memoryTicket{ticket: ticket, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryTicketStore) Take(ctx context.Context, id string) (Ticket, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.tickets[id]
+	delete(s.tickets, id)
+	if !ok || !s.now().Before(stored.expiresAt) {
+		return Ticket{}, ErrTicketInvalid
+	}
+	return stored.ticket, nil
+}
@@ -0,0 +1,43 @@
+package websocket
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTicketsRedeemOnceBeforeExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+	tickets := NewTicketsWithStore(NewMemoryTicketStore(clock), clock)
+
+	issued := Ticket{Role: TicketRoleVisitor, TenantID: "tenant-1", ParticipantID: "visitor-1", ConversationID: "conv-1"}
+	id, expiresAt, err := tickets.Issue(ctx, issued)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	if !expiresAt.Equal(now.Add(ticketTTL)) {
+		t.Fatalf("unexpected expiry %s", expiresAt)
+	}
+
+	redeemed, err := tickets.Redeem(ctx, id)
+	if err != nil || redeemed != issued {
+		t.Fatalf("expected %+v, got %+v (%v)", issued, redeemed, err)
+	}
+	if _, err := tickets.Redeem(ctx, id); err != ErrTicketInvalid {
+		t.Fatalf("expected a second redeem to fail, got %v", err)
+	}
+
+	stale, _, err := tickets.Issue(ctx, issued)
+	if err != nil {
+		t.Fatalf("Issue error: %v", err)
+	}
+	now = now.Add(ticketTTL)
+	if _, err := tickets.Redeem(ctx, stale); err != ErrTicketInvalid {
+		t.Fatalf("expected an expired ticket to fail, got %v", err)
+	}
+	if _, err := tickets.Redeem(ctx, ""); err != ErrTicketInvalid {
+		t.Fatalf("expected an empty ticket to fail, got %v", err)
+	}
+}
@@ -1,14 +1,32 @@
 package websocket
 
+import "time"
+
+// Room holds the clients of one room on this replica, keyed by connection ID
+// so several sockets of the same participant can join it.
 type Room struct {
 	Id      string               `json:"id"`
 	Clients map[string]*WSClient `json:"clients"`
+
+	emptySince time.Time // When the last client left; zero while occupied
+	lastSeq    int64     // Highest room log sequence delivered in the room
 }
 
+// WSMessage is the legacy wire frame. Messages carrying a typed event keep it
+// in Event; Content then holds its legacy rendering.
 type WSMessage struct {
 	Content   string `json:"content"`
 	RoomID    string `json:"roomId"`
 	Timestamp int64  `json:"timestamp"`
+	Event     *Event `json:"-"`
+	// sender is the participant whose own frame caused the message, such as a
+	// typing indicator. The message is not delivered back to their sockets.
+	sender participant
+}
+
+type participant struct {
+	senderType string
+	senderID   string
 }
 
 type JoinRoomReq struct {
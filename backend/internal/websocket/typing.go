@@ -0,0 +1,182 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// typingTimeout clears a typing indicator whose sender stopped refreshing it
+	// without sending typing.stop.
+	typingTimeout = 6 * time.Second
+	// typingRefreshInterval is the minimum gap between two typing.start events
+	// published for the same sender; starts in between only extend the timeout.
+	typingRefreshInterval = 2 * time.Second
+	typingSweepInterval   = time.Second
+)
+
+type typingKey struct {
+	roomID     string
+	senderType string
+	senderID   string
+}
+
+// typingState is the indicator of one participant, who may type from several
+// sockets. It stays up until the last of them stops typing.
+type typingState struct {
+	conns       map[string]time.Time // Expiry of each typing socket, by connection ID
+	broadcastAt time.Time
+}
+
+// typingTracker holds the typing indicators of the senders connected to this
+// replica. It is not safe for concurrent use; typingRelay guards it.
+type typingTracker struct {
+	active map[typingKey]*typingState
+}
+
+func newTypingTracker() *typingTracker {
+	return &typingTracker{active: make(map[typingKey]*typingState)}
+}
+
+func typingKeyFor(client *WSClient) typingKey {
+	return typingKey{
+		roomID:     client.RoomID,
+		senderType: client.SenderType,
+		senderID:   client.ID,
+	}
+}
+
+// start records that key is typing on the socket connID and reports whether a
+// typing.start should be published, together with the new expiry.
+func (t *typingTracker) start(key typingKey, connID string, now time.Time) (bool, time.Time) {
+	expiresAt := now.Add(typingTimeout)
+	state, ok := t.active[key]
+	if !ok {
+		t.active[key] = &typingState{conns: map[string]time.Time{connID: expiresAt}, broadcastAt: now}
+		return true, expiresAt
+	}
+
+	state.conns[connID] = expiresAt
+	if now.Sub(state.broadcastAt) < typingRefreshInterval {
+		return false, expiresAt
+	}
+	state.broadcastAt = now
+	return true, expiresAt
+}
+
+// stop clears the socket connID of key and reports whether that cleared the
+// indicator, which is only the case once no other socket of key is typing.
+func (t *typingTracker) stop(key typingKey, connID string) bool {
+	state, ok := t.active[key]
+	if !ok {
+		return false
+	}
+	if _, ok := state.conns[connID]; !ok {
+		return false
+	}
+	delete(state.conns, connID)
+	if len(state.conns) > 0 {
+		return false
+	}
+	delete(t.active, key)
+	return true
+}
+
+// expire clears the sockets that timed out by now and returns every
+// indicator left without a typing socket.
+func (t *typingTracker) expire(now time.Time) []typingKey {
+	var expired []typingKey
+	for key, state := range t.active {
+		for connID, expiresAt := range state.conns {
+			if !now.Before(expiresAt) {
+				delete(state.conns, connID)
+			}
+		}
+		if len(state.conns) == 0 {
+			expired = append(expired, key)
+			delete(t.active, key)
+		}
+	}
+	return expired
+}
+
+// typingRelay turns the typing frames read from the sockets of this replica
+// into typing events published to every replica. Frames are throttled here, in
+// the read loop of the sending client, so they never queue behind the hub.
+// The replica holding the sender's socket also publishes the typing.stop when
+// its indicator times out or the socket closes.
+type typingRelay struct {
+	mu      sync.Mutex
+	tracker *typingTracker
+	now     func() time.Time
+	publish func(roomID string, event Event)
+}
+
+func newTypingRelay(now func() time.Time, publish func(roomID string, event Event)) *typingRelay {
+	if now == nil {
+		now = time.Now
+	}
+	return &typingRelay{
+		tracker: newTypingTracker(),
+		now:     now,
+		publish: publish,
+	}
+}
+
+// handle applies a typing frame sent by cl. Frames sent to notification rooms
+// are ignored: nobody is typing in them.
+func (r *typingRelay) handle(cl *WSClient, frameType string) {
+	if isNotificationRoom(cl.RoomID) {
+		return
+	}
+
+	key := typingKeyFor(cl)
+	now := r.now()
+
+	r.mu.Lock()
+	var send bool
+	var expiresAt time.Time
+	switch frameType {
+	case FrameTypingStart:
+		send, expiresAt = r.tracker.start(key, cl.connID, now)
+	case FrameTypingStop:
+		send = r.tracker.stop(key, cl.connID)
+	}
+	r.mu.Unlock()
+
+	if send {
+		r.emit(frameType, key, expiresAt, now)
+	}
+}
+
+// disconnect clears the indicator of a closed socket, unless another socket
+// of the same participant is still typing.
+func (r *typingRelay) disconnect(cl *WSClient) {
+	r.handle(cl, FrameTypingStop)
+}
+
+// sweep publishes typing.stop for every indicator that timed out.
+func (r *typingRelay) sweep() {
+	now := r.now()
+
+	r.mu.Lock()
+	expired := r.tracker.expire(now)
+	r.mu.Unlock()
+
+	for _, key := range expired {
+		r.emit(FrameTypingStop, key, time.Time{}, now)
+	}
+}
+
+func (r *typingRelay) emit(eventType string, key typingKey, expiresAt, now time.Time) {
+	if r.publish == nil {
+		return
+	}
+	event, err := newTypingEvent(eventType, key, expiresAt, now)
+	if err != nil {
+		log.Printf("failed to build %s event for room %s: %v", eventType, key.roomID, err)
+		return
+	}
+	r.publish(key.roomID, event)
+}
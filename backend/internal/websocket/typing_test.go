@@ -0,0 +1,200 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func newTypingTestHub(roomID string, clients ...*WSClient) *Hub {
+	hub := NewHub()
+	room := &Room{Id: roomID, Clients: make(map[string]*WSClient)}
+	for _, client := range clients {
+		room.Clients[client.connID] = client
+	}
+	hub.rooms[roomID] = room
+	return hub
+}
+
+// newTypingTestRelay returns a relay whose events make the round trip through
+// a Redis payload into hub, the way every replica receives them.
+func newTypingTestRelay(hub *Hub, now *time.Time) (*typingRelay, *int) {
+	published := 0
+	relay := newTypingRelay(func() time.Time { return *now }, func(roomID string, event Event) {
+		published++
+		raw, err := json.Marshal(event)
+		if err != nil {
+			panic(err)
+		}
+		hub.deliver(messageFromPayload(roomID, string(raw), *now))
+	})
+	return relay, &published
+}
+
+func newTypingTestClient(roomID, id, senderType string) *WSClient {
+	return &WSClient{
+		ID:         id,
+		RoomID:     roomID,
+		SenderType: senderType,
+		Message:    make(chan *WSMessage, 10),
+		connID:     roomID + "/" + id,
+	}
+}
+
+func receiveTypingEvent(t *testing.T, client *WSClient) (string, TypingEvent) {
+	t.Helper()
+	select {
+	case msg := <-client.Message:
+		if msg.Event == nil {
+			t.Fatalf("expected an event for client %s, got %s", client.ID, msg.Content)
+		}
+		var payload TypingEvent
+		if err := msg.Event.DecodePayload(&payload); err != nil {
+			t.Fatalf("decode typing event: %v", err)
+		}
+		return msg.Event.Type, payload
+	default:
+		t.Fatalf("expected a message for client %s", client.ID)
+		return "", TypingEvent{}
+	}
+}
+
+func expectNoMessage(t *testing.T, client *WSClient) {
+	t.Helper()
+	select {
+	case msg := <-client.Message:
+		t.Fatalf("expected no message for client %s, got %s", client.ID, msg.Content)
+	default:
+	}
+}
+
+func TestTypingFanOutSkipsSenderAndCoalescesStarts(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitor := newTypingTestClient("conv-1", "visitor-1", SenderVisitor)
+	agent := newTypingTestClient("conv-1", "agent-1", SenderAgent)
+	hub := newTypingTestHub("conv-1", visitor, agent)
+	relay, published := newTypingTestRelay(hub, &now)
+
+	relay.handle(visitor, FrameTypingStart)
+
+	eventType, event := receiveTypingEvent(t, agent)
+	if eventType != FrameTypingStart || event.SenderType != SenderVisitor || event.SenderID != "visitor-1" {
+		t.Fatalf("unexpected typing event %+v", event)
+	}
+	if event.ConversationID != "conv-1" || event.ExpiresAt == "" {
+		t.Fatalf("expected conversation and expiry on start event, got %+v", event)
+	}
+	expectNoMessage(t, visitor)
+
+	now = now.Add(time.Second)
+	relay.handle(visitor, FrameTypingStart)
+	if *published != 1 {
+		t.Fatalf("expected the repeated start to be throttled, got %d publishes", *published)
+	}
+	expectNoMessage(t, agent)
+
+	now = now.Add(typingRefreshInterval)
+	relay.handle(visitor, FrameTypingStart)
+	if eventType, _ := receiveTypingEvent(t, agent); eventType != FrameTypingStart {
+		t.Fatalf("expected refreshed start, got %s", eventType)
+	}
+
+	relay.handle(visitor, FrameTypingStop)
+	if eventType, _ := receiveTypingEvent(t, agent); eventType != FrameTypingStop {
+		t.Fatalf("expected stop, got %s", eventType)
+	}
+
+	relay.handle(visitor, FrameTypingStop)
+	expectNoMessage(t, agent)
+}
+
+func TestTypingRelayStopsOnTimeoutAndDisconnect(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitor := newTypingTestClient("conv-1", "visitor-1", SenderVisitor)
+	agent := newTypingTestClient("conv-1", "agent-1", SenderAgent)
+	hub := newTypingTestHub("conv-1", visitor, agent)
+	relay, _ := newTypingTestRelay(hub, &now)
+
+	relay.handle(agent, FrameTypingStart)
+	receiveTypingEvent(t, visitor)
+
+	now = now.Add(typingTimeout)
+	relay.sweep()
+	if eventType, event := receiveTypingEvent(t, visitor); eventType != FrameTypingStop || event.SenderID != "agent-1" {
+		t.Fatalf("expected a stop for the timed out indicator, got %s %+v", eventType, event)
+	}
+
+	relay.handle(agent, FrameTypingStart)
+	receiveTypingEvent(t, visitor)
+	relay.disconnect(agent)
+	if eventType, _ := receiveTypingEvent(t, visitor); eventType != FrameTypingStop {
+		t.Fatalf("expected a stop when the socket closed, got %s", eventType)
+	}
+	expectNoMessage(t, agent)
+}
+
+func TestTypingIndicatorOutlivesOneOfTwoSockets(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	visitor := newTypingTestClient("conv-1", "visitor-1", SenderVisitor)
+	firstTab := newTypingTestClient("conv-1", "agent-1", SenderAgent)
+	secondTab := newTypingTestClient("conv-1", "agent-1", SenderAgent)
+	secondTab.connID = "conv-1/agent-1/2"
+	hub := newTypingTestHub("conv-1", visitor, firstTab, secondTab)
+	relay, _ := newTypingTestRelay(hub, &now)
+
+	relay.handle(firstTab, FrameTypingStart)
+	receiveTypingEvent(t, visitor)
+	relay.handle(secondTab, FrameTypingStart)
+
+	relay.disconnect(firstTab)
+	expectNoMessage(t, visitor)
+
+	relay.disconnect(secondTab)
+	if eventType, event := receiveTypingEvent(t, visitor); eventType != FrameTypingStop || event.SenderID != "agent-1" {
+		t.Fatalf("expected a stop once the last socket closed, got %s %+v", eventType, event)
+	}
+}
+
+func TestTypingIgnoredInNotificationRooms(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	hub := NewHub()
+	relay, published := newTypingTestRelay(hub, &now)
+
+	for _, roomID := range []string{TenantNotificationRoomID("tenant-1"), UserNotificationRoomID("tenant-1", "agent-1")} {
+		relay.handle(newTypingTestClient(roomID, "agent-1", SenderAgent), FrameTypingStart)
+	}
+	if *published != 0 {
+		t.Fatalf("expected typing in notification rooms to be ignored, got %d publishes", *published)
+	}
+}
+
+func TestTypingTrackerExpiresStaleIndicators(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	tracker := newTypingTracker()
+	key := typingKey{roomID: "conv-1", senderType: SenderAgent, senderID: "agent-1"}
+
+	if send, _ := tracker.start(key, "conn-1", now); !send {
+		t.Fatal("expected first start to be sent")
+	}
+	if expired := tracker.expire(now.Add(typingTimeout - time.Second)); len(expired) != 0 {
+		t.Fatalf("expected nothing to expire yet, got %v", expired)
+	}
+	expired := tracker.expire(now.Add(typingTimeout))
+	if len(expired) != 1 || expired[0] != key {
+		t.Fatalf("expected %v to expire, got %v", key, expired)
+	}
+	if tracker.stop(key, "conn-1") {
+		t.Fatal("expected expired indicator to be cleared")
+	}
+}
+
+func TestParseClientFrameAcceptsOnlyKnownTypes(t *testing.T) {
+	if frame, ok := parseClientFrame([]byte(`{"type":"typing.start"}`)); !ok || frame.Type != FrameTypingStart {
+		t.Fatalf("expected typing.start frame, got %+v %v", frame, ok)
+	}
+	for _, raw := range []string{`hello`, `{"type":"unknown"}`, `["typing.start"]`} {
+		if _, ok := parseClientFrame([]byte(raw)); ok {
+			t.Fatalf("expected %q to be rejected", raw)
+		}
+	}
+}
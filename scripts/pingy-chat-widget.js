@@ -6,6 +6,12 @@
   const DEFAULT_BUBBLE_TEXT = "Chat with us";
   const DEFAULT_HEADER = "Need a hand?";
   const STORAGE_PREFIX = "pingy_chat_widget";
+  // Matches the server: typing.start is resent at most every 2s while the
+  // visitor types, and an indicator that is not refreshed clears after 6s.
+  const TYPING_REFRESH_MS = 2000;
+  const EVENT_STREAM_RETRY_MS = 3000;
+  const SERVICE_RESTART_CLOSE_CODE = 1012;
+  const TYPING_TIMEOUT_MS = 6000;
 
   // User should *not* pass apiBase/wsBase. We resolve automatically.
   function resolveApiBase() {
@@ -136,6 +142,83 @@
         border-bottom-left-radius: 4px;
         box-shadow: 0 2px 8px rgba(15,23,42,0.08);
       }
+      .pingy-chat-message-system {
+        align-self: center;
+        max-width: 90%;
+        padding: 2px 8px;
+        background: transparent;
+        color: #64748b;
+        font-size: 12px;
+        text-align: center;
+      }
+      .pingy-chat-quick-replies {
+        display: flex;
+        flex-wrap: wrap;
+        gap: 6px;
+        margin-top: 8px;
+      }
+      .pingy-chat-quick-replies button,
+      .pingy-chat-form button {
+        border: 1px solid ${themeColor};
+        background: #ffffff;
+        color: ${themeColor};
+        border-radius: 999px;
+        padding: 4px 12px;
+        font-size: 13px;
+        cursor: pointer;
+      }
+      .pingy-chat-quick-replies button:disabled,
+      .pingy-chat-form button:disabled {
+        opacity: 0.6;
+        cursor: not-allowed;
+      }
+      .pingy-chat-card {
+        display: block;
+        margin-top: 6px;
+        padding: 8px 10px;
+        border: 1px solid #e2e8f0;
+        border-radius: 10px;
+        color: inherit;
+        text-decoration: none;
+      }
+      .pingy-chat-card img {
+        display: block;
+        max-width: 100%;
+        max-height: 140px;
+        margin-bottom: 6px;
+        border-radius: 6px;
+      }
+      .pingy-chat-card strong {
+        display: block;
+      }
+      .pingy-chat-card span {
+        display: block;
+        font-size: 12px;
+        color: #64748b;
+      }
+      .pingy-chat-form {
+        display: flex;
+        flex-direction: column;
+        gap: 6px;
+        margin-top: 8px;
+      }
+      .pingy-chat-form label {
+        display: flex;
+        flex-direction: column;
+        gap: 2px;
+        font-size: 12px;
+      }
+      .pingy-chat-form input,
+      .pingy-chat-form textarea,
+      .pingy-chat-form select {
+        border: 1px solid #cbd5f5;
+        border-radius: 6px;
+        padding: 6px 8px;
+        font: inherit;
+      }
+      .pingy-chat-form button {
+        align-self: flex-start;
+      }
       .pingy-chat-input {
         padding: 12px;
         border-top: 1px solid #e2e8f0;
@@ -228,11 +311,48 @@
         opacity: 0.6;
         cursor: not-allowed;
       }
+      .pingy-chat-actions {
+        display: flex;
+        justify-content: space-between;
+        align-items: center;
+      }
+      .pingy-chat-attach {
+        background: none;
+        border: 1px solid #cbd5f5;
+        border-radius: 999px;
+        padding: 6px 12px;
+        font-size: 13px;
+        color: #475569;
+        cursor: pointer;
+      }
+      .pingy-chat-attach:disabled {
+        opacity: 0.6;
+        cursor: not-allowed;
+      }
+      .pingy-chat-attachment {
+        display: block;
+        margin-top: 6px;
+        color: inherit;
+        text-decoration: underline;
+      }
+      .pingy-chat-attachment img {
+        display: block;
+        max-width: 100%;
+        max-height: 180px;
+        border-radius: 8px;
+      }
       .pingy-chat-note {
         font-size: 12px;
         color: #64748b;
         text-align: center;
       }
+      .pingy-chat-typing {
+        display: none;
+        padding: 0 16px 8px;
+        font-size: 12px;
+        font-style: italic;
+        color: #64748b;
+      }
       .pingy-chat-loading {
         text-align: center;
         padding: 16px;
@@ -263,6 +383,10 @@
     const messages = document.createElement("div");
     messages.className = "pingy-chat-messages";
 
+    const typing = document.createElement("div");
+    typing.className = "pingy-chat-typing";
+    typing.textContent = "Agent is typing…";
+
     const offlineContainer = document.createElement("div");
     offlineContainer.className = "pingy-chat-offline";
 
@@ -307,12 +431,27 @@
     sendBtn.className = "pingy-chat-send";
     sendBtn.textContent = "Send";
 
+    const attachBtn = document.createElement("button");
+    attachBtn.className = "pingy-chat-attach";
+    attachBtn.textContent = "Attach file";
+
+    const fileInput = document.createElement("input");
+    fileInput.type = "file";
+    fileInput.style.display = "none";
+
+    const actions = document.createElement("div");
+    actions.className = "pingy-chat-actions";
+    actions.appendChild(attachBtn);
+    actions.appendChild(sendBtn);
+
     inputContainer.appendChild(textarea);
-    inputContainer.appendChild(sendBtn);
+    inputContainer.appendChild(fileInput);
+    inputContainer.appendChild(actions);
     inputContainer.appendChild(note);
 
     windowEl.appendChild(header);
     windowEl.appendChild(messages);
+    windowEl.appendChild(typing);
     windowEl.appendChild(offlineContainer);
     windowEl.appendChild(inputContainer);
 
@@ -324,8 +463,11 @@
       windowEl,
       close,
       messages,
+      typing,
       textarea,
       sendBtn,
+      attachBtn,
+      fileInput,
       offlineContainer,
       offlineInput,
       offlineButton: offlineSave,
@@ -425,12 +567,16 @@
       elements,
       conversation: loadStoredConversation(storageKey),
       websocket: null,
+      eventSource: null,
+      streamSeq: 0,
       isSending: false,
       isLoadingMessages: false,
       isSavingEmail: false,
       offlineMessage: "",
       offlineMessageType: "info",
       renderedMessageIds: new Set(),
+      typingSentAt: 0,
+      agentTypingTimer: null,
     };
 
     updateOfflineControls(state);
@@ -548,18 +694,32 @@
   }
 
   function wireEvents(state) {
-    const { bubble, close, sendBtn, textarea, windowEl, offlineButton, offlineInput } = state.elements;
+    const { bubble, close, sendBtn, attachBtn, fileInput, textarea, windowEl, offlineButton, offlineInput } = state.elements;
 
     bubble.addEventListener("click", () => toggleWindow(state));
     close.addEventListener("click", () => closeWindow(state));
 
     sendBtn.addEventListener("click", () => sendMessage(state));
+    attachBtn.addEventListener("click", () => fileInput.click());
+    fileInput.addEventListener("change", () => {
+      const file = fileInput.files && fileInput.files[0];
+      fileInput.value = "";
+      if (file) sendAttachment(state, file);
+    });
     textarea.addEventListener("keydown", (event) => {
       if (event.key === "Enter" && !event.shiftKey) {
         event.preventDefault();
         sendMessage(state);
       }
     });
+    textarea.addEventListener("input", () => {
+      if (textarea.value.trim()) {
+        sendTypingStart(state);
+      } else {
+        sendTypingStop(state);
+      }
+    });
+    textarea.addEventListener("blur", () => sendTypingStop(state));
 
     document.addEventListener("click", (event) => {
       if (!windowEl.contains(event.target) && event.target !== bubble) {
@@ -616,6 +776,51 @@
       try { state.websocket.close(); } catch (_err) {}
       state.websocket = null;
     }
+    closeEventStream(state);
+    state.streamSeq = 0;
+    state.typingSentAt = 0;
+    setAgentTyping(state, false);
+  }
+
+  function sendSocketFrame(state, frame) {
+    const socket = state.websocket;
+    if (!socket || socket.readyState !== window.WebSocket.OPEN) return false;
+    try {
+      socket.send(JSON.stringify(frame));
+      return true;
+    } catch (_err) {
+      return false;
+    }
+  }
+
+  // sendTypingStart tells the agent the visitor is typing. Keystrokes within
+  // TYPING_REFRESH_MS of the last start are not sent again.
+  function sendTypingStart(state) {
+    const now = Date.now();
+    if (state.typingSentAt && now - state.typingSentAt < TYPING_REFRESH_MS) return;
+    if (sendSocketFrame(state, { type: "typing.start" })) {
+      state.typingSentAt = now;
+    }
+  }
+
+  function sendTypingStop(state) {
+    if (!state.typingSentAt) return;
+    state.typingSentAt = 0;
+    sendSocketFrame(state, { type: "typing.stop" });
+  }
+
+  function setAgentTyping(state, isTyping) {
+    const { typing } = state.elements;
+    if (state.agentTypingTimer) {
+      clearTimeout(state.agentTypingTimer);
+      state.agentTypingTimer = null;
+    }
+    if (!typing) return;
+    typing.style.display = isTyping ? "block" : "none";
+    if (isTyping) {
+      // Hide the indicator ourselves if its typing.stop never arrives.
+      state.agentTypingTimer = setTimeout(() => setAgentTyping(state, false), TYPING_TIMEOUT_MS);
+    }
   }
 
   function resetConversationForNewKey(state, newKey) {
@@ -649,6 +854,7 @@
 
     state.isSending = true;
     sendBtn.disabled = true;
+    sendTypingStop(state);
 
     const conversation = state.conversation;
     const sendPromise = conversation && conversation.conversationId
@@ -667,6 +873,40 @@
       });
   }
 
+  // Attachments need a conversation, so the first one starts it with the typed
+  // text or a note naming the file.
+  function sendAttachment(state, file) {
+    const { textarea, sendBtn, attachBtn } = state.elements;
+    if (state.isSending) return;
+
+    state.isSending = true;
+    sendBtn.disabled = true;
+    attachBtn.disabled = true;
+    sendTypingStop(state);
+
+    let body = textarea.value.trim();
+    let ready = Promise.resolve();
+    if (!state.conversation || !state.conversation.conversationId) {
+      ready = createConversation(state, body || `Sent ${file.name}`);
+      body = "";
+    }
+
+    ready
+      .then(() => postVisitorAttachment(state, file, body))
+      .then(() => { textarea.value = ""; })
+      .catch((error) => {
+        console.error("PingyChatWidget error:", error);
+        alert(error && error.status === 413
+          ? "That file is too large to send."
+          : "We couldn't send your file. Check its size and type and try again.");
+      })
+      .finally(() => {
+        state.isSending = false;
+        sendBtn.disabled = false;
+        attachBtn.disabled = false;
+      });
+  }
+
   function assignOfflineEmail(state) {
     if (!state || !state.elements || !state.elements.offlineInput) return Promise.resolve();
 
@@ -830,13 +1070,75 @@
       });
   }
 
+  // Quick replies are sent as plain text so agents and older dashboards read
+  // them like any other answer.
+  function sendQuickReply(state, reply, buttons) {
+    if (state.isSending || !state.conversation) return;
+
+    state.isSending = true;
+    buttons.forEach((button) => { button.disabled = true; });
+    postVisitorMessage(state, reply.value || reply.label)
+      .catch((error) => {
+        console.error("PingyChatWidget error:", error);
+        buttons.forEach((button) => { button.disabled = false; });
+        alert("We couldn't send your reply right now. Please try again shortly.");
+      })
+      .finally(() => {
+        state.isSending = false;
+      });
+  }
+
+  function submitForm(state, message, form) {
+    if (state.isSending || !state.conversation) return;
+
+    const values = {};
+    for (const field of form.elements) {
+      if (field.name && field.value.trim()) {
+        values[field.name] = field.value.trim();
+      }
+    }
+    const submit = form.querySelector("button");
+
+    state.isSending = true;
+    submit.disabled = true;
+    postVisitorPayload(state, {
+      type: "form_response",
+      content: { formResponse: { formMessageId: message.messageId, values } },
+    })
+      .then(() => {
+        for (const field of form.elements) {
+          field.disabled = true;
+        }
+      })
+      .catch((error) => {
+        console.error("PingyChatWidget error:", error);
+        submit.disabled = false;
+        alert("We couldn't send the form. Check your answers and try again.");
+      })
+      .finally(() => {
+        state.isSending = false;
+      });
+  }
+
   function postVisitorMessage(state, body) {
+    return postVisitorPayload(state, { body })
+      .catch((error) => {
+        if (error && error.status === 404) {
+          console.warn("PingyChatWidget: Conversation missing when sending. Resetting and retrying.", error);
+          flushConversation(state);
+          return createConversation(state, body);
+        }
+        throw error;
+      });
+  }
+
+  function postVisitorPayload(state, fields) {
     const { conversation } = state;
     const url = joinUrl(
       state.config.apiBase,
       `/api/public/v1/conversations/${encodeURIComponent(conversation.conversationId)}/messages`
     );
-    const payload = { visitorToken: conversation.visitorToken, body };
+    const payload = { visitorToken: conversation.visitorToken, ...fields };
 
     return fetch(url, {
       method: "POST",
@@ -852,14 +1154,33 @@
       .then((message) => {
         appendMessageToDOM(state, message);
         scrollMessages(state.elements.messages);
-      })
-      .catch((error) => {
-        if (error && error.status === 404) {
-          console.warn("PingyChatWidget: Conversation missing when sending. Resetting and retrying.", error);
-          flushConversation(state);
-          return createConversation(state, body);
-        }
-        throw error;
+      });
+  }
+
+  function postVisitorAttachment(state, file, body) {
+    const { conversation } = state;
+    const url = joinUrl(
+      state.config.apiBase,
+      `/api/public/v1/conversations/${encodeURIComponent(conversation.conversationId)}/attachments`
+    );
+    const form = new FormData();
+    form.append("file", file);
+    form.append("visitorToken", conversation.visitorToken);
+    if (body) form.append("body", body);
+
+    return fetch(url, {
+      method: "POST",
+      headers: {
+        "X-Tenant-Key": state.config.tenantKey,
+        "X-Visitor-Token": conversation.visitorToken,
+      },
+      body: form,
+    })
+      .then(checkStatus)
+      .then((response) => response.json())
+      .then((message) => {
+        appendMessageToDOM(state, message);
+        scrollMessages(state.elements.messages);
       });
   }
 
@@ -876,19 +1197,60 @@
     return ""; // give normalize a chance to no-op gracefully
   }
 
+  // Sockets authenticate with a single-use ticket so the visitor token never
+  // ends up in a URL.
+  function fetchWebsocketTicket(state) {
+    const { conversationId, visitorToken } = state.conversation;
+    const url = joinUrl(state.config.apiBase, "/api/public/v1/ws-tickets");
+
+    return fetch(url, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+        "X-Tenant-Key": state.config.tenantKey,
+        "X-Visitor-Token": visitorToken,
+      },
+      body: JSON.stringify({ conversationId }),
+    })
+      .then(checkStatus)
+      .then((response) => response.json())
+      .then((data) => data.ticket);
+  }
+
   function connectWebsocket(state) {
     if (!state.conversation) return;
 
+    if (state.websocket) {
+      try { state.websocket.close(); } catch (_err) {}
+    }
+    closeEventStream(state);
+
+    const conversation = state.conversation;
+    fetchWebsocketTicket(state)
+      .then((ticket) => {
+        if (state.conversation !== conversation) return;
+        openWebsocket(state, conversation.conversationId, ticket);
+      })
+      .catch((error) => {
+        console.warn("PingyChatWidget websocket ticket error:", error);
+      });
+  }
+
+  function openWebsocket(state, conversationId, ticket) {
     if (state.websocket) {
       try { state.websocket.close(); } catch (_err) {}
     }
 
-    const { conversationId, visitorToken } = state.conversation;
     const base = state.config.wsBase.replace(/\/+$/, "");
-    const url = `${base}/api/ws/v1/conversations/${encodeURIComponent(conversationId)}?role=visitor&token=${encodeURIComponent(visitorToken)}`;
+    const url = `${base}/api/ws/v1/conversations/${encodeURIComponent(conversationId)}?role=visitor&ticket=${encodeURIComponent(ticket)}`;
 
     try {
       const socket = new window.WebSocket(url);
+      let opened = false;
+
+      socket.onopen = () => {
+        opened = true;
+      };
 
       socket.onmessage = async (event) => {
         const raw = await readWsData(event.data);
@@ -896,19 +1258,121 @@
         handleSocketMessage(state, { data: raw });
       };
 
-      socket.onclose = () => { state.websocket = null; };
+      socket.onclose = (event) => {
+        if (state.websocket === socket) state.websocket = null;
+        if (!state.conversation || state.conversation.conversationId !== conversationId) return;
+        // A server shutting down for a deploy says when to come back, so its
+        // clients spread out over the remaining servers.
+        if (event && event.code === SERVICE_RESTART_CLOSE_CODE) {
+          setTimeout(() => {
+            if (state.conversation && state.conversation.conversationId === conversationId && !state.websocket) {
+              connectWebsocket(state);
+            }
+          }, reconnectAfterMs(event.reason));
+          return;
+        }
+        // A socket that never opened was most likely blocked on the way, so
+        // the widget falls back to a Server-Sent Events stream.
+        if (!opened) {
+          connectEventStream(state);
+        }
+      };
       state.websocket = socket;
     } catch (error) {
       console.warn("PingyChatWidget websocket error:", error);
+      connectEventStream(state);
+    }
+  }
+
+  function reconnectAfterMs(reason) {
+    try {
+      const hint = JSON.parse(reason || "{}");
+      if (typeof hint.reconnectAfterMs === "number" && hint.reconnectAfterMs >= 0) {
+        return hint.reconnectAfterMs;
+      }
+    } catch (_err) {}
+    return EVENT_STREAM_RETRY_MS;
+  }
+
+  function connectEventStream(state) {
+    if (!state.conversation || typeof window.EventSource !== "function") return;
+    closeEventStream(state);
+
+    const conversation = state.conversation;
+    fetchWebsocketTicket(state)
+      .then((ticket) => {
+        if (state.conversation !== conversation) return;
+        openEventStream(state, conversation.conversationId, ticket);
+      })
+      .catch((error) => {
+        console.warn("PingyChatWidget event stream ticket error:", error);
+      });
+  }
+
+  // openEventStream receives the same event envelopes as the socket. Tickets
+  // are single-use, so instead of letting EventSource retry with a spent
+  // ticket the stream is reopened with a new one, resuming after streamSeq.
+  function openEventStream(state, conversationId, ticket) {
+    closeEventStream(state);
+
+    const base = state.config.apiBase.replace(/\/+$/, "");
+    let url = `${base}/api/ws/v1/sse/conversations/${encodeURIComponent(conversationId)}?ticket=${encodeURIComponent(ticket)}`;
+    if (state.streamSeq) {
+      url += `&lastSeq=${state.streamSeq}`;
+    }
+
+    try {
+      const source = new window.EventSource(url);
+
+      source.onmessage = (event) => {
+        const seq = Number(event.lastEventId);
+        if (seq > state.streamSeq) state.streamSeq = seq;
+        handleSocketMessage(state, { data: event.data });
+      };
+
+      source.onerror = () => {
+        if (state.eventSource !== source) return;
+        closeEventStream(state);
+        setTimeout(() => {
+          if (state.conversation && state.conversation.conversationId === conversationId && !state.eventSource) {
+            connectEventStream(state);
+          }
+        }, EVENT_STREAM_RETRY_MS);
+      };
+      state.eventSource = source;
+    } catch (error) {
+      console.warn("PingyChatWidget event stream error:", error);
+    }
+  }
+
+  function closeEventStream(state) {
+    if (state.eventSource) {
+      try { state.eventSource.close(); } catch (_err) {}
+      state.eventSource = null;
     }
   }
 
 
   function handleSocketMessage(state, event) {
     const payload = normalizeSocketPayload(event.data);
-    if (!payload || !payload.message) return;
+    if (!payload) return;
+
+    if (payload.type === "typing.start" || payload.type === "typing.stop") {
+      if (payload.senderType === "agent") {
+        setAgentTyping(state, payload.type === "typing.start");
+      }
+      return;
+    }
+    if (!payload.message) return;
 
     const message = payload.message;
+    if (payload.type === "message.updated" || payload.type === "message.deleted") {
+      updateMessageInDOM(state, message);
+      return;
+    }
+    if (message.senderType === "agent") {
+      setAgentTyping(state, false);
+    }
     appendMessageToDOM(state, message);
     scrollMessages(state.elements.messages);
   }
@@ -924,6 +1388,10 @@
       normalized = decodedContent;
     }
 
+    if (normalized.version && normalized.payload && typeof normalized.payload === "object") {
+      normalized = { ...normalized.payload, type: normalized.type };
+    }
+
     if (normalized.message) {
       return normalized;
     }
@@ -982,14 +1450,162 @@
     }
 
     const bubble = document.createElement("div");
-    bubble.className = `pingy-chat-message ${message.senderType === "visitor" ? "pingy-chat-message-visitor" : "pingy-chat-message-agent"}`;
-    bubble.textContent = message.body;
+    bubble.className = `pingy-chat-message ${messageClass(message)}`;
+    renderMessageContent(state, bubble, message);
     if (messageId) {
       bubble.dataset.messageId = messageId;
     }
     state.elements.messages.appendChild(bubble);
   }
 
+  function updateMessageInDOM(state, message) {
+    if (!state || !state.elements || !state.elements.messages || !message || !message.messageId) return;
+    const bubbles = state.elements.messages.querySelectorAll(".pingy-chat-message");
+    for (const bubble of bubbles) {
+      if (bubble.dataset.messageId === message.messageId) {
+        renderMessageContent(state, bubble, message);
+        return;
+      }
+    }
+  }
+
+  // Deleted messages stay in the conversation as tombstones without a body.
+  function messageText(message) {
+    if (message.deletedAt) {
+      return "Message deleted";
+    }
+    return message.body;
+  }
+
+  function messageClass(message) {
+    if (message.senderType === "visitor") return "pingy-chat-message-visitor";
+    if (message.senderType === "system") return "pingy-chat-message-system";
+    return "pingy-chat-message-agent";
+  }
+
+  // Quick replies, cards and forms carry their own text; anything the widget
+  // does not know falls back to the plain body.
+  function renderMessageContent(state, bubble, message) {
+    const content = !message.deletedAt && message.content;
+    switch (content && message.type) {
+      case "quick_replies":
+        renderQuickReplies(state, bubble, content);
+        break;
+      case "card":
+        renderCard(bubble, content);
+        break;
+      case "form":
+        renderForm(state, bubble, message);
+        break;
+      default:
+        bubble.textContent = messageText(message);
+    }
+    if (message.deletedAt || !Array.isArray(message.attachments)) return;
+
+    for (const attachment of message.attachments) {
+      if (!attachment || !/^https?:\/\//.test(attachment.url || "")) continue;
+      const link = document.createElement("a");
+      link.className = "pingy-chat-attachment";
+      link.href = attachment.url;
+      link.target = "_blank";
+      link.rel = "noopener noreferrer";
+      if (/^image\//.test(attachment.contentType || "")) {
+        const image = document.createElement("img");
+        image.src = attachment.url;
+        image.alt = attachment.fileName || "Attachment";
+        link.appendChild(image);
+      } else {
+        link.textContent = attachment.fileName || "Attachment";
+      }
+      bubble.appendChild(link);
+    }
+  }
+
+  function renderQuickReplies(state, bubble, content) {
+    bubble.textContent = content.text || "";
+    const replies = document.createElement("div");
+    replies.className = "pingy-chat-quick-replies";
+    const buttons = [];
+    for (const reply of content.quickReplies || []) {
+      const button = document.createElement("button");
+      button.type = "button";
+      button.textContent = reply.label;
+      button.addEventListener("click", () => sendQuickReply(state, reply, buttons));
+      buttons.push(button);
+      replies.appendChild(button);
+    }
+    bubble.appendChild(replies);
+  }
+
+  function renderCard(bubble, content) {
+    const card = content.card || {};
+    bubble.textContent = content.text || "";
+    if (!/^https?:\/\//.test(card.url || "")) return;
+
+    const link = document.createElement("a");
+    link.className = "pingy-chat-card";
+    link.href = card.url;
+    link.target = "_blank";
+    link.rel = "noopener noreferrer";
+    if (/^https?:\/\//.test(card.imageUrl || "")) {
+      const image = document.createElement("img");
+      image.src = card.imageUrl;
+      image.alt = "";
+      link.appendChild(image);
+    }
+    const title = document.createElement("strong");
+    title.textContent = card.title;
+    link.appendChild(title);
+    if (card.description) {
+      const description = document.createElement("span");
+      description.textContent = card.description;
+      link.appendChild(description);
+    }
+    bubble.appendChild(link);
+  }
+
+  function renderForm(state, bubble, message) {
+    const spec = message.content.form || {};
+    bubble.textContent = message.content.text || "";
+
+    const form = document.createElement("form");
+    form.className = "pingy-chat-form";
+    for (const field of spec.fields || []) {
+      const label = document.createElement("label");
+      label.textContent = field.label || field.name;
+      let input;
+      if (field.type === "textarea") {
+        input = document.createElement("textarea");
+        input.rows = 2;
+      } else if (field.type === "select") {
+        input = document.createElement("select");
+        input.appendChild(document.createElement("option"));
+        for (const value of field.options || []) {
+          const option = document.createElement("option");
+          option.value = value;
+          option.textContent = value;
+          input.appendChild(option);
+        }
+      } else {
+        input = document.createElement("input");
+        input.type = field.type || "text";
+      }
+      input.name = field.name;
+      input.required = Boolean(field.required);
+      label.appendChild(input);
+      form.appendChild(label);
+    }
+    const submit = document.createElement("button");
+    submit.type = "submit";
+    submit.textContent = spec.submitLabel || "Send";
+    form.appendChild(submit);
+    form.addEventListener("submit", (event) => {
+      event.preventDefault();
+      submitForm(state, message, form);
+    });
+    bubble.appendChild(form);
+  }
+
   function scrollMessages(container) {
     if (!container) return;
     container.scrollTop = container.scrollHeight;
@@ -127,7 +127,11 @@ conversations_table=$(cat <<'JSON'
     {"AttributeName": "pk", "AttributeType": "S"},
     {"AttributeName": "tenantId", "AttributeType": "S"},
     {"AttributeName": "tenantVisitor", "AttributeType": "S"},
-    {"AttributeName": "lastMessageAt", "AttributeType": "S"}
+    {"AttributeName": "tenantVisitorEmail", "AttributeType": "S"},
+    {"AttributeName": "tenantStatus", "AttributeType": "S"},
+    {"AttributeName": "tenantAssignee", "AttributeType": "S"},
+    {"AttributeName": "lastMessageAt", "AttributeType": "S"},
+    {"AttributeName": "createdAt", "AttributeType": "S"}
   ],
   "KeySchema": [
     {"AttributeName": "pk", "KeyType": "HASH"}
@@ -142,6 +146,30 @@ conversations_table=$(cat <<'JSON'
       ],
       "Projection": {"ProjectionType": "ALL"}
     },
+    {
+      "IndexName": "byTenantCreated",
+      "KeySchema": [
+        {"AttributeName": "tenantId", "KeyType": "HASH"},
+        {"AttributeName": "createdAt", "KeyType": "RANGE"}
+      ],
+      "Projection": {"ProjectionType": "ALL"}
+    },
+    {
+      "IndexName": "byTenantStatus",
+      "KeySchema": [
+        {"AttributeName": "tenantStatus", "KeyType": "HASH"},
+        {"AttributeName": "lastMessageAt", "KeyType": "RANGE"}
+      ],
+      "Projection": {"ProjectionType": "ALL"}
+    },
+    {
+      "IndexName": "byTenantAssignee",
+      "KeySchema": [
+        {"AttributeName": "tenantAssignee", "KeyType": "HASH"},
+        {"AttributeName": "lastMessageAt", "KeyType": "RANGE"}
+      ],
+      "Projection": {"ProjectionType": "ALL"}
+    },
     {
       "IndexName": "byVisitor",
       "KeySchema": [
@@ -149,6 +177,14 @@ conversations_table=$(cat <<'JSON'
         {"AttributeName": "lastMessageAt", "KeyType": "RANGE"}
       ],
       "Projection": {"ProjectionType": "ALL"}
+    },
+    {
+      "IndexName": "byVisitorEmail",
+      "KeySchema": [
+        {"AttributeName": "tenantVisitorEmail", "KeyType": "HASH"},
+        {"AttributeName": "lastMessageAt", "KeyType": "RANGE"}
+      ],
+      "Projection": {"ProjectionType": "ALL"}
     }
   ]
 }
@@ -223,6 +259,22 @@ tenant_api_keys_table=$(cat <<'JSON'
 JSON
 )
 
+canned_responses_table=$(cat <<'JSON'
+{
+  "TableName": "CannedResponses",
+  "AttributeDefinitions": [
+    { "AttributeName": "tenantId", "AttributeType": "S" },
+    { "AttributeName": "responseId", "AttributeType": "S" }
+  ],
+  "KeySchema": [
+    { "AttributeName": "tenantId", "KeyType": "HASH" },
+    { "AttributeName": "responseId", "KeyType": "RANGE" }
+  ],
+  "BillingMode": "PAY_PER_REQUEST"
+}
+JSON
+)
+
 create_table "Tenants" "$tenants_table"
 create_table "Users" "$users_table"
 create_table "TenantInvites" "$tenant_invites_table"
@@ -230,6 +282,7 @@ create_table "Conversations" "$conversations_table"
 create_table "Messages" "$messages_table"
 create_table "Visitors" "$visitors_table"
 create_table "TenantAPIKeys" "$tenant_api_keys_table"
+create_table "CannedResponses" "$canned_responses_table"
 
 ensure_ttl "Messages" "expireAt"
 